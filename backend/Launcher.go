@@ -2,14 +2,16 @@ package main
 
 import (
 	"SimpleDB/backend/dm"
+	"SimpleDB/backend/fsck"
+	"SimpleDB/backend/restore"
 	"SimpleDB/backend/server"
-	"SimpleDB/backend/tbm"
-	"SimpleDB/backend/tm"
 	"SimpleDB/backend/vm"
 	"flag"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -25,46 +27,127 @@ func main() {
 	openFlag := flag.String("open", "", "Open database at DBPath")
 	createFlag := flag.String("create", "", "Create database at DBPath")
 	memFlag := flag.String("mem", "64MB", "Memory size (e.g., 64MB, 1GB)")
+	segmentFlag := flag.String("logsegment", "16MB", "Log segment size (e.g., 16MB)")
+	archiveFlag := flag.String("archive", "", "Directory to archive closed log segments")
+	restoreFlag := flag.String("restore", "", "Restore database to DBPath from a base backup and archived logs")
+	baseFlag := flag.String("base", "", "Base backup path used by -restore")
+	untilXidFlag := flag.Int64("until-xid", 0, "Restore up to (excluding) this transaction id")
+	verifyFlag := flag.String("verify", "", "Verify the backup at BackupPath by opening a copy of it")
+	untilTimeFlag := flag.String("until-time", "", "Restore up to this time (e.g., \"2006-01-02 15:04:05\")")
+	checkFlag := flag.String("check", "", "Check the integrity of the database at DBPath without modifying it")
+	lockTimeoutFlag := flag.Duration("lock-timeout", 0, "Maximum time a statement waits for a row lock, 0 means wait forever (e.g., 5s)")
+	victimFlag := flag.String("deadlock-victim", "requester", "Transaction aborted on deadlock: requester, youngest or fewest")
+	retentionFlag := flag.Duration("retention", 0, "How far back AS OF queries may look, 0 means no limit (e.g., 24h)")
+	readOnlyFlag := flag.Bool("readonly", false, "Open the database read-only, files are never modified and all transactions are read-only")
+	fileDirFlag := flag.String("file-dir", "", "Directory that COPY and BACKUP TO read and write files in, both are disabled when empty")
+	memoryFlag := flag.Bool("memory", false, "Start a throwaway in-memory database, nothing is written to disk and all data is lost on exit")
 
 	// 解析命令行参数
 	flag.Parse()
 
 	// 判断命令行参数，并调用相应的函数
-	if *openFlag != "" {
-		memSize := parseMem(*memFlag)
-		openDB(*openFlag, memSize)
+	if *memoryFlag || *openFlag != "" {
+		policy, err := vm.ParseDeadlockPolicy(*victimFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		opts := &server.Options{
+			Memory:         parseMem(*memFlag),
+			ReadOnly:       *readOnlyFlag,
+			SegmentSize:    parseMem(*segmentFlag),
+			ArchiveDir:     *archiveFlag,
+			LockTimeout:    *lockTimeoutFlag,
+			DeadlockPolicy: policy,
+			Retention:      *retentionFlag,
+			FileDir:        *fileDirFlag,
+		}
+		if *memoryFlag {
+			startDB(server.CreateMemoryDatabase(opts))
+		} else {
+			startDB(server.OpenDatabase(*openFlag, opts))
+		}
 		return
 	}
 	if *createFlag != "" {
 		createDB(*createFlag)
 		return
 	}
-	fmt.Println("Usage: launcher -open DBPath | -create DBPath [-mem MemorySize]")
+	if *verifyFlag != "" {
+		verifyBackup(*verifyFlag)
+		return
+	}
+	if *checkFlag != "" {
+		checkDB(*checkFlag)
+		return
+	}
+	if *restoreFlag != "" {
+		restoreDB(*restoreFlag, *baseFlag, *archiveFlag, *untilXidFlag, *untilTimeFlag)
+		return
+	}
+	fmt.Println("Usage: launcher -open DBPath | -create DBPath [-mem MemorySize] [-logsegment SegmentSize] [-archive ArchiveDir] [-lock-timeout Duration] [-deadlock-victim Policy] [-retention Duration] [-file-dir Dir]")
+	fmt.Println("       launcher -open DBPath -readonly [-mem MemorySize] [-file-dir Dir]")
+	fmt.Println("       launcher -memory [-mem MemorySize] [-logsegment SegmentSize] [-lock-timeout Duration] [-deadlock-victim Policy] [-retention Duration] [-file-dir Dir]")
+	fmt.Println("       launcher -restore DBPath -base BasePath [-archive ArchiveDir] -until-xid XID | -until-time Time")
+	fmt.Println("       launcher -verify BackupPath")
+	fmt.Println("       launcher -check DBPath")
+}
+
+// checkDB 离线检查数据库文件，以JSON格式输出检查报告，检查出错误时以状态码1退出
+func checkDB(path string) {
+	report := fsck.Check(path)
+	fmt.Println(string(report.JSON()))
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+// verifyBackup 校验备份能否正常打开
+func verifyBackup(path string) {
+	report, err := restore.Verify(path)
+	if err != nil {
+		fmt.Println("Verify failed: " + err.Error())
+		os.Exit(1)
+	}
+	fmt.Print(report)
+	fmt.Println("Verify done: " + path)
+}
+
+// restoreDB 从基础备份和归档日志恢复数据库到指定的事务或时间点
+func restoreDB(path string, basePath string, archiveDir string, untilXid int64, untilTime string) {
+	target := &dm.RecoveryTarget{Xid: untilXid}
+	if untilTime != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", untilTime, time.Local)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid time: %v", err))
+		}
+		target.Time = t
+	}
+	if basePath == "" || (target.Xid > 0) == !target.Time.IsZero() {
+		fmt.Println("Usage: launcher -restore DBPath -base BasePath [-archive ArchiveDir] -until-xid XID | -until-time Time")
+		return
+	}
+	if err := restore.Restore(path, basePath, archiveDir, target); err != nil {
+		panic(err)
+	}
+	fmt.Println("Restore done: " + path)
 }
 
 // createDB 创建新的数据库
 func createDB(path string) {
-	tm, err := tm.CreateTransactionManagerImpl(path)
+	db, err := server.CreateDatabase(path, nil)
 	if err != nil {
 		panic(err)
 	}
-	dm := dm.CreateDataManager(path, DEFAULT_MEM)
-	vm := vm.NewVersionManager(tm, dm)
-	tbm.CreateTableManger(path, vm, dm)
-	tm.Close()
-	dm.Close()
+	db.Close()
 }
 
-// openDB 启动已有的数据库
-func openDB(path string, memSize int64) {
-	tm, err := tm.OpenTransactionManagerImpl(path)
+// startDB 在打开的数据库上启动服务端，-readonly 打开时文件不会被修改，-memory 启动的数据库在进程退出后全部丢失
+func startDB(db *server.Database, err error) {
 	if err != nil {
 		panic(err)
 	}
-	dm := dm.OpenDataManager(path, memSize, tm)
-	vm := vm.NewVersionManager(tm, dm)
-	tbm := tbm.OpenTableManager(path, vm, dm)
-	server := server.NewServer(port, tbm)
+	server := server.NewServer(port, db.TBM)
 	server.Start()
 }
 
@@ -2,7 +2,6 @@ package common
 
 import (
 	"SimpleDB/commons"
-	"errors"
 	"time"
 )
 
@@ -65,7 +64,7 @@ func (cache *AbstractCache[T]) Get(key int64) (T, error) {
 		if cache.maxResource > 0 && cache.count >= cache.maxResource {
 			// 缓存已满，需要删除一个资源
 			cache.lock.Unlock()
-			return obj, errors.New(commons.ErrorMessage.CacheIsFullError)
+			return obj, commons.NewError(commons.ErrorMessage.CacheIsFullError)
 		}
 
 		cache.count++
@@ -128,6 +127,15 @@ func (cache *AbstractCache[T]) Release(key int64) {
 	}
 }
 
+// Range 对缓存中的每个资源调用fn，调用期间持有缓存的锁，资源不会被释放或者重新获取
+func (cache *AbstractCache[T]) Range(fn func(obj T)) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	for _, obj := range cache.cache {
+		fn(obj)
+	}
+}
+
 // Close 关闭缓存
 func (cache *AbstractCache[T]) Close() {
 	cache.lock.Lock()
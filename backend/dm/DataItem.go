@@ -75,7 +75,7 @@ func (dataItem *DataItem) Before() {
 
 // UnBefore 撤销修改数据项之前的操作
 func (dataItem *DataItem) UnBefore() {
-	dataItem.raw = make([]byte, len(dataItem.oldRaw))
+	// raw 指向页面中的数据，需要原地恢复
 	copy(dataItem.raw, dataItem.oldRaw)
 	dataItem.lock.Unlock()
 }
@@ -0,0 +1,43 @@
+package dm
+
+import (
+	"SimpleDB/backend/tm"
+	"path/filepath"
+	"testing"
+)
+
+// TestUnBeforeKeepsPageData 放弃修改之后数据项仍然指向页面中的数据，之后的修改能够写入页面
+func TestUnBeforeKeepsPageData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := CreateDataManager(path, 64<<20)
+	uid, err := dataManager.Insert(tm.SuperXid, []byte("aaaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := dataManager.Read(uid)
+	item.Before()
+	item.Data()[0] = 'b'
+	item.UnBefore()
+	if string(item.Data()) != "aaaa" {
+		t.Fatalf("UnBefore should restore the data, got %q", item.Data())
+	}
+	item.Before()
+	item.Data()[1] = 'c'
+	item.After(tm.SuperXid)
+	item.Release()
+	dataManager.Close()
+	transactionManager.Close()
+
+	transactionManager, _ = tm.OpenTransactionManagerImpl(path)
+	dataManager = OpenDataManager(path, 64<<20, transactionManager)
+	defer func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}()
+	item = dataManager.Read(uid)
+	defer item.Release()
+	if string(item.Data()) != "acaa" {
+		t.Fatalf("modification after UnBefore was not written to the page, got %q", item.Data())
+	}
+}
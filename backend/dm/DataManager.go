@@ -9,6 +9,8 @@ import (
 	"SimpleDB/backend/utils"
 	"SimpleDB/commons"
 	"errors"
+	"sync"
+	"time"
 )
 
 type DataManager struct {
@@ -24,6 +26,15 @@ type DataManager struct {
 	PageOne *dmPage.Page
 	// CacheManager 抽象缓存
 	CacheManager *common.AbstractCache[*DataItem]
+
+	// checkpointLock 写入日志并修改页面期间持有读锁，建立检查点时持有写锁确定开始重放的段
+	checkpointLock sync.RWMutex
+	// segmentsLock 保护firstSegments
+	segmentsLock sync.Mutex
+	// firstSegments 每个事务写入的第一条日志所在的段
+	firstSegments map[int64]int
+	// checkpointSegment 上一次检查点时的活动段
+	checkpointSegment int
 }
 
 func NewDataManager(pc *dmPage.PageCache, dbLogger *logger.DBLogger) *DataManager {
@@ -33,8 +44,14 @@ func NewDataManager(pc *dmPage.PageCache, dbLogger *logger.DBLogger) *DataManage
 		PC:       pc,
 		DBLogger: dbLogger,
 		PIndex:   dmPageIndex.NewPageIndex(),
+
+		firstSegments:     make(map[int64]int),
+		checkpointSegment: dbLogger.Segment(),
 	}
 
+	// 页面写回磁盘之前先将推迟的日志落盘
+	pc.SetBeforeFlush(dbLogger.Sync)
+
 	// 实现类似抽象类的实现作用
 	cacheManager := common.NewAbstractCache[*DataItem](0, dataManager)
 
@@ -61,7 +78,7 @@ func (dataManager *DataManager) Insert(xid int64, data []byte) (int64, error) {
 	raw := WrapDataItemRaw(data)
 	// 数据都大于了页面的理论最大空间，报错；这里注意数据大小不能大于一个页面大小，即8K减去前面元信息
 	if len(raw) > dmPage.PageXMaxFreeSpace {
-		return 0, errors.New(commons.ErrorMessage.DataTooLargeError)
+		return 0, commons.NewError(commons.ErrorMessage.DataTooLargeError)
 	}
 
 	// 从页面的索引信息中获取一个仍有足够空闲的页面
@@ -81,7 +98,7 @@ func (dataManager *DataManager) Insert(xid int64, data []byte) (int64, error) {
 	}
 	// 如果还是没有找到合适的页面，抛出异常
 	if pageInfo == nil {
-		return 0, errors.New(commons.ErrorMessage.DatabaseBusyError)
+		return 0, commons.NewError(commons.ErrorMessage.DatabaseBusyError)
 	}
 
 	// 取出索引的页面信息后获取仍有空闲的页面
@@ -106,11 +123,13 @@ func (dataManager *DataManager) Insert(xid int64, data []byte) (int64, error) {
 	}
 	// 生成插入日志
 	insertLog := InsertLog(xid, page, raw)
+	// 插入日志先于页面的修改写入，检查点需要等待页面修改完成
+	dataManager.checkpointLock.RLock()
 	// 将日志写入日志文件
-
-	dataManager.DBLogger.Log(insertLog)
+	dataManager.logFor(xid, insertLog)
 	// 在页面中插入新的数据项，并获取其在页面中的偏移量
 	offset := dmPage.InsertData2PageX(page, raw)
+	dataManager.checkpointLock.RUnlock()
 	// 释放页面
 	page.Release()
 	// 返回新插入的数据项的唯一标识符，即uid
@@ -130,7 +149,64 @@ func (dataManager *DataManager) Close() {
 // LogDataItem 为xid生成update日志
 func (dataManager *DataManager) LogDataItem(xid int64, dataItem *DataItem) {
 	log := UpdateLog(xid, dataItem)
+	dataManager.checkpointLock.RLock()
+	defer dataManager.checkpointLock.RUnlock()
+	dataManager.logFor(xid, log)
+}
+
+// logFor 写入xid的日志，并记录事务写入的第一条日志所在的段
+// 段编号在写入之前读取，日志可能写入切换之后的段，记录的段只会更早
+func (dataManager *DataManager) logFor(xid int64, log []byte) {
+	dataManager.segmentsLock.Lock()
+	if _, ok := dataManager.firstSegments[xid]; !ok {
+		dataManager.firstSegments[xid] = dataManager.DBLogger.Segment()
+	}
+	dataManager.segmentsLock.Unlock()
+	dataManager.DBLogger.Log(log)
+}
+
+// Checkpoint 日志切换到新的段之后建立检查点，并删除检查点之前已经归档的段，避免恢复时重放所有的日志
+// 检查点从当前的活动段以及仍然活跃或者预备的事务写入的第一个段中最早的一个开始，
+// 之前的日志中已经结束的事务的修改全部写回磁盘，提交时间也已经落盘，不再需要重放
+func (dataManager *DataManager) Checkpoint(tm *tm.TransactionManagerImpl) error {
+	dataManager.checkpointLock.Lock()
+	segment := dataManager.DBLogger.Segment()
+	if segment == dataManager.checkpointSegment {
+		dataManager.checkpointLock.Unlock()
+		return nil
+	}
+	start := segment
+	dataManager.segmentsLock.Lock()
+	for xid, first := range dataManager.firstSegments {
+		if !tm.IsActive(xid) && !tm.IsPrepared(xid) {
+			delete(dataManager.firstSegments, xid)
+		} else if first < start {
+			start = first
+		}
+	}
+	dataManager.segmentsLock.Unlock()
+	dataManager.checkpointSegment = segment
+	dataManager.checkpointLock.Unlock()
+
+	// 页面写回之前会先将日志落盘
+	dataManager.PC.FlushDirty()
+	tm.SyncCommitTimes()
+	return dataManager.DBLogger.Checkpoint(start, dataManager.PC.GetPageNumber())
+}
+
+// LogCommit 为xid生成提交日志，必须在xid文件中标记提交之前写入，返回日志中记录的提交时间
+func (dataManager *DataManager) LogCommit(xid int64) int64 {
+	timestamp := time.Now().UnixNano()
+	log := CommitLog(xid, timestamp)
 	dataManager.DBLogger.Log(log)
+	// 即使其他事务推迟了日志的落盘，提交时也要保证该事务的所有日志都已经落盘
+	dataManager.DBLogger.Sync()
+	return timestamp
+}
+
+// SyncLog 将所有日志落盘，用于预备事务之前保证事务的修改在重启后能够重做
+func (dataManager *DataManager) SyncLog() {
+	dataManager.DBLogger.Sync()
 }
 
 func (dataManager *DataManager) ReleaseDataItem(dataItem *DataItem) {
@@ -219,6 +295,13 @@ func CreateDataManager(path string, memory int64) *DataManager {
 	return dataManager
 }
 
+// CreateMemoryDataManager 创建内存数据库的数据管理器，页面和日志都只保存在内存中
+func CreateMemoryDataManager(memory int64) *DataManager {
+	dataManager := NewDataManager(dmPage.CreateMemoryPageCache(memory), logger.CreateMemoryLogger())
+	dataManager.InitPageOne()
+	return dataManager
+}
+
 //func CreateDataManagerByMockTM(path string, memory int64, tm *tm.MockTransactionManager) *DataManager {
 //	PC := dmPage.CreatePageCache(path, memory)
 //	DBLogger := logger.CreateLogger(path)
@@ -250,3 +333,30 @@ func OpenDataManager(path string, memory int64, tm *tm.TransactionManagerImpl) *
 	// 返回创建的DataManager实例
 	return dataManager
 }
+
+// RestoreDataManager 打开基础备份和归档日志组成的数据库，并将其恢复到target指定的时间点
+func RestoreDataManager(path string, memory int64, tm *tm.TransactionManagerImpl, target *RecoveryTarget) *DataManager {
+	PC := dmPage.OpenPageCache(path, memory)
+	DBLogger := logger.OpenLogger(path)
+	dataManager := NewDataManager(PC, DBLogger)
+	// 基础备份是在数据库运行时复制的，无论PageOne是否有效都需要恢复
+	dataManager.LoadCheckPageOne()
+	RecoverToTarget(tm, DBLogger, PC, target)
+	dataManager.FillPageIndex()
+	dmPage.PageOneSetValidStatusOpen(dataManager.PageOne)
+	dataManager.PC.FlushPage(dataManager.PageOne)
+	return dataManager
+}
+
+// OpenReadOnlyDataManager 以只读方式打开数据管理器，不会修改任何文件
+// 数据库没有正常关闭时仍然进行恢复，恢复修改的页面和事务状态只保存在内存中
+func OpenReadOnlyDataManager(path string, memory int64, tm *tm.TransactionManagerImpl) *DataManager {
+	PC := dmPage.OpenReadOnlyPageCache(path, memory)
+	DBLogger := logger.OpenReadOnlyLogger(path)
+	dataManager := NewDataManager(PC, DBLogger)
+	if !dataManager.LoadCheckPageOne() {
+		Recover(tm, DBLogger, PC)
+	}
+	dataManager.FillPageIndex()
+	return dataManager
+}
@@ -6,6 +6,8 @@ import (
 	"SimpleDB/backend/tm"
 	"SimpleDB/commons"
 	"encoding/binary"
+	"fmt"
+	"time"
 )
 
 var (
@@ -13,6 +15,8 @@ var (
 	LogTypeInsert byte = 0
 	// LogTypeUpdate 更新日志类型
 	LogTypeUpdate byte = 1
+	// LogTypeCommit 提交日志类型
+	LogTypeCommit byte = 2
 
 	// TypeRedo redo log
 	TypeRedo byte = 0
@@ -35,6 +39,11 @@ var (
 	UpdateLogOffsetUID = LogOffsetXID + 8
 	// UpdateLogOffsetOldRaw 更新日志中旧数据项的偏移位置
 	UpdateLogOffsetOldRaw = UpdateLogOffsetUID + 8
+
+	// CommitLogOffsetTimestamp 提交日志中提交时间的偏移位置
+	CommitLogOffsetTimestamp = LogOffsetXID + 8
+	// CommitLogLength 提交日志的长度
+	CommitLogLength = CommitLogOffsetTimestamp + 8
 )
 
 // InsertLogInfo 格式 [LogType] [XID] [Pgno] [Offset] [Raw]
@@ -50,6 +59,11 @@ func IsInsertLog(log []byte) bool {
 	return log[0] == LogTypeInsert
 }
 
+// IsCommitLog 判断是否是提交日志
+func IsCommitLog(log []byte) bool {
+	return log[0] == LogTypeCommit
+}
+
 // InsertLog 生成插入日志
 func InsertLog(xid int64, pg *dmPage.Page, raw []byte) []byte {
 	var logType []byte = []byte{LogTypeInsert}
@@ -179,7 +193,59 @@ func doUpdateLog(pc *dmPage.PageCache, log []byte, logType byte) {
 	page.Release()
 }
 
+// CommitLogInfo 格式 [LogType] [XID] [Timestamp]
+type CommitLogInfo struct {
+	xid int64
+	// timestamp 提交时间，Unix纳秒
+	timestamp int64
+}
+
+// CommitLog 生成提交日志
+func CommitLog(xid int64, timestamp int64) []byte {
+	log := make([]byte, CommitLogLength)
+	log[LogOffsetType] = LogTypeCommit
+	binary.BigEndian.PutUint64(log[LogOffsetXID:CommitLogOffsetTimestamp], uint64(xid))
+	binary.BigEndian.PutUint64(log[CommitLogOffsetTimestamp:CommitLogLength], uint64(timestamp))
+	return log
+}
+
+// parseCommitLog 解析提交日志
+func parseCommitLog(log []byte) *CommitLogInfo {
+	return &CommitLogInfo{
+		xid:       int64(binary.BigEndian.Uint64(log[LogOffsetXID:CommitLogOffsetTimestamp])),
+		timestamp: int64(binary.BigEndian.Uint64(log[CommitLogOffsetTimestamp:CommitLogLength])),
+	}
+}
+
+// logXid 获取日志记录所属的事务ID
+func logXid(log []byte) int64 {
+	return int64(binary.BigEndian.Uint64(log[LogOffsetXID : LogOffsetXID+8]))
+}
+
+// scanCommits 遍历日志，返回所有写入了提交日志的事务及其提交时间，以及日志中出现过的最大事务ID
+func scanCommits(lg *logger.DBLogger) (map[int64]int64, int64) {
+	lg.Rewind()
+	commits := make(map[int64]int64)
+	var maxXid int64 = 0
+	for {
+		log := lg.Next()
+		if log == nil {
+			break
+		}
+		xid := logXid(log)
+		if xid > maxXid {
+			maxXid = xid
+		}
+		if IsCommitLog(log) {
+			commitLogInfo := parseCommitLog(log)
+			commits[commitLogInfo.xid] = commitLogInfo.timestamp
+		}
+	}
+	return commits, maxXid
+}
+
 // redoTransactions 遍历事务，根据事务的状态决定是否要进行redo操作(包括了插入的redo和更新的redo)
+// 预备状态的事务等待协调者的决定，它的修改需要和已经结束的事务一样重做
 func redoTransactions(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dmPage.PageCache) {
 	// 重置日志文件的读取位置到开始
 	lg.Rewind()
@@ -192,7 +258,10 @@ func redoTransactions(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dm
 			break
 		}
 		// 判断日志记录的类型
-		if IsInsertLog(log) {
+		if IsCommitLog(log) {
+			// 提交日志不涉及页面的修改
+			continue
+		} else if IsInsertLog(log) {
 			// 如果是插入日志，解析日志记录，获取插入日志信息
 			insertInfoLog := parseInsertLog(log)
 			// 获取事务ID
@@ -214,6 +283,7 @@ func redoTransactions(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dm
 	}
 }
 
+// undoTransactions 撤销所有仍处于活动状态的事务，预备状态的事务不是活动状态，不会被撤销
 func undoTransactions(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dmPage.PageCache) {
 	// 将日志文件的读取位置重置到开始
 	lg.Rewind()
@@ -228,7 +298,9 @@ func undoTransactions(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dm
 			break
 		}
 		// 判断日志记录的类型
-		if IsInsertLog(log) {
+		if IsCommitLog(log) {
+			continue
+		} else if IsInsertLog(log) {
 			// 如果是插入日志，解析日志记录，获取插入日志信息
 			insertInfoLog := parseInsertLog(log)
 			// 获取事务ID
@@ -281,7 +353,9 @@ func Recover(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dmPage.Page
 			break
 		}
 		var pageNumber int
-		if IsInsertLog(log) {
+		if IsCommitLog(log) {
+			continue
+		} else if IsInsertLog(log) {
 			insertInfoLog := parseInsertLog(log)
 			pageNumber = insertInfoLog.pageNumber
 		} else {
@@ -297,11 +371,28 @@ func Recover(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dmPage.Page
 		// 这里是因为没有日志，所以没有任何数据需要恢复，但是存在一个用于校验的PageOne
 		maxPageNumber = 1
 	}
+	// 检查点之前的日志不再重放，检查点时已经写回磁盘的页面不能被截断
+	if pages := lg.CheckpointPages(); pages > maxPageNumber {
+		maxPageNumber = pages
+	}
 
 	// 截断后面的无效日志
 	pc.TruncateByPgNo(maxPageNumber)
 	commons.Logger.Infof("Truncate to page %d", maxPageNumber)
 
+	// 在线备份时xid文件先于日志复制，日志中可能出现xid文件中还没有的事务
+	commits, maxXid := scanCommits(lg)
+	tm.AdvanceXidCounter(maxXid)
+	// 提交日志先于xid文件写入，已经写入提交日志的事务即使在xid文件中仍为活跃或者预备状态，也视为已经提交
+	// 提交时间文件提交时不落盘，已经提交的事务丢失的提交记录根据提交日志补齐
+	for xid, timestamp := range commits {
+		if tm.IsActive(xid) || tm.IsPrepared(xid) {
+			tm.CommitAt(xid, timestamp)
+		} else if tm.IsCommitted(xid) {
+			tm.RestoreCommitTime(xid, timestamp)
+		}
+	}
+
 	redoTransactions(tm, lg, pc)
 	commons.Logger.Infof("Redo done.......")
 
@@ -311,3 +402,103 @@ func Recover(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dmPage.Page
 	commons.Logger.Infof("Recover done.......")
 
 }
+
+// RecoveryTarget 时间点恢复的目标，Xid和Time二者只需设置其一
+type RecoveryTarget struct {
+	// Xid 恢复到该事务开始之前的状态，大于等于Xid的事务全部视为终止
+	Xid int64
+	// Time 恢复到该时间点的状态，在该时间之后提交的事务全部视为终止
+	Time time.Time
+}
+
+// isCommittedBefore 判断一个写入了提交日志的事务是否在恢复目标之前提交
+func (target *RecoveryTarget) isCommittedBefore(xid int64, timestamp int64) bool {
+	if target.Xid > 0 {
+		return xid < target.Xid
+	}
+	return timestamp <= target.Time.UnixNano()
+}
+
+// RecoverToTarget 将基础备份和归档日志恢复到指定的目标：
+// 先根据提交日志确定每个事务在目标时刻的状态，目标之后的事务全部标记为终止，
+// 再通过Recover重做所有的日志，被标记为终止的事务的数据对任何事务都不可见
+func RecoverToTarget(tm *tm.TransactionManagerImpl, lg *logger.DBLogger, pc *dmPage.PageCache, target *RecoveryTarget) {
+	commons.Logger.Infof("Recover to target start.......")
+
+	commits, maxXid := scanCommits(lg)
+	// 基础备份中的xid文件可能落后于日志，需要补齐日志中出现的事务
+	tm.AdvanceXidCounter(maxXid)
+
+	for xid := int64(1); xid <= tm.XidCounter(); xid++ {
+		if timestamp, ok := commits[xid]; ok {
+			if target.isCommittedBefore(xid, timestamp) {
+				tm.CommitAt(xid, timestamp)
+			} else {
+				tm.Abort(xid)
+			}
+			continue
+		}
+		// 没有提交日志的事务，只有在基础备份中已经提交且早于目标的才保留
+		if tm.IsCommitted(xid) && (target.Xid == 0 || xid < target.Xid) {
+			continue
+		}
+		tm.Abort(xid)
+	}
+	commons.Logger.Infof("Transactions after target aborted, xid counter %d", tm.XidCounter())
+
+	Recover(tm, lg, pc)
+}
+
+// LogRecord 解析后的一条日志，用于离线检查和查看日志，恢复流程不使用它
+type LogRecord struct {
+	Type byte
+	Xid  int64
+	// PageNumber 和 Offset 为插入或者更新的数据项所在的位置
+	PageNumber int
+	Offset     int16
+	// Uid 更新日志中的数据项UID
+	Uid int64
+	// Raw 插入日志中的数据项
+	Raw []byte
+	// OldRaw 和 NewRaw 为更新日志中的新旧数据项
+	OldRaw []byte
+	NewRaw []byte
+	// Timestamp 提交日志中的提交时间，Unix纳秒
+	Timestamp int64
+}
+
+// ParseLogRecord 解析一条日志，并检查日志长度是否合法
+func ParseLogRecord(log []byte) (*LogRecord, error) {
+	if len(log) < LogOffsetXID+8 {
+		return nil, fmt.Errorf("log record too short: %d bytes", len(log))
+	}
+	record := &LogRecord{Type: log[LogOffsetType], Xid: logXid(log)}
+	switch record.Type {
+	case LogTypeInsert:
+		if len(log) < InsertLogOffsetRaw {
+			return nil, fmt.Errorf("insert log too short: %d bytes", len(log))
+		}
+		insertLogInfo := parseInsertLog(log)
+		record.PageNumber = insertLogInfo.pageNumber
+		record.Offset = insertLogInfo.offset
+		record.Raw = insertLogInfo.raw
+	case LogTypeUpdate:
+		if len(log) < UpdateLogOffsetOldRaw || (len(log)-UpdateLogOffsetOldRaw)%2 != 0 {
+			return nil, fmt.Errorf("invalid update log length: %d bytes", len(log))
+		}
+		updateLogInfo := parseUpdateLog(log)
+		record.PageNumber = updateLogInfo.pageNumber
+		record.Offset = updateLogInfo.offset
+		record.Uid = int64(binary.BigEndian.Uint64(log[UpdateLogOffsetUID:UpdateLogOffsetOldRaw]))
+		record.OldRaw = updateLogInfo.oldRaw
+		record.NewRaw = updateLogInfo.newRaw
+	case LogTypeCommit:
+		if len(log) != CommitLogLength {
+			return nil, fmt.Errorf("invalid commit log length: %d bytes", len(log))
+		}
+		record.Timestamp = parseCommitLog(log).timestamp
+	default:
+		return nil, fmt.Errorf("unknown log type %d", record.Type)
+	}
+	return record, nil
+}
@@ -64,13 +64,18 @@ var (
 )
 
 type PageCache struct {
-	file *os.File
+	// file 数据文件，内存数据库中为 utils.MemoryFile
+	file utils.File
 	// 需要原子操作页数
 	pageNumbers int32
 	// 可重入锁
 	lock commons.ReentrantLock
 	// 抽象缓存类
 	CacheManager *common.AbstractCache[*Page]
+	// beforeFlush 页面写回磁盘之前调用，用于保证日志先于页面落盘
+	beforeFlush func()
+	// overlay 只读打开时被修改过的页面，页面不会写回文件，而是保存在这里
+	overlay map[int][]byte
 }
 
 // CreatePageCache 创建页面缓存
@@ -102,6 +107,17 @@ func CreatePageCache(path string, memory int64) *PageCache {
 	return &pageCache
 }
 
+// CreateMemoryPageCache 创建内存数据库的页面缓存，所有页面都保存在内存文件中
+func CreateMemoryPageCache(memory int64) *PageCache {
+	pageCache := PageCache{file: utils.NewMemoryFile(nil)}
+	maxResource := int(memory / int64(constants.PageSize))
+	if maxResource < MEM_MIN_LIM {
+		panic(commons.ErrorMessage.AllocMemoryTooSmallError)
+	}
+	pageCache.CacheManager = common.NewAbstractCache[*Page](maxResource, &pageCache)
+	return &pageCache
+}
+
 // OpenPageCache 打开页面缓存
 func OpenPageCache(path string, memory int64) *PageCache {
 	file, _ := os.OpenFile(path+DB_SUFFIX, os.O_RDWR, 0755)
@@ -124,3 +140,26 @@ func OpenPageCache(path string, memory int64) *PageCache {
 
 	return &pageCache
 }
+
+// OpenReadOnlyPageCache 以只读方式打开页面缓存，恢复等操作修改的页面只保存在内存中
+func OpenReadOnlyPageCache(path string, memory int64) *PageCache {
+	file, err := os.Open(path + DB_SUFFIX)
+	if err != nil {
+		panic(err)
+	}
+
+	fileLength, _ := utils.GetFileSizeByPath(path + DB_SUFFIX)
+	pageCache := PageCache{
+		file:        file,
+		pageNumbers: int32(int(fileLength / int64(constants.PageSize))),
+		overlay:     make(map[int][]byte),
+	}
+	maxResource := int(memory / int64(constants.PageSize))
+	pageCache.CacheManager = common.NewAbstractCache[*Page](maxResource, &pageCache)
+	return &pageCache
+}
+
+// IsReadOnly 判断页面缓存是否以只读方式打开
+func (pageCache *PageCache) IsReadOnly() bool {
+	return pageCache.overlay != nil
+}
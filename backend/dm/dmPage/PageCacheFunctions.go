@@ -2,6 +2,7 @@ package dmPage
 
 import (
 	"SimpleDB/backend/dm/constants"
+	"os"
 	"sync/atomic"
 )
 
@@ -15,6 +16,10 @@ func (pageCache *PageCache) GetForCache(key int64) (*Page, error) {
 	pageCache.lock.Lock()
 	defer pageCache.lock.Unlock()
 
+	if data, ok := pageCache.overlay[pageNo]; ok {
+		copy(buf, data)
+		return NewPage(pageNo, buf, pageCache), nil
+	}
 	_, err := pageCache.file.ReadAt(buf, offset)
 	if err != nil {
 		return nil, err
@@ -56,14 +61,37 @@ func (pageCache *PageCache) FlushPage(pg *Page) {
 	pageCache.flush(pg)
 }
 
+// FlushDirty 将缓存中所有的脏页写回磁盘，用于建立检查点
+// 页面仍然被引用，之后可能继续被修改，因此不清除脏标记，释放时会再次写回
+func (pageCache *PageCache) FlushDirty() {
+	pageCache.CacheManager.Range(func(pg *Page) {
+		if pg.IsDirty() {
+			pageCache.flush(pg)
+		}
+	})
+}
+
+// SetBeforeFlush 设置页面写回磁盘之前的回调
+func (pageCache *PageCache) SetBeforeFlush(fn func()) {
+	pageCache.beforeFlush = fn
+}
+
 // flush 真正刷新
 func (pageCache *PageCache) flush(pg *Page) {
+	if pageCache.beforeFlush != nil {
+		pageCache.beforeFlush()
+	}
 	pageNo := (*pg).GetPageNumber()
 	offset := pageCache.pageOffset(pageNo)
 
 	pageCache.lock.Lock()
 	defer pageCache.lock.Unlock()
 
+	// 只读打开时页面保存在内存中
+	if pageCache.IsReadOnly() {
+		pageCache.overlay[pageNo] = append([]byte(nil), (*pg).GetData()...)
+		return
+	}
 	// 写入数据
 	pageCache.file.WriteAt((*pg).GetData(), offset)
 	// 刷新磁盘
@@ -74,7 +102,15 @@ func (pageCache *PageCache) flush(pg *Page) {
 // TruncateByPgNo 截断文件，保留指定页数
 func (pageCache *PageCache) TruncateByPgNo(maxPageNumber int) {
 	size := pageCache.pageOffset(maxPageNumber + 1)
-	pageCache.file.Truncate(size)
+	if pageCache.IsReadOnly() {
+		for pageNo := range pageCache.overlay {
+			if pageNo > maxPageNumber {
+				delete(pageCache.overlay, pageNo)
+			}
+		}
+	} else {
+		pageCache.file.Truncate(size)
+	}
 	atomic.StoreInt32(&pageCache.pageNumbers, int32(maxPageNumber))
 }
 
@@ -94,3 +130,31 @@ func (pageCache *PageCache) GetPageNumber() int {
 func (pageCache *PageCache) pageOffset(pageNo int) int64 {
 	return int64((pageNo - 1) * constants.PageSize)
 }
+
+// Backup 将所有页面复制到path对应的数据文件中
+// 页面通过缓存读取并在页面锁内复制，缓存中尚未刷回的修改也会被包含在备份中
+func (pageCache *PageCache) Backup(path string) error {
+	file, err := os.OpenFile(path+DB_SUFFIX, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pageNumber := pageCache.GetPageNumber()
+	buf := make([]byte, constants.PageSize)
+	for pageNo := 1; pageNo <= pageNumber; pageNo++ {
+		page, err := pageCache.GetPage(pageNo)
+		if err != nil {
+			return err
+		}
+		page.Lock()
+		copy(buf, page.GetData())
+		page.Unlock()
+		page.Release()
+
+		if _, err = file.WriteAt(buf, pageCache.pageOffset(pageNo)); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
@@ -37,7 +37,7 @@ func PageOneSetValidOpenData(data []byte) {
 
 // PageOneSetValidStatusClose 设置校验状态为关闭，即关闭数据库时的状态
 func PageOneSetValidStatusClose(page *Page) {
-	page.SetDirty(false)
+	page.SetDirty(true)
 	PageOneSetValidCloseData(page.GetData())
 }
 
@@ -59,5 +59,5 @@ func CheckPageOneDataValid(data []byte) bool {
 			return false
 		}
 	}
-	return false
+	return true
 }
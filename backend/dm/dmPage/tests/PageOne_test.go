@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/constants"
+	"SimpleDB/backend/dm/dmPage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPageOneValidStatus 打开时两段校验字节不同，关闭时复制之后校验通过，并且第一页需要写回磁盘
+func TestPageOneValidStatus(t *testing.T) {
+	page := dmPage.NewPage(1, dmPage.PageOneInitRaw(), nil)
+	dmPage.PageOneSetValidStatusOpen(page)
+	if dmPage.CheckPageOneValid(page) {
+		t.Fatal("page one should be invalid while the database is open")
+	}
+	page.SetDirty(false)
+	dmPage.PageOneSetValidStatusClose(page)
+	if !page.IsDirty() {
+		t.Fatal("page one should be dirty after close")
+	}
+	if !dmPage.CheckPageOneValid(page) {
+		t.Fatal("page one should be valid after close")
+	}
+}
+
+// TestPageOneCleanShutdown 正常关闭后磁盘上的第一页校验通过，下次打开时不需要恢复
+func TestPageOneCleanShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	dataManager.Close()
+
+	data, err := os.ReadFile(path + dmPage.DB_SUFFIX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dmPage.CheckPageOneDataValid(data[:constants.PageSize]) {
+		t.Fatal("page one on disk should be valid after a clean shutdown")
+	}
+}
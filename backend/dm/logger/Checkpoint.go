@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"SimpleDB/backend/utils"
+	"SimpleDB/commons"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * 检查点文件的格式如下：
+ * [Segment][PageNumber]
+ * Segment 恢复时开始重放的段编号，8字节
+ * PageNumber 建立检查点时数据文件的页数，8字节，恢复时截断数据文件不能少于这个页数
+ * 检查点文件先写入临时文件再重命名，文件中总是一个完整的检查点
+ */
+
+var (
+	// CheckpointLength 检查点文件的长度
+	CheckpointLength = 16
+	// CheckpointTmpSuffix 写入检查点时的临时文件后缀
+	CheckpointTmpSuffix = ".ckpt.tmp"
+)
+
+// loadCheckpoint 读取检查点文件，文件不存在说明还没有建立过检查点
+func (logger *DBLogger) loadCheckpoint() {
+	data, err := os.ReadFile(logger.path + CheckpointSuffix)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	if len(data) != CheckpointLength {
+		panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
+	}
+	logger.checkpoint = int(binary.BigEndian.Uint64(data[:8]))
+	logger.checkpointPages = int(binary.BigEndian.Uint64(data[8:]))
+}
+
+// Segment 返回当前活动段的编号
+func (logger *DBLogger) Segment() int {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	return logger.segment
+}
+
+// CheckpointPages 返回最近一次检查点时数据文件的页数，没有检查点时返回0
+func (logger *DBLogger) CheckpointPages() int {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	return logger.checkpointPages
+}
+
+// PinSegments 在备份复制日志段期间禁止删除旧的段，需要与UnpinSegments成对调用
+func (logger *DBLogger) PinSegments() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.pins++
+}
+
+// UnpinSegments 备份结束之后允许删除旧的段
+func (logger *DBLogger) UnpinSegments() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.pins--
+}
+
+// Checkpoint 记录检查点，之后恢复时从segment开始重放，pageNumber为此时数据文件的页数
+// 调用之前必须保证segment之前的日志对应的修改都已经写回磁盘，不再需要重放
+// 记录之后删除segment之前并且已经归档的段，没有设置归档目录时直接删除
+func (logger *DBLogger) Checkpoint(segment int, pageNumber int) error {
+	if logger.readOnly {
+		return commons.NewError(commons.ErrorMessage.ReadOnlyDatabaseError)
+	}
+	// 内存中的日志切换段时已经丢弃了旧的段
+	if logger.memory {
+		return nil
+	}
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	if segment > logger.segment {
+		segment = logger.segment
+	}
+	if segment < logger.checkpoint {
+		return nil
+	}
+	data := make([]byte, CheckpointLength)
+	binary.BigEndian.PutUint64(data[:8], uint64(segment))
+	binary.BigEndian.PutUint64(data[8:], uint64(pageNumber))
+	tmp := logger.path + CheckpointTmpSuffix
+	_ = os.Remove(tmp)
+	if err := utils.WriteFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, logger.path+CheckpointSuffix); err != nil {
+		return err
+	}
+	if err := utils.SyncDir(filepath.Dir(logger.path)); err != nil {
+		return err
+	}
+	logger.checkpoint = segment
+	logger.checkpointPages = pageNumber
+	return logger.removeSegments()
+}
+
+// removeSegments 删除检查点之前已经归档的段，保留的段的编号仍然是连续的
+// 有备份正在复制时不删除，等到下次检查点再删除
+func (logger *DBLogger) removeSegments() error {
+	if logger.pins > 0 {
+		return nil
+	}
+	for logger.firstSegment < logger.checkpoint {
+		segment := logger.firstSegment
+		// 尚未归档的段需要保留，等待补充归档之后再删除
+		if logger.archiveDir != "" && !utils.FileExists(logger.archivePath(segment)) {
+			return nil
+		}
+		if logger.readFile != nil && logger.readSegment == segment {
+			logger.closeReadFile()
+		}
+		if err := os.Remove(SegmentPath(logger.path, segment)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		logger.firstSegment++
+	}
+	return nil
+}
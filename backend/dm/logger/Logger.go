@@ -3,9 +3,22 @@ package logger
 import (
 	"SimpleDB/backend/utils"
 	"SimpleDB/commons"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 )
 
+/**
+ * 日志被切分为多个编号递增的段文件，每个段文件的格式如下：
+ * [XCheckSum][Log1][Log2]...[LogN][BadTail]
+ * XCheckSum 为该段内所有日志的校验和，4字节
+ * 每条日志的格式为：[Size][CheckSum][Data]
+ * 段文件的命名格式为：path.00000001.log，编号最大的段为当前正在写入的活动段，
+ * 其余的段均已关闭，关闭后的段会被归档到配置的归档目录中
+ * 建立检查点之后，检查点之前并且已经归档的段会被删除，恢复时从检查点记录的段开始重放
+ */
+
 var (
 	SEED int32 = 13331
 	// OffsetSize 偏移大小
@@ -21,67 +34,195 @@ var (
 	OffsetDataSize = OffsetCheckSumSize + CheckSumSize
 	// LogSuffix 日志文件后缀
 	LogSuffix = ".log"
+
+	// DefaultSegmentSize 默认的日志段大小，当前段超过该大小后会切换到新的段
+	DefaultSegmentSize int64 = 16 << 20
+	// SegmentNumberFormat 段编号在文件名中的格式
+	SegmentNumberFormat = "%08d"
+	// CheckpointSuffix 检查点文件后缀
+	CheckpointSuffix = ".ckpt"
 )
 
 type DBLogger struct {
-	file *os.File
+	// path 数据库路径，段文件名由它生成
+	path string
+	// file 当前活动段的文件，所有的日志都追加到这个文件中
+	file utils.File
+	// segment 当前活动段的编号
+	segment int
+	// firstSegment 第一个段的编号
+	firstSegment int
 
 	lock commons.ReentrantLock
 
+	// 迭代日志时正在读取的段编号
+	readSegment int
+	// 迭代日志时正在读取的段文件，如果是活动段则与file相同
+	readFile utils.File
 	// 当前日志指针的位置
 	currentPosition int64
-	// 初始化时记录一下，当进行log操作时不更新此值
+	// 正在读取的段的文件大小，切换到该段时记录，当进行log操作时不更新此值
 	fileSize int64
-	// xCheckSum 全局校验和
+	// xCheckSum 当前活动段的校验和
 	xCheckSum int32
+
+	// segmentSize 日志段的大小上限
+	segmentSize int64
+	// archiveDir 归档目录，为空时不进行归档
+	archiveDir string
+
+	// syncDeferred 大于0时写入日志后不立即落盘，用于批量写入
+	syncDeferred int
+	// unsynced 活动段中是否有尚未落盘的日志
+	unsynced bool
+	// readOnly 只读打开的日志只能读取，不会截断或者写入
+	readOnly bool
+	// memory 内存数据库的日志，段保存在内存文件中，切换段时丢弃已关闭的段
+	memory bool
+
+	// checkpoint 最近一次检查点记录的段，恢复时从这个段开始重放
+	checkpoint int
+	// checkpointPages 最近一次检查点时数据文件的页数
+	checkpointPages int
+	// pins 大于0时有备份正在复制日志段，此时不删除旧的段
+	pins int
 }
 
 // CreateLogger 创建一个新的日志管理器
 func CreateLogger(path string) *DBLogger {
-	// 创建日志文件，不能存在
-	if utils.FileExists(path + LogSuffix) {
+	// 不能存在任何日志段
+	if utils.FileExists(path+LogSuffix) || len(ListSegments(path)) > 0 {
 		panic(commons.ErrorMessage.FileExistError)
 	}
 
-	file, err := os.OpenFile(path+LogSuffix, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
-	if err != nil {
-		panic(err)
+	file := createSegmentFile(SegmentPath(path, 1))
+	return NewLogger(path, file, 1, 1)
+}
+
+// CreateMemoryLogger 创建内存数据库的日志，内存数据库不会重新打开，因此不需要保留已关闭的段
+func CreateMemoryLogger() *DBLogger {
+	logger := NewLogger("", utils.NewMemoryFile([]byte{0, 0, 0, 0}), 1, 1)
+	logger.memory = true
+	return logger
+}
+
+// OpenLogger 打开一个已经存在的日志
+func OpenLogger(path string) *DBLogger {
+	// 兼容旧版本的单文件日志，其格式与段文件一致，直接作为第一个段
+	migrateLegacyLog(path)
+
+	segments := ListSegments(path)
+	if len(segments) == 0 {
+		panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
+	}
+	last := segments[len(segments)-1]
+	// 段编号必须是连续的
+	if last-segments[0]+1 != len(segments) {
+		panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
 	}
 
-	// 创建日志文件，写入一开始的校验和（4字节的0）
-	_, err = file.Write([]byte{0, 0, 0, 0})
+	file, err := os.OpenFile(SegmentPath(path, last), os.O_RDWR, 0755)
 	if err != nil {
 		panic(err)
 	}
-	file.Sync()
 
-	return NewLogger(file)
+	logger := NewLogger(path, file, segments[0], last)
+	logger.loadCheckpoint()
+	logger.init()
+
+	return logger
 }
 
-// OpenLogger 打开一个已经存在的日志文件
-func OpenLogger(path string) *DBLogger {
-	// 日志文件必须存在
-	file, err := os.OpenFile(path+LogSuffix, os.O_RDWR, 0755)
+// OpenReadOnlyLogger 以只读方式打开已经存在的日志，活动段末尾的损坏部分不会被截断
+// 旧版本的单文件日志直接作为第一个段读取，不会被重命名
+func OpenReadOnlyLogger(path string) *DBLogger {
+	name := path + LogSuffix
+	segments := ListSegments(path)
+	if utils.FileExists(name) && len(segments) == 0 {
+		segments = []int{1}
+	} else {
+		if len(segments) == 0 || segments[len(segments)-1]-segments[0]+1 != len(segments) {
+			panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
+		}
+		name = SegmentPath(path, segments[len(segments)-1])
+	}
+
+	file, err := os.Open(name)
 	if err != nil {
 		panic(err)
 	}
-
-	logger := NewLogger(file)
+	logger := NewLogger(path, file, segments[0], segments[len(segments)-1])
+	logger.readOnly = true
+	logger.loadCheckpoint()
 	logger.init()
+	return logger
+}
 
+// NewLogger 创建一个新的日志管理器，file为编号为segment的活动段
+func NewLogger(path string, file utils.File, firstSegment int, segment int, xCheckSum ...int32) *DBLogger {
+	logger := &DBLogger{
+		path:         path,
+		file:         file,
+		firstSegment: firstSegment,
+		segment:      segment,
+		segmentSize:  DefaultSegmentSize,
+	}
+	if len(xCheckSum) > 0 {
+		logger.xCheckSum = xCheckSum[0]
+	}
 	return logger
 }
 
-// NewLogger 创建一个新的日志管理器
-func NewLogger(file *os.File, xCheckSum ...int32) *DBLogger {
-	if len(xCheckSum) == 0 {
-		return &DBLogger{
-			file: file,
+// SegmentPath 返回编号为segment的段文件路径
+func SegmentPath(path string, segment int) string {
+	return path + "." + fmt.Sprintf(SegmentNumberFormat, segment) + LogSuffix
+}
+
+// ListSegments 列出path下所有的段编号，按照从小到大的顺序排列
+func ListSegments(path string) []int {
+	matches, err := filepath.Glob(path + ".*" + LogSuffix)
+	if err != nil {
+		panic(err)
+	}
+	segments := make([]int, 0, len(matches))
+	for _, match := range matches {
+		var segment int
+		name := match[len(path)+1 : len(match)-len(LogSuffix)]
+		if len(name) != len(fmt.Sprintf(SegmentNumberFormat, 0)) {
+			continue
 		}
+		if _, err := fmt.Sscanf(name, SegmentNumberFormat, &segment); err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Ints(segments)
+	return segments
+}
+
+// migrateLegacyLog 将旧版本的path.log重命名为第一个段
+func migrateLegacyLog(path string) {
+	if !utils.FileExists(path + LogSuffix) {
+		return
+	}
+	if len(ListSegments(path)) > 0 {
+		panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
+	}
+	if err := os.Rename(path+LogSuffix, SegmentPath(path, 1)); err != nil {
+		panic(err)
 	}
+}
 
-	return &DBLogger{
-		file:      file,
-		xCheckSum: xCheckSum[0],
+// createSegmentFile 创建一个新的段文件，写入一开始的校验和（4字节的0）
+func createSegmentFile(name string) *os.File {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		panic(err)
+	}
+	_, err = file.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		panic(err)
 	}
+	file.Sync()
+	return file
 }
@@ -4,44 +4,76 @@ import (
 	"SimpleDB/backend/utils"
 	"SimpleDB/commons"
 	"encoding/binary"
-	"errors"
+	"io"
+	"os"
+	"path/filepath"
 )
 
-// init 对logger进行初始化，主要是获取文件大小并进行文件大小和校验和的校验
+// init 对logger进行初始化，校验所有已关闭的段，并对活动段进行文件大小和校验和的校验
 func (logger *DBLogger) init() {
-	// 获取文件大小
-	size, err := utils.GetFileSize(logger.file)
+	// 已关闭的段在切换时已经完整落盘，校验和必须完全一致
+	for segment := logger.firstSegment; segment < logger.segment; segment++ {
+		logger.checkClosedSegment(segment)
+	}
+
+	// 获取活动段的校验和
+	checkSum, err := readSegmentCheckSum(logger.file)
 	if err != nil {
 		panic(err)
 	}
+	logger.xCheckSum = checkSum
+	// 检查校验和并且移除后面的截断部分
+	logger.checkAndRemoveTail()
+}
+
+// readSegmentCheckSum 读取段文件开头4字节的校验和
+func readSegmentCheckSum(file utils.File) (int32, error) {
+	size, err := utils.GetFileSize(file)
+	if err != nil {
+		return 0, err
+	}
 	// 小于4字节说明连前面的校验和都没有
-	if size < 4 {
-		panic(errors.New(commons.ErrorMessage.BadLogFileError))
+	if size < int64(OffsetCheckSumSize) {
+		return 0, commons.NewError(commons.ErrorMessage.BadLogFileError)
+	}
+	raw := make([]byte, OffsetCheckSumSize)
+	if _, err = file.ReadAt(raw, 0); err != nil {
+		return 0, err
 	}
+	return int32(binary.BigEndian.Uint32(raw)), nil
+}
+
+// checkClosedSegment 校验一个已经关闭的段，校验失败说明日志文件已损坏
+func (logger *DBLogger) checkClosedSegment(segment int) {
+	logger.openSegment(segment)
+	defer logger.closeReadFile()
 
-	// 获取前面4字节的校验和
-	raw := make([]byte, 4)
-	_, err = logger.file.ReadAt(raw, 0)
+	checkSum, err := readSegmentCheckSum(logger.readFile)
 	if err != nil {
 		panic(err)
 	}
-
-	checkSum := int32(binary.BigEndian.Uint32(raw))
-	logger.fileSize = size
-	logger.xCheckSum = checkSum
-	// 检查校验和并且移除后面的截断部分
-	logger.checkAndRemoveTail()
+	var xCheck int32 = 0
+	for {
+		log := logger.nextInSegment()
+		if log == nil {
+			break
+		}
+		xCheck = logger.calCheckSum(xCheck, log)
+	}
+	if xCheck != checkSum || logger.currentPosition != logger.fileSize {
+		panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
+	}
 }
 
-// 对校验和进行检查并且移除后面的截断部分
+// 对活动段的校验和进行检查并且移除后面的截断部分
 func (logger *DBLogger) checkAndRemoveTail() {
-	logger.Rewind()
+	logger.openSegment(logger.segment)
 
 	var xCheck int32 = 0
 	// 从头开始读取，计算校验和
 	for {
 		// 读取下一条日志
-		log := logger.internNext()
+		log := logger.nextInSegment()
 		if log == nil {
 			break
 		}
@@ -49,7 +81,7 @@ func (logger *DBLogger) checkAndRemoveTail() {
 		xCheck = logger.calCheckSum(xCheck, log)
 	}
 	if xCheck != logger.xCheckSum {
-		panic(errors.New(commons.ErrorMessage.BadLogFileError))
+		panic(commons.NewError(commons.ErrorMessage.BadLogFileError))
 	}
 
 	// 截断后面的部分
@@ -58,11 +90,6 @@ func (logger *DBLogger) checkAndRemoveTail() {
 		panic(err)
 	}
 
-	_, err = logger.file.Seek(logger.currentPosition, 1)
-	if err != nil {
-		panic(err)
-	}
-
 	// 重置文件指针位置
 	logger.Rewind()
 }
@@ -75,30 +102,85 @@ func (logger *DBLogger) calCheckSum(xCheck int32, log []byte) int32 {
 	return xCheck
 }
 
-// Log 记录日志
+// Log 记录日志，当前段写满后会先切换到新的段
 func (logger *DBLogger) Log(data []byte) {
 	logger.lock.Lock()
 	defer logger.lock.Unlock()
 
+	if logger.readOnly {
+		panic(commons.NewError(commons.ErrorMessage.ReadOnlyDatabaseError))
+	}
+
 	// 将数据包装成日志条目
 	log := logger.wrapLog(data)
-	stat, err2 := logger.file.Stat()
-	if err2 != nil {
-		panic(err2)
+	size, err := utils.GetFileSize(logger.file)
+	if err != nil {
+		panic(err)
+	}
+	// 段内至少保留一条日志，避免单条过大的日志导致无限切换
+	if logger.segmentSize > 0 && size > int64(OffsetCheckSumSize) && size+int64(len(log)) > logger.segmentSize {
+		logger.rotate()
+		size = int64(OffsetCheckSumSize)
 	}
 	// 写入日志
-	_, err := logger.file.WriteAt(log, stat.Size())
-
+	_, err = logger.file.WriteAt(log, size)
 	if err != nil {
 		panic(err)
 	}
-	logger.file.Sync()
+	logger.syncUnlessDeferred()
 
 	// 更新校验和
 	logger.updateXCheckSum(log)
 
 }
 
+// syncUnlessDeferred 没有推迟落盘时立即落盘，否则只记录有未落盘的日志
+func (logger *DBLogger) syncUnlessDeferred() {
+	if logger.syncDeferred > 0 {
+		logger.unsynced = true
+		return
+	}
+	if err := logger.file.Sync(); err != nil {
+		panic(err)
+	}
+}
+
+// DeferSync 推迟日志的落盘，之后写入的日志直到ResumeSync或者Sync时才会落盘，可以嵌套调用
+func (logger *DBLogger) DeferSync() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.syncDeferred++
+}
+
+// ResumeSync 恢复每条日志立即落盘，最外层的调用会将推迟的日志落盘
+func (logger *DBLogger) ResumeSync() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	if logger.syncDeferred > 0 {
+		logger.syncDeferred--
+	}
+	if logger.syncDeferred == 0 {
+		logger.sync()
+	}
+}
+
+// Sync 将推迟的日志落盘，提交事务以及页面刷回磁盘之前都需要调用，保证日志先于数据落盘
+func (logger *DBLogger) Sync() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.sync()
+}
+
+func (logger *DBLogger) sync() {
+	if !logger.unsynced {
+		return
+	}
+	if err := logger.file.Sync(); err != nil {
+		panic(err)
+	}
+	logger.unsynced = false
+}
+
 // updateXCheckSum 更新校验和
 func (logger *DBLogger) updateXCheckSum(log []byte) {
 	logger.xCheckSum = int32(logger.calCheckSum(logger.xCheckSum, log))
@@ -108,7 +190,7 @@ func (logger *DBLogger) updateXCheckSum(log []byte) {
 	if err != nil {
 		panic(err)
 	}
-	logger.file.Sync()
+	logger.syncUnlessDeferred()
 
 }
 
@@ -121,16 +203,185 @@ func (logger *DBLogger) wrapLog(data []byte) []byte {
 	return append(append(size, checkSum...), data...)
 }
 
-// Truncate 截断文件
+// rotate 关闭当前的活动段，并创建一个新的活动段
+func (logger *DBLogger) rotate() {
+	if err := logger.file.Sync(); err != nil {
+		panic(err)
+	}
+	logger.unsynced = false
+	// 正在读取活动段时，下次读取需要重新打开该段
+	if logger.readFile == logger.file {
+		logger.readFile = nil
+	}
+	if err := logger.file.Close(); err != nil {
+		panic(err)
+	}
+
+	closed := logger.segment
+	logger.segment++
+	logger.xCheckSum = 0
+	if logger.memory {
+		logger.file = utils.NewMemoryFile([]byte{0, 0, 0, 0})
+		logger.firstSegment = logger.segment
+		return
+	}
+	logger.file = createSegmentFile(SegmentPath(logger.path, logger.segment))
+
+	// 归档失败不影响日志的写入，等待下次打开或者重新设置归档目录时再补充归档
+	if err := logger.archiveSegment(closed); err != nil {
+		commons.Logger.Errorf("archive log segment %d failed: %v", closed, err)
+	}
+}
+
+// SetSegmentSize 设置日志段的大小上限，小于等于0表示不切分
+func (logger *DBLogger) SetSegmentSize(size int64) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	logger.segmentSize = size
+}
+
+// SetArchiveDir 设置归档目录，并将所有尚未归档的已关闭段归档
+func (logger *DBLogger) SetArchiveDir(dir string) error {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	if logger.memory {
+		return commons.NewError(commons.ErrorMessage.MemoryDatabaseError)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	logger.archiveDir = dir
+	for segment := logger.firstSegment; segment < logger.segment; segment++ {
+		if utils.FileExists(logger.archivePath(segment)) {
+			continue
+		}
+		if err := logger.archiveSegment(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivePath 返回段在归档目录中的路径
+func (logger *DBLogger) archivePath(segment int) string {
+	return filepath.Join(logger.archiveDir, filepath.Base(SegmentPath(logger.path, segment)))
+}
+
+// archiveSegment 将已关闭的段复制到归档目录，先写入临时文件再重命名，保证归档目录中的段总是完整的
+func (logger *DBLogger) archiveSegment(segment int) error {
+	if logger.archiveDir == "" {
+		return nil
+	}
+	src, err := os.Open(SegmentPath(logger.path, segment))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	target := logger.archivePath(segment)
+	tmp, err := os.OpenFile(target+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(target+".tmp", target)
+}
+
+// Backup 切换到新的活动段，并将此前所有的段复制为path对应的段文件
+// 切换之前写入的日志都会包含在备份中，备份中编号最大的段即为切换前的活动段
+func (logger *DBLogger) Backup(path string) error {
+	if logger.readOnly {
+		return commons.NewError(commons.ErrorMessage.ReadOnlyDatabaseError)
+	}
+	if logger.memory {
+		return commons.NewError(commons.ErrorMessage.MemoryDatabaseError)
+	}
+	logger.lock.Lock()
+	logger.rotate()
+	first, last := logger.firstSegment, logger.segment-1
+	logger.pins++
+	logger.lock.Unlock()
+	defer logger.UnpinSegments()
+
+	// 已关闭的段不会再被修改，可以在锁外复制
+	for segment := first; segment <= last; segment++ {
+		if err := utils.CopyFile(SegmentPath(logger.path, segment), SegmentPath(path, segment)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Truncate 截断活动段
 func (logger *DBLogger) Truncate(x int64) error {
 	logger.lock.Lock()
 	defer logger.lock.Unlock()
 
+	if logger.readOnly {
+		return nil
+	}
 	return logger.file.Truncate(x)
 }
 
-// internNext 读取下一个日志条目
+// openSegment 打开编号为segment的段用于读取，并将文件指针定位到校验和之后
+func (logger *DBLogger) openSegment(segment int) {
+	logger.closeReadFile()
+	if segment == logger.segment {
+		logger.readFile = logger.file
+	} else {
+		file, err := os.Open(SegmentPath(logger.path, segment))
+		if err != nil {
+			panic(err)
+		}
+		logger.readFile = file
+	}
+	size, err := utils.GetFileSize(logger.readFile)
+	if err != nil {
+		panic(err)
+	}
+	logger.readSegment = segment
+	logger.fileSize = size
+	logger.currentPosition = int64(OffsetCheckSumSize)
+}
+
+// closeReadFile 关闭正在读取的已关闭段
+func (logger *DBLogger) closeReadFile() {
+	if logger.readFile != nil && logger.readFile != logger.file {
+		logger.readFile.Close()
+	}
+	logger.readFile = nil
+}
+
+// internNext 读取下一个日志条目，当前段读完后继续读取下一个段
 func (logger *DBLogger) internNext() []byte {
+	for {
+		if logger.readFile == nil {
+			logger.openSegment(logger.readSegment)
+		}
+		log := logger.nextInSegment()
+		if log != nil {
+			return log
+		}
+		if logger.readSegment >= logger.segment {
+			return nil
+		}
+		logger.openSegment(logger.readSegment + 1)
+	}
+}
+
+// nextInSegment 读取当前段中的下一个日志条目
+func (logger *DBLogger) nextInSegment() []byte {
 	// 如果当前文件指针位置 + 8字节 大于等于了文件大小，直接返回
 	// 这里8字节是因为每条日志内部的前边4个字节是size，接着4个字节是检验和，再往后才是数据
 	if logger.currentPosition+int64(OffsetDataSize) >= logger.fileSize {
@@ -138,7 +389,7 @@ func (logger *DBLogger) internNext() []byte {
 	}
 
 	tmp := make([]byte, LogItemLengthSize)
-	_, err := logger.file.ReadAt(tmp, logger.currentPosition)
+	_, err := logger.readFile.ReadAt(tmp, logger.currentPosition)
 	if err != nil {
 		panic(err)
 	}
@@ -150,7 +401,7 @@ func (logger *DBLogger) internNext() []byte {
 
 	// 读取整条日志记录，包括了前面的8字节数据
 	buf := make([]byte, size+OffsetDataSize)
-	_, err = logger.file.ReadAt(buf, logger.currentPosition)
+	_, err = logger.readFile.ReadAt(buf, logger.currentPosition)
 	if err != nil {
 		panic(err)
 	}
@@ -178,13 +429,24 @@ func (logger *DBLogger) Next() []byte {
 	return log[OffsetDataSize:]
 }
 
-// Rewind 将文件指针位置重新定位到最开始的校验和后面，即4字节的位置
+// Rewind 将文件指针位置重新定位到第一个需要重放的段的校验和后面，即4字节的位置
+// 建立过检查点时从检查点记录的段开始，之前尚未删除的段中的日志不再需要重放
 func (logger *DBLogger) Rewind() {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	logger.closeReadFile()
+	logger.readSegment = logger.firstSegment
+	if logger.checkpoint > logger.readSegment {
+		logger.readSegment = logger.checkpoint
+	}
 	logger.currentPosition = int64(OffsetCheckSumSize)
 }
 
 // Close 关闭文件
 func (logger *DBLogger) Close() {
+	logger.Sync()
+	logger.closeReadFile()
 	err := logger.file.Close()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"SimpleDB/backend/utils"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// SegmentInfo 只读遍历时得到的段信息
+type SegmentInfo struct {
+	// Segment 段编号
+	Segment int
+	// Path 段文件路径
+	Path string
+	// Size 段文件大小
+	Size int64
+	// CheckSum 段文件开头记录的校验和
+	CheckSum int32
+	// Computed 根据段内所有合法日志计算出的校验和
+	Computed int32
+	// ValidEnd 最后一条合法日志的结束位置，之后的部分为损坏的尾部
+	ValidEnd int64
+	// Records 段内合法日志的数量
+	Records int
+}
+
+// CheckSumMatched 判断段的校验和是否一致
+func (info *SegmentInfo) CheckSumMatched() bool {
+	return info.CheckSum == info.Computed
+}
+
+// BadTail 返回段末尾损坏部分的长度
+func (info *SegmentInfo) BadTail() int64 {
+	return info.Size - info.ValidEnd
+}
+
+// Record 只读遍历时得到的一条日志
+type Record struct {
+	// Segment 日志所在的段编号
+	Segment int
+	// Offset 日志在段文件中的偏移
+	Offset int64
+	// CheckSum 日志条目中记录的校验和
+	CheckSum int32
+	// Data 日志的数据部分
+	Data []byte
+}
+
+// ReadSegments 以只读方式按顺序遍历path下所有的段，对每一条合法的日志调用fn，不会修改任何文件
+// 与OpenLogger不同，这里不会迁移旧版本日志，不会校验已关闭的段，也不会截断损坏的尾部，只是将它们记录在返回的段信息中
+// 旧版本的单文件日志作为编号为1的段读取，与迁移之后的编号一致
+func ReadSegments(path string, fn func(record *Record) error) ([]*SegmentInfo, error) {
+	segments := ListSegments(path)
+	legacy := len(segments) == 0
+	if legacy {
+		if !utils.FileExists(path + LogSuffix) {
+			return nil, errors.New("no log segment found")
+		}
+		segments = []int{1}
+	}
+	segmentPath := func(segment int) string {
+		if legacy {
+			return path + LogSuffix
+		}
+		return SegmentPath(path, segment)
+	}
+	file, err := os.Open(segmentPath(segments[len(segments)-1]))
+	if err != nil {
+		return nil, err
+	}
+	// 复用Next使用的读取逻辑，但是不调用init，段损坏时不会panic
+	reader := NewLogger(path, file, segments[0], segments[len(segments)-1])
+	reader.readOnly = true
+	defer reader.Close()
+
+	infos := make([]*SegmentInfo, 0, len(segments))
+	for _, segment := range segments {
+		info, err := reader.readSegmentInfo(segment, segmentPath(segment), fn)
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// readSegmentInfo 遍历一个段中所有合法的日志，并计算段的校验和以及合法部分的结束位置
+func (logger *DBLogger) readSegmentInfo(segment int, name string, fn func(record *Record) error) (*SegmentInfo, error) {
+	logger.openSegment(segment)
+	defer logger.closeReadFile()
+
+	info := &SegmentInfo{
+		Segment: segment,
+		Path:    name,
+		Size:    logger.fileSize,
+	}
+	checkSum, err := readSegmentCheckSum(logger.readFile)
+	if err != nil {
+		return info, errors.New(name + ": " + err.Error())
+	}
+	info.CheckSum = checkSum
+
+	for {
+		position := logger.currentPosition
+		log := logger.nextInSegment()
+		if log == nil {
+			break
+		}
+		info.Computed = logger.calCheckSum(info.Computed, log)
+		info.Records++
+		if fn == nil {
+			continue
+		}
+		err = fn(&Record{
+			Segment:  segment,
+			Offset:   position,
+			CheckSum: int32(binary.BigEndian.Uint32(log[OffsetCheckSumSize:OffsetDataSize])),
+			Data:     log[OffsetDataSize:],
+		})
+		if err != nil {
+			return info, err
+		}
+	}
+	info.ValidEnd = logger.currentPosition
+	return info, nil
+}
@@ -19,7 +19,7 @@ func TestLogger(t *testing.T) {
 	logger = logger2.OpenLogger("/Users/xuyifei/repos/SimpleDB/data/test/backend/dm/logger")
 	logger.Rewind()
 
-	defer os.RemoveAll("/Users/xuyifei/repos/SimpleDB/data/test/backend/dm/logger" + logger2.LogSuffix)
+	defer os.RemoveAll(logger2.SegmentPath("/Users/xuyifei/repos/SimpleDB/data/test/backend/dm/logger", 1))
 
 	log := logger.Next()
 	if log == nil {
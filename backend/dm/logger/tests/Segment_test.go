@@ -0,0 +1,126 @@
+package tests
+
+import (
+	logger2 "SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/utils"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoggerSegment(t *testing.T) {
+	t.Log("TestLoggerSegment")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "segment")
+	archive := filepath.Join(dir, "archive")
+
+	logger := logger2.CreateLogger(path)
+	logger.SetSegmentSize(64)
+	if err := logger.SetArchiveDir(archive); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		logger.Log([]byte(fmt.Sprintf("log-%02d", i)))
+	}
+	logger.Close()
+
+	// 每条日志占用14字节，每个段最多容纳4条日志
+	for segment := 1; segment <= 5; segment++ {
+		if !utils.FileExists(logger2.SegmentPath(path, segment)) {
+			t.Fatalf("segment %d not exists", segment)
+		}
+	}
+	for segment := 1; segment <= 4; segment++ {
+		if !utils.FileExists(logger2.SegmentPath(filepath.Join(archive, "segment"), segment)) {
+			t.Fatalf("segment %d not archived", segment)
+		}
+	}
+	if utils.FileExists(logger2.SegmentPath(filepath.Join(archive, "segment"), 5)) {
+		t.Fatalf("active segment should not be archived")
+	}
+
+	logger = logger2.OpenLogger(path)
+	defer logger.Close()
+	logger.Rewind()
+	for i := 0; i < 20; i++ {
+		log := logger.Next()
+		if string(log) != fmt.Sprintf("log-%02d", i) {
+			t.Fatalf("log %d not equal, got %s", i, string(log))
+		}
+	}
+	if logger.Next() != nil {
+		t.Fatalf("log is not nil")
+	}
+}
+
+func TestMemoryLoggerSegment(t *testing.T) {
+	t.Log("TestMemoryLoggerSegment")
+	logger := logger2.CreateMemoryLogger()
+	defer logger.Close()
+	logger.SetSegmentSize(64)
+	for i := 0; i < 18; i++ {
+		logger.Log([]byte(fmt.Sprintf("log-%02d", i)))
+	}
+
+	// 内存中的日志切换段时丢弃已关闭的段，只能读到活动段中的日志
+	logger.Rewind()
+	for i := 16; i < 18; i++ {
+		log := logger.Next()
+		if string(log) != fmt.Sprintf("log-%02d", i) {
+			t.Fatalf("log %d not equal, got %s", i, string(log))
+		}
+	}
+	if logger.Next() != nil {
+		t.Fatalf("log is not nil")
+	}
+	if err := logger.SetArchiveDir(t.TempDir()); err == nil {
+		t.Fatalf("memory logger should not archive")
+	}
+}
+
+func TestLoggerCheckpoint(t *testing.T) {
+	t.Log("TestLoggerCheckpoint")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "segment")
+	archive := filepath.Join(dir, "archive")
+
+	logger := logger2.CreateLogger(path)
+	logger.SetSegmentSize(64)
+	if err := logger.SetArchiveDir(archive); err != nil {
+		t.Fatal(err)
+	}
+	// 每次切换段之后建立检查点，检查点之前已经归档的段被删除，本地最多保留活动段
+	for i := 0; i < 40; i++ {
+		logger.Log([]byte(fmt.Sprintf("log-%02d", i)))
+		if err := logger.Checkpoint(logger.Segment(), 3); err != nil {
+			t.Fatal(err)
+		}
+		if segments := logger2.ListSegments(path); len(segments) != 1 {
+			t.Fatalf("%d local segments after %d logs: %v", len(segments), i+1, segments)
+		}
+	}
+	last := logger.Segment()
+	logger.Close()
+	for segment := 1; segment < last; segment++ {
+		if !utils.FileExists(logger2.SegmentPath(filepath.Join(archive, "segment"), segment)) {
+			t.Fatalf("segment %d not archived", segment)
+		}
+	}
+
+	// 重新打开后从检查点的段开始读取
+	logger = logger2.OpenLogger(path)
+	defer logger.Close()
+	if logger.CheckpointPages() != 3 {
+		t.Fatalf("checkpoint pages %d, expected 3", logger.CheckpointPages())
+	}
+	logger.Rewind()
+	for i := 36; i < 40; i++ {
+		log := logger.Next()
+		if string(log) != fmt.Sprintf("log-%02d", i) {
+			t.Fatalf("log %d not equal, got %s", i, string(log))
+		}
+	}
+	if logger.Next() != nil {
+		t.Fatalf("log is not nil")
+	}
+}
@@ -0,0 +1,105 @@
+package dump
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+/**
+ * 逻辑导出，导出的脚本与磁盘上的页面格式无关，每行一条语句：
+ * -- 开头的行为注释
+ * create table student id int32, name string, (index id)
+ * insert into student values 1 'alice'
+ */
+
+var (
+	// DumpMemory 导出时页面缓存使用的内存大小
+	DumpMemory int64 = 64 << 20
+	// CommentPrefix 注释行的前缀
+	CommentPrefix = "--"
+)
+
+// Dump 直接打开path处的数据库文件，在同一个可重复读快照中导出所有表的建表语句和数据，数据库服务不能同时运行
+func Dump(path string, w io.Writer) error {
+	transactionManager, err := tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		return err
+	}
+	defer transactionManager.Close()
+	dataManager := dm.OpenDataManager(path, DumpMemory, transactionManager)
+	defer dataManager.Close()
+	tableManager := tbm.OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+
+	begin := tableManager.Begin(&statement.BeginStatement{IsRepeatableRead: true})
+	defer tableManager.Abort(begin.Xid)
+
+	return DumpTables(tableManager, begin.Xid, w)
+}
+
+// DumpTables 使用事务xid的快照导出tableManager中的所有表
+func DumpTables(tableManager *tbm.TableManager, xid int64, w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "%s SimpleDB dump, xid %d, %s\n", CommentPrefix, xid, time.Now().Format("2006-01-02 15:04:05"))
+
+	for _, name := range tableManager.TableNames() {
+		table := tableManager.GetTable(name)
+		fmt.Fprintf(writer, "\n%s table %s\n", CommentPrefix, name)
+		writer.WriteString(createStatement(table))
+		writer.WriteString("\n")
+
+		err := table.Scan(xid, func(values []string) error {
+			_, err := writer.WriteString(insertStatement(table, values) + "\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// createStatement 生成建表语句，索引声明来自字段的索引信息
+func createStatement(table *tbm.Table) string {
+	fields := make([]string, 0, len(table.Fields))
+	indexes := make([]string, 0)
+	for _, field := range table.Fields {
+		fields = append(fields, field.FieldName+" "+field.FieldType)
+		if field.IsIndexed() {
+			indexes = append(indexes, field.FieldName)
+		}
+	}
+	return fmt.Sprintf("create table %s %s, (index %s)", table.Name, strings.Join(fields, ", "), strings.Join(indexes, " "))
+}
+
+// insertStatement 生成插入语句
+func insertStatement(table *tbm.Table, values []string) string {
+	quoted := make([]string, len(values))
+	for i, field := range table.Fields {
+		if field.FieldType != "string" {
+			quoted[i] = values[i]
+			continue
+		}
+		quoted[i] = quoteString(values[i])
+	}
+	return "insert into " + table.Name + " values " + strings.Join(quoted, " ")
+}
+
+// quoteString 为字符串加上引号，优先选择字符串中没有出现的引号
+// 同时包含两种引号时使用单引号，字符串中的单引号写成两个单引号
+func quoteString(value string) string {
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	if !strings.Contains(value, "\"") {
+		return "\"" + value + "\""
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,119 @@
+package dump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// DefaultBatchSize 每个事务中插入语句的默认数量
+	DefaultBatchSize = 500
+)
+
+// Executor 执行一条语句，client.Client和server.Executor都满足这个接口
+type Executor interface {
+	Execute(stat []byte) ([]byte, error)
+}
+
+// Load 读取Dump生成的脚本并通过executor重放，插入语句每batchSize条放在一个事务中提交
+// 建表语句会在当前批次提交之后单独执行；出错时终止当前批次并返回出错语句所在的行号
+func Load(executor Executor, r io.Reader, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	reader := bufio.NewReader(r)
+	loaded := 0
+	inBatch := 0
+	line := 1
+
+	commit := func() error {
+		if inBatch == 0 {
+			return nil
+		}
+		inBatch = 0
+		_, err := executor.Execute([]byte("commit"))
+		return err
+	}
+
+	for {
+		stat, startLine, next, err := readStatement(reader, line)
+		line = next
+		if err != nil && err != io.EOF {
+			return loaded, err
+		}
+		if stat != "" {
+			if strings.HasPrefix(stat, "insert") {
+				if inBatch == 0 {
+					if _, e := executor.Execute([]byte("begin")); e != nil {
+						return loaded, fmt.Errorf("line %d: %v", startLine, e)
+					}
+				}
+				inBatch++
+			} else if e := commit(); e != nil {
+				return loaded, fmt.Errorf("line %d: %v", startLine, e)
+			}
+
+			if _, e := executor.Execute([]byte(stat)); e != nil {
+				if inBatch > 0 {
+					executor.Execute([]byte("abort"))
+				}
+				return loaded, fmt.Errorf("line %d: %v", startLine, e)
+			}
+			loaded++
+			if inBatch >= batchSize {
+				if e := commit(); e != nil {
+					return loaded, fmt.Errorf("line %d: %v", startLine, e)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := commit(); err != nil {
+		return loaded, fmt.Errorf("line %d: %v", line, err)
+	}
+	return loaded, nil
+}
+
+// readStatement 读取下一条语句，引号外的换行表示语句结束，跳过空行和注释行
+// 返回语句、语句开始的行号以及下一条语句开始的行号
+func readStatement(reader *bufio.Reader, line int) (string, int, int, error) {
+	for {
+		var sb strings.Builder
+		startLine := line
+		var quote byte = 0
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				if quote != 0 {
+					return "", startLine, line, fmt.Errorf("line %d: unterminated string", startLine)
+				}
+				stat := strings.TrimSpace(sb.String())
+				if strings.HasPrefix(stat, CommentPrefix) {
+					stat = ""
+				}
+				return stat, startLine, line, err
+			}
+			if b == '\n' {
+				line++
+				if quote == 0 {
+					break
+				}
+			}
+			if quote == 0 && (b == '\'' || b == '"') {
+				quote = b
+			} else if b == quote {
+				quote = 0
+			}
+			sb.WriteByte(b)
+		}
+		stat := strings.TrimSpace(sb.String())
+		if stat == "" || strings.HasPrefix(stat, CommentPrefix) {
+			continue
+		}
+		return stat, startLine, line, nil
+	}
+}
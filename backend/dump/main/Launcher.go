@@ -0,0 +1,86 @@
+package main
+
+import (
+	"SimpleDB/backend/dump"
+	"SimpleDB/client"
+	"SimpleDB/transport"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+func main() {
+	// 定义命令行参数
+	dumpFlag := flag.String("dump", "", "Dump database at DBPath as a SQL script (the server must be stopped)")
+	outFlag := flag.String("out", "", "Write the dump to this file instead of stdout")
+	loadFlag := flag.String("load", "", "Load a SQL script produced by -dump, \"-\" reads stdin")
+	addrFlag := flag.String("addr", "127.0.0.1:9998", "Server address used by -load")
+	batchFlag := flag.Int("batch", dump.DefaultBatchSize, "Number of inserts committed in one transaction by -load")
+
+	// 解析命令行参数
+	flag.Parse()
+
+	if *dumpFlag != "" {
+		dumpDB(*dumpFlag, *outFlag)
+		return
+	}
+	if *loadFlag != "" {
+		loadScript(*loadFlag, *addrFlag, *batchFlag)
+		return
+	}
+	fmt.Println("Usage: db_dump -dump DBPath [-out File] | -load File [-addr Host:Port] [-batch N]")
+}
+
+// dumpDB 导出数据库
+func dumpDB(path string, out string) {
+	var w io.Writer = os.Stdout
+	if out != "" {
+		file, err := os.OpenFile(out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			fmt.Println("Error creating output file:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := dump.Dump(path, w); err != nil {
+		fmt.Fprintln(os.Stderr, "Dump failed:", err)
+		os.Exit(1)
+	}
+}
+
+// loadScript 连接数据库服务并导入脚本
+func loadScript(script string, addr string, batch int) {
+	var r io.Reader = os.Stdin
+	if script != "-" {
+		file, err := os.Open(script)
+		if err != nil {
+			fmt.Println("Error opening script:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Println("Error connecting to server:", err)
+		os.Exit(1)
+	}
+	packager, err := transport.ClientHandshake(conn, transport.ProtocolBinary)
+	if err != nil {
+		fmt.Println("Error negotiating protocol:", err)
+		os.Exit(1)
+	}
+	cl := client.NewClient(packager)
+	defer cl.Close()
+
+	loaded, err := dump.Load(cl, r, batch)
+	if err != nil {
+		fmt.Println("Load failed:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Loaded %d statements\n", loaded)
+}
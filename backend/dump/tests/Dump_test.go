@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dump"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createDB 创建数据库并执行sqls
+func createDB(t *testing.T, path string, sqls ...string) {
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	for _, sql := range sqls {
+		if _, err := executor.Execute([]byte(sql)); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	dataManager.Close()
+	transactionManager.Close()
+}
+
+// dumpWithoutHeader 导出数据库，去掉包含xid和时间的第一行
+func dumpWithoutHeader(t *testing.T, path string) string {
+	var buf bytes.Buffer
+	if err := dump.Dump(path, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()[strings.Index(buf.String(), "\n")+1:]
+}
+
+func TestDumpAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "src")
+	createDB(t, path,
+		"create table student id int32, name string, age int64, (index id name)",
+		"create table course cid int64, title string, (index cid)",
+		"insert into student values 1 alice 20",
+		"insert into student values 2 \"o'brien\" 21",
+		"insert into student values 3 'say \"hi\"' 22",
+		"insert into course values 10 'data base'",
+		"insert into course values 11 'multi\nline'",
+		"delete from student where id = 1",
+	)
+
+	script := dumpWithoutHeader(t, path)
+	t.Log(script)
+	for _, want := range []string{
+		"create table course cid int64, title string, (index cid)",
+		"create table student id int32, name string, age int64, (index id name)",
+		"insert into student values 2 \"o'brien\" 21",
+		"insert into student values 3 'say \"hi\"' 22",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("dump does not contain %q", want)
+		}
+	}
+	if strings.Contains(script, "alice") {
+		t.Errorf("dump contains deleted row")
+	}
+
+	target := filepath.Join(dir, "dst")
+	createDB(t, target)
+	transactionManager, _ := tm.OpenTransactionManagerImpl(target)
+	dataManager := dm.OpenDataManager(target, 64<<20, transactionManager)
+	tableManager := tbm.OpenTableManager(target, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	loaded, err := dump.Load(server.NewExecutor(tableManager), strings.NewReader(script), 2)
+	dataManager.Close()
+	transactionManager.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 6 {
+		t.Errorf("expected 6 statements loaded, got %d", loaded)
+	}
+
+	if reloaded := dumpWithoutHeader(t, target); reloaded != script {
+		t.Errorf("dump after load differs:\n%s", reloaded)
+	}
+}
+
+// TestDumpQuotes 空字符串和同时包含两种引号的字符串可以导出并重新导入
+func TestDumpQuotes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "src")
+	createDB(t, path,
+		"create table note id int32, body string, (index id)",
+		"insert into note values 1 ''",
+		`insert into note values 2 'it''s "quoted"'`,
+	)
+	script := dumpWithoutHeader(t, path)
+	for _, want := range []string{"insert into note values 1 ''\n", `insert into note values 2 'it''s "quoted"'` + "\n"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("dump does not contain %q:\n%s", want, script)
+		}
+	}
+
+	target := filepath.Join(dir, "dst")
+	createDB(t, target)
+	transactionManager, _ := tm.OpenTransactionManagerImpl(target)
+	dataManager := dm.OpenDataManager(target, 64<<20, transactionManager)
+	tableManager := tbm.OpenTableManager(target, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	_, err := dump.Load(server.NewExecutor(tableManager), strings.NewReader(script), 10)
+	dataManager.Close()
+	transactionManager.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded := dumpWithoutHeader(t, target); reloaded != script {
+		t.Errorf("dump after load differs:\n%s", reloaded)
+	}
+}
+
+func TestLoadReportsLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	createDB(t, path)
+	transactionManager, _ := tm.OpenTransactionManagerImpl(path)
+	dataManager := dm.OpenDataManager(path, 64<<20, transactionManager)
+	defer transactionManager.Close()
+	defer dataManager.Close()
+	tableManager := tbm.OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+
+	script := "-- comment\ncreate table t id int32, (index id)\n\ninsert into t values 1\ninsert into missing values 2\n"
+	_, err := dump.Load(server.NewExecutor(tableManager), strings.NewReader(script), 10)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5:") {
+		t.Errorf("expected error at line 5, got %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package fsck
+
+import (
+	"SimpleDB/backend/im"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// field 从记录中解析出的字段
+type field struct {
+	name      string
+	fieldType string
+	index     int64
+}
+
+// parseString 带边界检查地解析 [StringLength][StringData]
+func parseString(raw []byte) (string, int, error) {
+	if len(raw) < 4 {
+		return "", 0, errors.New("string length out of range")
+	}
+	length := int(binary.BigEndian.Uint32(raw[:4]))
+	if length > len(raw)-4 {
+		return "", 0, errors.New("string data out of range")
+	}
+	return string(raw[4 : 4+length]), 4 + length, nil
+}
+
+// entryData 获取uid处记录的数据部分，并检查XMIN是否合法
+func (c *checker) entryData(check string, uid int64) ([]byte, error) {
+	data, ok := c.items[uid]
+	if !ok {
+		return nil, errors.New("entry does not point to a valid data item")
+	}
+	if len(data) < vm.EntryOffsetData {
+		return nil, fmt.Errorf("entry is shorter than its header: %d bytes", len(data))
+	}
+	xmin := int64(binary.BigEndian.Uint64(data[vm.EntryOffsetXMIN:vm.EntryOffsetXMAX]))
+	xmax := int64(binary.BigEndian.Uint64(data[vm.EntryOffsetXMAX:vm.EntryOffsetData]))
+	if c.xids != nil {
+		if xmin > c.xids.Counter() {
+			return nil, fmt.Errorf("xmin %d is beyond the xid counter %d", xmin, c.xids.Counter())
+		}
+		if xmax > c.xids.Counter() {
+			return nil, fmt.Errorf("xmax %d is beyond the xid counter %d", xmax, c.xids.Counter())
+		}
+		if xmin != tm.SuperXid && c.xids.Status(xmin) == tm.FieldTranAborted {
+			c.report.warnf(check, location(uid), "entry was created by aborted transaction %d", xmin)
+		}
+	}
+	return data[vm.EntryOffsetData:], nil
+}
+
+// checkCatalog 从Booter开始检查表链、字段以及索引
+func (c *checker) checkCatalog() {
+	raw, err := os.ReadFile(c.path + tbm.BooterSuffix)
+	if err != nil {
+		c.report.errorf("catalog", "", "read booter file: %v", err)
+		return
+	}
+	if len(raw) != 8 {
+		c.report.errorf("catalog", "", "booter file should have 8 bytes, got %d", len(raw))
+		return
+	}
+	if c.pages == nil {
+		return
+	}
+
+	names := make(map[string]bool)
+	visited := make(map[int64]bool)
+	uid := int64(binary.BigEndian.Uint64(raw))
+	for uid != 0 {
+		if visited[uid] {
+			c.report.errorf("catalog", location(uid), "table chain has a cycle")
+			return
+		}
+		visited[uid] = true
+		data, err := c.entryData("catalog", uid)
+		if err != nil {
+			c.report.errorf("catalog", location(uid), "table: %v", err)
+			return
+		}
+		name, pos, err := parseString(data)
+		if err != nil || len(data)-pos < 8 || (len(data)-pos-8)%8 != 0 {
+			c.report.errorf("catalog", location(uid), "malformed table record")
+			return
+		}
+		next := int64(binary.BigEndian.Uint64(data[pos : pos+8]))
+		if c.uncommittedTable(data[pos+8:]) {
+			c.report.warnf("catalog", location(uid), "table %s was created by a transaction that did not commit, it is skipped on open", name)
+			uid = next
+			continue
+		}
+		c.report.Stats.Tables++
+		if names[name] {
+			c.report.errorf("catalog", location(uid), "duplicated table %s", name)
+		}
+		names[name] = true
+
+		fields := make([]*field, 0)
+		for pos += 8; pos < len(data); pos += 8 {
+			fieldUid := int64(binary.BigEndian.Uint64(data[pos : pos+8]))
+			f, err := c.parseField(fieldUid)
+			if err != nil {
+				c.report.errorf("catalog", location(fieldUid), "table %s field: %v", name, err)
+				continue
+			}
+			fields = append(fields, f)
+		}
+		for i, f := range fields {
+			if f.index != 0 {
+				c.checkIndex(name, fields, i)
+			}
+		}
+		uid = next
+	}
+}
+
+// uncommittedTable 判断表是否由没有提交的事务创建，fields为表记录中的字段uid
+// 表记录由SuperXid写入，字段与建表的事务一起写入，事务没有提交时第一个字段在恢复时被撤销或者由没有提交的事务创建
+func (c *checker) uncommittedTable(fields []byte) bool {
+	if len(fields) < 8 {
+		return false
+	}
+	data, ok := c.items[int64(binary.BigEndian.Uint64(fields[:8]))]
+	if !ok {
+		return true
+	}
+	if c.xids == nil || len(data) < vm.EntryOffsetData {
+		return false
+	}
+	xmin := int64(binary.BigEndian.Uint64(data[vm.EntryOffsetXMIN:vm.EntryOffsetXMAX]))
+	return xmin != tm.SuperXid && xmin <= c.xids.Counter() && c.xids.Status(xmin) != tm.FieldTranCommitted
+}
+
+// parseField 解析字段记录 [FieldName][TypeName][IndexUid]
+func (c *checker) parseField(uid int64) (*field, error) {
+	data, err := c.entryData("catalog", uid)
+	if err != nil {
+		return nil, err
+	}
+	name, pos, err := parseString(data)
+	if err != nil {
+		return nil, err
+	}
+	fieldType, shift, err := parseString(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += shift
+	if len(data)-pos != 8 {
+		return nil, errors.New("malformed field record")
+	}
+	if fieldType != "int32" && fieldType != "int64" && fieldType != "string" {
+		return nil, fmt.Errorf("invalid field type %q", fieldType)
+	}
+	c.report.Stats.Fields++
+	return &field{
+		name:      name,
+		fieldType: fieldType,
+		index:     int64(binary.BigEndian.Uint64(data[pos : pos+8])),
+	}, nil
+}
+
+// fieldKey 解析记录中第kth个字段的值，并按照索引的规则转换为key
+func fieldKey(fields []*field, kth int, data []byte) (int64, error) {
+	pos := 0
+	for i, f := range fields {
+		var key int64
+		shift := 0
+		switch f.fieldType {
+		case "string":
+			str, n, err := parseString(data[pos:])
+			if err != nil {
+				return 0, err
+			}
+			key, shift = commons.Str2Uid(str), n
+		case "int32":
+			if len(data)-pos < 4 {
+				return 0, errors.New("int32 value out of range")
+			}
+			key, shift = int64(int32(binary.BigEndian.Uint32(data[pos:pos+4]))), 4
+		case "int64":
+			if len(data)-pos < 8 {
+				return 0, errors.New("int64 value out of range")
+			}
+			key, shift = int64(binary.BigEndian.Uint64(data[pos:pos+8])), 8
+		}
+		if i == kth {
+			return key, nil
+		}
+		pos += shift
+	}
+	return 0, errors.New("field out of range")
+}
+
+// checkIndex 检查表table中第kth个字段的B+树索引
+// 节点分裂后父节点中的key只是查找的起点，查找时会沿兄弟指针向右移动，
+// 因此这里不要求子树的key落在父节点的区间内，而是检查每一项都能通过与BPlusTree相同的查找过程找到
+func (c *checker) checkIndex(table string, fields []*field, kth int) {
+	f := fields[kth]
+	name := table + "." + f.name
+	c.report.Stats.Indexes++
+	boot, ok := c.items[f.index]
+	if !ok || len(boot) != 8 {
+		c.report.errorf("index", location(f.index), "index %s: boot item is missing or malformed", name)
+		return
+	}
+	root := int64(binary.BigEndian.Uint64(boot))
+	errorCount := len(c.report.Errors)
+
+	levels := make(map[int][]int64)
+	leafDepth := -1
+	visited := make(map[int64]bool)
+
+	var walk func(uid int64, depth int)
+	walk = func(uid int64, depth int) {
+		if visited[uid] {
+			c.report.errorf("index", location(uid), "index %s: node is referenced more than once", name)
+			return
+		}
+		visited[uid] = true
+		raw, ok := c.items[uid]
+		if !ok || len(raw) != im.NodeSize {
+			c.report.errorf("index", location(uid), "index %s: node is missing or has a wrong size", name)
+			return
+		}
+		c.report.Stats.IndexNodes++
+		levels[depth] = append(levels[depth], uid)
+
+		numberKeys := im.GetRawNumberKeys(raw)
+		if numberKeys > im.BalanceNumber*2 {
+			c.report.errorf("index", location(uid), "index %s: node has too many keys: %d", name, numberKeys)
+			return
+		}
+		isLeaf := im.GetRawIsLeaf(raw)
+		if isLeaf {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				c.report.errorf("index", location(uid), "index %s: leaf at depth %d, expected %d", name, depth, leafDepth)
+			}
+		}
+
+		for i := 0; i < numberKeys; i++ {
+			key := im.GetRawKthKey(raw, i)
+			if i > 0 && key < im.GetRawKthKey(raw, i-1) {
+				c.report.errorf("index", location(uid), "index %s: key %d at %d is out of order", name, key, i)
+			}
+			son := im.GetRawKthSon(raw, i)
+			if isLeaf {
+				c.checkIndexEntry(name, fields, kth, key, son)
+			} else {
+				walk(son, depth+1)
+			}
+		}
+	}
+	walk(root, 0)
+
+	// 同一层的节点从最左边的节点开始通过兄弟指针连接，每个节点恰好出现一次，最右边节点的兄弟为0
+	// 叶子插入时可能转移到兄弟节点，分裂后父节点中儿子的顺序不一定与兄弟指针的顺序相同
+	chains := make(map[int][]int64)
+	for depth := 0; depth < len(levels); depth++ {
+		nodes := make(map[int64]bool)
+		for _, uid := range levels[depth] {
+			nodes[uid] = true
+		}
+		for uid := levels[depth][0]; uid != 0; uid = im.GetRawSibling(c.items[uid]) {
+			if !nodes[uid] {
+				c.report.errorf("index", location(uid), "index %s: sibling chain at depth %d reaches an unexpected or repeated node", name, depth)
+				break
+			}
+			delete(nodes, uid)
+			chains[depth] = append(chains[depth], uid)
+		}
+		for uid := range nodes {
+			c.report.errorf("index", location(uid), "index %s: node is not reachable through the sibling chain at depth %d", name, depth)
+		}
+	}
+	if len(c.report.Errors) != errorCount || leafDepth == -1 {
+		return
+	}
+
+	// 叶子链上的key整体有序，并且每一项都能被查找到
+	var previous int64 = math.MinInt64
+	for _, leaf := range chains[leafDepth] {
+		raw := c.items[leaf]
+		for i := 0; i < im.GetRawNumberKeys(raw); i++ {
+			key := im.GetRawKthKey(raw, i)
+			if key < previous {
+				c.report.errorf("index", location(leaf), "index %s: key %d is smaller than the key %d in a previous leaf", name, key, previous)
+			} else if !c.searchIndex(root, key, im.GetRawKthSon(raw, i)) {
+				c.report.errorf("index", location(leaf), "index %s: key %d can not be found from the root", name, key)
+			}
+			previous = key
+		}
+	}
+}
+
+// searchIndex 按照BPlusTree.SearchRange(key, key)的过程查找key，判断结果中是否包含uid
+// 调用前树的结构已经检查过，所有节点都存在且兄弟指针无环
+func (c *checker) searchIndex(root int64, key int64, uid int64) bool {
+	nodeUid := root
+	for !im.GetRawIsLeaf(c.items[nodeUid]) {
+		raw := c.items[nodeUid]
+		next := int64(0)
+		for i := 0; i < im.GetRawNumberKeys(raw); i++ {
+			if im.GetRawKthKey(raw, i) > key {
+				next = im.GetRawKthSon(raw, i)
+				break
+			}
+		}
+		if next == 0 {
+			next = im.GetRawSibling(raw)
+			if next == 0 {
+				return false
+			}
+		}
+		nodeUid = next
+	}
+	for nodeUid != 0 {
+		raw := c.items[nodeUid]
+		numberKeys := im.GetRawNumberKeys(raw)
+		i := 0
+		for ; i < numberKeys; i++ {
+			ik := im.GetRawKthKey(raw, i)
+			if ik > key {
+				return false
+			}
+			if ik == key && im.GetRawKthSon(raw, i) == uid {
+				return true
+			}
+		}
+		nodeUid = im.GetRawSibling(raw)
+	}
+	return false
+}
+
+// checkIndexEntry 检查叶子中的一项，uid必须指向合法的记录，并且记录中字段的值与key一致
+func (c *checker) checkIndexEntry(name string, fields []*field, kth int, key int64, uid int64) {
+	c.report.Stats.IndexEntries++
+	data, err := c.entryData("index", uid)
+	if err != nil {
+		c.report.errorf("index", location(uid), "index %s key %d: %v", name, key, err)
+		return
+	}
+	value, err := fieldKey(fields, kth, data)
+	if err != nil {
+		c.report.errorf("index", location(uid), "index %s key %d: malformed entry: %v", name, key, err)
+		return
+	}
+	if value != key {
+		c.report.errorf("index", location(uid), "index %s: key %d does not match the entry value %d", name, key, value)
+	}
+}
@@ -0,0 +1,183 @@
+package fsck
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/constants"
+	"SimpleDB/backend/dm/dmPage"
+	"SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/utils"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+/**
+ * 离线一致性检查，只读方式打开 .xid、日志段、.db、.bt 文件并交叉校验：
+ * 1. xid文件头中的计数器、冻结事务与文件长度一致，事务状态合法
+ * 2. 日志段编号连续，校验和一致，日志记录可以解析
+ * 3. PageOne 的校验位，PageX 的空闲位置偏移，数据项的 ValidFlag/DataSize
+ * 4. 从 Booter 开始的表链，表和字段的结构
+ * 5. 每个索引 B+ 树的结构（key 有序、兄弟指针、叶子深度一致），以及叶子中的 UID 指向合法的记录
+ */
+
+// checker 检查过程中的状态
+type checker struct {
+	path   string
+	report *Report
+
+	// xids 所有事务的状态
+	xids *tm.XidState
+	// pages 第i个元素为第i+1页的数据
+	pages [][]byte
+	// items 所有合法数据项的数据部分，键为UID
+	items map[int64][]byte
+}
+
+// Check 检查path处的数据库文件，不会修改任何文件
+func Check(path string) *Report {
+	c := &checker{
+		path:   path,
+		report: newReport(path),
+		items:  make(map[int64][]byte),
+	}
+	c.checkXid()
+	c.checkLog()
+	c.checkPages()
+	c.checkCatalog()
+	c.report.OK = len(c.report.Errors) == 0
+	return c.report
+}
+
+// location 生成数据项的位置描述
+func location(uid int64) string {
+	return fmt.Sprintf("uid %d (page %d, offset %d)", uid, uid>>32, uid&((1<<16)-1))
+}
+
+// checkXid 检查xid文件
+func (c *checker) checkXid() {
+	data, err := os.ReadFile(c.path + tm.XidSuffix)
+	if err != nil {
+		c.report.errorf("xid", "", "read xid file: %v", err)
+		return
+	}
+	state, err := tm.ParseXidState(data)
+	if err != nil {
+		c.report.errorf("xid", "", "%v", err)
+		return
+	}
+	c.report.Stats.XidCounter = state.Counter()
+	c.report.Stats.FrozenXid = state.Frozen()
+	if err = state.Validate(); err != nil {
+		c.report.errorf("xid", "", "%v", err)
+		return
+	}
+	if int64(len(data)) != state.FileLength() {
+		c.report.warnf("xid", "", "xid file has %d bytes, expected %d, it will be rewritten on open", len(data), state.FileLength())
+	}
+	c.xids = state
+}
+
+// checkLog 检查所有日志段
+func (c *checker) checkLog() {
+	infos, err := logger.ReadSegments(c.path, func(record *logger.Record) error {
+		c.report.Stats.LogRecords++
+		where := fmt.Sprintf("segment %d, offset %d", record.Segment, record.Offset)
+		logRecord, err := dm.ParseLogRecord(record.Data)
+		if err != nil {
+			c.report.errorf("log", where, "%v", err)
+			return nil
+		}
+		if c.xids != nil && logRecord.Xid > c.xids.Counter() {
+			c.report.warnf("log", where, "xid %d is beyond the xid counter %d", logRecord.Xid, c.xids.Counter())
+		}
+		return nil
+	})
+	if err != nil {
+		c.report.errorf("log", "", "read log: %v", err)
+	}
+	c.report.Stats.LogSegments = len(infos)
+
+	for i, info := range infos {
+		where := fmt.Sprintf("segment %d", info.Segment)
+		if i > 0 && info.Segment != infos[i-1].Segment+1 {
+			c.report.errorf("log", where, "segment %d is missing", infos[i-1].Segment+1)
+		}
+		active := i == len(infos)-1
+		if !info.CheckSumMatched() {
+			c.report.errorf("log", where, "checksum mismatch: header %d, computed %d", info.CheckSum, info.Computed)
+		}
+		if info.BadTail() > 0 {
+			if active {
+				c.report.warnf("log", where, "%d bytes of bad tail will be truncated on open", info.BadTail())
+			} else {
+				c.report.errorf("log", where, "closed segment has %d bytes of bad tail", info.BadTail())
+			}
+		}
+	}
+}
+
+// checkPages 检查数据文件中的所有页面以及页面中的数据项
+func (c *checker) checkPages() {
+	data, err := os.ReadFile(c.path + dmPage.DB_SUFFIX)
+	if err != nil {
+		c.report.errorf("page", "", "read db file: %v", err)
+		return
+	}
+	if len(data)%constants.PageSize != 0 {
+		c.report.errorf("page", "", "db file size %d is not a multiple of the page size %d", len(data), constants.PageSize)
+	}
+	for offset := 0; offset+constants.PageSize <= len(data); offset += constants.PageSize {
+		c.pages = append(c.pages, data[offset:offset+constants.PageSize])
+	}
+	c.report.Stats.Pages = len(c.pages)
+	if len(c.pages) == 0 {
+		c.report.errorf("page", "", "db file has no page")
+		return
+	}
+
+	c.report.Stats.CleanShutdown = dmPage.CheckPageOneDataValid(c.pages[0])
+	if !c.report.Stats.CleanShutdown {
+		c.report.warnf("page", "page 1", "database was not shut down cleanly, recovery will run on open")
+	}
+
+	for i := 1; i < len(c.pages); i++ {
+		c.checkPageX(i+1, c.pages[i])
+	}
+}
+
+// checkPageX 检查普通页面，页面内的数据项从头开始依次排列到空闲位置为止
+func (c *checker) checkPageX(pageNumber int, page []byte) {
+	where := fmt.Sprintf("page %d", pageNumber)
+	freeSpaceOffset := int(binary.BigEndian.Uint16(page[dmPage.PageXOffsetFreeSpace:dmPage.PageXOffsetDataSize]))
+	if freeSpaceOffset < int(dmPage.PageXOffsetDataSize) || freeSpaceOffset > constants.PageSize {
+		c.report.errorf("page", where, "invalid free space offset %d", freeSpaceOffset)
+		return
+	}
+
+	position := int(dmPage.PageXOffsetDataSize)
+	for position < freeSpaceOffset {
+		uid := utils.GenerateUID(pageNumber, position)
+		if position+dm.DataItemOffsetData > freeSpaceOffset {
+			c.report.errorf("page", location(uid), "data item header crosses the free space offset %d", freeSpaceOffset)
+			return
+		}
+		validFlag := page[position+dm.DataItemOffsetValid]
+		size := int(binary.BigEndian.Uint16(page[position+dm.DataItemOffsetDataSize : position+dm.DataItemOffsetData]))
+		end := position + dm.DataItemOffsetData + size
+		if end > freeSpaceOffset {
+			c.report.errorf("page", location(uid), "data size %d crosses the free space offset %d", size, freeSpaceOffset)
+			return
+		}
+		switch validFlag {
+		case 0:
+			c.items[uid] = page[position+dm.DataItemOffsetData : end]
+			c.report.Stats.DataItems++
+		case 1:
+			c.report.Stats.InvalidItems++
+		default:
+			c.report.errorf("page", location(uid), "invalid valid flag %d", validFlag)
+		}
+		position = end
+	}
+}
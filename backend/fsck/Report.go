@@ -0,0 +1,69 @@
+package fsck
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Issue 检查中发现的一个问题
+type Issue struct {
+	// Check 发现问题的检查项，如 xid、log、page、catalog、index
+	Check string `json:"check"`
+	// Location 问题所在的位置，如段编号、页号、UID
+	Location string `json:"location,omitempty"`
+	// Message 问题描述
+	Message string `json:"message"`
+}
+
+// Stats 检查过程中的统计信息
+type Stats struct {
+	XidCounter    int64 `json:"xidCounter"`
+	FrozenXid     int64 `json:"frozenXid"`
+	LogSegments   int   `json:"logSegments"`
+	LogRecords    int   `json:"logRecords"`
+	Pages         int   `json:"pages"`
+	DataItems     int   `json:"dataItems"`
+	InvalidItems  int   `json:"invalidItems"`
+	Tables        int   `json:"tables"`
+	Fields        int   `json:"fields"`
+	Indexes       int   `json:"indexes"`
+	IndexNodes    int   `json:"indexNodes"`
+	IndexEntries  int   `json:"indexEntries"`
+	CleanShutdown bool  `json:"cleanShutdown"`
+}
+
+// Report 检查报告，Errors为空时表示检查通过，Warnings不影响数据库的打开
+type Report struct {
+	Path     string   `json:"path"`
+	OK       bool     `json:"ok"`
+	Errors   []*Issue `json:"errors"`
+	Warnings []*Issue `json:"warnings"`
+	Stats    Stats    `json:"stats"`
+}
+
+func newReport(path string) *Report {
+	return &Report{
+		Path:     path,
+		Errors:   make([]*Issue, 0),
+		Warnings: make([]*Issue, 0),
+	}
+}
+
+// errorf 记录一个错误
+func (report *Report) errorf(check string, location string, format string, args ...interface{}) {
+	report.Errors = append(report.Errors, &Issue{Check: check, Location: location, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnf 记录一个警告
+func (report *Report) warnf(check string, location string, format string, args ...interface{}) {
+	report.Warnings = append(report.Warnings, &Issue{Check: check, Location: location, Message: fmt.Sprintf(format, args...)})
+}
+
+// JSON 以JSON格式输出报告
+func (report *Report) JSON() []byte {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
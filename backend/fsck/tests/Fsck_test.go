@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/constants"
+	"SimpleDB/backend/dm/dmPage"
+	"SimpleDB/backend/fsck"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createDatabase 创建数据库并插入数据后正常关闭
+func createDatabase(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	sqls := []string{"create table student id int32, name string, (index id name)"}
+	for i := 0; i < 200; i++ {
+		sqls = append(sqls, fmt.Sprintf("insert into student values %d name%d", i, i))
+	}
+	sqls = append(sqls, "delete from student where id < 10")
+	for _, sql := range sqls {
+		if _, err := executor.Execute([]byte(sql)); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	dataManager.Close()
+	transactionManager.Close()
+	return path
+}
+
+func TestCheckClean(t *testing.T) {
+	path := createDatabase(t)
+	report := fsck.Check(path)
+	if !report.OK || len(report.Warnings) != 0 {
+		t.Fatalf("unexpected report: %s", report.JSON())
+	}
+	if !report.Stats.CleanShutdown || report.Stats.Tables != 1 || report.Stats.Indexes != 2 {
+		t.Fatalf("unexpected stats: %s", report.JSON())
+	}
+	// 每个索引都包含全部200条记录
+	if report.Stats.IndexEntries != 400 {
+		t.Fatalf("expected 400 index entries, got %d", report.Stats.IndexEntries)
+	}
+}
+
+func TestCheckCorruptedPage(t *testing.T) {
+	path := createDatabase(t)
+	file, err := os.OpenFile(path+dmPage.DB_SUFFIX, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 将第二页的空闲位置偏移改为超出页面大小
+	offset := make([]byte, 2)
+	binary.BigEndian.PutUint16(offset, uint16(constants.PageSize+1))
+	if _, err = file.WriteAt(offset, int64(constants.PageSize)); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	report := fsck.Check(path)
+	if report.OK {
+		t.Fatalf("corruption is not detected: %s", report.JSON())
+	}
+	found := false
+	for _, issue := range report.Errors {
+		if issue.Check == "page" && issue.Location == "page 2" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("missing page error: %s", report.JSON())
+	}
+}
@@ -143,6 +143,69 @@ func (bTree *BPlusTree) SearchRange(leftKey int64, rightKey int64) ([]int64, err
 
 }
 
+// RangeIterator 按照key的顺序逐批读取一个范围内的uid，不会一次读取整个范围
+// 每一批都从上一批最后的key重新查找叶子节点，因此两批之间B+树可以被修改；
+// 与最后的key相同的uid中已经返回过的会被跳过，之后插入的key是否返回取决于它的位置
+type RangeIterator struct {
+	bTree    *BPlusTree
+	rightKey int64
+	// next 下一批开始查找的key
+	next int64
+	// seen 上一批最后的key对应的、已经返回过的uid
+	seen map[int64]struct{}
+	done bool
+}
+
+// Iterate 创建读取[leftKey, rightKey]范围的迭代器
+func (bTree *BPlusTree) Iterate(leftKey int64, rightKey int64) *RangeIterator {
+	return &RangeIterator{bTree: bTree, rightKey: rightKey, next: leftKey, seen: make(map[int64]struct{}), done: leftKey > rightKey}
+}
+
+// Next 读取下一批最多limit个uid，范围已经读完时返回空
+func (iterator *RangeIterator) Next(limit int) ([]int64, error) {
+	uids := make([]int64, 0, limit)
+	if iterator.done {
+		return uids, nil
+	}
+	leafUid, err := iterator.bTree.searchLeaf(iterator.bTree.rootUid(), iterator.next)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		leaf, err := LoadNode(iterator.bTree, leafUid)
+		if err != nil {
+			return nil, err
+		}
+		result := leaf.LeafSearchRange(iterator.next, iterator.rightKey)
+		leaf.Release()
+		for i, uid := range result.Uids {
+			key := result.Keys[i]
+			if key != iterator.next {
+				iterator.next = key
+				iterator.seen = make(map[int64]struct{})
+			}
+			if _, ok := iterator.seen[uid]; ok {
+				continue
+			}
+			iterator.seen[uid] = struct{}{}
+			uids = append(uids, uid)
+			if len(uids) == limit {
+				return uids, nil
+			}
+		}
+		if result.SiblingUid == 0 {
+			iterator.done = true
+			return uids, nil
+		}
+		leafUid = result.SiblingUid
+	}
+}
+
+// Done 判断范围是否已经读完
+func (iterator *RangeIterator) Done() bool {
+	return iterator.done
+}
+
 // Insert 向B+树中插入一个键值对
 func (bTree *BPlusTree) Insert(key int64, uid int64) error {
 	rootUid := bTree.rootUid()
@@ -221,6 +284,27 @@ func (bTree *BPlusTree) insertAndSplit(nodeUid int64, uid int64, key int64) (*In
 	}
 }
 
+// Remove 从B+树中删除键值对 (key, uid)，返回是否找到并删除
+func (bTree *BPlusTree) Remove(key int64, uid int64) (bool, error) {
+	leafUid, err := bTree.searchLeaf(bTree.rootUid(), key)
+	if err != nil {
+		return false, err
+	}
+	for leafUid != 0 {
+		leaf, err := LoadNode(bTree, leafUid)
+		if err != nil {
+			return false, err
+		}
+		result := leaf.LeafRemove(uid, key)
+		leaf.Release()
+		if result.Removed {
+			return true, nil
+		}
+		leafUid = result.SiblingUid
+	}
+	return false, nil
+}
+
 func (bTree *BPlusTree) Close() {
 	bTree.BootDataItem.Release()
 }
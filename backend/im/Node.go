@@ -116,6 +116,12 @@ func ShiftRawKth(raw []byte, kth int) {
 	}
 }
 
+// UnShiftRawKth 将一个节点的原始字节数组中第kth个之后的节点整体向前移动，覆盖第kth个节点
+func UnShiftRawKth(raw []byte, kth int) {
+	begin := NodeHeaderSize + kth*(8*2)
+	copy(raw[begin:], raw[begin+8*2:])
+}
+
 // NewRootRaw 创建一个新的根节点的原始字节数组
 // 这个新的根节点包含两个子节点，它们的键分别是key和MaxInt64，UID分别是left和right
 func NewRootRaw(left int64, right int64, key int64) []byte {
@@ -223,7 +229,9 @@ func (node *Node) SearchNext(key int64) *SearchNextResult {
 // ============ 用于在B+树中根据key搜索节点 =================
 
 type LeafSearchRangeResult struct {
-	Uids       []int64
+	Uids []int64
+	// Keys 与Uids一一对应的key
+	Keys       []int64
 	SiblingUid int64
 }
 
@@ -247,6 +255,7 @@ func (node *Node) LeafSearchRange(leftKey int64, rightKey int64) *LeafSearchRang
 
 	// 创建一个列表，用于存储所有在键值范围内的子节点的UID
 	uids := make([]int64, 0)
+	keys := make([]int64, 0)
 	// 遍历所有的键，将所有小于或等于右键的键对应的子节点的UID添加到列表中
 	for kth < numberKeys {
 		ik := GetRawKthKey(node.Raw, kth)
@@ -254,6 +263,7 @@ func (node *Node) LeafSearchRange(leftKey int64, rightKey int64) *LeafSearchRang
 			break
 		}
 		uids = append(uids, GetRawKthSon(node.Raw, kth))
+		keys = append(keys, ik)
 		kth++
 	}
 	// 如果所有的键都被遍历过，获取兄弟节点的UID
@@ -264,6 +274,7 @@ func (node *Node) LeafSearchRange(leftKey int64, rightKey int64) *LeafSearchRang
 	// 创建一个LeafSearchRangeRes对象，用于存储搜索结果
 	result := &LeafSearchRangeResult{
 		Uids:       uids,
+		Keys:       keys,
 		SiblingUid: siblingUid,
 	}
 
@@ -367,6 +378,39 @@ func (node *Node) insert(uid int64, key int64) bool {
 	return true
 }
 
+// ============ 用于在B+树的叶子节点中删除一个键值对 =================
+
+type LeafRemoveResult struct {
+	Removed    bool
+	SiblingUid int64
+}
+
+// LeafRemove 在叶子节点中删除键值对 (key, uid)，节点中没有且后面的key都不大于key时返回兄弟节点
+// 删除后不合并节点，查找和插入时都会沿兄弟指针继续，空的叶子节点不影响B+树的结构
+func (node *Node) LeafRemove(uid int64, key int64) *LeafRemoveResult {
+	node.DataItem.Before()
+
+	result := &LeafRemoveResult{}
+	numberKeys := GetRawNumberKeys(node.Raw)
+	for kth := 0; kth < numberKeys; kth++ {
+		ik := GetRawKthKey(node.Raw, kth)
+		if ik > key {
+			node.DataItem.UnBefore()
+			return result
+		}
+		if ik == key && GetRawKthSon(node.Raw, kth) == uid {
+			UnShiftRawKth(node.Raw, kth)
+			SetRawNumberKeys(node.Raw, numberKeys-1)
+			node.DataItem.After(tm.SuperXid)
+			result.Removed = true
+			return result
+		}
+	}
+	result.SiblingUid = GetRawSibling(node.Raw)
+	node.DataItem.UnBefore()
+	return result
+}
+
 type SplitResult struct {
 	newSon int64
 	newKey int64
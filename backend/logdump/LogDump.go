@@ -0,0 +1,150 @@
+package logdump
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+/**
+ * 以可读的方式输出日志中的每一条记录：
+ * [段编号:偏移] 类型 xid 页号/页内偏移或UID 以及新旧数据项的字节
+ * 每个段结束后输出段的校验和与损坏的尾部，不会修改任何日志文件
+ */
+
+// typeNames 日志类型的名称
+var typeNames = map[byte]string{
+	dm.LogTypeInsert: "insert",
+	dm.LogTypeUpdate: "update",
+	dm.LogTypeCommit: "commit",
+}
+
+// Filter 过滤条件，零值表示不过滤
+type Filter struct {
+	// Xid 只输出该事务的日志，小于0时不过滤
+	Xid int64
+	// Page 只输出该页面的插入和更新日志，0表示不过滤
+	Page int
+	// Type 只输出该类型的日志，如 insert、update、commit，空字符串表示不过滤
+	Type string
+}
+
+// NewFilter 创建不过滤任何日志的过滤条件
+func NewFilter() *Filter {
+	return &Filter{Xid: -1}
+}
+
+// ParseType 检查类型名称是否合法
+func ParseType(name string) (string, error) {
+	name = strings.ToLower(name)
+	for _, typeName := range typeNames {
+		if typeName == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log type %q, expected insert, update or commit", name)
+}
+
+// match 判断日志是否满足过滤条件
+func (filter *Filter) match(record *dm.LogRecord) bool {
+	if filter.Xid >= 0 && record.Xid != filter.Xid {
+		return false
+	}
+	if filter.Page != 0 && (record.Type == dm.LogTypeCommit || record.PageNumber != filter.Page) {
+		return false
+	}
+	if filter.Type != "" && typeNames[record.Type] != filter.Type {
+		return false
+	}
+	return true
+}
+
+// Summary 输出结束后的统计信息
+type Summary struct {
+	// Records 所有段中合法日志的数量
+	Records int
+	// Matched 满足过滤条件的日志数量
+	Matched int
+	// Segments 每个段的信息
+	Segments []*logger.SegmentInfo
+	// Corrupted 是否存在校验和不一致、无法解析的日志或者已关闭的段存在损坏的尾部
+	Corrupted bool
+}
+
+// Dump 将path对应的日志按照filter过滤后输出到w
+func Dump(path string, filter *Filter, w io.Writer) (*Summary, error) {
+	if filter == nil {
+		filter = NewFilter()
+	}
+	summary := &Summary{}
+	segment := -1
+	infos, err := logger.ReadSegments(path, func(record *logger.Record) error {
+		if record.Segment != segment {
+			segment = record.Segment
+			fmt.Fprintf(w, "-- segment %d\n", segment)
+		}
+		summary.Records++
+		logRecord, err := dm.ParseLogRecord(record.Data)
+		if err != nil {
+			summary.Corrupted = true
+			_, err = fmt.Fprintf(w, "[%d:%d] BAD record %v checksum=%d data=%s\n", record.Segment, record.Offset, err, record.CheckSum, hex.EncodeToString(record.Data))
+			return err
+		}
+		if !filter.match(logRecord) {
+			return nil
+		}
+		summary.Matched++
+		_, err = fmt.Fprintf(w, "[%d:%d] %s checksum=%d\n", record.Segment, record.Offset, format(logRecord), record.CheckSum)
+		return err
+	})
+	summary.Segments = infos
+	if err != nil {
+		return summary, err
+	}
+	if len(infos) == 0 {
+		return summary, errors.New("no log segment found")
+	}
+
+	for i, info := range infos {
+		status := "ok"
+		if !info.CheckSumMatched() {
+			status = "MISMATCH"
+			summary.Corrupted = true
+		}
+		fmt.Fprintf(w, "-- segment %d (%s): %d records, %d bytes, checksum %d, computed %d %s",
+			info.Segment, info.Path, info.Records, info.Size, info.CheckSum, info.Computed, status)
+		if info.BadTail() > 0 {
+			// 只有当前段的损坏尾部可以在打开时被截断，已关闭的段不应该存在损坏的尾部
+			if i != len(infos)-1 {
+				summary.Corrupted = true
+			}
+			fmt.Fprintf(w, ", %d bytes of bad tail at %d", info.BadTail(), info.ValidEnd)
+		}
+		fmt.Fprintln(w)
+	}
+	_, err = fmt.Fprintf(w, "-- %d of %d records matched\n", summary.Matched, summary.Records)
+	return summary, err
+}
+
+// format 将一条日志格式化为一行文本
+func format(record *dm.LogRecord) string {
+	switch record.Type {
+	case dm.LogTypeInsert:
+		return fmt.Sprintf("INSERT xid=%d page=%d offset=%d uid=%d raw=%s",
+			record.Xid, record.PageNumber, record.Offset,
+			utils.GenerateUID(record.PageNumber, int(record.Offset)), hex.EncodeToString(record.Raw))
+	case dm.LogTypeUpdate:
+		return fmt.Sprintf("UPDATE xid=%d page=%d offset=%d uid=%d old=%s new=%s",
+			record.Xid, record.PageNumber, record.Offset, record.Uid,
+			hex.EncodeToString(record.OldRaw), hex.EncodeToString(record.NewRaw))
+	default:
+		return fmt.Sprintf("COMMIT xid=%d time=%s",
+			record.Xid, time.Unix(0, record.Timestamp).Format("2006-01-02 15:04:05.000000000"))
+	}
+}
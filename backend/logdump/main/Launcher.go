@@ -0,0 +1,45 @@
+package main
+
+import (
+	"SimpleDB/backend/logdump"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	// 定义命令行参数
+	pathFlag := flag.String("path", "", "Print the log records of the database at DBPath")
+	xidFlag := flag.Int64("xid", -1, "Only print records of this transaction")
+	pageFlag := flag.Int("page", 0, "Only print insert and update records of this page")
+	typeFlag := flag.String("type", "", "Only print records of this type: insert, update or commit")
+
+	// 解析命令行参数
+	flag.Parse()
+
+	if *pathFlag == "" {
+		fmt.Println("Usage: db_logdump -path DBPath [-xid XID] [-page PageNumber] [-type insert|update|commit]")
+		return
+	}
+	filter := logdump.NewFilter()
+	filter.Xid = *xidFlag
+	filter.Page = *pageFlag
+	if *typeFlag != "" {
+		logType, err := logdump.ParseType(*typeFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		filter.Type = logType
+	}
+
+	summary, err := logdump.Dump(*pathFlag, filter, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Log dump failed:", err)
+		os.Exit(1)
+	}
+	// 校验和不一致或者存在无法解析的日志时以状态码1退出
+	if summary.Corrupted {
+		os.Exit(1)
+	}
+}
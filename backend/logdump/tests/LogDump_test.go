@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/logdump"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createDB 创建数据库并执行sqls
+func createDB(t *testing.T, path string, sqls ...string) {
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	for _, sql := range sqls {
+		if _, err := executor.Execute([]byte(sql)); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	dataManager.Close()
+	transactionManager.Close()
+}
+
+func TestLogDumpFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	createDB(t, path,
+		"create table student id int32, name string, (index id)",
+		"insert into student values 1 alice",
+		"insert into student values 2 bob",
+		"delete from student where id = 1",
+	)
+
+	var buf bytes.Buffer
+	summary, err := logdump.Dump(path, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Corrupted || summary.Records == 0 || summary.Matched != summary.Records {
+		t.Fatalf("unexpected summary %+v\n%s", summary, buf.String())
+	}
+	for _, expected := range []string{"INSERT xid=", "UPDATE xid=", "COMMIT xid=", " ok\n"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("missing %q in\n%s", expected, buf.String())
+		}
+	}
+
+	// 只输出第3个事务（插入bob）的提交日志
+	filter := logdump.NewFilter()
+	filter.Xid = 3
+	filter.Type = "commit"
+	buf.Reset()
+	summary, err = logdump.Dump(path, filter, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Matched != 1 || !strings.Contains(buf.String(), "COMMIT xid=3 ") {
+		t.Fatalf("unexpected output\n%s", buf.String())
+	}
+
+	// 按页过滤时不输出提交日志
+	filter = logdump.NewFilter()
+	filter.Page = 2
+	buf.Reset()
+	if _, err = logdump.Dump(path, filter, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "COMMIT") || !strings.Contains(buf.String(), "page=2 ") {
+		t.Fatalf("unexpected output\n%s", buf.String())
+	}
+}
+
+func TestLogDumpChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	createDB(t, path, "create table student id int32, (index id)", "insert into student values 1")
+
+	// 修改段文件开头的校验和
+	segment := logger.SegmentPath(path, logger.ListSegments(path)[0])
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 0xff
+	if err = os.WriteFile(segment, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	summary, err := logdump.Dump(path, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Corrupted || !strings.Contains(buf.String(), "MISMATCH") {
+		t.Fatalf("checksum mismatch is not reported\n%s", buf.String())
+	}
+}
+
+// TestLogDumpBadRecord 校验和正确但是无法解析的日志标记为损坏的记录，而不是校验和错误
+func TestLogDumpBadRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	createDB(t, path, "create table student id int32, (index id)")
+	dbLogger := logger.OpenLogger(path)
+	dbLogger.Log([]byte{dm.LogTypeInsert, 1})
+	dbLogger.Close()
+
+	var buf bytes.Buffer
+	summary, err := logdump.Dump(path, nil, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Corrupted || !strings.Contains(buf.String(), "] BAD record log record too short") ||
+		strings.Contains(buf.String(), "MISMATCH") {
+		t.Fatalf("bad record is not reported\n%s", buf.String())
+	}
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/commons"
+)
+
+// Bind 使用参数的值替换 ParsePrepared 返回的语句中的参数占位符，第n个参数的值为 params[n-1]
+// 返回新的语句，原来的语句不会被修改，因此同一条预备语句可以多次绑定
+// 参数的值直接作为字段的值，不会再经过词法分析，因此不需要转义
+func Bind(stat interface{}, params []string) (interface{}, error) {
+	value := func(v string, param int) (string, error) {
+		if param == 0 {
+			return v, nil
+		}
+		if param > len(params) {
+			return "", commons.NewError(commons.ErrorMessage.ParameterCountError)
+		}
+		return params[param-1], nil
+	}
+	var err error
+	switch stat := stat.(type) {
+	case *statement.InsertStatement:
+		insert := *stat
+		if stat.Params == nil {
+			return &insert, nil
+		}
+		insert.Values = make([]string, len(stat.Values))
+		insert.Params = nil
+		for i, v := range stat.Values {
+			if insert.Values[i], err = value(v, stat.Params[i]); err != nil {
+				return nil, err
+			}
+		}
+		return &insert, nil
+	case *statement.UpdateStatement:
+		update := *stat
+		if update.Value, err = value(stat.Value, stat.Param); err != nil {
+			return nil, err
+		}
+		update.Param = 0
+		if update.Where, err = bindWhere(stat.Where, value); err != nil {
+			return nil, err
+		}
+		return &update, nil
+	case *statement.SelectStatement:
+		sel := *stat
+		if sel.Where, err = bindWhere(stat.Where, value); err != nil {
+			return nil, err
+		}
+		return &sel, nil
+	case *statement.DeleteStatement:
+		del := *stat
+		if del.Where, err = bindWhere(stat.Where, value); err != nil {
+			return nil, err
+		}
+		return &del, nil
+	}
+	// 其他语句中不会有参数
+	return stat, nil
+}
+
+func bindWhere(where *statement.WhereSubStatement, value func(string, int) (string, error)) (*statement.WhereSubStatement, error) {
+	if where == nil {
+		return nil, nil
+	}
+	bound := *where
+	var err error
+	for _, exp := range []**statement.SingleExpression{&bound.SingleExp1, &bound.SingleExp2} {
+		if *exp == nil {
+			continue
+		}
+		e := **exp
+		if e.Value, err = value(e.Value, e.Param); err != nil {
+			return nil, err
+		}
+		e.Param = 0
+		*exp = &e
+	}
+	return &bound, nil
+}
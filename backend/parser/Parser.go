@@ -3,12 +3,38 @@ package parser
 import (
 	"SimpleDB/backend/parser/statement"
 	"SimpleDB/commons"
-	"errors"
+	"strconv"
+	"time"
 )
 
-// Parse 解析SQL语句
+// Parse 解析SQL语句，语句中不能有参数占位符
 func Parse(statement []byte) (interface{}, error) {
+	stat, params, err := ParsePrepared(statement)
+	if err != nil {
+		return nil, err
+	}
+	if params > 0 {
+		return nil, commons.NewError(commons.ErrorMessage.UnboundParameterError)
+	}
+	return stat, nil
+}
+
+// ParsePrepared 解析带有参数占位符 ? 的SQL语句，返回语句和参数的个数
+// 参数只能出现在值的位置上：insert 的值、update 的新值以及 where 条件中的值，之后通过 Bind 绑定参数的值
+func ParsePrepared(statement []byte) (interface{}, int, error) {
 	tokenizer := NewTokenizer(statement)
+	stat, err := parse(tokenizer)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 出现在其他位置上的占位符
+	if tokenizer.placeholders != tokenizer.params {
+		return nil, 0, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	return stat, tokenizer.params, nil
+}
+
+func parse(tokenizer *Tokenizer) (interface{}, error) {
 	token, err := tokenizer.Peek()
 	if err != nil {
 		return nil, err
@@ -50,26 +76,39 @@ func Parse(statement []byte) (interface{}, error) {
 	case "show":
 		stat, statErr = parseShow(tokenizer)
 		break
+	case "backup":
+		stat, statErr = parseBackup(tokenizer)
+		break
+	case "copy":
+		stat, statErr = parseCopy(tokenizer)
+		break
+	case "savepoint":
+		stat, statErr = parseSavepoint(tokenizer)
+		break
+	case "rollback":
+		stat, statErr = parseRollback(tokenizer)
+		break
+	case "release":
+		stat, statErr = parseRelease(tokenizer)
+		break
+	case "prepare":
+		stat, statErr = parsePrepare(tokenizer)
+		break
 	default:
 		// 如果标记的值不符合预期，抛出异常
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError).WithPosition(tokenizer.Position())
 	}
 
 	// 获取下一个标记
 	next, err := tokenizer.Peek()
 	// 如果还有未处理的标记，那么抛出异常
-	if next != "" {
-		errStat := tokenizer.ErrStat()
-		statErr = errors.New("Invalid statement: " + string(errStat))
-	}
-
-	if err != nil {
+	if next != "" || err != nil {
 		errStat := tokenizer.ErrStat()
-		statErr = errors.New("Invalid statement: " + string(errStat))
+		statErr = commons.NewCodeError(commons.CodeSyntaxError, "Invalid statement: "+string(errStat))
 	}
-	// 如果存在错误，抛出异常
+	// 如果存在错误，抛出异常，错误的位置为出错时的token
 	if statErr != nil {
-		return nil, statErr
+		return nil, commons.AsError(statErr).WithPosition(tokenizer.Position())
 	}
 	// 返回生成的语句对象
 	return stat, nil
@@ -87,9 +126,13 @@ func parseBegin(tokenizer *Tokenizer) (*statement.BeginStatement, error) {
 	if isolation == "" {
 		return begin, nil
 	}
+	// begin read only
+	if isolation == "read" {
+		return parseReadOnly(tokenizer, begin)
+	}
 	// 获取isolation关键字
 	if isolation != "isolation" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -99,7 +142,7 @@ func parseBegin(tokenizer *Tokenizer) (*statement.BeginStatement, error) {
 		return nil, err
 	}
 	if level != "level" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -117,16 +160,9 @@ func parseBegin(tokenizer *Tokenizer) (*statement.BeginStatement, error) {
 		}
 		if tmp2 == "committed" {
 			tokenizer.Pop()
-			tmp3, err := tokenizer.Peek()
-			if err != nil {
-				return nil, err
-			}
-			if tmp3 != "" {
-				return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
-			}
-			return begin, nil
+			return parseReadOnly(tokenizer, begin)
 		} else {
-			return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		}
 		// 如果是repeatable read，那么设置隔离级别为repeatable read
 	} else if tmp1 == "repeatable" {
@@ -138,20 +174,50 @@ func parseBegin(tokenizer *Tokenizer) (*statement.BeginStatement, error) {
 		if tmp2 == "read" {
 			begin.IsRepeatableRead = true
 			tokenizer.Pop()
-			tmp3, err := tokenizer.Peek()
-			if err != nil {
-				return nil, err
-			}
-			if tmp3 != "" {
-				return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
-			}
-			return begin, nil
+			return parseReadOnly(tokenizer, begin)
 		} else {
-			return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		}
+		// 如果是serializable，那么设置隔离级别为serializable
+	} else if tmp1 == "serializable" {
+		begin.IsSerializable = true
+		tokenizer.Pop()
+		return parseReadOnly(tokenizer, begin)
 	} else {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+}
+
+// parseReadOnly 解析begin语句末尾可选的read only
+func parseReadOnly(tokenizer *Tokenizer, begin *statement.BeginStatement) (*statement.BeginStatement, error) {
+	read, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if read == "" {
+		return begin, nil
+	}
+	if read != "read" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+	only, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if only != "only" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+	tmp, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
 	}
+	if tmp != "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	begin.IsReadOnly = true
+	return begin, nil
 }
 
 // parseAbort 解析abort语句
@@ -162,11 +228,109 @@ func parseAbort(tokenizer *Tokenizer) (*statement.AbortStatement, error) {
 		return nil, err
 	}
 	if tmp != "" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	return &statement.AbortStatement{}, nil
 }
 
+// parseSavepointName 解析保存点的名称，名称之后不应该有其他的标记
+func parseSavepointName(tokenizer *Tokenizer) (string, error) {
+	name, err := tokenizer.Peek()
+	if err != nil {
+		return "", err
+	}
+	if name == "" || !isName(name) {
+		return "", commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+	tmp, err := tokenizer.Peek()
+	if err != nil {
+		return "", err
+	}
+	if tmp != "" {
+		return "", commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	return name, nil
+}
+
+// parseSavepoint 解析savepoint语句，格式为 savepoint name
+func parseSavepoint(tokenizer *Tokenizer) (*statement.SavepointStatement, error) {
+	name, err := parseSavepointName(tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	return &statement.SavepointStatement{Name: name}, nil
+}
+
+// parseRollback 解析rollback语句，格式为 rollback to [savepoint] name 或者 rollback prepared 'gid'
+func parseRollback(tokenizer *Tokenizer) (interface{}, error) {
+	if tmp, err := tokenizer.Peek(); err == nil && tmp == "prepared" {
+		tokenizer.Pop()
+		gid, err := parseGid(tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		return &statement.RollbackPreparedStatement{Gid: gid}, nil
+	}
+	if tmp, err := tokenizer.Peek(); err != nil || tmp != "to" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+	if tmp, err := tokenizer.Peek(); err == nil && tmp == "savepoint" {
+		tokenizer.Pop()
+	}
+	name, err := parseSavepointName(tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	return &statement.RollbackStatement{Savepoint: name}, nil
+}
+
+// parseGid 解析两阶段提交的全局事务ID，全局事务ID之后不应该有其他的标记
+func parseGid(tokenizer *Tokenizer) (string, error) {
+	gid, err := tokenizer.Peek()
+	if err != nil {
+		return "", err
+	}
+	if gid == "" {
+		return "", commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+	tmp, err := tokenizer.Peek()
+	if err != nil {
+		return "", err
+	}
+	if tmp != "" {
+		return "", commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	return gid, nil
+}
+
+// parsePrepare 解析prepare语句，格式为 prepare transaction 'gid'
+func parsePrepare(tokenizer *Tokenizer) (*statement.PrepareStatement, error) {
+	if tmp, err := tokenizer.Peek(); err != nil || tmp != "transaction" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+	gid, err := parseGid(tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	return &statement.PrepareStatement{Gid: gid}, nil
+}
+
+// parseRelease 解析release语句，格式为 release [savepoint] name
+func parseRelease(tokenizer *Tokenizer) (*statement.ReleaseStatement, error) {
+	if tmp, err := tokenizer.Peek(); err == nil && tmp == "savepoint" {
+		tokenizer.Pop()
+	}
+	name, err := parseSavepointName(tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	return &statement.ReleaseStatement{Name: name}, nil
+}
+
 // parseCreate 解析create语句
 func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 	create := &statement.CreateStatement{}
@@ -176,7 +340,7 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 		return nil, err
 	}
 	if tmp != "table" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -186,7 +350,7 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 		return nil, err
 	}
 	if !isName(tableName) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	create.TableName = tableName
 
@@ -204,7 +368,7 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 			break
 		}
 		if !isName(fieldName) {
-			return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		}
 		tokenizer.Pop()
 
@@ -214,7 +378,7 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 			return nil, err
 		}
 		if !isType(fieldType) {
-			return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		}
 		fNames = append(fNames, fieldName)
 		fTypes = append(fTypes, fieldType)
@@ -227,11 +391,11 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 		if next == "," {
 			continue
 		} else if next == "" {
-			return nil, errors.New(commons.ErrorMessage.TableNoIndexError)
+			return nil, commons.NewError(commons.ErrorMessage.TableNoIndexError)
 		} else if next == "(" {
 			break
 		} else {
-			return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		}
 	}
 
@@ -245,7 +409,7 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 		return nil, err
 	}
 	if tmp != "index" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 
 	// 获取索引
@@ -261,7 +425,7 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 			break
 		}
 		if !isName(indexName) {
-			return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		}
 		indexes = append(indexes, indexName)
 	}
@@ -274,20 +438,28 @@ func parseCreate(tokenizer *Tokenizer) (*statement.CreateStatement, error) {
 		return nil, err
 	}
 	if tmp != "" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	return create, nil
 }
 
-// parseCommit 解析commit语句
-func parseCommit(tokenizer *Tokenizer) (*statement.CommitStatement, error) {、
-	// commit语句后不应该有任何其他的标记了
+// parseCommit 解析commit语句，commit prepared 'gid' 提交预备事务
+func parseCommit(tokenizer *Tokenizer) (interface{}, error) {
 	tmp, err := tokenizer.Peek()
 	if err != nil {
 		return nil, err
 	}
+	if tmp == "prepared" {
+		tokenizer.Pop()
+		gid, err := parseGid(tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		return &statement.CommitPreparedStatement{Gid: gid}, nil
+	}
+	// commit语句后不应该有任何其他的标记了
 	if tmp != "" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	return &statement.CommitStatement{}, nil
 }
@@ -298,7 +470,7 @@ func parserDelete(tokenizer *Tokenizer) (*statement.DeleteStatement, error) {
 
 	// 获取from关键字
 	if tmp, err := tokenizer.Peek(); err != nil || tmp != "from" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -308,7 +480,7 @@ func parserDelete(tokenizer *Tokenizer) (*statement.DeleteStatement, error) {
 		return nil, err
 	}
 	if !isName(tableName) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	deleteStatement.TableName = tableName
 	tokenizer.Pop()
@@ -319,6 +491,10 @@ func parserDelete(tokenizer *Tokenizer) (*statement.DeleteStatement, error) {
 		return nil, err
 	}
 	deleteStatement.Where = whereStatement
+	// 只有select语句可以加锁
+	if tmp, err := tokenizer.Peek(); err != nil || tmp != "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
 	return deleteStatement, nil
 }
 
@@ -331,7 +507,7 @@ func parseDrop(tokenizer *Tokenizer) (*statement.DropStatement, error) {
 		return nil, err
 	}
 	if tableKey != "table" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -341,7 +517,7 @@ func parseDrop(tokenizer *Tokenizer) (*statement.DropStatement, error) {
 		return nil, err
 	}
 	if !isName(tableName) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	drop.TableName = tableName
 	tokenizer.Pop()
@@ -351,7 +527,7 @@ func parseDrop(tokenizer *Tokenizer) (*statement.DropStatement, error) {
 		return nil, err
 	}
 	if tmp != "" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	return drop, nil
 }
@@ -365,7 +541,92 @@ func parseShow(tokenizer *Tokenizer) (*statement.ShowStatement, error) {
 	if tmp == "" {
 		return &statement.ShowStatement{}, nil
 	}
-	return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+	return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+}
+
+// parseBackup 解析backup语句，格式为 backup to 'dir'
+func parseBackup(tokenizer *Tokenizer) (*statement.BackupStatement, error) {
+	// 获取to关键字
+	if tmp, err := tokenizer.Peek(); err != nil || tmp != "to" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+
+	// 获取备份目录
+	dir, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+
+	tmp, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if tmp != "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	return &statement.BackupStatement{Dir: dir}, nil
+}
+
+// parseCopy 解析copy语句，格式为 copy table from|to 'file' [header]
+func parseCopy(tokenizer *Tokenizer) (*statement.CopyStatement, error) {
+	copyStatement := &statement.CopyStatement{}
+
+	// 获取表名
+	tableName, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if !isName(tableName) {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	copyStatement.TableName = tableName
+	tokenizer.Pop()
+
+	// 获取from或者to关键字
+	direction, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if direction == "from" {
+		copyStatement.IsFrom = true
+	} else if direction != "to" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+
+	// 获取文件路径
+	file, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	copyStatement.File = file
+	tokenizer.Pop()
+
+	// 获取可选的header关键字
+	tmp, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if tmp == "header" {
+		copyStatement.Header = true
+		tokenizer.Pop()
+		tmp, err = tokenizer.Peek()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tmp != "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	return copyStatement, nil
 }
 
 // parseUpdate 解析update语句
@@ -381,7 +642,7 @@ func parseUpdate(tokenizer *Tokenizer) (*statement.UpdateStatement, error) {
 
 	// 获取SET关键字
 	if tmp, err := tokenizer.Peek(); err != nil || tmp != "set" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -395,7 +656,7 @@ func parseUpdate(tokenizer *Tokenizer) (*statement.UpdateStatement, error) {
 
 	// 获取等号
 	if tmp, err := tokenizer.Peek(); err != nil || tmp != "=" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -405,6 +666,7 @@ func parseUpdate(tokenizer *Tokenizer) (*statement.UpdateStatement, error) {
 		return nil, err
 	}
 	update.Value = fieldValue
+	update.Param = tokenizer.Param()
 	tokenizer.Pop()
 
 	// 获取WHERE子句
@@ -422,6 +684,10 @@ func parseUpdate(tokenizer *Tokenizer) (*statement.UpdateStatement, error) {
 		return nil, err
 	}
 	update.Where = whereStatement
+	// 只有select语句可以加锁
+	if tmp, err := tokenizer.Peek(); err != nil || tmp != "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
 	return update, nil
 }
 
@@ -431,7 +697,7 @@ func parseInsert(tokenizer *Tokenizer) (*statement.InsertStatement, error) {
 
 	// 获取into关键字
 	if tmp, err := tokenizer.Peek(); err != nil || tmp != "into" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -441,14 +707,14 @@ func parseInsert(tokenizer *Tokenizer) (*statement.InsertStatement, error) {
 		return nil, err
 	}
 	if !isName(tableName) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	insert.TableName = tableName
 	tokenizer.Pop()
 
 	// 获取values关键字
 	if tmp, err := tokenizer.Peek(); err != nil || tmp != "values" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 
 	// 获取values的值
@@ -459,11 +725,19 @@ func parseInsert(tokenizer *Tokenizer) (*statement.InsertStatement, error) {
 		if err != nil {
 			return nil, err
 		}
-		if value == "" {
+		if value == "" && !tokenizer.Quoted() {
 			break
 		} else {
 			values = append(values, value)
 		}
+		if param := tokenizer.Param(); param > 0 {
+			if insert.Params == nil {
+				insert.Params = make([]int, len(values)-1, len(values))
+			}
+			insert.Params = append(insert.Params, param)
+		} else if insert.Params != nil {
+			insert.Params = append(insert.Params, 0)
+		}
 	}
 	insert.Values = values
 	return insert, nil
@@ -490,7 +764,7 @@ func parseSelect(tokenizer *Tokenizer) (*statement.SelectStatement, error) {
 				return nil, err
 			}
 			if !isName(field) {
-				return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+				return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 			}
 			fields = append(fields, field)
 			tokenizer.Pop()
@@ -514,7 +788,7 @@ func parseSelect(tokenizer *Tokenizer) (*statement.SelectStatement, error) {
 		return nil, err
 	}
 	if from != "from" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -524,29 +798,115 @@ func parseSelect(tokenizer *Tokenizer) (*statement.SelectStatement, error) {
 		return nil, err
 	}
 	if !isName(tableName) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	read.TableName = tableName
 	tokenizer.Pop()
 
-	// 获取where子句
+	// 获取as of子句
 	where, err := tokenizer.Peek()
 	if err != nil {
 		return nil, err
 	}
-	if where == "" {
-		read.Where = nil
-		return read, nil
+	if where == "as" {
+		read.AsOf, err = parseAsOf(tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		where, err = tokenizer.Peek()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	whereStatement, err := parserWhere(tokenizer)
+	// 获取where子句
+	if where != "" && where != "for" {
+		whereStatement, err := parserWhere(tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		read.Where = whereStatement
+	}
+
+	// 获取for update或者for share子句
+	tmp, err := tokenizer.Peek()
 	if err != nil {
 		return nil, err
 	}
-	read.Where = whereStatement
+	// 历史数据不能加锁
+	if tmp == "for" && read.AsOf != nil {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	if tmp == "for" {
+		tokenizer.Pop()
+		mode, err := tokenizer.Peek()
+		if err != nil {
+			return nil, err
+		}
+		if mode == "update" {
+			read.ForUpdate = true
+		} else if mode == "share" {
+			read.ForShare = true
+		} else {
+			return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+		}
+		tokenizer.Pop()
+		tmp, err = tokenizer.Peek()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tmp != "" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
 	return read, nil
 }
 
+// AsOfTimeLayout AS OF TIMESTAMP 中时间的格式，使用本地时区，秒之后可以带有小数部分
+const AsOfTimeLayout = "2006-01-02 15:04:05"
+
+// parseAsOf 解析 as of xid n 或者 as of timestamp 'time'
+func parseAsOf(tokenizer *Tokenizer) (*statement.AsOfSubStatement, error) {
+	tokenizer.Pop()
+	of, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if of != "of" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	tokenizer.Pop()
+
+	kind, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	tokenizer.Pop()
+	value, err := tokenizer.Peek()
+	if err != nil {
+		return nil, err
+	}
+	tokenizer.Pop()
+
+	asOf := &statement.AsOfSubStatement{}
+	switch kind {
+	case "xid":
+		asOf.Xid, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || asOf.Xid <= 0 {
+			return nil, commons.NewError(commons.ErrorMessage.InvalidValuesError)
+		}
+	case "timestamp":
+		t, err := time.ParseInLocation(AsOfTimeLayout, value, time.Local)
+		if err != nil {
+			return nil, commons.NewError(commons.ErrorMessage.InvalidValuesError)
+		}
+		asOf.Timestamp = t.UnixNano()
+	default:
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	return asOf, nil
+}
+
 // parserWhere 解析where子句
 func parserWhere(tokenizer *Tokenizer) (*statement.WhereSubStatement, error) {
 	where := &statement.WhereSubStatement{}
@@ -554,7 +914,7 @@ func parserWhere(tokenizer *Tokenizer) (*statement.WhereSubStatement, error) {
 	// 获取where关键字
 	tmp, err := tokenizer.Peek()
 	if err != nil || tmp != "where" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	tokenizer.Pop()
 
@@ -569,12 +929,13 @@ func parserWhere(tokenizer *Tokenizer) (*statement.WhereSubStatement, error) {
 	if err != nil {
 		return nil, err
 	}
-	if logicOp == "" {
-		where.LogicOp = logicOp
+	// select语句的where子句之后可以跟for update或者for share
+	if logicOp == "" || logicOp == "for" {
+		where.LogicOp = ""
 		return where, nil
 	}
 	if !isLogicOp(logicOp) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	where.LogicOp = logicOp
 	tokenizer.Pop()
@@ -590,8 +951,8 @@ func parserWhere(tokenizer *Tokenizer) (*statement.WhereSubStatement, error) {
 	if err != nil {
 		return nil, err
 	}
-	if tmp != "" {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+	if tmp != "" && tmp != "for" {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 
 	return where, nil
@@ -608,7 +969,7 @@ func parseSingleExpression(tokenizer *Tokenizer) (*statement.SingleExpression, e
 		return nil, err
 	}
 	if !isName(field) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	exp.Field = field
 	tokenizer.Pop()
@@ -619,7 +980,7 @@ func parseSingleExpression(tokenizer *Tokenizer) (*statement.SingleExpression, e
 		return nil, err
 	}
 	if !isCmpOp(compareOp) {
-		return nil, errors.New(commons.ErrorMessage.InvalidCommandError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
 	}
 	exp.CompareOp = compareOp
 	tokenizer.Pop()
@@ -630,6 +991,7 @@ func parseSingleExpression(tokenizer *Tokenizer) (*statement.SingleExpression, e
 		return nil, err
 	}
 	exp.Value = value
+	exp.Param = tokenizer.Param()
 	tokenizer.Pop()
 
 	return exp, nil
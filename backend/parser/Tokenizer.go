@@ -3,7 +3,6 @@ package parser
 import (
 	"SimpleDB/commons"
 	"bytes"
-	"errors"
 )
 
 type Tokenizer struct {
@@ -11,12 +10,21 @@ type Tokenizer struct {
 	stat []byte
 	// 当前解析位置
 	pos int
+	// start 当前token在语句中的起始位置
+	start int
 	// 当前token
 	currentToken string
 	// 标记是否需要刷新当前token
 	flushToken bool
 	// 解析过程中发生的异常
 	err error
+	// placeholder 当前token是否是参数占位符 ?，带引号的 "?" 是普通的字符串
+	placeholder bool
+	// quoted 当前token是否是引号包围的字符串，用于区分空字符串 '' 和语句结束
+	quoted bool
+	// placeholders 出现过的参数占位符的个数，params 出现在值的位置上的参数的个数
+	placeholders int
+	params       int
 }
 
 // NewTokenizer 构造函数，初始化输入的SQL语句
@@ -65,6 +73,26 @@ func (tokenizer *Tokenizer) ErrStat() []byte {
 	return res
 }
 
+// Param 在值的位置上调用，当前token是参数占位符时返回参数的序号（从1开始），否则返回0
+// 每个值只能调用一次
+func (tokenizer *Tokenizer) Param() int {
+	if !tokenizer.placeholder {
+		return 0
+	}
+	tokenizer.params++
+	return tokenizer.params
+}
+
+// Quoted 当前token是否是引号包围的字符串
+func (tokenizer *Tokenizer) Quoted() bool {
+	return tokenizer.quoted
+}
+
+// Position 返回最近一个token在语句中的位置，从1开始，语句已经结束时为语句的长度加1
+func (tokenizer *Tokenizer) Position() int {
+	return tokenizer.start + 1
+}
+
 // popByte 移动到下一个字节
 func (tokenizer *Tokenizer) popByte() {
 	tokenizer.pos++
@@ -91,6 +119,7 @@ func (tokenizer *Tokenizer) next() (string, error) {
 
 // nextMetaState 获取下一个元状态。元状态可以是一个符号、引号包围的字符串或者一个由字母、数字或下划线组成的标记
 func (tokenizer *Tokenizer) nextMetaState() (string, error) {
+	tokenizer.quoted = false
 	for {
 		b := tokenizer.peekByte()
 		// 如果没有下一个字节，返回空字符串
@@ -105,7 +134,15 @@ func (tokenizer *Tokenizer) nextMetaState() (string, error) {
 		tokenizer.popByte()
 	}
 	// 获取下一个字节
+	tokenizer.start = tokenizer.pos
+	tokenizer.placeholder = false
 	b := tokenizer.peekByte()
+	if b == '?' {
+		tokenizer.popByte()
+		tokenizer.placeholder = true
+		tokenizer.placeholders++
+		return "?", nil
+	}
 	if IsSymbol(b) {
 		// 如果这个字节是一个符号，跳过这个字节
 		tokenizer.popByte()
@@ -113,13 +150,14 @@ func (tokenizer *Tokenizer) nextMetaState() (string, error) {
 		return string(b), nil
 	} else if b == '"' || b == '\'' {
 		// 如果这个字节是引号，获取下一个引号状态
+		tokenizer.quoted = true
 		return tokenizer.nextQuoteState()
 	} else if IsAlphaBeta(b) || IsDigit(b) {
 		// 如果这个字节是字母、数字或下划线，获取下一个标记状态
 		return tokenizer.nextTokenState()
 	} else {
 		// 否则，设置错误状态为无效的命令异常
-		tokenizer.err = errors.New(commons.ErrorMessage.InvalidCommandError)
+		tokenizer.err = commons.NewError(commons.ErrorMessage.InvalidCommandError)
 		return "", tokenizer.err
 	}
 
@@ -149,6 +187,7 @@ func (tokenizer *Tokenizer) nextTokenState() (string, error) {
 }
 
 // nextQuoteState 处理引号状态，即处理被引号包围的字符串。
+// 字符串中连续出现两次的外层引号表示一个引号字符
 func (tokenizer *Tokenizer) nextQuoteState() (string, error) {
 	// 获取下一个字节，这应该是一个引号
 	quote := tokenizer.peekByte()
@@ -157,19 +196,22 @@ func (tokenizer *Tokenizer) nextQuoteState() (string, error) {
 	// 创建一个buffer，用于存储被引号包围的字符串
 	var sb bytes.Buffer
 	for {
-		// 获取下一个字节
-		b := tokenizer.peekByte()
-		if b == 0 {
+		if tokenizer.pos == len(tokenizer.stat) {
 			// 如果没有下一个字节，设置错误状态为无效的命令异常
-			tokenizer.err = errors.New(commons.ErrorMessage.InvalidCommandError)
+			tokenizer.err = commons.NewError(commons.ErrorMessage.InvalidCommandError)
 			return "", tokenizer.err
 		}
+		// 获取下一个字节
+		b := tokenizer.peekByte()
 		if b == quote {
-			// 如果这个字节是引号，跳过这个字节，并跳出循环
+			// 如果这个字节是引号，跳过这个字节
 			tokenizer.popByte()
-			break
+			if tokenizer.peekByte() != quote {
+				// 后面不是引号，字符串结束
+				break
+			}
 		}
-		// 如果这个字节不是引号，将这个字节添加到StringBuilder中
+		// 将这个字节添加到buffer中
 		sb.WriteByte(b)
 		// 跳过这个字节
 		tokenizer.popByte()
@@ -3,13 +3,35 @@ package statement
 type AbortStatement struct {
 }
 
+type BackupStatement struct {
+	Dir string
+}
+
 type BeginStatement struct {
 	IsRepeatableRead bool
+	// IsSerializable 可串行化隔离级别，在可重复读的基础上检测读写冲突
+	IsSerializable bool
+	// IsReadOnly 只读事务，不能执行写语句，也不会加行锁
+	IsReadOnly bool
 }
 
 type CommitStatement struct {
 }
 
+// CommitPreparedStatement commit prepared 'gid'
+type CommitPreparedStatement struct {
+	Gid string
+}
+
+type CopyStatement struct {
+	TableName string
+	// IsFrom 为true时从文件导入，否则导出到文件
+	IsFrom bool
+	File   string
+	// Header 文件第一行是否为字段名
+	Header bool
+}
+
 type CreateStatement struct {
 	TableName string
 	FieldName []string
@@ -29,12 +51,51 @@ type DropStatement struct {
 type InsertStatement struct {
 	TableName string
 	Values    []string
+	// Params 每个值对应的参数序号，为0表示字面值，语句没有参数时为nil
+	Params []int
+}
+
+// PrepareStatement prepare transaction 'gid'
+type PrepareStatement struct {
+	Gid string
+}
+
+// ReleaseStatement release [savepoint] name
+type ReleaseStatement struct {
+	Name string
+}
+
+// RollbackStatement rollback to [savepoint] name
+type RollbackStatement struct {
+	Savepoint string
+}
+
+// RollbackPreparedStatement rollback prepared 'gid'
+type RollbackPreparedStatement struct {
+	Gid string
+}
+
+// SavepointStatement savepoint name
+type SavepointStatement struct {
+	Name string
 }
 
 type SelectStatement struct {
 	TableName string
 	Fields    []string
 	Where     *WhereSubStatement
+	// ForUpdate 和 ForShare 表示对查询到的记录加排他锁或共享锁
+	ForUpdate bool
+	ForShare  bool
+	// AsOf 历史查询的目标，为nil时查询当前的数据
+	AsOf *AsOfSubStatement
+}
+
+// AsOfSubStatement AS OF XID n 或者 AS OF TIMESTAMP 'time'，Xid为0时使用Timestamp
+type AsOfSubStatement struct {
+	Xid int64
+	// Timestamp Unix纳秒
+	Timestamp int64
 }
 
 type ShowStatement struct {
@@ -44,7 +105,9 @@ type UpdateStatement struct {
 	TableName string
 	FieldName string
 	Value     string
-	Where     *WhereSubStatement
+	// Param Value对应的参数序号，为0表示字面值
+	Param int
+	Where *WhereSubStatement
 }
 
 type WhereSubStatement struct {
@@ -59,4 +122,6 @@ type SingleExpression struct {
 	Field     string
 	CompareOp string
 	Value     string
+	// Param Value对应的参数序号，为0表示字面值
+	Param int
 }
@@ -3,7 +3,10 @@ package tests
 import (
 	"SimpleDB/backend/parser"
 	"SimpleDB/backend/parser/statement"
+	"SimpleDB/commons"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestCreate(t *testing.T) {
@@ -78,6 +81,34 @@ func TestBegin(t *testing.T) {
 	}
 	t.Log(begin)
 	t.Log("==================")
+
+	stat = "begin isolation level serializable"
+	res, err = parser.Parse([]byte(stat))
+	if err != nil {
+		t.Error(err)
+	}
+
+	begin, ok = res.(*statement.BeginStatement)
+	if !ok {
+		t.Error("not begin statement")
+	}
+	if begin.IsSerializable != true || begin.IsRepeatableRead == true {
+		t.Error("level error")
+	}
+	t.Log(begin)
+	t.Log("==================")
+
+	for _, stat := range []string{"begin read only", "begin isolation level read committed read only", "begin isolation level repeatable read read only"} {
+		res, err = parser.Parse([]byte(stat))
+		if err != nil || !res.(*statement.BeginStatement).IsReadOnly {
+			t.Errorf("%s error: %v", stat, err)
+		}
+	}
+	for _, stat := range []string{"begin read", "begin read only now", "begin isolation level serializable read write"} {
+		if _, err = parser.Parse([]byte(stat)); err == nil {
+			t.Errorf("expected error for %q", stat)
+		}
+	}
 }
 
 func TestRead(t *testing.T) {
@@ -99,6 +130,45 @@ func TestRead(t *testing.T) {
 	t.Logf("where: %v\n", read.Where)
 	t.Log(read)
 	t.Log("==================")
+
+	res, err = parser.Parse([]byte("select * from student where id = 1 for update"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read = res.(*statement.SelectStatement)
+	if !read.ForUpdate || read.ForShare || read.Where == nil || read.Where.SingleExp1.Value != "1" {
+		t.Errorf("for update error: %+v", read)
+	}
+	res, err = parser.Parse([]byte("select * from student for share"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read = res.(*statement.SelectStatement)
+	if read.ForUpdate || !read.ForShare || read.Where != nil {
+		t.Errorf("for share error: %+v", read)
+	}
+	res, err = parser.Parse([]byte("select * from student as of xid 5 where id = 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read = res.(*statement.SelectStatement)
+	if read.AsOf == nil || read.AsOf.Xid != 5 || read.Where == nil {
+		t.Errorf("as of xid error: %+v", read)
+	}
+	res, err = parser.Parse([]byte("select * from student as of timestamp '2024-01-02 15:04:05.5'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read = res.(*statement.SelectStatement)
+	if read.AsOf == nil || read.AsOf.Xid != 0 || read.AsOf.Timestamp != time.Date(2024, 1, 2, 15, 4, 5, 500000000, time.Local).UnixNano() {
+		t.Errorf("as of timestamp error: %+v", read.AsOf)
+	}
+	for _, stat := range []string{"select * from student for delete", "delete from student where id = 1 for update",
+		"select * from student as of xid 0", "select * from student as of timestamp 'yesterday'", "select * from student as of xid 5 for update"} {
+		if _, err = parser.Parse([]byte(stat)); err == nil {
+			t.Errorf("expected error for %q", stat)
+		}
+	}
 }
 
 func TestInsert(t *testing.T) {
@@ -122,6 +192,22 @@ func TestInsert(t *testing.T) {
 	t.Log("==================")
 }
 
+// TestQuotedValues 连续的两个引号表示一个引号字符，空字符串是一个值而不是语句的结束
+func TestQuotedValues(t *testing.T) {
+	res, err := parser.Parse([]byte(`insert into student values 'it''s' "say ""hi""" '' 'a''"b' ''''`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := res.(*statement.InsertStatement).Values
+	expected := []string{"it's", `say "hi"`, "", `a'"b`, "'"}
+	if fmt.Sprintf("%q", values) != fmt.Sprintf("%q", expected) {
+		t.Fatalf("unexpected values %q", values)
+	}
+	if _, err = parser.Parse([]byte("insert into student values 'abc''")); err == nil {
+		t.Fatal("unterminated string should be rejected")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	t.Log("TestDelete")
 	stat := "delete from student where name = \"Xu Yifei\""
@@ -181,3 +267,123 @@ func TestUpdate(t *testing.T) {
 	t.Log(update)
 	t.Log("==================")
 }
+
+func TestCopy(t *testing.T) {
+	t.Log("TestCopy")
+	stat := "copy student from '/tmp/student data.csv' header"
+	res, err := parser.Parse([]byte(stat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyStatement, ok := res.(*statement.CopyStatement)
+	if !ok {
+		t.Fatal("not copy statement")
+	}
+	if copyStatement.TableName != "student" || !copyStatement.IsFrom || copyStatement.File != "/tmp/student data.csv" || !copyStatement.Header {
+		t.Errorf("copy statement error: %+v", copyStatement)
+	}
+
+	res, err = parser.Parse([]byte("copy student to 'out.csv'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyStatement = res.(*statement.CopyStatement)
+	if copyStatement.IsFrom || copyStatement.Header || copyStatement.File != "out.csv" {
+		t.Errorf("copy statement error: %+v", copyStatement)
+	}
+
+	if _, err = parser.Parse([]byte("copy student into 'out.csv'")); err == nil {
+		t.Error("expected error for invalid copy direction")
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	res, err := parser.Parse([]byte("savepoint a"))
+	if err != nil || res.(*statement.SavepointStatement).Name != "a" {
+		t.Fatalf("savepoint error: %v", err)
+	}
+	for _, stat := range []string{"rollback to a", "rollback to savepoint a"} {
+		res, err = parser.Parse([]byte(stat))
+		if err != nil || res.(*statement.RollbackStatement).Savepoint != "a" {
+			t.Fatalf("%s error: %v", stat, err)
+		}
+	}
+	for _, stat := range []string{"release a", "release savepoint a"} {
+		res, err = parser.Parse([]byte(stat))
+		if err != nil || res.(*statement.ReleaseStatement).Name != "a" {
+			t.Fatalf("%s error: %v", stat, err)
+		}
+	}
+	for _, stat := range []string{"savepoint", "rollback a", "release a b"} {
+		if _, err = parser.Parse([]byte(stat)); err == nil {
+			t.Errorf("expected error for %q", stat)
+		}
+	}
+}
+
+func TestPrepared(t *testing.T) {
+	res, err := parser.Parse([]byte("prepare transaction 'tx-1'"))
+	if err != nil || res.(*statement.PrepareStatement).Gid != "tx-1" {
+		t.Fatalf("prepare error: %v", err)
+	}
+	res, err = parser.Parse([]byte("commit prepared 'tx-1'"))
+	if err != nil || res.(*statement.CommitPreparedStatement).Gid != "tx-1" {
+		t.Fatalf("commit prepared error: %v", err)
+	}
+	res, err = parser.Parse([]byte("rollback prepared 'tx-1'"))
+	if err != nil || res.(*statement.RollbackPreparedStatement).Gid != "tx-1" {
+		t.Fatalf("rollback prepared error: %v", err)
+	}
+	if _, ok := res.(*statement.CommitStatement); ok {
+		t.Fatal("commit prepared should not be a commit statement")
+	}
+	for _, stat := range []string{"prepare 'tx-1'", "prepare transaction", "commit prepared", "rollback prepared 'a' 'b'"} {
+		if _, err = parser.Parse([]byte(stat)); err == nil {
+			t.Errorf("expected error for %q", stat)
+		}
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	res, params, err := parser.ParsePrepared([]byte("insert into student values ? 'a b' ?"))
+	if err != nil || params != 2 {
+		t.Fatalf("parse insert: %d %v", params, err)
+	}
+	insert := res.(*statement.InsertStatement)
+	if fmt.Sprint(insert.Params) != "[1 0 2]" {
+		t.Fatalf("unexpected params %v", insert.Params)
+	}
+	bound, err := parser.Bind(insert, []string{"1", "x' or '1'='1"})
+	if err != nil || fmt.Sprint(bound.(*statement.InsertStatement).Values) != "[1 a b x' or '1'='1]" {
+		t.Fatalf("unexpected bound values %v %v", bound, err)
+	}
+	if insert.Values[0] != "?" {
+		t.Fatal("binding should not modify the prepared statement")
+	}
+
+	res, params, err = parser.ParsePrepared([]byte("update student set name = ? where id > ? and id < ?"))
+	if err != nil || params != 3 {
+		t.Fatalf("parse update: %d %v", params, err)
+	}
+	bound, _ = parser.Bind(res, []string{"bob", "1", "5"})
+	update := bound.(*statement.UpdateStatement)
+	if update.Value != "bob" || update.Where.SingleExp1.Value != "1" || update.Where.SingleExp2.Value != "5" {
+		t.Fatalf("unexpected bound update %+v", update)
+	}
+	if _, err = parser.Bind(res, []string{"bob"}); err == nil {
+		t.Fatal("missing parameters should be rejected")
+	}
+
+	// 带引号的 ? 是普通的字符串，不带引号的 ? 不能出现在值以外的位置，也不能在普通语句中使用
+	if _, params, err = parser.ParsePrepared([]byte("select * from student where name = '?'")); err != nil || params != 0 {
+		t.Fatalf("quoted placeholder: %d %v", params, err)
+	}
+	for _, stat := range []string{"select * from ?", "delete from student where ? = 1", "update student set ? = 1"} {
+		if _, _, err = parser.ParsePrepared([]byte(stat)); err == nil {
+			t.Errorf("expected error for %q", stat)
+		}
+	}
+	if _, err = parser.Parse([]byte("delete from student where id = ?")); err == nil || err.Error() != commons.ErrorMessage.UnboundParameterError {
+		t.Fatalf("expected unbound parameter error, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package restore
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/dmPage"
+	"SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/utils"
+	"SimpleDB/commons"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+/**
+ * 时间点恢复：
+ * 1. 将基础备份中的.db、.xid、.bt文件复制到目标路径
+ * 2. 将归档目录以及基础备份中的日志段按编号复制到目标路径，段编号必须连续
+ * 3. 通过dm.RecoverToTarget重放所有日志，恢复目标之后的事务全部视为终止
+ */
+
+var (
+	// RestoreMemory 恢复时页面缓存使用的内存大小
+	RestoreMemory int64 = 64 << 20
+)
+
+// Restore 使用basePath处的基础备份和archiveDir中的归档日志，在targetPath处恢复出一个到target为止的数据库
+// 归档目录中的段文件需要与基础备份同名，即 archiveDir/base(basePath).00000001.log
+func Restore(targetPath string, basePath string, archiveDir string, target *dm.RecoveryTarget) error {
+	if target == nil || (target.Xid <= 0 && target.Time.IsZero()) {
+		return errors.New("restore target is required")
+	}
+	for _, suffix := range []string{dmPage.DB_SUFFIX, tm.XidSuffix, tbm.BooterSuffix} {
+		if utils.FileExists(targetPath + suffix) {
+			return commons.NewError(commons.ErrorMessage.FileExistError)
+		}
+		if err := utils.CopyFile(basePath+suffix, targetPath+suffix); err != nil {
+			return err
+		}
+	}
+	// 提交时间文件是后来加入的，旧的基础备份中可能没有；没有预备事务时也不会有预备事务文件
+	for _, suffix := range []string{tm.CommitTimeSuffix, tm.PreparedSuffix} {
+		if !utils.FileExists(basePath + suffix) {
+			continue
+		}
+		if err := utils.CopyFile(basePath+suffix, targetPath+suffix); err != nil {
+			return err
+		}
+	}
+	if err := copySegments(targetPath, basePath, archiveDir); err != nil {
+		return err
+	}
+
+	transactionManager, err := tm.OpenTransactionManagerImpl(targetPath)
+	if err != nil {
+		return err
+	}
+	dataManager := dm.RestoreDataManager(targetPath, RestoreMemory, transactionManager, target)
+	dataManager.Close()
+	transactionManager.Close()
+	return nil
+}
+
+// copySegments 收集归档目录和基础备份中的日志段，归档目录中的段已经完整关闭，优先使用
+func copySegments(targetPath string, basePath string, archiveDir string) error {
+	if len(logger.ListSegments(targetPath)) > 0 {
+		return commons.NewError(commons.ErrorMessage.FileExistError)
+	}
+
+	sources := make(map[int]string)
+	for _, segment := range logger.ListSegments(basePath) {
+		sources[segment] = logger.SegmentPath(basePath, segment)
+	}
+	if archiveDir != "" {
+		archivePath := filepath.Join(archiveDir, filepath.Base(basePath))
+		for _, segment := range logger.ListSegments(archivePath) {
+			sources[segment] = logger.SegmentPath(archivePath, segment)
+		}
+	}
+	if len(sources) == 0 {
+		return commons.NewError(commons.ErrorMessage.BadLogFileError)
+	}
+
+	first, last := 0, 0
+	for segment := range sources {
+		if first == 0 || segment < first {
+			first = segment
+		}
+		if segment > last {
+			last = segment
+		}
+	}
+	for segment := first; segment <= last; segment++ {
+		source, ok := sources[segment]
+		if !ok {
+			return fmt.Errorf("log segment %d is missing", segment)
+		}
+		if err := utils.CopyFile(source, logger.SegmentPath(targetPath, segment)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/restore"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOnlineBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	backupDir := filepath.Join(dir, "backup")
+
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	dataManager.DBLogger.SetSegmentSize(1024)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	tableManager.SetFileDir(dir)
+	execute(t, server.NewExecutor(tableManager), "create table student id int32, name string, (index id)")
+
+	// 备份期间持续写入
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			executor := server.NewExecutor(tableManager)
+			for i := 0; i < 100; i++ {
+				if _, err := executor.Execute([]byte(fmt.Sprintf("insert into student values %d name%d", w*1000+i, i))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	res := execute(t, server.NewExecutor(tableManager), "backup to 'backup'")
+	wg.Wait()
+	execute(t, server.NewExecutor(tableManager), "insert into student values 9999 after")
+	dataManager.Close()
+	transactionManager.Close()
+
+	backupPath := filepath.Join(backupDir, "db")
+	if res != "backup to "+backupPath {
+		t.Fatalf("unexpected backup result %q", res)
+	}
+
+	report, err := restore.Verify(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(report)
+
+	rows := strings.Count(selectAll(t, backupPath), "\n")
+	if rows > 200 || strings.Contains(selectAll(t, backupPath), "after") {
+		t.Errorf("backup contains rows written after it: %d", rows)
+	}
+	if rows := strings.Count(selectAll(t, path), "\n"); rows != 201 {
+		t.Errorf("expected 201 rows in the source database, got %d", rows)
+	}
+}
+
+// TestBackupRejectsPaths 备份只能写入文件目录下的目录，绝对路径和包含 .. 的路径都被拒绝，没有配置文件目录时不能备份
+func TestBackupRejectsPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	defer transactionManager.Close()
+	defer dataManager.Close()
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+
+	if _, err := executor.Execute([]byte("backup to 'backup'")); err == nil || err.Error() != commons.ErrorMessage.FileAccessDisabledError {
+		t.Fatalf("expected file access to be disabled, got %v", err)
+	}
+
+	fileDir := filepath.Join(dir, "files")
+	tableManager.SetFileDir(fileDir)
+	outside := filepath.Join(t.TempDir(), "backup")
+	for _, target := range []string{outside, "../backup", "a/../../backup"} {
+		_, err := executor.Execute([]byte("backup to '" + target + "'"))
+		if err == nil || err.Error() != commons.ErrorMessage.InvalidFilePathError || commons.ErrorCode(err) != commons.CodeInsufficientPrivilege {
+			t.Fatalf("backup to %s: expected invalid file path, got %v", target, err)
+		}
+	}
+	for _, target := range []string{outside, filepath.Join(dir, "backup")} {
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("backup created %s outside the file directory: %v", target, err)
+		}
+	}
+
+	if res := execute(t, executor, "backup to 'nightly/1'"); res != "backup to "+filepath.Join(fileDir, "nightly", "1", "db") {
+		t.Fatalf("unexpected backup result %q", res)
+	}
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/restore"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func copyFile(t *testing.T, source string, target string) {
+	src, err := os.Open(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := os.Create(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if _, err = io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func execute(t *testing.T, executor *server.Executor, sql string) string {
+	res, err := executor.Execute([]byte(sql))
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return string(res)
+}
+
+// selectAll 打开path处的数据库并查询全部数据
+func selectAll(t *testing.T, path string) string {
+	transactionManager, err := tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataManager := dm.OpenDataManager(path, 64<<20, transactionManager)
+	tableManager := tbm.OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	res := execute(t, server.NewExecutor(tableManager), "select * from student")
+	dataManager.Close()
+	transactionManager.Close()
+	return res
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	basePath := filepath.Join(dir, "base", "db")
+	archiveDir := filepath.Join(dir, "archive")
+
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	execute(t, server.NewExecutor(tableManager), "create table student id int32, name string, (index id)")
+	dataManager.Close()
+	transactionManager.Close()
+
+	// 基础备份
+	os.MkdirAll(filepath.Dir(basePath), 0755)
+	for _, suffix := range []string{".db", ".xid", ".bt"} {
+		copyFile(t, path+suffix, basePath+suffix)
+	}
+	copyFile(t, logger.SegmentPath(path, 1), logger.SegmentPath(basePath, 1))
+
+	transactionManager, _ = tm.OpenTransactionManagerImpl(path)
+	dataManager = dm.OpenDataManager(path, 64<<20, transactionManager)
+	dataManager.DBLogger.SetSegmentSize(256)
+	if err := dataManager.DBLogger.SetArchiveDir(archiveDir); err != nil {
+		t.Fatal(err)
+	}
+	tableManager = tbm.OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+
+	execute(t, executor, "insert into student values 1 alice")
+	untilXid := transactionManager.XidCounter() + 1
+	execute(t, executor, "insert into student values 2 bob")
+	time.Sleep(10 * time.Millisecond)
+	untilTime := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	execute(t, executor, "insert into student values 3 carol")
+	dataManager.Close()
+	transactionManager.Close()
+
+	xidPath := filepath.Join(dir, "xid", "db")
+	os.MkdirAll(filepath.Dir(xidPath), 0755)
+	if err := restore.Restore(xidPath, basePath, archiveDir, &dm.RecoveryTarget{Xid: untilXid}); err != nil {
+		t.Fatal(err)
+	}
+	res := selectAll(t, xidPath)
+	if !strings.Contains(res, "alice") || strings.Contains(res, "bob") || strings.Contains(res, "carol") {
+		t.Errorf("restore until xid %d got %q", untilXid, res)
+	}
+
+	timePath := filepath.Join(dir, "time", "db")
+	os.MkdirAll(filepath.Dir(timePath), 0755)
+	if err := restore.Restore(timePath, basePath, archiveDir, &dm.RecoveryTarget{Time: untilTime}); err != nil {
+		t.Fatal(err)
+	}
+	res = selectAll(t, timePath)
+	if !strings.Contains(res, "alice") || !strings.Contains(res, "bob") || strings.Contains(res, "carol") {
+		t.Errorf("restore until %v got %q", untilTime, res)
+	}
+}
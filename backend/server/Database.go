@@ -0,0 +1,147 @@
+package server
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"fmt"
+	"time"
+)
+
+// DefaultMemory 页面缓存默认的大小
+const DefaultMemory = 64 << 20
+
+// Options 打开数据库的选项，零值表示使用默认值
+type Options struct {
+	// Memory 页面缓存的大小
+	Memory int64
+	// ReadOnly 只读打开已有的数据库，不会修改任何文件
+	ReadOnly bool
+	// SegmentSize 日志段的大小上限
+	SegmentSize int64
+	// ArchiveDir 已关闭的日志段的归档目录，为空时不归档
+	ArchiveDir string
+	// LockTimeout 语句等待行锁的最长时间，为0时一直等待
+	LockTimeout time.Duration
+	// DeadlockPolicy 发生死锁时选择终止哪个事务
+	DeadlockPolicy vm.DeadlockPolicy
+	// Retention 历史查询能够访问的时间范围，为0时不限制
+	Retention time.Duration
+	// FileDir COPY 和 BACKUP TO 语句读写文件的目录，语句中的路径都相对于这个目录，为空时不能读写服务端的文件
+	FileDir string
+}
+
+// Database 打开的数据库，服务端和嵌入式使用相同的方式创建各层的管理器
+type Database struct {
+	TM  *tm.TransactionManagerImpl
+	DM  *dm.DataManager
+	TBM *tbm.TableManager
+}
+
+// CreateDatabase 在path处创建新的数据库，opts为nil时使用默认选项
+func CreateDatabase(path string, opts *Options) (*Database, error) {
+	return openDatabase(opts, func(opts *Options, memory int64) (*Database, error) {
+		transactionManager, err := tm.CreateTransactionManagerImpl(path)
+		if err != nil {
+			return nil, err
+		}
+		db := &Database{TM: transactionManager, DM: dm.CreateDataManager(path, memory)}
+		if err = db.configureLogger(opts); err != nil {
+			return nil, err
+		}
+		db.TBM = tbm.CreateTableManger(path, newVersionManager(db, opts), db.DM)
+		return db, nil
+	})
+}
+
+// OpenDatabase 打开path处已有的数据库，opts为nil时使用默认选项
+func OpenDatabase(path string, opts *Options) (*Database, error) {
+	return openDatabase(opts, func(opts *Options, memory int64) (*Database, error) {
+		if opts.ReadOnly {
+			transactionManager, err := tm.OpenReadOnlyTransactionManagerImpl(path)
+			if err != nil {
+				return nil, err
+			}
+			db := &Database{TM: transactionManager, DM: dm.OpenReadOnlyDataManager(path, memory, transactionManager)}
+			db.TBM = tbm.OpenReadOnlyTableManager(path, newVersionManager(db, opts), db.DM)
+			return db, nil
+		}
+		transactionManager, err := tm.OpenTransactionManagerImpl(path)
+		if err != nil {
+			return nil, err
+		}
+		db := &Database{TM: transactionManager, DM: dm.OpenDataManager(path, memory, transactionManager)}
+		if err = db.configureLogger(opts); err != nil {
+			return nil, err
+		}
+		db.TBM = tbm.OpenTableManager(path, newVersionManager(db, opts), db.DM)
+		return db, nil
+	})
+}
+
+// CreateMemoryDatabase 创建只保存在内存中的临时数据库，不支持只读打开和日志归档
+func CreateMemoryDatabase(opts *Options) (*Database, error) {
+	return openDatabase(opts, func(opts *Options, memory int64) (*Database, error) {
+		if opts.ReadOnly {
+			return nil, commons.NewError(commons.ErrorMessage.MemoryDatabaseError)
+		}
+		db := &Database{TM: tm.CreateMemoryTransactionManagerImpl(), DM: dm.CreateMemoryDataManager(memory)}
+		if err := db.configureLogger(opts); err != nil {
+			return nil, err
+		}
+		db.TBM = tbm.CreateMemoryTableManager(newVersionManager(db, opts), db.DM)
+		return db, nil
+	})
+}
+
+// openDatabase 填充默认选项，底层在文件损坏时会直接panic，这里统一转换为错误
+func openDatabase(opts *Options, open func(opts *Options, memory int64) (*Database, error)) (db *Database, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	memory := opts.Memory
+	if memory == 0 {
+		memory = DefaultMemory
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			db, err = nil, fmt.Errorf("open database failed: %v", r)
+		}
+	}()
+	db, err = open(opts, memory)
+	if err != nil {
+		return nil, err
+	}
+	db.TBM.SetFileDir(opts.FileDir)
+	return db, nil
+}
+
+// configureLogger 设置日志段大小和归档目录
+func (db *Database) configureLogger(opts *Options) error {
+	if opts.SegmentSize > 0 {
+		db.DM.DBLogger.SetSegmentSize(opts.SegmentSize)
+	}
+	if opts.ArchiveDir != "" {
+		return db.DM.DBLogger.SetArchiveDir(opts.ArchiveDir)
+	}
+	return nil
+}
+
+// newVersionManager 创建版本管理器，并设置等待锁的超时时间、死锁牺牲者策略和历史查询能够访问的时间范围
+func newVersionManager(db *Database, opts *Options) *vm.VersionManager {
+	versionManager := vm.NewVersionManager(db.TM, db.DM)
+	versionManager.LT.SetLockTimeout(opts.LockTimeout)
+	versionManager.LT.SetDeadlockPolicy(opts.DeadlockPolicy)
+	versionManager.SetRetention(opts.Retention)
+	return versionManager
+}
+
+// Close 将页面写回磁盘并关闭数据库的文件，调用之前必须结束所有的会话
+func (db *Database) Close() {
+	// 提交时间文件提交时不落盘，需要在第一页标记正常关闭之前落盘
+	db.TM.SyncCommitTimes()
+	db.DM.Close()
+	db.TM.Close()
+}
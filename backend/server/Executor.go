@@ -5,48 +5,201 @@ import (
 	"SimpleDB/backend/parser/statement"
 	"SimpleDB/backend/tbm"
 	"SimpleDB/commons"
-	"errors"
 )
 
 type Executor struct {
 	xid int64
 	TBM *tbm.TableManager
+	// cursor 当前打开的游标，同一时间只能有一个，执行下一条语句之前自动关闭
+	cursor *tbm.Cursor
+	// cursorTransaction 游标是否在临时事务中打开，临时事务在游标关闭时结束
+	cursorTransaction bool
+	// cursorStatement 游标是否在显式事务中打开，读取期间仍然可能加锁或者出错，语句在游标关闭时结束
+	cursorStatement bool
+	// prepared 当前连接的预备语句，解析之后的语句按编号缓存，连接关闭时释放
+	prepared       map[uint32]*preparedStatement
+	nextPreparedId uint32
+}
+
+// preparedStatement 解析之后的预备语句，params 为参数的个数
+type preparedStatement struct {
+	stat   interface{}
+	params int
 }
 
 func NewExecutor(tbm *tbm.TableManager) *Executor {
 	return &Executor{
-		xid: 0,
-		TBM: tbm,
+		xid:      0,
+		TBM:      tbm,
+		prepared: make(map[uint32]*preparedStatement),
 	}
 }
 
 func (e *Executor) Close() {
+	e.prepared = nil
+	e.CloseCursor()
 	if e.xid != 0 {
 		commons.Logger.Warnf("Abnormal Abort: %d", e.xid)
 		e.TBM.Abort(e.xid)
 	}
 }
 
+// Execute 执行一条语句，返回文本形式的结果
 func (e *Executor) Execute(sql []byte) ([]byte, error) {
+	result, rows, err := e.Query(sql)
+	if rows != nil {
+		return []byte(rows.String()), err
+	}
+	return result, err
+}
+
+// Query 执行一条语句，select 语句返回带有字段信息的查询结果 rows，其他语句返回文本形式的结果
+func (e *Executor) Query(sql []byte) ([]byte, *tbm.QueryResult, error) {
+	result, cursor, err := e.Open(sql)
+	if err != nil || cursor == nil {
+		return result, nil, err
+	}
+	rows := &tbm.QueryResult{Fields: cursor.Fields, Rows: make([][]interface{}, 0)}
+	for {
+		row, err := e.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if row == nil {
+			return nil, rows, nil
+		}
+		rows.Rows = append(rows.Rows, row)
+	}
+}
+
+// Open 执行一条语句，select 语句返回打开的游标，之后通过 Next 逐条读取记录，其他语句返回文本形式的结果
+// 之前打开的游标会被关闭
+func (e *Executor) Open(sql []byte) ([]byte, *tbm.Cursor, error) {
+	e.CloseCursor()
 	commons.Logger.Infof("Execute SQL: %s", string(sql))
 
 	stat, err := parser.Parse(sql)
 	if err != nil {
 		commons.Logger.Warnf("Parse SQL error: %s", err.Error())
-		return nil, err
+		return nil, nil, err
+	}
+	return e.open(stat)
+}
+
+// Prepare 解析带有参数占位符 ? 的语句并缓存，返回预备语句的编号和参数的个数
+func (e *Executor) Prepare(sql []byte) (uint32, int, error) {
+	commons.Logger.Infof("Prepare SQL: %s", string(sql))
+	stat, params, err := parser.ParsePrepared(sql)
+	if err != nil {
+		commons.Logger.Warnf("Parse SQL error: %s", err.Error())
+		return 0, 0, err
 	}
+	e.nextPreparedId++
+	e.prepared[e.nextPreparedId] = &preparedStatement{stat: stat, params: params}
+	return e.nextPreparedId, params, nil
+}
 
+// OpenPrepared 绑定参数并执行预备语句，参数的个数必须与语句中的参数个数相同，结果与 Open 相同
+func (e *Executor) OpenPrepared(id uint32, params []string) ([]byte, *tbm.Cursor, error) {
+	e.CloseCursor()
+	prepared, ok := e.prepared[id]
+	if !ok {
+		return nil, nil, commons.NewError(commons.ErrorMessage.PreparedStatementNotFoundError)
+	}
+	if len(params) != prepared.params {
+		return nil, nil, commons.NewError(commons.ErrorMessage.ParameterCountError)
+	}
+	stat, err := parser.Bind(prepared.stat, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e.open(stat)
+}
+
+// Deallocate 释放预备语句
+func (e *Executor) Deallocate(id uint32) error {
+	if _, ok := e.prepared[id]; !ok {
+		return commons.NewError(commons.ErrorMessage.PreparedStatementNotFoundError)
+	}
+	delete(e.prepared, id)
+	return nil
+}
+
+func (e *Executor) open(stat interface{}) ([]byte, *tbm.Cursor, error) {
+	if _, ok := stat.(*statement.SelectStatement); ok {
+		return e.execute2(stat)
+	}
+	result, err := e.execute(stat)
+	return result, nil, err
+}
+
+// Next 从当前的游标中读取下一条记录，读取完毕时关闭游标并返回nil，出错时同样关闭游标
+func (e *Executor) Next() ([]interface{}, error) {
+	if e.cursor == nil {
+		return nil, commons.NewError(commons.ErrorMessage.NoOpenCursorError)
+	}
+	row, err := e.cursor.Next()
+	if err != nil || row == nil {
+		// 语句的修改无法撤销时事务被自动终止，返回终止事务的错误
+		if closeErr := e.closeCursor(err != nil); closeErr != nil {
+			return nil, closeErr
+		}
+	}
+	return row, err
+}
+
+// Cursor 返回当前打开的游标，没有时返回nil
+func (e *Executor) Cursor() *tbm.Cursor {
+	return e.cursor
+}
+
+// HasCursor 判断是否有打开的游标
+func (e *Executor) HasCursor() bool {
+	return e.cursor != nil
+}
+
+// CloseCursor 关闭当前的游标，停止查询，游标在临时事务中打开时提交临时事务，在显式事务中打开时结束语句
+func (e *Executor) CloseCursor() error {
+	return e.closeCursor(false)
+}
+
+// closeCursor 关闭游标，failed 表示读取出错，显式事务中撤销语句的修改以及读取期间获得的锁
+func (e *Executor) closeCursor(failed bool) error {
+	if e.cursor == nil {
+		return nil
+	}
+	e.cursor.Close()
+	e.cursor = nil
+	var err error
+	if e.cursorStatement {
+		err = e.TBM.EndStatement(e.xid, failed)
+		e.cursorStatement = false
+	}
+	if e.cursorTransaction {
+		if failed {
+			e.TBM.Abort(e.xid)
+		} else {
+			e.TBM.Commit(e.xid)
+		}
+		e.xid = 0
+		e.cursorTransaction = false
+	}
+	return err
+}
+
+// execute 执行事务控制语句，其他语句交给 execute2 执行
+func (e *Executor) execute(stat interface{}) ([]byte, error) {
 	switch stat.(type) {
 	case *statement.BeginStatement:
 		if e.xid != 0 {
-			return nil, errors.New(commons.ErrorMessage.NestedTransactionError)
+			return nil, commons.NewError(commons.ErrorMessage.NestedTransactionError)
 		}
 		beginResult := e.TBM.Begin(stat.(*statement.BeginStatement))
 		e.xid = beginResult.Xid
 		return beginResult.Result, nil
 	case *statement.CommitStatement:
 		if e.xid == 0 {
-			return nil, errors.New(commons.ErrorMessage.NoTransactionError)
+			return nil, commons.NewError(commons.ErrorMessage.NoTransactionError)
 		}
 		res, err := e.TBM.Commit(e.xid)
 		if err != nil {
@@ -56,20 +209,65 @@ func (e *Executor) Execute(sql []byte) ([]byte, error) {
 		return res, nil
 	case *statement.AbortStatement:
 		if e.xid == 0 {
-			return nil, errors.New(commons.ErrorMessage.NoTransactionError)
+			return nil, commons.NewError(commons.ErrorMessage.NoTransactionError)
 		}
 		res := e.TBM.Abort(e.xid)
 		e.xid = 0
 		return res, nil
+	case *statement.PrepareStatement:
+		if e.xid == 0 {
+			return nil, commons.NewError(commons.ErrorMessage.NoTransactionError)
+		}
+		res, err := e.TBM.Prepare(e.xid, stat.(*statement.PrepareStatement))
+		if err != nil {
+			return nil, err
+		}
+		// 预备之后事务与当前连接分离，连接关闭时也不会终止它
+		e.xid = 0
+		return res, nil
+	case *statement.CommitPreparedStatement, *statement.RollbackPreparedStatement:
+		// 结束预备事务不属于当前连接的事务，不能在事务中执行
+		if e.xid != 0 {
+			return nil, commons.NewError(commons.ErrorMessage.NestedTransactionError)
+		}
+		if e.TBM.IsReadOnlyDatabase() {
+			return nil, commons.NewError(commons.ErrorMessage.ReadOnlyDatabaseError)
+		}
+		if commit, ok := stat.(*statement.CommitPreparedStatement); ok {
+			return e.TBM.CommitPrepared(commit)
+		}
+		return e.TBM.RollbackPrepared(stat.(*statement.RollbackPreparedStatement))
+	case *statement.SavepointStatement:
+		if e.xid == 0 {
+			return nil, commons.NewError(commons.ErrorMessage.NoTransactionError)
+		}
+		return e.TBM.Savepoint(e.xid, stat.(*statement.SavepointStatement))
+	case *statement.RollbackStatement:
+		if e.xid == 0 {
+			return nil, commons.NewError(commons.ErrorMessage.NoTransactionError)
+		}
+		return e.TBM.RollbackTo(e.xid, stat.(*statement.RollbackStatement))
+	case *statement.ReleaseStatement:
+		if e.xid == 0 {
+			return nil, commons.NewError(commons.ErrorMessage.NoTransactionError)
+		}
+		return e.TBM.Release(e.xid, stat.(*statement.ReleaseStatement))
+	case *statement.BackupStatement:
+		// 备份不属于任何事务，只读打开的数据库不能切换日志段
+		if e.TBM.IsReadOnlyDatabase() {
+			return nil, commons.NewError(commons.ErrorMessage.ReadOnlyDatabaseError)
+		}
+		return e.TBM.Backup(stat.(*statement.BackupStatement))
 	default:
-		return e.execute2(stat)
+		result, _, err := e.execute2(stat)
+		return result, err
 	}
 
 }
 
-func (e *Executor) execute2(stat interface{}) ([]byte, error) {
+// execute2 在当前事务或者临时事务中执行语句，select 语句打开游标，临时事务会保留到游标关闭
+func (e *Executor) execute2(stat interface{}) (result []byte, cursor *tbm.Cursor, err error) {
 	tmpTransaction := false
-	var err error = nil
 
 	// 如果当前没有事务，则开启一个新的事务
 	if e.xid == 0 {
@@ -78,7 +276,27 @@ func (e *Executor) execute2(stat interface{}) ([]byte, error) {
 		tmpTransaction = true
 	}
 
+	// 显式事务中的每条语句都是原子的，语句出错时撤销语句的修改，事务可以继续执行
+	if !tmpTransaction {
+		if err = e.TBM.BeginStatement(e.xid); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	defer func() {
+		// 游标读取期间仍然属于这条语句，临时事务和显式事务中的语句都在游标关闭时结束
+		if cursor != nil {
+			e.cursor = cursor
+			e.cursorTransaction = tmpTransaction
+			e.cursorStatement = !tmpTransaction
+			return
+		}
+		// 语句的修改无法撤销时事务被自动终止，语句的结果作废
+		if !tmpTransaction {
+			if endErr := e.TBM.EndStatement(e.xid, err != nil); endErr != nil {
+				result, err = nil, endErr
+			}
+		}
 		if tmpTransaction {
 			if err != nil {
 				e.TBM.Abort(e.xid)
@@ -89,7 +307,12 @@ func (e *Executor) execute2(stat interface{}) ([]byte, error) {
 		}
 	}()
 
-	var result []byte = nil
+	// 只读事务不能执行写语句，也不能加行锁
+	if isWriteStatement(stat) && e.TBM.IsReadOnly(e.xid) {
+		err = commons.NewError(commons.ErrorMessage.ReadOnlyTransactionError)
+		return nil, nil, err
+	}
+
 	switch stat.(type) {
 	case *statement.ShowStatement:
 		result = e.TBM.Show(e.xid)
@@ -98,7 +321,7 @@ func (e *Executor) execute2(stat interface{}) ([]byte, error) {
 		result, err = e.TBM.Create(e.xid, stat.(*statement.CreateStatement))
 		break
 	case *statement.SelectStatement:
-		result, err = e.TBM.Read(e.xid, stat.(*statement.SelectStatement))
+		cursor, err = e.TBM.OpenCursor(e.xid, stat.(*statement.SelectStatement))
 		break
 	case *statement.InsertStatement:
 		result, err = e.TBM.Insert(e.xid, stat.(*statement.InsertStatement))
@@ -109,11 +332,27 @@ func (e *Executor) execute2(stat interface{}) ([]byte, error) {
 	case *statement.UpdateStatement:
 		result, err = e.TBM.Update(e.xid, stat.(*statement.UpdateStatement))
 		break
+	case *statement.CopyStatement:
+		result, err = e.TBM.Copy(e.xid, stat.(*statement.CopyStatement))
+		break
 	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return result, nil
+	return result, cursor, nil
+
+}
 
+// isWriteStatement 判断语句是否会修改数据或者加行锁
+func isWriteStatement(stat interface{}) bool {
+	switch stat := stat.(type) {
+	case *statement.CreateStatement, *statement.InsertStatement, *statement.DeleteStatement, *statement.UpdateStatement:
+		return true
+	case *statement.SelectStatement:
+		return stat.ForUpdate || stat.ForShare
+	case *statement.CopyStatement:
+		return stat.IsFrom
+	}
+	return false
 }
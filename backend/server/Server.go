@@ -2,7 +2,9 @@ package server
 
 import (
 	"SimpleDB/backend/tbm"
+	"SimpleDB/commons"
 	"SimpleDB/transport"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -24,13 +26,20 @@ func (s *Server) Start() {
 		fmt.Println("Error starting server:", err)
 		return
 	}
-	defer ln.Close()
 	fmt.Println("Server listening on port:", s.port)
+	s.Serve(ln)
+}
 
+// Serve 在ln上接受连接并为每个连接启动一个协程，ln关闭后等待所有连接处理完毕再返回
+func (s *Server) Serve(ln net.Listener) {
+	defer ln.Close()
 	var wg sync.WaitGroup
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
 			fmt.Println("Error accepting connection:", err)
 			continue
 		}
@@ -45,13 +54,16 @@ func (s *Server) Start() {
 
 func handleConnection(conn net.Conn, tbm *tbm.TableManager) {
 	defer conn.Close()
-	addr := conn.RemoteAddr().(*net.TCPAddr)
-	fmt.Printf("Established connection: %s:%d\n", addr.IP, addr.Port)
-
-	transporter := transport.NewTransporter(conn)
-	encoder := &transport.Encoder{}
+	fmt.Printf("Established connection: %s\n", conn.RemoteAddr())
 
-	packager := transport.NewPackager(transporter, encoder)
+	// 根据客户端发送的第一个字节选择二进制协议或者旧的十六进制协议
+	packager, err := transport.ServerHandshake(conn)
+	if err != nil {
+		if err != io.EOF {
+			fmt.Println("Error negotiating protocol:", err)
+		}
+		return
+	}
 	executor := NewExecutor(tbm)
 
 	for {
@@ -63,12 +75,27 @@ func handleConnection(conn net.Conn, tbm *tbm.TableManager) {
 			break
 		}
 
-		sql := pkg.Data
-		var result []byte
-		var execErr error
-
-		result, execErr = executor.Execute(sql)
-		pkg = &transport.Package{Data: result, Err: execErr}
+		switch {
+		case !packager.IsBinary():
+			// 十六进制协议只能传输文本形式的结果，一次返回全部记录
+			result, execErr := executor.Execute(pkg.Data)
+			pkg = transport.NewPackage(result, execErr)
+		case pkg.GetType() == transport.MsgFetch:
+			pkg = fetch(executor, pkg)
+		case pkg.GetType() == transport.MsgClose:
+			// 显式事务中关闭游标时结束语句，语句无法结束时事务被自动终止
+			pkg = &transport.Package{Type: transport.MsgResult, Err: executor.CloseCursor()}
+		case pkg.GetType() == transport.MsgQuery:
+			pkg = open(executor, pkg.Data)
+		case pkg.GetType() == transport.MsgPrepare:
+			pkg = prepare(executor, pkg.Data)
+		case pkg.GetType() == transport.MsgExecute:
+			pkg = execute(executor, pkg.Data)
+		case pkg.GetType() == transport.MsgDeallocate:
+			pkg = deallocate(executor, pkg)
+		default:
+			pkg = &transport.Package{Err: commons.NewError(commons.ErrorMessage.InvalidPkgDataError)}
+		}
 
 		err = packager.Send(pkg)
 		if err != nil {
@@ -80,3 +107,103 @@ func handleConnection(conn net.Conn, tbm *tbm.TableManager) {
 	executor.Close()
 	packager.Close()
 }
+
+// open 执行一条语句，select 语句返回结果集和第一批记录
+func open(executor *Executor, sql []byte) *transport.Package {
+	result, cursor, err := executor.Open(sql)
+	return openResult(executor, result, cursor, err)
+}
+
+// prepare 解析并缓存预备语句，返回它的编号和参数个数
+func prepare(executor *Executor, sql []byte) *transport.Package {
+	id, params, err := executor.Prepare(sql)
+	if err != nil {
+		return &transport.Package{Err: err}
+	}
+	return transport.NewPreparedPackage(id, params)
+}
+
+// execute 绑定参数并执行预备语句，参数转换为文本后由字段的类型检查
+func execute(executor *Executor, data []byte) *transport.Package {
+	executor.CloseCursor()
+	id, values, err := transport.DecodeExecute(data)
+	if err != nil {
+		return &transport.Package{Err: err}
+	}
+	params := make([]string, len(values))
+	for i, v := range values {
+		params[i] = transport.FormatValue(v)
+	}
+	result, cursor, err := executor.OpenPrepared(id, params)
+	return openResult(executor, result, cursor, err)
+}
+
+// deallocate 释放预备语句
+func deallocate(executor *Executor, pkg *transport.Package) *transport.Package {
+	id, err := pkg.StatementId()
+	if err == nil {
+		err = executor.Deallocate(id)
+	}
+	return &transport.Package{Err: err}
+}
+
+// openResult 将执行语句的结果转换为数据包
+func openResult(executor *Executor, result []byte, cursor *tbm.Cursor, err error) *transport.Package {
+	if err != nil {
+		return &transport.Package{Err: err}
+	}
+	if cursor == nil {
+		return &transport.Package{Data: result}
+	}
+	rs := &transport.ResultSet{Columns: columns(cursor.Fields)}
+	rs.Rows, rs.More, err = nextBatch(executor, rs.Columns, transport.DefaultFetchSize)
+	if err != nil {
+		return &transport.Package{Err: err}
+	}
+	return &transport.Package{Type: transport.MsgResultSet, Data: transport.EncodeResultSet(rs)}
+}
+
+// fetch 返回当前结果集的后续记录
+func fetch(executor *Executor, pkg *transport.Package) *transport.Package {
+	n, err := pkg.FetchSize()
+	if err != nil {
+		return &transport.Package{Err: err}
+	}
+	if !executor.HasCursor() {
+		return &transport.Package{Err: commons.NewError(commons.ErrorMessage.NoOpenCursorError)}
+	}
+	cols := columns(executor.cursor.Fields)
+	rows, more, err := nextBatch(executor, cols, n)
+	if err != nil {
+		return &transport.Package{Err: err}
+	}
+	return &transport.Package{Type: transport.MsgRowBatch, Data: transport.EncodeRowBatch(cols, rows, more)}
+}
+
+// nextBatch 从游标中读取最多n条记录，编码后的长度达到 MaxBatchBytes 时提前结束，more 表示游标是否仍然打开
+func nextBatch(executor *Executor, cols []transport.Column, n int) ([][]interface{}, bool, error) {
+	rows := make([][]interface{}, 0)
+	size := 0
+	for len(rows) < n && size < transport.MaxBatchBytes {
+		row, err := executor.Next()
+		if err != nil {
+			return nil, false, err
+		}
+		if row == nil {
+			return rows, false, nil
+		}
+		rows = append(rows, row)
+		size += transport.RowSize(cols, row)
+	}
+	return rows, executor.HasCursor(), nil
+}
+
+// columns 将字段转换为结果集的列
+func columns(fields []*tbm.Field) []transport.Column {
+	cols := make([]transport.Column, len(fields))
+	for i, field := range fields {
+		columnType, _ := transport.ColumnType(field.FieldType)
+		cols[i] = transport.Column{Name: field.FieldName, Type: columnType}
+	}
+	return cols
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tm"
+	"SimpleDB/commons"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsOf(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, executor, "insert into account values 1 10")
+	inserted := tableManager.VM.TM.XidCounter()
+	insertedAt, _ := tableManager.VM.TM.CommitTime(inserted)
+	beforeUpdate := time.Unix(0, insertedAt)
+	mustExecute(t, executor, "update account set balance = 20 where id = 1")
+	updated := tableManager.VM.TM.XidCounter()
+	updatedAt, _ := tableManager.VM.TM.CommitTime(updated)
+	mustExecute(t, executor, "delete from account where id = 1")
+	deleted := tableManager.VM.TM.XidCounter()
+	if res := mustExecute(t, executor, "select * from account"); res != "" {
+		t.Fatalf("row should be deleted: %q", res)
+	}
+
+	expected := map[int64]string{inserted: "", updated: "10", deleted: "20", deleted + 1: ""}
+	for xid, balance := range expected {
+		res := mustExecute(t, executor, fmt.Sprintf("select * from account as of xid %d where id = 1", xid))
+		if (balance == "") != (res == "") || !strings.Contains(res, balance) || strings.Count(res, "\n") > 1 {
+			t.Fatalf("as of xid %d: expected balance %q, got %q", xid, balance, res)
+		}
+	}
+	res := mustExecute(t, executor, "select * from account as of timestamp '"+beforeUpdate.Format("2006-01-02 15:04:05.000000000")+"'")
+	if strings.Count(res, "\n") != 1 || !strings.Contains(res, "10") {
+		t.Fatalf("as of timestamp: %q", res)
+	}
+
+	// 显式事务中的历史查询不受事务快照的影响
+	mustExecute(t, executor, "begin isolation level repeatable read")
+	mustExecute(t, executor, "insert into account values 2 30")
+	res = mustExecute(t, executor, fmt.Sprintf("select * from account as of xid %d", deleted))
+	if strings.Count(res, "\n") != 1 || !strings.Contains(res, "20") {
+		t.Fatalf("as of xid in transaction: %q", res)
+	}
+	mustExecute(t, executor, "commit")
+
+	// 保留时间从更新提交时开始，更新之前的状态都已经超出保留范围
+	tableManager.VM.SetRetention(time.Since(time.Unix(0, updatedAt)))
+	for _, stat := range []string{fmt.Sprintf("select * from account as of xid %d", inserted),
+		"select * from account as of timestamp '" + beforeUpdate.Format("2006-01-02 15:04:05.000000000") + "'"} {
+		if _, err := executor.Execute([]byte(stat)); err == nil || err.Error() != commons.ErrorMessage.AsOfTooOldError {
+			t.Fatalf("%s: expected retention error, got %v", stat, err)
+		}
+	}
+	mustExecute(t, executor, fmt.Sprintf("select * from account as of xid %d", tableManager.VM.RetentionHorizon()))
+}
+
+// TestAsOfXidSnapshot 事务ID较小但是在目标事务开始之后才提交的修改不可见
+func TestAsOfXidSnapshot(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	writer := server.NewExecutor(tableManager)
+	reader := server.NewExecutor(tableManager)
+	mustExecute(t, writer, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, writer, "begin")
+	mustExecute(t, writer, "insert into account values 1 10")
+	mustExecute(t, reader, "begin")
+	target := tableManager.VM.TM.XidCounter()
+	mustExecute(t, writer, "commit")
+	mustExecute(t, reader, "commit")
+
+	if res := mustExecute(t, reader, fmt.Sprintf("select * from account as of xid %d", target)); res != "" {
+		t.Fatalf("transaction committed after xid %d began is visible: %q", target, res)
+	}
+	if res := mustExecute(t, reader, fmt.Sprintf("select * from account as of xid %d", target+1)); !strings.Contains(res, "10") {
+		t.Fatalf("committed insert is not visible: %q", res)
+	}
+}
+
+// TestAsOfCommitTimesRecovered 提交时间文件提交时不落盘，崩溃后根据提交日志补齐丢失的记录
+func TestAsOfCommitTimesRecovered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := server.CreateDatabase(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := server.NewExecutor(db.TBM)
+	mustExecute(t, executor, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, executor, "insert into account values 1 10")
+	inserted := db.TM.XidCounter()
+	insertedAt, _ := db.TM.CommitTime(inserted)
+
+	// 模拟崩溃时提交时间文件中还没有落盘的记录全部丢失
+	if err = os.Truncate(path+tm.CommitTimeSuffix, 0); err != nil {
+		t.Fatal(err)
+	}
+	db, err = server.OpenDatabase(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if timestamp, ok := db.TM.CommitTime(inserted); !ok || timestamp != insertedAt {
+		t.Fatalf("commit time of xid %d: %d %v, expected %d", inserted, timestamp, ok, insertedAt)
+	}
+	res := mustExecute(t, server.NewExecutor(db.TBM), fmt.Sprintf("select * from account as of xid %d", inserted+1))
+	if res != "[1,10]\n" {
+		t.Fatalf("as of xid %d after recovery: %q", inserted+1, res)
+	}
+}
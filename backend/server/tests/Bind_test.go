@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"SimpleDB/client"
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestExecuteEncoding(t *testing.T) {
+	params := []interface{}{int32(-1), int64(1) << 40, "a 'b'", ""}
+	pkg, err := transport.NewExecutePackage(7, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, decoded, err := transport.DecodeExecute(pkg.Data)
+	if err != nil || id != 7 || !reflect.DeepEqual(decoded, params) {
+		t.Fatalf("round trip mismatch: %d %v %v", id, decoded, err)
+	}
+	if _, _, err = transport.DecodeExecute(pkg.Data[:len(pkg.Data)-1]); err == nil {
+		t.Fatal("truncated parameters were accepted")
+	}
+	if _, err = transport.NewExecutePackage(7, []interface{}{1.5}); commons.ErrorCode(err) != commons.CodeDatatypeMismatch {
+		t.Fatalf("expected datatype mismatch, got %v", err)
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	addr := startServer(t)
+	cl := dialServer(t, addr, transport.ProtocolBinary)
+	cl.Execute([]byte("create table student id int32, age int64, name string, (index id)"))
+
+	insert, err := cl.Prepare([]byte("insert into student values ? ? ?"))
+	if err != nil || insert.NumParams != 3 {
+		t.Fatalf("prepare insert: %v", err)
+	}
+	// 参数的值不会被当作SQL解析，带有空格和引号的字符串原样保存
+	names := []string{"alice", "bob smith", "x' or '1'='1"}
+	for i, name := range names {
+		if _, err = insert.Execute(i+1, int64(20+i), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = insert.Execute(4, 24); client.ErrorCode(err) != commons.CodeProtocolViolation {
+		t.Fatalf("expected wrong parameter count, got %v", err)
+	}
+	if _, err = insert.Execute("four", 24, "dave"); client.ErrorCode(err) != commons.CodeInvalidTextRepresentation {
+		t.Fatalf("expected invalid value, got %v", err)
+	}
+
+	query, err := cl.Prepare([]byte("select * from student where id > ? and id < ?"))
+	if err != nil || query.NumParams != 2 {
+		t.Fatalf("prepare select: %v", err)
+	}
+	rows, err := query.Query(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		got = append(got, rows.Values()[2].(string))
+	}
+	if !reflect.DeepEqual(got, names[1:]) {
+		t.Fatalf("unexpected rows %q", got)
+	}
+	if res, err := query.Execute(0, 2); err != nil || string(res) != "[1,20,alice]\n" {
+		t.Fatalf("unexpected result %q %v", res, err)
+	}
+
+	// 预备语句在连接内缓存，释放之后不能再执行，也不会影响其他预备语句
+	if err = insert.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = insert.Execute(4, 24, "dave"); err == nil {
+		t.Fatal("closed statement should fail")
+	}
+	if _, err = query.Execute(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cl.Execute([]byte("select * from student where id = ?")); client.ErrorCode(err) != commons.CodeUndefinedParameter {
+		t.Fatalf("expected unbound parameter, got %v", err)
+	}
+	if _, err = cl.Prepare([]byte("select * from ? where id = 1")); client.ErrorCode(err) != commons.CodeSyntaxError {
+		t.Fatalf("expected syntax error, got %v", err)
+	}
+
+	// 预备语句的编号只在创建它的连接中有效
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager, err := transport.ClientHandshake(conn, transport.ProtocolBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packager.Close()
+	pkg, _ := transport.NewExecutePackage(2, []interface{}{int32(0), int32(2)})
+	packager.Send(pkg)
+	if res, err := packager.Receive(); err != nil || commons.ErrorCode(res.GetErr()) != commons.CodeInvalidStatementName {
+		t.Fatalf("expected unknown statement, got %v %v", res, err)
+	}
+	packager.Send(transport.NewDeallocatePackage(2))
+	if res, err := packager.Receive(); err != nil || commons.ErrorCode(res.GetErr()) != commons.CodeInvalidStatementName {
+		t.Fatalf("expected unknown statement, got %v %v", res, err)
+	}
+
+	hex := dialServer(t, addr, transport.ProtocolHex)
+	if _, err = hex.Prepare([]byte("select * from student where id = ?")); client.ErrorCode(err) != commons.CodeFeatureNotSupported {
+		t.Fatalf("hex protocol should not support prepared statements, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm/logger"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/utils"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckpointBoundsSegments 日志不断切换段时，检查点之前已经归档的段被删除，本地的段数保持有界，
+// 没有正常关闭时从检查点开始恢复，仍然能读到所有已经提交的数据
+func TestCheckpointBoundsSegments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	archive := filepath.Join(dir, "archive")
+	db, err := server.CreateDatabase(path, &server.Options{SegmentSize: 1024, ArchiveDir: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := server.NewExecutor(db.TBM)
+	mustExecute(t, executor, "create table account id int32, balance int32, (index id)")
+	for i := 0; i < 200; i++ {
+		mustExecute(t, executor, fmt.Sprintf("insert into account values %d %d", i, i*10))
+		if segments := logger.ListSegments(path); len(segments) > 3 {
+			t.Fatalf("%d local segments after %d inserts: %v", len(segments), i+1, segments)
+		}
+	}
+	segments := logger.ListSegments(path)
+	if segments[0] <= 1 {
+		t.Fatalf("old segments were not removed: %v", segments)
+	}
+	// 被删除的段都已经归档
+	for segment := 1; segment < segments[0]; segment++ {
+		if !utils.FileExists(logger.SegmentPath(filepath.Join(archive, "db"), segment)) {
+			t.Fatalf("segment %d removed before it was archived", segment)
+		}
+	}
+
+	// 不关闭数据库直接重新打开，模拟崩溃之后的恢复
+	db, err = server.OpenDatabase(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	res := mustExecute(t, server.NewExecutor(db.TBM), "select * from account")
+	if rows := strings.Count(res, "\n"); rows != 200 {
+		t.Fatalf("%d rows after recovery, expected 200", rows)
+	}
+	if !strings.Contains(res, "[199,1990]\n") {
+		t.Fatalf("last row missing after recovery: %q", res)
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openExecutor 在临时目录中创建数据库，返回执行器和关闭数据库的函数
+func openExecutor(t *testing.T) (*server.Executor, func()) {
+	executor, _, closeDB := openCopyExecutor(t)
+	return executor, closeDB
+}
+
+// openCopyExecutor 与 openExecutor 相同，同时返回 COPY 语句读写文件的目录
+func openCopyExecutor(t *testing.T) (*server.Executor, string, func()) {
+	path := filepath.Join(t.TempDir(), "db")
+	fileDir := t.TempDir()
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	tableManager.SetFileDir(fileDir)
+	return server.NewExecutor(tableManager), fileDir, func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}
+}
+
+func mustExecute(t *testing.T, executor *server.Executor, sql string) string {
+	res, err := executor.Execute([]byte(sql))
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return string(res)
+}
+
+func TestCopy(t *testing.T) {
+	executor, dir, closeDB := openCopyExecutor(t)
+	defer closeDB()
+
+	mustExecute(t, executor, "create table student id int32, name string, age int64, (index id)")
+	if err := os.Mkdir(filepath.Join(dir, "csv"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "csv", "in.csv"), []byte("id,name,age\n1,alice,20\n2,\"bob, jr\",21\n3,carol,22\n"), 0644)
+
+	if res := mustExecute(t, executor, "copy student from 'csv/in.csv' header"); res != "copy 3" {
+		t.Errorf("unexpected copy result %q", res)
+	}
+	if res := mustExecute(t, executor, "select * from student where id = 2"); res != "[2,bob, jr,21]\n" {
+		t.Errorf("unexpected select result %q", res)
+	}
+
+	if res := mustExecute(t, executor, "copy student to 'out.csv' header"); res != "copy 3" {
+		t.Errorf("unexpected copy result %q", res)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "out.csv"))
+	if string(data) != "id,name,age\n1,alice,20\n2,\"bob, jr\",21\n3,carol,22\n" {
+		t.Errorf("unexpected csv %q", string(data))
+	}
+}
+
+func TestCopyReportsLine(t *testing.T) {
+	executor, dir, closeDB := openCopyExecutor(t)
+	defer closeDB()
+
+	mustExecute(t, executor, "create table student id int32, name string, (index id)")
+	os.WriteFile(filepath.Join(dir, "in.csv"), []byte("1,alice\n2,bob\nx,carol\n"), 0644)
+
+	_, err := executor.Execute([]byte("copy student from 'in.csv'"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Fatalf("expected error at line 3, got %v", err)
+	}
+	// 导入在一个事务中进行，出错时之前导入的数据也会回滚
+	if res := mustExecute(t, executor, "select * from student"); res != "" {
+		t.Errorf("expected no rows after failed copy, got %q", res)
+	}
+}
+
+// TestCopyRejectsPaths COPY 只能读写文件目录下的文件，绝对路径和包含 .. 的路径都被拒绝，没有配置文件目录时不能使用 COPY
+func TestCopyRejectsPaths(t *testing.T) {
+	executor, dir, closeDB := openCopyExecutor(t)
+	defer closeDB()
+	mustExecute(t, executor, "create table student id int32, name string, (index id)")
+	outside := filepath.Join(t.TempDir(), "in.csv")
+	os.WriteFile(outside, []byte("1,alice\n"), 0644)
+
+	for _, sql := range []string{
+		"copy student from '" + outside + "'",
+		"copy student to '" + filepath.Join(filepath.Dir(outside), "out.csv") + "'",
+		"copy student from '../in.csv'",
+		"copy student to 'csv/../../out.csv'",
+	} {
+		_, err := executor.Execute([]byte(sql))
+		if err == nil || err.Error() != commons.ErrorMessage.InvalidFilePathError || commons.ErrorCode(err) != commons.CodeInsufficientPrivilege {
+			t.Fatalf("%s: expected invalid file path, got %v", sql, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(outside), "out.csv")); !os.IsNotExist(err) {
+		t.Fatalf("copy wrote a file outside the file directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "out.csv")); !os.IsNotExist(err) {
+		t.Fatalf("copy wrote a file outside the file directory: %v", err)
+	}
+
+	tableManager, closeTable := openTableManager(t)
+	defer closeTable()
+	disabled := server.NewExecutor(tableManager)
+	mustExecute(t, disabled, "create table student id int32, name string, (index id)")
+	if _, err := disabled.Execute([]byte("copy student to 'out.csv'")); err == nil || err.Error() != commons.ErrorMessage.FileAccessDisabledError {
+		t.Fatalf("expected file access to be disabled, got %v", err)
+	}
+}
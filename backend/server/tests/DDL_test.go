@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/fsck"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateTableVisibility(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	creator := server.NewExecutor(tableManager)
+	other := server.NewExecutor(tableManager)
+
+	mustExecute(t, creator, "begin")
+	mustExecute(t, creator, "create table student id int32, (index id)")
+	mustExecute(t, creator, "insert into student values 1")
+	if res := mustExecute(t, creator, "show"); !strings.Contains(res, "student") {
+		t.Fatalf("creator should see its table: %q", res)
+	}
+	if res := mustExecute(t, other, "show"); strings.Contains(res, "student") {
+		t.Fatalf("uncommitted table should be invisible: %q", res)
+	}
+	if _, err := other.Execute([]byte("select * from student")); err == nil || err.Error() != commons.ErrorMessage.TableNotFoundError {
+		t.Fatalf("expected table not found, got %v", err)
+	}
+	if _, err := other.Execute([]byte("create table student id int32, (index id)")); err == nil || err.Error() != commons.ErrorMessage.DuplicatedTableError {
+		t.Fatalf("expected duplicated table, got %v", err)
+	}
+	mustExecute(t, creator, "commit")
+	if res := mustExecute(t, other, "select * from student"); strings.Count(res, "\n") != 1 {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
+
+func TestCreateTableAbort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "create table teacher id int32, (index id)")
+
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "create table student id int32, (index id)")
+	mustExecute(t, executor, "insert into student values 1")
+	mustExecute(t, executor, "abort")
+	if res := mustExecute(t, executor, "show"); strings.Contains(res, "student") {
+		t.Fatalf("aborted table should be dropped: %q", res)
+	}
+
+	// 回滚到保存点时丢弃之后创建的表，之前创建的表保留
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "create table student id int32, (index id)")
+	mustExecute(t, executor, "savepoint a")
+	mustExecute(t, executor, "create table course id int32, (index id)")
+	mustExecute(t, executor, "rollback to a")
+	mustExecute(t, executor, "insert into student values 2")
+	mustExecute(t, executor, "commit")
+	res := mustExecute(t, executor, "show")
+	if !strings.Contains(res, "student") || strings.Contains(res, "course") {
+		t.Fatalf("unexpected tables %q", res)
+	}
+	// 建表失败不影响事务继续执行
+	mustExecute(t, executor, "begin")
+	if _, err := executor.Execute([]byte("create table course id int128, (index id)")); err == nil {
+		t.Fatal("expected invalid field type")
+	}
+	mustExecute(t, executor, "create table course id int32, (index id)")
+	mustExecute(t, executor, "commit")
+	dataManager.Close()
+	transactionManager.Close()
+
+	if report := fsck.Check(path); !report.OK {
+		t.Fatalf("fsck failed: %s", report.JSON())
+	}
+	transactionManager, _ = tm.OpenTransactionManagerImpl(path)
+	dataManager = dm.OpenDataManager(path, 64<<20, transactionManager)
+	tableManager = tbm.OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	defer func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}()
+	if names := strings.Join(tableManager.TableNames(), ","); names != "course,student,teacher" {
+		t.Fatalf("unexpected tables after reopen: %s", names)
+	}
+	if res := mustExecute(t, server.NewExecutor(tableManager), "select * from student"); strings.Count(res, "\n") != 1 || !strings.Contains(res, "2") {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"SimpleDB/client"
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"errors"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	addr := startServer(t)
+	for _, protocol := range []transport.Protocol{transport.ProtocolBinary, transport.ProtocolHex} {
+		cl := dialServer(t, addr, protocol)
+		cl.Execute([]byte("create table student id int32, name string, (index id)"))
+		for _, c := range []struct {
+			sql  string
+			code string
+		}{
+			{"selct * from student", commons.CodeSyntaxError},
+			{"select * from teacher", commons.CodeUndefinedTable},
+			{"select * from student where age = 1", commons.CodeUndefinedColumn},
+			{"insert into student values x alice", commons.CodeInvalidTextRepresentation},
+			{"commit", commons.CodeNoActiveTransaction},
+			{"create table student id int32, (index id)", commons.CodeDuplicateTable},
+		} {
+			_, err := cl.Execute([]byte(c.sql))
+			if client.ErrorCode(err) != c.code {
+				t.Fatalf("protocol %d, %s: expected code %s, got %v (%s)", protocol, c.sql, c.code, err, client.ErrorCode(err))
+			}
+			if client.IsRetryable(err) {
+				t.Fatalf("%s should not be retryable", c.sql)
+			}
+		}
+		cl.Close()
+	}
+
+	// 二进制协议携带错误在语句中的位置
+	cl := dialServer(t, addr, transport.ProtocolBinary)
+	defer cl.Close()
+	_, err := cl.Execute([]byte("select * from student where id = 1 1"))
+	var e *commons.Error
+	if !errors.As(err, &e) || e.Code != commons.CodeSyntaxError || e.Position != 36 {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	_, err = cl.Execute([]byte("selct * from student"))
+	if !errors.As(err, &e) || e.Position != 1 || e.Message != commons.ErrorMessage.InvalidCommandError {
+		t.Fatalf("unexpected error %#v", err)
+	}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	encoder := &transport.BinaryEncoder{}
+	for _, c := range []struct {
+		err       error
+		code      string
+		rollback  bool
+		retryable bool
+	}{
+		{commons.NewError(commons.ErrorMessage.DeadLockError), commons.CodeDeadlockDetected, true, true},
+		{commons.NewError(commons.ErrorMessage.SerializationFailureError), commons.CodeSerializationFailure, true, true},
+		{commons.NewError(commons.ErrorMessage.ConcurrentUpdateError), commons.CodeSerializationFailure, true, true},
+		{commons.NewError(commons.ErrorMessage.LockTimeoutError), commons.CodeLockNotAvailable, false, true},
+		{errors.New("unknown"), commons.CodeInternalError, false, false},
+	} {
+		pkg, err := encoder.Decode(encoder.Encode(&transport.Package{Err: c.err}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.GetErr().Error() != c.err.Error() || client.ErrorCode(pkg.GetErr()) != c.code {
+			t.Fatalf("%v: decoded %#v", c.err, pkg.GetErr())
+		}
+		if client.IsTransactionRollback(pkg.GetErr()) != c.rollback || client.IsRetryable(pkg.GetErr()) != c.retryable {
+			t.Fatalf("%v: unexpected retry classification", c.err)
+		}
+	}
+	if client.ErrorCode(nil) != "" || client.IsRetryable(nil) {
+		t.Fatal("nil error should have no code")
+	}
+}
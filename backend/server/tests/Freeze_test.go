@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFreezeKeepsLiveSnapshot(t *testing.T) {
+	threshold := tm.FreezeThreshold
+	tm.FreezeThreshold = 16
+	defer func() { tm.FreezeThreshold = threshold }()
+
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "create table student id int32, (index id)")
+	for i := 0; i < 20; i++ {
+		mustExecute(t, executor, fmt.Sprintf("insert into student values %d", i))
+	}
+
+	// 可重复读事务开始后，它之前的事务可以被冻结，它自己以及之后的事务不能被冻结
+	reader := server.NewExecutor(tableManager)
+	mustExecute(t, reader, "begin isolation level repeatable read")
+	readerXid := transactionManager.XidCounter()
+	before := mustExecute(t, reader, "select * from student")
+
+	for i := 20; i < 100; i++ {
+		mustExecute(t, executor, fmt.Sprintf("insert into student values %d", i))
+		if i%5 == 0 {
+			mustExecute(t, executor, "begin")
+			mustExecute(t, executor, fmt.Sprintf("delete from student where id = %d", i))
+			mustExecute(t, executor, "abort")
+		}
+	}
+	if frozen := transactionManager.FrozenXid(); frozen == 0 || frozen >= readerXid {
+		t.Fatalf("frozen xid %d should be in [1, %d)", frozen, readerXid)
+	}
+	if after := mustExecute(t, reader, "select * from student"); after != before {
+		t.Fatalf("snapshot changed after freeze:\n%s\n%s", before, after)
+	}
+	mustExecute(t, reader, "commit")
+
+	for i := 100; i < 120; i++ {
+		mustExecute(t, executor, fmt.Sprintf("insert into student values %d", i))
+	}
+	if frozen := transactionManager.FrozenXid(); frozen <= readerXid {
+		t.Fatalf("frozen xid %d should pass the finished reader %d", frozen, readerXid)
+	}
+	// 被终止的删除不影响冻结后的可见性
+	if rows := strings.Count(mustExecute(t, executor, "select * from student"), "\n"); rows != 120 {
+		t.Fatalf("expected 120 rows, got %d", rows)
+	}
+	dataManager.Close()
+	transactionManager.Close()
+}
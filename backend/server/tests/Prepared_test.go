@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreparedTransaction(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	tableManager.VM.LT.SetLockTimeout(50 * time.Millisecond)
+	session := server.NewExecutor(tableManager)
+	other := server.NewExecutor(tableManager)
+	mustExecute(t, session, "create table student id int32, (index id)")
+	mustExecute(t, session, "insert into student values 1")
+
+	mustExecute(t, session, "begin")
+	mustExecute(t, session, "insert into student values 2")
+	mustExecute(t, session, "delete from student where id = 1")
+	mustExecute(t, session, "prepare transaction 'g1'")
+	// 预备之后连接可以开始新的事务
+	mustExecute(t, session, "begin")
+	if _, err := session.Execute([]byte("prepare transaction 'g1'")); err == nil || err.Error() != commons.ErrorMessage.DuplicatedGidError {
+		t.Fatalf("expected duplicated gid, got %v", err)
+	}
+	if _, err := session.Execute([]byte("commit prepared 'g1'")); err == nil || err.Error() != commons.ErrorMessage.NestedTransactionError {
+		t.Fatalf("expected nested transaction, got %v", err)
+	}
+	mustExecute(t, session, "create table teacher id int32, (index id)")
+	if _, err := session.Execute([]byte("prepare transaction 'g2'")); err == nil || err.Error() != commons.ErrorMessage.CannotPrepareError {
+		t.Fatalf("expected cannot prepare, got %v", err)
+	}
+	mustExecute(t, session, "abort")
+
+	if res := mustExecute(t, other, "select * from student"); strings.Count(res, "\n") != 1 || !strings.Contains(res, "1") {
+		t.Fatalf("prepared changes should be invisible: %q", res)
+	}
+	if _, err := other.Execute([]byte("delete from student where id = 1")); err == nil || err.Error() != commons.ErrorMessage.LockTimeoutError {
+		t.Fatalf("prepared transaction should keep its row locks, got %v", err)
+	}
+	if _, err := other.Execute([]byte("rollback prepared 'g2'")); err == nil || err.Error() != commons.ErrorMessage.PreparedTransactionNotFoundError {
+		t.Fatalf("expected prepared transaction not found, got %v", err)
+	}
+	mustExecute(t, other, "commit prepared 'g1'")
+	if res := mustExecute(t, other, "select * from student"); strings.Count(res, "\n") != 1 || !strings.Contains(res, "2") {
+		t.Fatalf("unexpected result %q", res)
+	}
+	if _, err := other.Execute([]byte("commit prepared 'g1'")); err == nil || err.Error() != commons.ErrorMessage.PreparedTransactionNotFoundError {
+		t.Fatalf("expected prepared transaction not found, got %v", err)
+	}
+}
+
+// TestPrepareInvalidGid 全局事务ID不合法时只有 PREPARE 失败，事务不会被终止
+func TestPrepareInvalidGid(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	session := server.NewExecutor(tableManager)
+	mustExecute(t, session, "create table student id int32, (index id)")
+	mustExecute(t, session, "begin")
+	mustExecute(t, session, "insert into student values 1")
+	gid := strings.Repeat("g", tm.MaxGidLength+1)
+	if _, err := session.Execute([]byte("prepare transaction '" + gid + "'")); commons.ErrorCode(err) != commons.CodeInvalidParameterValue {
+		t.Fatalf("expected invalid gid, got %v", err)
+	}
+	mustExecute(t, session, "insert into student values 2")
+	mustExecute(t, session, "prepare transaction 'g1'")
+	mustExecute(t, session, "commit prepared 'g1'")
+	if res := mustExecute(t, session, "select * from student"); res != "[1]\n[2]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
+
+func TestPreparedTransactionRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "create table student id int32, (index id)")
+	mustExecute(t, executor, "insert into student values 1")
+	mustExecute(t, executor, "insert into student values 2")
+
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "insert into student values 3")
+	mustExecute(t, executor, "delete from student where id = 1")
+	mustExecute(t, executor, "prepare transaction 'commit-me'")
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "insert into student values 4")
+	mustExecute(t, executor, "select * from student where id = 2 for update")
+	mustExecute(t, executor, "prepare transaction 'rollback-me'")
+	// 活动事务在重启后被撤销
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "insert into student values 5")
+
+	// 不关闭数据库，模拟崩溃后重启
+	transactionManager, _ = tm.OpenTransactionManagerImpl(path)
+	dataManager = dm.OpenDataManager(path, 64<<20, transactionManager)
+	tableManager = tbm.OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	defer func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}()
+	tableManager.VM.LT.SetLockTimeout(50 * time.Millisecond)
+	executor = server.NewExecutor(tableManager)
+	if res := mustExecute(t, executor, "select * from student"); res != "[1]\n[2]\n" {
+		t.Fatalf("prepared changes should be invisible after restart: %q", res)
+	}
+	for _, stat := range []string{"delete from student where id = 1", "update student set id = 6 where id = 2"} {
+		if _, err := executor.Execute([]byte(stat)); err == nil || err.Error() != commons.ErrorMessage.LockTimeoutError {
+			t.Fatalf("%s: row locks should be restored, got %v", stat, err)
+		}
+	}
+
+	mustExecute(t, executor, "rollback prepared 'rollback-me'")
+	mustExecute(t, executor, "update student set id = 6 where id = 2")
+	mustExecute(t, executor, "commit prepared 'commit-me'")
+	if res := mustExecute(t, executor, "select * from student"); res != "[3]\n[6]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	if len(transactionManager.Prepared()) != 0 {
+		t.Fatal("no transaction should be prepared")
+	}
+}
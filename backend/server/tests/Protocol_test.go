@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"SimpleDB/client"
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// echoServer 在conn上完成协商，之后将收到的语句原样返回，语句为 "error" 时返回错误
+// 协商失败时直接关闭连接，由客户端检查协商的结果
+func echoServer(conn net.Conn) {
+	packager, err := transport.ServerHandshake(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer packager.Close()
+	for {
+		pkg, err := packager.Receive()
+		if err != nil {
+			return
+		}
+		if string(pkg.GetData()) == "error" {
+			err = packager.Send(transport.NewPackage(nil, errors.New("bad statement")))
+		} else {
+			err = packager.Send(transport.NewPackage(pkg.GetData(), nil))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	for _, protocol := range []transport.Protocol{transport.ProtocolBinary, transport.ProtocolHex} {
+		clientConn, serverConn := net.Pipe()
+		go echoServer(serverConn)
+		packager, err := transport.ClientHandshake(clientConn, protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cl := client.NewClient(packager)
+		large := strings.Repeat("x", 1<<20)
+		if res, err := cl.Execute([]byte(large)); err != nil || string(res) != large {
+			t.Fatalf("protocol %d: large payload was not echoed: %v", protocol, err)
+		}
+		if res, err := cl.Execute([]byte("")); err != nil || len(res) != 0 {
+			t.Fatalf("protocol %d: empty payload was not echoed: %v", protocol, err)
+		}
+		if _, err = cl.Execute([]byte("error")); err == nil || err.Error() != "bad statement" {
+			t.Fatalf("protocol %d: expected error, got %v", protocol, err)
+		}
+		cl.Close()
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	handshake := func(version uint16) uint16 {
+		clientConn, serverConn := net.Pipe()
+		defer clientConn.Close()
+		go echoServer(serverConn)
+		message := append(append([]byte{}, transport.ProtocolMagic...), 0, 0)
+		binary.BigEndian.PutUint16(message[len(transport.ProtocolMagic):], version)
+		if _, err := clientConn.Write(message); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, len(message))
+		if _, err := io.ReadFull(clientConn, reply); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(reply[:len(transport.ProtocolMagic)], transport.ProtocolMagic) {
+			t.Fatalf("bad magic %v", reply)
+		}
+		return binary.BigEndian.Uint16(reply[len(transport.ProtocolMagic):])
+	}
+	// 客户端支持更高的版本时使用服务端支持的最高版本
+	if version := handshake(transport.ProtocolVersion + 5); version != transport.ProtocolVersion {
+		t.Fatalf("negotiated version %d", version)
+	}
+	if version := handshake(0); version != 0 {
+		t.Fatalf("version 0 should be rejected, got %d", version)
+	}
+	// 版本1的客户端仍然可以连接
+	if version := handshake(1); version != 1 {
+		t.Fatalf("version 1 should still be accepted, got %d", version)
+	}
+}
+
+// TestVersionOneErrorFrame 版本1的错误消息只有错误信息，接收方根据错误信息还原错误码
+func TestVersionOneErrorFrame(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	message := commons.ErrorMessage.ReadOnlyDatabaseError
+	go func() {
+		err := commons.NewError(message).WithPosition(3)
+		transport.NewPackager(transport.NewBinaryTransporter(clientConn), &transport.BinaryEncoder{Version: 1}).
+			Send(&transport.Package{Type: transport.MsgError, Err: err})
+	}()
+	frame := make([]byte, 5+len(message))
+	if _, err := io.ReadFull(serverConn, frame); err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint32(frame) != uint32(1+len(message)) || frame[4] != transport.MsgError || string(frame[5:]) != message {
+		t.Fatalf("unexpected version 1 error frame %v", frame)
+	}
+
+	pkg, err := (&transport.BinaryEncoder{Version: 1}).Decode(frame[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := pkg.GetError(); e == nil || e.Message != message || e.Code != commons.CodeReadOnlyTransaction || e.Position != 0 {
+		t.Fatalf("unexpected decoded error %+v", e)
+	}
+}
+
+func TestBinaryFrame(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	go func() {
+		transport.NewPackager(transport.NewBinaryTransporter(clientConn), &transport.BinaryEncoder{}).
+			Send(&transport.Package{Type: transport.MsgQuery, Data: []byte("show")})
+	}()
+	frame := make([]byte, 9)
+	if _, err := io.ReadFull(serverConn, frame); err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint32(frame) != 5 || frame[4] != transport.MsgQuery || string(frame[5:]) != "show" {
+		t.Fatalf("unexpected frame %v", frame)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyTransaction(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	writer := server.NewExecutor(tableManager)
+	mustExecute(t, writer, "create table student id int32, (index id)")
+	mustExecute(t, writer, "insert into student values 1")
+
+	// 只读事务开始之后，写事务才分配到与只读事务快照上界相同的事务ID
+	reader := server.NewExecutor(tableManager)
+	counter := tableManager.VM.TM.XidCounter()
+	mustExecute(t, reader, "begin isolation level repeatable read read only")
+	if tableManager.VM.TM.XidCounter() != counter {
+		t.Fatal("read-only transaction should not allocate a xid")
+	}
+	mustExecute(t, writer, "begin")
+	mustExecute(t, writer, "insert into student values 2")
+	mustExecute(t, writer, "delete from student where id = 1")
+	if res := mustExecute(t, reader, "select * from student"); strings.Count(res, "\n") != 1 || !strings.Contains(res, "1") {
+		t.Fatalf("uncommitted changes of the writer should not be visible: %q", res)
+	}
+	mustExecute(t, writer, "commit")
+	if res := mustExecute(t, reader, "select * from student"); strings.Count(res, "\n") != 1 || !strings.Contains(res, "1") {
+		t.Fatalf("snapshot changed: %q", res)
+	}
+
+	for _, stat := range []string{"insert into student values 3", "update student set id = 4 where id = 1",
+		"delete from student where id = 1", "create table teacher id int32, (index id)", "select * from student for share"} {
+		if _, err := reader.Execute([]byte(stat)); err == nil || err.Error() != commons.ErrorMessage.ReadOnlyTransactionError {
+			t.Fatalf("%s: expected read-only error, got %v", stat, err)
+		}
+	}
+	// 语句出错不影响只读事务继续执行
+	mustExecute(t, reader, "select * from student")
+	mustExecute(t, reader, "commit")
+	if tableManager.VM.TM.XidCounter() != counter+1 {
+		t.Fatalf("only the writer should allocate a xid, counter %d", tableManager.VM.TM.XidCounter())
+	}
+	if res := mustExecute(t, reader, "select * from student"); strings.Count(res, "\n") != 1 || !strings.Contains(res, "2") {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
+
+// readFiles 读取目录中所有文件的内容
+func readFiles(t *testing.T, dir string) map[string][]byte {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = data
+	}
+	return files
+}
+
+func TestReadOnlyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "create table student id int32, (index id)")
+	mustExecute(t, executor, "insert into student values 1")
+	mustExecute(t, executor, "insert into student values 2")
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "insert into student values 3")
+	// 不关闭数据库，模拟运行中的数据库，打开时需要在内存中恢复
+	before := readFiles(t, dir)
+
+	readOnlyTM, err := tm.OpenReadOnlyTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnlyDM := dm.OpenReadOnlyDataManager(path, 64<<20, readOnlyTM)
+	readOnlyTBM := tbm.OpenReadOnlyTableManager(path, vm.NewVersionManager(readOnlyTM, readOnlyDM), readOnlyDM)
+	reader := server.NewExecutor(readOnlyTBM)
+	if res := mustExecute(t, reader, "select * from student"); strings.Count(res, "\n") != 2 || strings.Contains(res, "3") {
+		t.Fatalf("unexpected result %q", res)
+	}
+	mustExecute(t, reader, "begin")
+	if _, err = reader.Execute([]byte("insert into student values 4")); err == nil || err.Error() != commons.ErrorMessage.ReadOnlyTransactionError {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	mustExecute(t, reader, "commit")
+	if _, err = reader.Execute([]byte("backup to '" + filepath.Join(t.TempDir(), "backup") + "'")); err == nil || err.Error() != commons.ErrorMessage.ReadOnlyDatabaseError {
+		t.Fatalf("expected read-only database error, got %v", err)
+	}
+	readOnlyDM.Close()
+	readOnlyTM.Close()
+
+	after := readFiles(t, dir)
+	if len(after) != len(before) {
+		t.Fatalf("files changed: %d -> %d", len(before), len(after))
+	}
+	for name, data := range before {
+		if !bytes.Equal(data, after[name]) {
+			t.Fatalf("%s was modified", name)
+		}
+	}
+	mustExecute(t, executor, "commit")
+	dataManager.Close()
+	transactionManager.Close()
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"SimpleDB/backend/server"
+	"SimpleDB/client"
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// startServer 在随机端口上启动服务端，返回它的地址
+func startServer(t *testing.T) string {
+	tableManager, closeDB := openTableManager(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		server.NewServer(0, tableManager).Serve(ln)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		<-done
+		closeDB()
+	})
+	return ln.Addr().String()
+}
+
+func dialServer(t *testing.T, addr string, protocol transport.Protocol) *client.Client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager, err := transport.ClientHandshake(conn, protocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := client.NewClient(packager)
+	// 测试失败时也要关闭连接，否则服务端会一直等待连接结束
+	t.Cleanup(cl.Close)
+	return cl
+}
+
+func TestResultSetEncoding(t *testing.T) {
+	rs := &transport.ResultSet{
+		Columns: []transport.Column{{Name: "id", Type: transport.ColumnInt32}, {Name: "age", Type: transport.ColumnInt64}, {Name: "name", Type: transport.ColumnString}},
+		Rows:    [][]interface{}{{int32(-1), int64(1) << 40, "alice"}, {int32(2), int64(0), ""}},
+	}
+	data := transport.EncodeResultSet(rs)
+	decoded, err := transport.DecodeResultSet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rs, decoded) {
+		t.Fatalf("round trip mismatch: %v", decoded)
+	}
+	if _, err = transport.DecodeResultSet(data[:len(data)-1]); err == nil {
+		t.Fatal("truncated result set was accepted")
+	}
+	if _, err = transport.DecodeResultSet(append(data, 0)); err == nil {
+		t.Fatal("trailing bytes were accepted")
+	}
+}
+
+func TestTypedResultSet(t *testing.T) {
+	addr := startServer(t)
+	cl := dialServer(t, addr, transport.ProtocolBinary)
+	defer cl.Close()
+	for _, sql := range []string{
+		"create table student id int32, age int64, name string, (index id)",
+		"insert into student values 1 4294967296 alice",
+		"insert into student values 2 20 bob",
+	} {
+		if _, err := cl.Execute([]byte(sql)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := cl.Query([]byte("select * from student where id > 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []transport.Column{{Name: "id", Type: transport.ColumnInt32}, {Name: "age", Type: transport.ColumnInt64}, {Name: "name", Type: transport.ColumnString}}
+	if !reflect.DeepEqual(rows.Columns(), expected) {
+		t.Fatalf("unexpected columns %v", rows.Columns())
+	}
+	var values [][]interface{}
+	for rows.Next() {
+		values = append(values, rows.Values())
+	}
+	if !reflect.DeepEqual(values, [][]interface{}{{int32(1), int64(4294967296), "alice"}, {int32(2), int64(20), "bob"}}) {
+		t.Fatalf("unexpected rows %v", values)
+	}
+
+	rows, err = cl.Query([]byte("select * from student where id = 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	var age int64
+	var name string
+	if !rows.Next() || rows.Scan(&id, &age, &name) != nil || id != 2 || age != 20 || name != "bob" || rows.Next() {
+		t.Fatalf("unexpected row %d %d %q", id, age, name)
+	}
+	var small int32
+	rows, _ = cl.Query([]byte("select * from student where id = 1"))
+	if !rows.Next() || rows.Scan(&id, &small, &name) == nil {
+		t.Fatal("overflowing Scan should fail")
+	}
+
+	// 空结果集仍然带有列的信息
+	rows, err = cl.Query([]byte("select * from student where id = 3"))
+	if err != nil || len(rows.Columns()) != 3 || rows.Next() {
+		t.Fatalf("unexpected empty result %v", err)
+	}
+	if _, err = cl.Query([]byte("insert into student values 3 1 carol")); err == nil || err.Error() != commons.ErrorMessage.NoResultSetError {
+		t.Fatalf("expected no result set error, got %v", err)
+	}
+	if res, err := cl.Execute([]byte("select * from student where id = 1")); err != nil || string(res) != "[1,4294967296,alice]\n" {
+		t.Fatalf("unexpected text result %q %v", res, err)
+	}
+
+	// 十六进制协议只能返回文本形式的结果
+	hex := dialServer(t, addr, transport.ProtocolHex)
+	defer hex.Close()
+	if res, err := hex.Execute([]byte("select * from student where id = 2")); err != nil || string(res) != "[2,20,bob]\n" {
+		t.Fatalf("unexpected hex result %q %v", res, err)
+	}
+	if _, err = hex.Query([]byte("select * from student where id = 2")); err == nil {
+		t.Fatal("hex protocol should not return a result set")
+	}
+}
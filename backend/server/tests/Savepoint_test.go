@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/fsck"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollbackToSavepoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "create table student id int32, age int32, (index id age)")
+
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "insert into student values 1 20")
+	mustExecute(t, executor, "insert into student values 2 21")
+	mustExecute(t, executor, "savepoint a")
+	mustExecute(t, executor, "insert into student values 3 22")
+	mustExecute(t, executor, "delete from student where id = 1")
+	mustExecute(t, executor, "update student set age = 30 where id = 2")
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[2,30]\n[3,22]\n" {
+		t.Fatalf("unexpected result before rollback %q", res)
+	}
+
+	if res := mustExecute(t, executor, "rollback to savepoint a"); res != "rollback to a" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[1,20]\n[2,21]\n" {
+		t.Fatalf("unexpected result after rollback %q", res)
+	}
+	// 保存点之后插入的索引项已经被删除
+	if res := mustExecute(t, executor, "select * from student where age = 30"); res != "" {
+		t.Fatalf("index entry was not removed: %q", res)
+	}
+
+	// 回滚后保存点仍然存在，可以再次回滚
+	mustExecute(t, executor, "insert into student values 3 23")
+	mustExecute(t, executor, "rollback to a")
+	mustExecute(t, executor, "insert into student values 4 24")
+	mustExecute(t, executor, "commit")
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[1,20]\n[2,21]\n[4,24]\n" {
+		t.Fatalf("unexpected result after commit %q", res)
+	}
+
+	dataManager.Close()
+	transactionManager.Close()
+	if report := fsck.Check(path); !report.OK {
+		t.Fatalf("database is inconsistent: %s", report.JSON())
+	}
+}
+
+func TestRollbackToSavepointReleasesLocks(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, setup, "insert into account values 1 10")
+	mustExecute(t, setup, "insert into account values 2 10")
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	mustExecute(t, t1, "begin")
+	mustExecute(t, t1, "select * from account where id = 1 for share")
+	mustExecute(t, t1, "savepoint s")
+	mustExecute(t, t1, "update account set balance = 0 where id = 1")
+	mustExecute(t, t1, "delete from account where id = 2")
+	mustExecute(t, t1, "rollback to s")
+
+	// 保存点之后获得的锁被释放，升级的锁恢复为共享锁
+	mustExecute(t, t2, "begin")
+	if res := mustExecute(t, t2, "delete from account where id = 2"); res != "delete 1" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	if res := mustExecute(t, t2, "select * from account where id = 1 for share"); res != "[1,10]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	done := executeAsync(t2, "update account set balance = 20 where id = 1")
+	expectBlocked(t, done)
+	mustExecute(t, t1, "commit")
+	if res := <-done; res != "update 1" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	mustExecute(t, t2, "commit")
+}
+
+func TestReleaseSavepoint(t *testing.T) {
+	executor, closeDB := openExecutor(t)
+	defer closeDB()
+	mustExecute(t, executor, "create table student id int32, (index id)")
+
+	if _, err := executor.Execute([]byte("savepoint a")); err == nil || err.Error() != commons.ErrorMessage.NoTransactionError {
+		t.Fatalf("expected no transaction error, got %v", err)
+	}
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "savepoint a")
+	mustExecute(t, executor, "insert into student values 1")
+	mustExecute(t, executor, "savepoint b")
+	mustExecute(t, executor, "insert into student values 2")
+	mustExecute(t, executor, "release a")
+	// 释放保存点时之后的保存点也一起释放，修改保留
+	if _, err := executor.Execute([]byte("rollback to b")); err == nil || err.Error() != commons.ErrorMessage.SavepointNotFoundError {
+		t.Fatalf("expected savepoint not found, got %v", err)
+	}
+	mustExecute(t, executor, "commit")
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[1]\n[2]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"SimpleDB/backend/server"
+	"testing"
+	"time"
+)
+
+// executeAsync 在另一个协程中执行语句，返回接收结果的通道
+func executeAsync(executor *server.Executor, sql string) chan string {
+	done := make(chan string, 1)
+	go func() {
+		res, err := executor.Execute([]byte(sql))
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		done <- string(res)
+	}()
+	return done
+}
+
+// expectBlocked 检查语句仍在等待锁
+func expectBlocked(t *testing.T, done chan string) {
+	select {
+	case res := <-done:
+		t.Fatalf("statement should wait for the lock, got %q", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSelectForUpdate(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, setup, "insert into account values 1 10")
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	mustExecute(t, t1, "begin")
+	mustExecute(t, t2, "begin")
+	if res := mustExecute(t, t1, "select * from account where id = 1 for update"); res != "[1,10]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	done := executeAsync(t2, "select * from account where id = 1 for update")
+	expectBlocked(t, done)
+
+	// t1提交后t2读到更新后的记录，并在新版本上继续修改
+	mustExecute(t, t1, "update account set balance = 20 where id = 1")
+	mustExecute(t, t1, "commit")
+	if res := <-done; res != "[1,20]\n" {
+		t.Fatalf("expected the committed row, got %q", res)
+	}
+	mustExecute(t, t2, "update account set balance = 30 where id = 1")
+	mustExecute(t, t2, "commit")
+	if res := mustExecute(t, setup, "select * from account where id = 1"); res != "[1,30]\n" {
+		t.Fatalf("lost update: %q", res)
+	}
+}
+
+func TestSelectForShare(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, setup, "insert into account values 1 10")
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	t3 := server.NewExecutor(tableManager)
+	mustExecute(t, t1, "begin")
+	mustExecute(t, t2, "begin")
+	mustExecute(t, t3, "begin")
+	mustExecute(t, t1, "select * from account where id = 1 for share")
+	mustExecute(t, t2, "select * from account where id = 1 for share")
+
+	// 共享锁全部释放之后才能修改
+	done := executeAsync(t3, "update account set balance = 20 where id = 1")
+	expectBlocked(t, done)
+	mustExecute(t, t1, "commit")
+	expectBlocked(t, done)
+	mustExecute(t, t2, "commit")
+	if res := <-done; res != "update 1" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	mustExecute(t, t3, "commit")
+}
+
+// TestSelectForUpdateCursorStatement 显式事务中游标读取期间语句还没有结束，游标关闭时才结束语句
+func TestSelectForUpdateCursorStatement(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, setup, "insert into account values 1 10")
+	mustExecute(t, setup, "insert into account values 2 10")
+
+	executor := server.NewExecutor(tableManager)
+	mustExecute(t, executor, "begin")
+	xid := tableManager.VM.TM.XidCounter()
+	for _, sql := range []string{"select * from account where id > 0 for update", "select * from account where id > 0 for share"} {
+		if _, _, err := executor.Open([]byte(sql)); err != nil {
+			t.Fatal(err)
+		}
+		if count := tableManager.VM.SavepointCount(xid); count != 1 {
+			t.Fatalf("%s: %d savepoints while the cursor is open, expected the statement savepoint", sql, count)
+		}
+		for {
+			row, err := executor.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row == nil {
+				break
+			}
+		}
+		if count := tableManager.VM.SavepointCount(xid); count != 0 {
+			t.Fatalf("%s: %d savepoints after the cursor is closed", sql, count)
+		}
+	}
+
+	// 提前关闭游标同样结束语句
+	if _, _, err := executor.Open([]byte("select * from account where id > 0 for update")); err != nil {
+		t.Fatal(err)
+	}
+	if err := executor.CloseCursor(); err != nil {
+		t.Fatal(err)
+	}
+	if count := tableManager.VM.SavepointCount(xid); count != 0 {
+		t.Fatalf("%d savepoints after CloseCursor", count)
+	}
+	mustExecute(t, executor, "commit")
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/commons"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTableManager 在临时目录中创建数据库，多个执行器共享同一个表管理器以模拟并发的连接
+func openTableManager(t *testing.T) (*tbm.TableManager, func()) {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	return tableManager, func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}
+}
+
+// writeSkew 两个医生都在值班，两个事务各自确认另一个医生在值班后让自己下班
+func writeSkew(t *testing.T, level string) (error, error) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table doctor id int32, oncall int32, (index id oncall)")
+	mustExecute(t, setup, "insert into doctor values 1 1")
+	mustExecute(t, setup, "insert into doctor values 2 1")
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	mustExecute(t, t1, "begin isolation level "+level)
+	mustExecute(t, t2, "begin isolation level "+level)
+	if res := mustExecute(t, t1, "select * from doctor where oncall = 1"); strings.Count(res, "\n") != 2 {
+		t.Fatalf("unexpected result %q", res)
+	}
+	mustExecute(t, t2, "select * from doctor where oncall = 1")
+	mustExecute(t, t1, "update doctor set oncall = 0 where id = 1")
+
+	_, err2 := t2.Execute([]byte("update doctor set oncall = 0 where id = 2"))
+	if err2 == nil {
+		_, err2 = t2.Execute([]byte("commit"))
+	}
+	_, err1 := t1.Execute([]byte("commit"))
+	return err1, err2
+}
+
+func TestSerializableWriteSkew(t *testing.T) {
+	err1, err2 := writeSkew(t, "serializable")
+	if err1 != nil {
+		t.Fatalf("first transaction should commit: %v", err1)
+	}
+	if err2 == nil || err2.Error() != commons.ErrorMessage.SerializationFailureError {
+		t.Fatalf("expected serialization failure, got %v", err2)
+	}
+}
+
+func TestRepeatableReadAllowsWriteSkew(t *testing.T) {
+	err1, err2 := writeSkew(t, "repeatable read")
+	if err1 != nil || err2 != nil {
+		t.Fatalf("write skew should be allowed under repeatable read: %v, %v", err1, err2)
+	}
+}
+
+// TestSerializableReadOnlyAnomaly 只读事务T3看到了T1的提交，却没有看到更早开始的T2的修改
+func TestSerializableReadOnlyAnomaly(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table account id int32, balance int32, (index id)")
+	mustExecute(t, setup, "insert into account values 1 0")
+	mustExecute(t, setup, "insert into account values 2 0")
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	t3 := server.NewExecutor(tableManager)
+	mustExecute(t, t2, "begin isolation level serializable")
+	mustExecute(t, t2, "select * from account where id = 1")
+	mustExecute(t, t2, "select * from account where id = 2")
+
+	mustExecute(t, t1, "begin isolation level serializable")
+	mustExecute(t, t1, "select * from account where id = 1")
+	mustExecute(t, t1, "update account set balance = 20 where id = 1")
+	mustExecute(t, t1, "commit")
+
+	mustExecute(t, t3, "begin isolation level serializable")
+	if res := mustExecute(t, t3, "select * from account where id > 0"); res != "[1,20]\n[2,0]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	mustExecute(t, t3, "commit")
+
+	_, err := t2.Execute([]byte("update account set balance = 11 where id = 2"))
+	if err == nil {
+		_, err = t2.Execute([]byte("commit"))
+	}
+	if err == nil || err.Error() != commons.ErrorMessage.SerializationFailureError {
+		t.Fatalf("expected serialization failure, got %v", err)
+	}
+	mustExecute(t, t2, "abort")
+	if res := mustExecute(t, setup, "select * from account where id = 2"); res != "[2,0]\n" {
+		t.Fatalf("aborted update is visible: %q", res)
+	}
+}
+
+func TestSerializableDisjoint(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table item id int32, count int32, (index id)")
+	mustExecute(t, setup, "insert into item values 1 0")
+	mustExecute(t, setup, "insert into item values 2 0")
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	mustExecute(t, t1, "begin isolation level serializable")
+	mustExecute(t, t2, "begin isolation level serializable")
+	mustExecute(t, t1, "select * from item where id = 1")
+	mustExecute(t, t2, "select * from item where id = 2")
+	mustExecute(t, t1, "update item set count = 1 where id = 1")
+	mustExecute(t, t2, "update item set count = 1 where id = 2")
+	mustExecute(t, t2, "insert into item values 3 0")
+	mustExecute(t, t1, "commit")
+	mustExecute(t, t2, "commit")
+	if res := mustExecute(t, setup, "select * from item where id > 0"); res != "[1,1]\n[2,1]\n[3,0]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
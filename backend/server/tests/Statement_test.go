@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/server"
+	"SimpleDB/commons"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestStatementAtomicUpdate 更新多条记录的语句中途等待锁超时，之前更新的记录被撤销，事务可以继续执行
+func TestStatementAtomicUpdate(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	tableManager.VM.LT.SetLockTimeout(50 * time.Millisecond)
+	setup := server.NewExecutor(tableManager)
+	mustExecute(t, setup, "create table account id int32, balance int32, (index id)")
+	for _, sql := range []string{"insert into account values 1 10", "insert into account values 2 10", "insert into account values 3 10"} {
+		mustExecute(t, setup, sql)
+	}
+
+	t1 := server.NewExecutor(tableManager)
+	t2 := server.NewExecutor(tableManager)
+	mustExecute(t, t2, "begin")
+	mustExecute(t, t2, "select * from account where id = 3 for update")
+
+	mustExecute(t, t1, "begin")
+	_, err := t1.Execute([]byte("update account set balance = 0 where id > 0"))
+	if err == nil || err.Error() != commons.ErrorMessage.LockTimeoutError {
+		t.Fatalf("expected lock timeout, got %v", err)
+	}
+	if res := mustExecute(t, t1, "select * from account where id > 0"); res != "[1,10]\n[2,10]\n[3,10]\n" {
+		t.Fatalf("failed statement left changes: %q", res)
+	}
+	// 失败的语句获得的锁已经释放
+	if res := mustExecute(t, t2, "update account set balance = 20 where id = 2"); res != "update 1" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	mustExecute(t, t2, "commit")
+
+	mustExecute(t, t1, "update account set balance = 0 where id = 1")
+	mustExecute(t, t1, "commit")
+	if res := mustExecute(t, setup, "select * from account where id > 0"); res != "[1,0]\n[2,20]\n[3,10]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
+
+// TestStatementErrorKeepsTransaction 普通的错误不会终止显式事务
+func TestStatementErrorKeepsTransaction(t *testing.T) {
+	executor, dir, closeDB := openCopyExecutor(t)
+	defer closeDB()
+	mustExecute(t, executor, "create table student id int32, name string, (index id)")
+	os.WriteFile(filepath.Join(dir, "in.csv"), []byte("2,bob\n3,carol\nx,dave\n"), 0644)
+
+	mustExecute(t, executor, "begin")
+	mustExecute(t, executor, "insert into student values 1 alice")
+	for _, sql := range []string{
+		"copy student from 'in.csv'",
+		"insert into student values x eve",
+		"update student set age = 1 where id = 1",
+		"select * from teacher",
+	} {
+		if _, err := executor.Execute([]byte(sql)); err == nil {
+			t.Fatalf("%s: expected error", sql)
+		}
+	}
+	mustExecute(t, executor, "insert into student values 4 frank")
+	mustExecute(t, executor, "commit")
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[1,alice]\n[4,frank]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
+
+// TestEndStatementFailure 无法撤销语句的修改时自动终止事务并返回错误，而不是让服务端崩溃
+func TestEndStatementFailure(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	xid := tableManager.Begin(&statement.BeginStatement{}).Xid
+	// 没有设置语句的保存点，撤销和释放都会失败
+	err := tableManager.EndStatement(xid, true)
+	if err == nil || err.Error() != commons.ErrorMessage.SavepointNotFoundError {
+		t.Fatalf("expected savepoint not found, got %v", err)
+	}
+	if tableManager.VM.IsAlive(xid) {
+		t.Fatal("transaction should be aborted")
+	}
+	if _, err = tableManager.Commit(xid); err == nil {
+		t.Fatal("aborted transaction should not commit")
+	}
+	tableManager.Abort(xid)
+}
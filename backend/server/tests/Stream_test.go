@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"SimpleDB/backend/server"
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fillStudents 插入n条记录，每条记录的name长度为10
+func fillStudents(t *testing.T, executor *server.Executor, n int) {
+	mustExecute(t, executor, "create table student id int32, name string, (index id)")
+	mustExecute(t, executor, "begin")
+	for i := 1; i <= n; i++ {
+		mustExecute(t, executor, fmt.Sprintf("insert into student values %d name%06d", i, i))
+	}
+	mustExecute(t, executor, "commit")
+}
+
+func TestStreamBatches(t *testing.T) {
+	addr := startServer(t)
+	cl := dialServer(t, addr, transport.ProtocolBinary)
+	defer cl.Close()
+	for _, sql := range []string{"create table student id int32, name string, (index id)", "begin"} {
+		cl.Execute([]byte(sql))
+	}
+	for i := 1; i <= 300; i++ {
+		if _, err := cl.Execute([]byte(fmt.Sprintf("insert into student values %d name%06d", i, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cl.Execute([]byte("commit"))
+
+	cl.SetFetchSize(7)
+	rows, err := cl.Query([]byte("select * from student"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for rows.Next() {
+		var id int
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if id != count || name != fmt.Sprintf("name%06d", count) {
+			t.Fatalf("unexpected row %d %s at %d", id, name, count)
+		}
+	}
+	if rows.Err() != nil || count != 300 {
+		t.Fatalf("read %d rows: %v", count, rows.Err())
+	}
+
+	// 执行下一条语句时未读取完的结果集被关闭
+	rows, _ = cl.Query([]byte("select * from student"))
+	rows.Next()
+	if res, err := cl.Execute([]byte("select * from student where id = 1")); err != nil || string(res) != "[1,name000001]\n" {
+		t.Fatalf("unexpected result %q %v", res, err)
+	}
+	if rows.Next() || rows.Err() == nil || rows.Err().Error() != commons.ErrorMessage.ResultSetClosedError {
+		t.Fatalf("abandoned result set should fail, got %v", rows.Err())
+	}
+}
+
+// TestStreamProtocol 第一批记录受 DefaultFetchSize 和 MaxBatchBytes 的限制，之后的批次由客户端决定行数
+func TestStreamProtocol(t *testing.T) {
+	addr := startServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager, err := transport.ClientHandshake(conn, transport.ProtocolBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packager.Close()
+	roundTrip := func(pkg *transport.Package) *transport.Package {
+		if err := packager.Send(pkg); err != nil {
+			t.Fatal(err)
+		}
+		res, err := packager.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	query := func(sql string) *transport.Package {
+		return roundTrip(&transport.Package{Type: transport.MsgQuery, Data: []byte(sql)})
+	}
+	query("create table student id int32, name string, (index id)")
+	query("begin")
+	for i := 1; i <= 300; i++ {
+		query(fmt.Sprintf("insert into student values %d name%06d", i, i))
+	}
+	query("commit")
+
+	res := query("select * from student")
+	rs, err := transport.DecodeResultSet(res.GetData())
+	if err != nil || res.GetType() != transport.MsgResultSet {
+		t.Fatalf("unexpected response %v %v", res, err)
+	}
+	if len(rs.Rows) != transport.DefaultFetchSize || !rs.More {
+		t.Fatalf("first batch has %d rows, more %v", len(rs.Rows), rs.More)
+	}
+	res = roundTrip(transport.NewFetchPackage(10))
+	rows, more, err := transport.DecodeRowBatch(rs.Columns, res.GetData())
+	if err != nil || len(rows) != 10 || !more || rows[0][0] != int32(transport.DefaultFetchSize+1) {
+		t.Fatalf("unexpected batch %v %v %v", rows, more, err)
+	}
+	res = roundTrip(transport.NewFetchPackage(1000))
+	rows, more, _ = transport.DecodeRowBatch(rs.Columns, res.GetData())
+	if len(rows) != 300-transport.DefaultFetchSize-10 || more {
+		t.Fatalf("last batch has %d rows, more %v", len(rows), more)
+	}
+	// 结果集已经读取完毕并关闭
+	if res = roundTrip(transport.NewFetchPackage(10)); res.GetErr() == nil || res.GetErr().Error() != commons.ErrorMessage.NoOpenCursorError {
+		t.Fatalf("expected no open cursor, got %v", res.GetErr())
+	}
+
+	// 每一批记录的大小受 MaxBatchBytes 限制，每条记录编码后为 4+4+10 字节
+	maxBatchBytes := transport.MaxBatchBytes
+	transport.MaxBatchBytes = 18 * 5
+	defer func() { transport.MaxBatchBytes = maxBatchBytes }()
+	rs, _ = transport.DecodeResultSet(query("select * from student").GetData())
+	if len(rs.Rows) != 5 || !rs.More {
+		t.Fatalf("first batch has %d rows, more %v", len(rs.Rows), rs.More)
+	}
+	if res = roundTrip(&transport.Package{Type: transport.MsgClose}); res.GetErr() != nil || res.GetType() != transport.MsgResult {
+		t.Fatalf("unexpected close response %v", res)
+	}
+	if res = roundTrip(transport.NewFetchPackage(10)); res.GetErr() == nil {
+		t.Fatal("fetch after close should fail")
+	}
+}
+
+// TestCursorClose 提前关闭游标时结束临时事务，之后的语句不受影响
+func TestCursorClose(t *testing.T) {
+	tableManager, closeDB := openTableManager(t)
+	defer closeDB()
+	executor := server.NewExecutor(tableManager)
+	fillStudents(t, executor, 100)
+	active := len(tableManager.VM.ActiveTransaction)
+
+	_, cursor, err := executor.Open([]byte("select * from student"))
+	if err != nil || cursor == nil {
+		t.Fatalf("open cursor: %v", err)
+	}
+	if len(tableManager.VM.ActiveTransaction) != active+1 {
+		t.Fatal("temporary transaction should stay open with the cursor")
+	}
+	if row, err := executor.Next(); err != nil || row[0] != int32(1) {
+		t.Fatalf("unexpected row %v %v", row, err)
+	}
+	executor.CloseCursor()
+	if executor.HasCursor() || len(tableManager.VM.ActiveTransaction) != active {
+		t.Fatal("closing the cursor should end the temporary transaction")
+	}
+	if _, err = executor.Next(); err == nil || err.Error() != commons.ErrorMessage.NoOpenCursorError {
+		t.Fatalf("expected no open cursor, got %v", err)
+	}
+
+	// 显式事务中打开的游标关闭后事务仍然存在
+	mustExecute(t, executor, "begin")
+	executor.Open([]byte("select * from student"))
+	mustExecute(t, executor, "insert into student values 101 name000101")
+	if executor.HasCursor() {
+		t.Fatal("next statement should close the cursor")
+	}
+	mustExecute(t, executor, "commit")
+	if res := mustExecute(t, executor, "select * from student where id = 101"); res != "[101,name000101]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+}
@@ -0,0 +1,23 @@
+package tests
+
+import "testing"
+
+// TestUpdateIndexKeys 更新一个字段后，新版本在每个索引中都使用自己字段的值作为key
+func TestUpdateIndexKeys(t *testing.T) {
+	executor, closeDB := openExecutor(t)
+	defer closeDB()
+	mustExecute(t, executor, "create table student id int32, age int32, (index id age)")
+	mustExecute(t, executor, "insert into student values 1 20")
+	mustExecute(t, executor, "insert into student values 2 21")
+
+	mustExecute(t, executor, "update student set age = 30 where id = 1")
+	if res := mustExecute(t, executor, "select * from student where id = 1"); res != "[1,30]\n" {
+		t.Fatalf("updated row is missing from the id index: %q", res)
+	}
+	if res := mustExecute(t, executor, "select * from student where age = 30"); res != "[1,30]\n" {
+		t.Fatalf("updated row is missing from the age index: %q", res)
+	}
+	if res := mustExecute(t, executor, "select * from student where id = 30"); res != "" {
+		t.Fatalf("updated value should not be indexed as id: %q", res)
+	}
+}
@@ -0,0 +1,22 @@
+package tests
+
+import "testing"
+
+// TestRepeatableReadOwnDelete 可重复读事务看不到自己删除的记录
+func TestRepeatableReadOwnDelete(t *testing.T) {
+	executor, closeDB := openExecutor(t)
+	defer closeDB()
+	mustExecute(t, executor, "create table student id int32, (index id)")
+	mustExecute(t, executor, "insert into student values 1")
+	mustExecute(t, executor, "insert into student values 2")
+
+	mustExecute(t, executor, "begin isolation level repeatable read")
+	mustExecute(t, executor, "delete from student where id = 1")
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[2]\n" {
+		t.Fatalf("deleted row is still visible to its own transaction: %q", res)
+	}
+	mustExecute(t, executor, "commit")
+	if res := mustExecute(t, executor, "select * from student where id > 0"); res != "[2]\n" {
+		t.Fatalf("unexpected result after commit %q", res)
+	}
+}
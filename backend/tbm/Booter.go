@@ -2,6 +2,7 @@ package tbm
 
 import (
 	"SimpleDB/backend/utils"
+	"SimpleDB/commons"
 	"fmt"
 	"os"
 )
@@ -19,7 +20,11 @@ type Booter struct {
 	// 数据库启动信息文件的路径
 	Path string
 	// 数据库启动信息文件
-	file *os.File
+	file utils.File
+	// readOnly 只读打开的启动信息文件不能被更新
+	readOnly bool
+	// memory 内存数据库的启动信息保存在内存文件中，直接覆盖更新
+	memory bool
 }
 
 // Load 加载文件启动信息文件
@@ -39,6 +44,18 @@ func (b *Booter) Load() []byte {
 
 // Update 更新启动信息文件的内容
 func (b *Booter) Update(data []byte) {
+	if b.readOnly {
+		panic(commons.NewError(commons.ErrorMessage.ReadOnlyDatabaseError))
+	}
+	if b.memory {
+		if _, err := b.file.WriteAt(data, 0); err != nil {
+			panic(err)
+		}
+		if err := b.file.Truncate(int64(len(data))); err != nil {
+			panic(err)
+		}
+		return
+	}
 	// 创建一个新的临时文件
 	tmpFile, err := os.Create(b.Path + BooterTmpSuffix)
 	if err != nil {
@@ -78,12 +95,12 @@ func (b *Booter) Update(data []byte) {
 		panic(fmt.Sprintf("Failed to open file: %v", err))
 	}
 
-	// 更新file字段为新的启动信息文件
-	b.file = file
 	// 检查新的启动信息文件是否可读写，如果不可读写，则抛出异常
-	if err := b.file.Chmod(0666); err != nil {
+	if err := file.Chmod(0666); err != nil {
 		panic(err)
 	}
+	// 更新file字段为新的启动信息文件
+	b.file = file
 }
 
 // CreateBooter 创建一个新的Booter对象
@@ -107,6 +124,14 @@ func CreateBooter(path string) *Booter {
 	}
 }
 
+// CreateMemoryBooter 创建内存数据库的Booter对象
+func CreateMemoryBooter() *Booter {
+	return &Booter{
+		file:   utils.NewMemoryFile(nil),
+		memory: true,
+	}
+}
+
 // OpenBooter 打开一个已经存在的Booter对象
 func OpenBooter(path string) *Booter {
 	// 删除可能存在的临时文件
@@ -127,6 +152,19 @@ func OpenBooter(path string) *Booter {
 	}
 }
 
+// OpenReadOnlyBooter 以只读方式打开已经存在的Booter对象，不会删除临时文件
+func OpenReadOnlyBooter(path string) *Booter {
+	file, err := os.Open(path + BooterSuffix)
+	if err != nil {
+		panic(err)
+	}
+	return &Booter{
+		Path:     path,
+		file:     file,
+		readOnly: true,
+	}
+}
+
 // RemoveBatTmpBooter 删除可能存在的临时文件
 func RemoveBatTmpBooter(path string) {
 	// 删除路径加上临时文件后缀的文件
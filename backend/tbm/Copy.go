@@ -0,0 +1,131 @@
+package tbm
+
+import (
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/commons"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetFileDir 设置 COPY 和 BACKUP TO 语句读写文件的目录，为空时不能读写服务端的文件
+func (tableManager *TableManager) SetFileDir(dir string) {
+	tableManager.lock.Lock()
+	defer tableManager.lock.Unlock()
+	tableManager.fileDir = dir
+}
+
+// resolveFile 将语句中的文件路径解析为文件目录下的路径
+// 客户端不能访问文件目录之外的文件，因此拒绝绝对路径和包含 .. 的路径
+func (tableManager *TableManager) resolveFile(name string) (string, error) {
+	tableManager.lock.Lock()
+	dir := tableManager.fileDir
+	tableManager.lock.Unlock()
+	if dir == "" {
+		return "", commons.NewError(commons.ErrorMessage.FileAccessDisabledError)
+	}
+	if name == "" || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", commons.NewError(commons.ErrorMessage.InvalidFilePathError)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(name), "/") {
+		if element == ".." {
+			return "", commons.NewError(commons.ErrorMessage.InvalidFilePathError)
+		}
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// CopyFrom 从CSV文件中导入数据，所有数据在事务xid中插入，插入期间推迟日志落盘，最后统一落盘
+// 出错时返回的错误带有出错记录所在的行号
+func (table *Table) CopyFrom(xid int64, file string, header bool) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	// 字段数量由表结构检查，这里不做限制
+	reader.FieldsPerRecord = -1
+
+	logger := table.TBM.DM.DBLogger
+	logger.DeferSync()
+	defer logger.ResumeSync()
+
+	count := 0
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// csv.ParseError中已经带有行号
+			return count, err
+		}
+		line, _ := reader.FieldPos(0)
+		if first && header {
+			first = false
+			if err = table.checkHeader(record); err != nil {
+				return count, fmt.Errorf("line %d: %w", line, err)
+			}
+			continue
+		}
+		first = false
+		if err = table.Insert(xid, &statement.InsertStatement{TableName: table.Name, Values: record}); err != nil {
+			return count, fmt.Errorf("line %d: %w", line, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// checkHeader 检查CSV的表头是否与表的字段一致
+func (table *Table) checkHeader(record []string) error {
+	if len(record) != len(table.Fields) {
+		return commons.NewError(commons.ErrorMessage.InvalidValuesError)
+	}
+	for i, field := range table.Fields {
+		if record[i] != field.FieldName {
+			return commons.NewCodeError(commons.CodeInvalidTextRepresentation, fmt.Sprintf("%s: header %q does not match field %q", commons.ErrorMessage.InvalidValuesError, record[i], field.FieldName))
+		}
+	}
+	return nil
+}
+
+// CopyTo 将事务xid可见的所有数据导出到CSV文件中
+func (table *Table) CopyTo(xid int64, file string, header bool) (int, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	writer := csv.NewWriter(f)
+	if header {
+		names := make([]string, len(table.Fields))
+		for i, field := range table.Fields {
+			names[i] = field.FieldName
+		}
+		if err = writer.Write(names); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	err = table.Scan(xid, func(values []string) error {
+		count++
+		return writer.Write(values)
+	})
+	if err != nil {
+		return count, err
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return count, err
+	}
+	return count, f.Sync()
+}
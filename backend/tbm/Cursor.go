@@ -0,0 +1,164 @@
+package tbm
+
+import (
+	"SimpleDB/backend/im"
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+)
+
+var (
+	// CursorBatchSize 游标每次从索引中读取的uid数量
+	CursorBatchSize = 128
+)
+
+// Cursor 查询结果的游标，按照索引的顺序逐批读取满足条件的记录的uid，每次取出记录时才读取记录的内容
+// 游标读取的记录对打开游标的事务可见，使用游标期间事务不能执行其他语句
+// 读已提交级别下可见性在取出记录时判断，读取期间其他事务提交的更新可能使同一条记录的新旧版本都被返回
+type Cursor struct {
+	Fields []*Field
+	table  *Table
+	// uids 已经从索引中读取、还没有返回的uid
+	uids []int64
+	// iterators 还没有读完的索引范围，WHERE 子句包含 OR 时有两个
+	iterators []*im.RangeIterator
+	// read 读取一条记录，记录对事务不可见时返回nil
+	read func(uid int64) ([]byte, error)
+}
+
+// OpenCursor 执行查询并返回游标
+// SELECT ... FOR UPDATE / FOR SHARE 在打开游标时就对所有记录加锁，之后只读取加锁成功的记录
+func (table *Table) OpenCursor(xid int64, read *statement.SelectStatement) (*Cursor, error) {
+	cursor := &Cursor{Fields: table.Fields, table: table}
+	if read.ForUpdate || read.ForShare {
+		uids, err := table.lockRows(xid, read)
+		if err != nil {
+			return nil, err
+		}
+		cursor.uids = uids
+		cursor.read = func(uid int64) ([]byte, error) {
+			return table.TBM.VM.Read(xid, uid)
+		}
+		return cursor, nil
+	}
+	if read.AsOf != nil {
+		// 历史数据不会再被修改，不需要登记谓词锁
+		asOf := &vm.AsOf{Xid: read.AsOf.Xid, Timestamp: read.AsOf.Timestamp}
+		if err := table.TBM.VM.CheckAsOf(asOf); err != nil {
+			return nil, err
+		}
+		if err := cursor.iterate(tm.SuperXid, read.Where); err != nil {
+			return nil, err
+		}
+		cursor.read = func(uid int64) ([]byte, error) {
+			return table.TBM.VM.ReadAsOf(xid, uid, asOf)
+		}
+		return cursor, nil
+	}
+	if err := cursor.iterate(xid, read.Where); err != nil {
+		return nil, err
+	}
+	cursor.read = func(uid int64) ([]byte, error) {
+		return table.TBM.VM.Read(xid, uid)
+	}
+	return cursor, nil
+}
+
+// iterate 解析 WHERE 子句并为每个索引范围创建迭代器，谓词锁在打开游标时登记
+func (cursor *Cursor) iterate(xid int64, where *statement.WhereSubStatement) error {
+	fd, ranges, err := cursor.table.whereRanges(xid, where)
+	if err != nil {
+		return err
+	}
+	cursor.iterators = []*im.RangeIterator{fd.Iterate(ranges.l0, ranges.r0)}
+	if !ranges.single {
+		cursor.iterators = append(cursor.iterators, fd.Iterate(ranges.l1, ranges.r1))
+	}
+	return nil
+}
+
+// fill 当前批次的uid用完时从索引中读取下一批，返回是否还有uid
+func (cursor *Cursor) fill() (bool, error) {
+	for len(cursor.uids) == 0 && len(cursor.iterators) > 0 {
+		iterator := cursor.iterators[0]
+		uids, err := iterator.Next(CursorBatchSize)
+		if err != nil {
+			return false, err
+		}
+		cursor.uids = uids
+		if iterator.Done() {
+			cursor.iterators = cursor.iterators[1:]
+		}
+	}
+	return len(cursor.uids) > 0, nil
+}
+
+// lockRows 查询记录并对每一条记录加排他锁或共享锁，返回加锁成功的记录
+// 读已提交级别下，等待锁期间记录可能被其他事务更新为新的版本，这时重新查找，对新版本加锁
+// 持有锁期间其他事务不能修改这些记录，因此之后仍然可以读取到加锁时的版本
+func (table *Table) lockRows(xid int64, read *statement.SelectStatement) ([]int64, error) {
+	mode := vm.LockShared
+	if read.ForUpdate {
+		mode = vm.LockExclusive
+	}
+	for {
+		uids, err := table.parseWhere(xid, read.Where)
+		if err != nil {
+			return nil, err
+		}
+		locked := make([]int64, 0)
+		retry := false
+		for _, uid := range uids {
+			raw, err := table.TBM.VM.Read(xid, uid)
+			if err != nil {
+				return nil, err
+			}
+			if raw == nil {
+				continue
+			}
+			raw, err = table.TBM.VM.LockRow(xid, uid, mode)
+			if err != nil {
+				return nil, err
+			}
+			if raw == nil {
+				retry = true
+				break
+			}
+			locked = append(locked, uid)
+		}
+		if !retry {
+			return locked, nil
+		}
+	}
+}
+
+// Next 读取下一条记录，按照字段的顺序返回字段值，没有更多的记录时返回nil
+func (cursor *Cursor) Next() ([]interface{}, error) {
+	for {
+		ok, err := cursor.fill()
+		if err != nil || !ok {
+			return nil, err
+		}
+		uid := cursor.uids[0]
+		cursor.uids = cursor.uids[1:]
+		raw, err := cursor.read(uid)
+		if err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			continue
+		}
+		return cursor.table.entryValues(cursor.table.parseEntry(raw)), nil
+	}
+}
+
+// Done 判断是否已经没有剩余的记录，剩余的记录可能都不可见或者索引范围还没有读完，因此返回false时Next仍然可能返回nil
+func (cursor *Cursor) Done() bool {
+	return len(cursor.uids) == 0 && len(cursor.iterators) == 0
+}
+
+// Close 关闭游标，释放剩余的uid和索引范围
+func (cursor *Cursor) Close() {
+	cursor.uids = nil
+	cursor.iterators = nil
+}
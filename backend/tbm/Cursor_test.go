@@ -0,0 +1,70 @@
+package tbm
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestCursorReadsIndexLazily 游标逐批读取索引，相同的key跨越批次时每条记录只返回一次
+func TestCursorReadsIndexLazily(t *testing.T) {
+	batchSize := CursorBatchSize
+	CursorBatchSize = 4
+	defer func() { CursorBatchSize = batchSize }()
+
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	defer func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}()
+	tableManager := CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	xid := tableManager.Begin(&statement.BeginStatement{}).Xid
+	if _, err := tableManager.Create(xid, mustParse(t, "create table student id int32, (index id)").(*statement.CreateStatement)); err != nil {
+		t.Fatal(err)
+	}
+	// 每个id插入3条记录
+	for i := 0; i < 30; i++ {
+		insert := mustParse(t, fmt.Sprintf("insert into student values %d", i/3)).(*statement.InsertStatement)
+		if _, err := tableManager.Insert(xid, insert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tableManager.Commit(xid); err != nil {
+		t.Fatal(err)
+	}
+
+	xid = tableManager.Begin(&statement.BeginStatement{}).Xid
+	cursor, err := tableManager.OpenCursor(xid, mustParse(t, "select * from student where id < 3 or id > 6").(*statement.SelectStatement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cursor.Close()
+	counts := make(map[int32]int)
+	for {
+		row, err := cursor.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row == nil {
+			break
+		}
+		if len(cursor.uids) >= CursorBatchSize {
+			t.Fatalf("cursor holds %d uids, expected less than one batch", len(cursor.uids))
+		}
+		counts[row[0].(int32)]++
+	}
+	if !cursor.Done() || len(counts) != 6 {
+		t.Fatalf("unexpected rows %v", counts)
+	}
+	for id, count := range counts {
+		if (id >= 3 && id <= 6) || count != 3 {
+			t.Fatalf("unexpected rows %v", counts)
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"SimpleDB/backend/tm"
 	"SimpleDB/commons"
 	"encoding/binary"
-	"errors"
+	"fmt"
 	"math"
 	"strconv"
 )
@@ -158,7 +158,7 @@ func fieldTypeCheck(fieldType string) error {
 	if fieldType == "int32" || fieldType == "string" || fieldType == "int64" {
 		return nil
 	}
-	return errors.New(commons.ErrorMessage.InvalidFieldTypeError)
+	return commons.NewError(commons.ErrorMessage.InvalidFieldTypeError)
 }
 
 // IsIndexed 判断字段是否有索引
@@ -167,40 +167,52 @@ func (field *Field) IsIndexed() bool {
 }
 
 // Insert 将value和uid插入到B+树索引中
-func (field *Field) Insert(value interface{}, uid int64) error {
+func (field *Field) Insert(xid int64, value interface{}, uid int64) error {
 	uKey := field.Value2UKey(value)
 	err := field.bt.Insert(uKey, uid)
 	if err != nil {
 		return err
 	}
+	// 记录索引的修改，回滚到保存点时需要删除
+	field.table.TBM.VM.LogIndex(xid, field.index, uKey, uid)
 	return nil
 }
 
+// Remove 从索引中删除键值对，用于回滚到保存点
+func (field *Field) Remove(key int64, uid int64) error {
+	_, err := field.bt.Remove(key, uid)
+	return err
+}
+
 // Search 根据key的范围查找uid
 func (field *Field) Search(left int64, right int64) ([]int64, error) {
 	return field.bt.SearchRange(left, right)
 }
 
-// String2Value 将字符串转换为字段值
-func (field *Field) String2Value(str string) interface{} {
+// Iterate 返回逐批读取key范围内uid的迭代器
+func (field *Field) Iterate(left int64, right int64) *im.RangeIterator {
+	return field.bt.Iterate(left, right)
+}
+
+// String2Value 将字符串转换为字段值，字符串不是合法的字段值时返回错误
+func (field *Field) String2Value(str string) (interface{}, error) {
 	switch field.FieldType {
 	case "string":
-		return str
+		return str, nil
 	case "int32":
 		num, err := strconv.ParseInt(str, 10, 32)
 		if err != nil {
-			panic(err)
+			return nil, commons.NewCodeError(commons.CodeInvalidTextRepresentation, fmt.Sprintf("%s: invalid %s value %q", commons.ErrorMessage.InvalidValuesError, field.FieldType, str))
 		}
-		return int32(num)
+		return int32(num), nil
 	case "int64":
 		num, err := strconv.ParseInt(str, 10, 64)
 		if err != nil {
-			panic(err)
-
+			return nil, commons.NewCodeError(commons.CodeInvalidTextRepresentation, fmt.Sprintf("%s: invalid %s value %q", commons.ErrorMessage.InvalidValuesError, field.FieldType, str))
 		}
-		return num
+		return num, nil
 	}
-	return nil
+	return nil, commons.NewError(commons.ErrorMessage.InvalidFieldTypeError)
 }
 
 // Value2UKey 根据value生成一个key，这个是用来构建索引的，对于数字直接转换即可
@@ -249,25 +261,25 @@ type CalFieldResult struct {
 
 // CalExp 根据条件查询表达式得到查询的结果
 func (field *Field) CalExp(exp *statement.SingleExpression) (*CalFieldResult, error) {
-	var v interface{}
 	result := &CalFieldResult{}
+	v, err := field.String2Value(exp.Value)
+	if err != nil {
+		return nil, err
+	}
 	switch exp.CompareOp {
 	case "<":
 		result.left = 0
-		v = field.String2Value(exp.Value)
 		result.right = field.Value2UKey(v)
 		if result.right > 0 {
 			result.right -= 1
 		}
 		break
 	case "=":
-		v = field.String2Value(exp.Value)
 		result.left = field.Value2UKey(v)
 		result.right = result.left
 		break
 	case ">":
 		result.right = math.MaxInt64
-		v = field.String2Value(exp.Value)
 		result.left = field.Value2UKey(v) + 1
 		break
 	}
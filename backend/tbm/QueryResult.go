@@ -0,0 +1,25 @@
+package tbm
+
+import "strings"
+
+// QueryResult 查询的结果，Rows 中每一行按照 Fields 的顺序保存字段值，字段值的类型为 int32、int64 或者 string
+type QueryResult struct {
+	Fields []*Field
+	Rows   [][]interface{}
+}
+
+// String 返回查询结果的文本形式，每一行为 [v1,v2,...] 加换行符
+func (result *QueryResult) String() string {
+	var sb strings.Builder
+	for _, row := range result.Rows {
+		sb.WriteString("[")
+		for i, field := range result.Fields {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(field.PrintValue(row[i]))
+		}
+		sb.WriteString("]\n")
+	}
+	return sb.String()
+}
@@ -5,7 +5,6 @@ import (
 	"SimpleDB/backend/tm"
 	"SimpleDB/commons"
 	"encoding/binary"
-	"errors"
 	"math"
 )
 
@@ -31,13 +30,12 @@ type Table struct {
 	Fields []*Field
 }
 
-// CreateTable 创建一个新的数据库表
-func CreateTable(tbm *TableManager, nextUid int64, xid int64, create *statement.CreateStatement) (*Table, error) {
+// CreateTable 创建一个新的数据库表，字段在创建时写入，表记录在事务提交时才通过persistSelf写入
+func CreateTable(tbm *TableManager, xid int64, create *statement.CreateStatement) (*Table, error) {
 	// 创建一个新的表对象
 	table := &Table{
-		TBM:     tbm,
-		Name:    create.TableName,
-		NextUid: nextUid,
+		TBM:  tbm,
+		Name: create.TableName,
 	}
 	// 遍历创建表语句中的所有字段
 	for i := 0; i < len(create.FieldName); i++ {
@@ -59,8 +57,7 @@ func CreateTable(tbm *TableManager, nextUid int64, xid int64, create *statement.
 		}
 		table.Fields = append(table.Fields, newField)
 	}
-	// 将表对象的状态持久化到存储系统中，并返回表对象
-	return table.persistSelf(xid)
+	return table, nil
 }
 
 // LoadTable 用于从数据库中加载一个表
@@ -88,6 +85,23 @@ func LoadTable(tbm *TableManager, uid int64) *Table {
 	return table.parseSelf(raw)
 }
 
+// parseNextUid 只解析表记录中下一个表的uid
+func parseNextUid(raw []byte) int64 {
+	parseStringResult := commons.ParseString(raw)
+	pos := int(parseStringResult.Next)
+	return int64(binary.BigEndian.Uint64(raw[pos : pos+8]))
+}
+
+// parseFirstFieldUid 只解析表记录中第一个字段的uid，表没有字段时返回false
+func parseFirstFieldUid(raw []byte) (int64, bool) {
+	parseStringResult := commons.ParseString(raw)
+	pos := int(parseStringResult.Next) + 8
+	if pos+8 > len(raw) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(raw[pos : pos+8])), true
+}
+
 // parseSelf 用于解析表对象
 func (table *Table) parseSelf(raw []byte) *Table {
 	// 初始化位置变量
@@ -157,7 +171,29 @@ type CalWhereResult struct {
 }
 
 // parseWhere 解析 WHERE 子句并返回满足条件的记录的 uid 列表
-func (table *Table) parseWhere(where *statement.WhereSubStatement) ([]int64, error) {
+// 对于可串行化事务，查找的索引范围会被记录为谓词锁
+func (table *Table) parseWhere(xid int64, where *statement.WhereSubStatement) ([]int64, error) {
+	fd, ranges, err := table.whereRanges(xid, where)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := fd.Search(ranges.l0, ranges.r0)
+	if err != nil {
+		return nil, err
+	}
+	// 如果 WHERE 子句包含 OR 运算符，则需要搜索两个范围，并将结果合并
+	if !ranges.single {
+		uids1, err := fd.Search(ranges.l1, ranges.r1)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, uids1...)
+	}
+	return uids, nil
+}
+
+// whereRanges 解析 WHERE 子句，返回查找的索引字段和索引范围，并为可串行化事务登记谓词锁
+func (table *Table) whereRanges(xid int64, where *statement.WhereSubStatement) (*Field, *CalWhereResult, error) {
 	// 初始化搜索范围和标志位
 	var l0 int64 = 0
 	var r0 int64 = 0
@@ -179,6 +215,10 @@ func (table *Table) parseWhere(where *statement.WhereSubStatement) ([]int64, err
 		// 设置搜索范围为整个 uid 空间
 		l0, r0 = 0, math.MaxInt64
 		single = true
+		// 没有条件时读取了整张表
+		if err := table.TBM.VM.PredicateLock(xid, fd.index, math.MinInt64, math.MaxInt64); err != nil {
+			return nil, nil, err
+		}
 	} else {
 		// 如果 WHERE 子句不为空，则根据 WHERE 子句解析搜索范围
 		// 寻找 WHERE 子句中涉及的字段
@@ -186,7 +226,7 @@ func (table *Table) parseWhere(where *statement.WhereSubStatement) ([]int64, err
 			if field.FieldName == where.SingleExp1.Field {
 				// 如果字段没有索引，则抛出异常
 				if !field.IsIndexed() {
-					return nil, errors.New(commons.ErrorMessage.FieldNotIndexedError)
+					return nil, nil, commons.NewError(commons.ErrorMessage.FieldNotIndexedError)
 				}
 				fd = field
 				break
@@ -194,31 +234,27 @@ func (table *Table) parseWhere(where *statement.WhereSubStatement) ([]int64, err
 		}
 		// 如果字段不存在，则抛出异常
 		if fd == nil {
-			return nil, errors.New(commons.ErrorMessage.FieldNotFoundError)
+			return nil, nil, commons.NewError(commons.ErrorMessage.FieldNotFoundError)
 		}
 		// 计算 WHERE 子句的搜索范围
 		calWhereResult, err := table.calWhere(fd, where)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		l0, r0 = calWhereResult.l0, calWhereResult.r0
 		l1, r1 = calWhereResult.l1, calWhereResult.r1
 		single = calWhereResult.single
 	}
-	// 在计算出的搜索范围内搜索记录
-	uids, err := fd.Search(l0, r0)
-	if err != nil {
-		return nil, err
+	// 登记将要搜索的范围
+	if err := table.TBM.VM.PredicateLock(xid, fd.index, l0, r0); err != nil {
+		return nil, nil, err
 	}
-	// 如果 WHERE 子句包含 OR 运算符，则需要搜索两个范围，并将结果合并
 	if !single {
-		uids1, err := fd.Search(l1, r1)
-		if err != nil {
-			return nil, err
+		if err := table.TBM.VM.PredicateLock(xid, fd.index, l1, r1); err != nil {
+			return nil, nil, err
 		}
-		uids = append(uids, uids1...)
 	}
-	return uids, nil
+	return fd, &CalWhereResult{l0: l0, r0: r0, l1: l1, r1: r1, single: single}, nil
 }
 
 func (table *Table) calWhere(fd *Field, where *statement.WhereSubStatement) (*CalWhereResult, error) {
@@ -270,7 +306,7 @@ func (table *Table) calWhere(fd *Field, where *statement.WhereSubStatement) (*Ca
 		}
 		break
 	default:
-		return nil, errors.New(commons.ErrorMessage.InvalidLogOpError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidLogOpError)
 	}
 	return result, nil
 }
@@ -279,12 +315,26 @@ func (table *Table) calWhere(fd *Field, where *statement.WhereSubStatement) (*Ca
 
 func (table *Table) Delete(xid int64, delete *statement.DeleteStatement) (int, error) {
 	// 解析 WHERE 子句
-	uids, err := table.parseWhere(delete.Where)
+	uids, err := table.parseWhere(xid, delete.Where)
 	if err != nil {
 		return 0, err
 	}
+	serializable := table.TBM.VM.IsSerializable(xid)
 	count := 0
 	for _, uid := range uids {
+		// 可串行化事务需要检查删除的记录是否落在并发事务读取过的范围内
+		if serializable {
+			raw, err := table.TBM.VM.Read(xid, uid)
+			if err != nil {
+				return 0, err
+			}
+			if raw == nil {
+				continue
+			}
+			if err = table.checkWrite(xid, table.parseEntry(raw)); err != nil {
+				return 0, err
+			}
+		}
 		// 删除记录
 		deleted, err := table.TBM.VM.Delete(xid, uid)
 		if err != nil {
@@ -299,7 +349,7 @@ func (table *Table) Delete(xid int64, delete *statement.DeleteStatement) (int, e
 
 func (table *Table) Update(xid int64, update *statement.UpdateStatement) (int, error) {
 	// 解析 WHERE 子句
-	uids, err := table.parseWhere(update.Where)
+	uids, err := table.parseWhere(xid, update.Where)
 	if err != nil {
 		return 0, err
 	}
@@ -311,10 +361,13 @@ func (table *Table) Update(xid int64, update *statement.UpdateStatement) (int, e
 		}
 	}
 	if fd == nil {
-		return 0, errors.New(commons.ErrorMessage.FieldNotFoundError)
+		return 0, commons.NewError(commons.ErrorMessage.FieldNotFoundError)
 	}
 
-	value := fd.String2Value(update.Value)
+	value, err := fd.String2Value(update.Value)
+	if err != nil {
+		return 0, err
+	}
 	// 成功更新记录的数目
 	count := 0
 	for _, uid := range uids {
@@ -326,28 +379,39 @@ func (table *Table) Update(xid int64, update *statement.UpdateStatement) (int, e
 			continue
 		}
 
-		// 先删除旧记录（更新XMax）
-		_, err = table.TBM.VM.Delete(xid, uid)
+		// 先取出来这一条表记录
+		entry := table.parseEntry(raw)
+		if err = table.checkWrite(xid, entry); err != nil {
+			return 0, err
+		}
+
+		// 先删除旧记录（更新XMax），记录在等待锁期间被其他事务删除时跳过
+		deleted, err := table.TBM.VM.Delete(xid, uid)
 		if err != nil {
 			return 0, err
 		}
+		if !deleted {
+			continue
+		}
 
-		// 先取出来这一条表记录
-		entry := table.parseEntry(raw)
 		// 再插入新记录
 		entry[update.FieldName] = value
+		if err = table.checkWrite(xid, entry); err != nil {
+			return 0, err
+		}
 		updatedRaw := table.entry2Raw(entry)
 		uuid, err := table.TBM.VM.Insert(xid, updatedRaw)
 		if err != nil {
 			return 0, err
 		}
+		table.TBM.VM.LogInsert(xid, uuid)
 
 		// 更新记录，记录更新成功的数目
 		count++
 
 		for _, field := range table.Fields {
 			if field.IsIndexed() {
-				err = field.Insert(value, uuid)
+				err = field.Insert(xid, entry[field.FieldName], uuid)
 				if err != nil {
 					return 0, err
 				}
@@ -359,28 +423,72 @@ func (table *Table) Update(xid int64, update *statement.UpdateStatement) (int, e
 	return count, nil
 }
 
-// Read 用于读取表中的记录，返回查询结果
+// Read 用于读取表中的记录，返回查询结果的文本形式
 func (table *Table) Read(xid int64, read *statement.SelectStatement) (string, error) {
-	uids, err := table.parseWhere(read.Where)
+	result, err := table.Query(xid, read)
 	if err != nil {
 		return "", err
 	}
-	result := ""
+	return result.String(), nil
+}
 
+// Query 用于读取表中的记录，返回带有字段信息的查询结果
+func (table *Table) Query(xid int64, read *statement.SelectStatement) (*QueryResult, error) {
+	cursor, err := table.OpenCursor(xid, read)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+	result := &QueryResult{Fields: table.Fields, Rows: make([][]interface{}, 0)}
+	for {
+		row, err := cursor.Next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			return result, nil
+		}
+		result.Rows = append(result.Rows, row)
+	}
+}
+
+// Scan 按照第一个索引字段的顺序遍历xid可见的所有记录，values为每个字段的字符串形式
+func (table *Table) Scan(xid int64, fn func(values []string) error) error {
+	var fd *Field
+	for _, field := range table.Fields {
+		if field.IsIndexed() {
+			fd = field
+			break
+		}
+	}
+	if fd == nil {
+		return commons.NewError(commons.ErrorMessage.TableNoIndexError)
+	}
+	if err := table.TBM.VM.PredicateLock(xid, fd.index, math.MinInt64, math.MaxInt64); err != nil {
+		return err
+	}
+	uids, err := fd.Search(math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return err
+	}
 	for _, uid := range uids {
 		raw, err := table.TBM.VM.Read(xid, uid)
 		if err != nil {
-			return "", err
+			return err
 		}
 		if raw == nil {
 			continue
 		}
 		entry := table.parseEntry(raw)
-		result += table.printEntry(entry)
-		result += "\n"
+		values := make([]string, len(table.Fields))
+		for i, field := range table.Fields {
+			values[i] = field.PrintValue(entry[field.FieldName])
+		}
+		if err = fn(values); err != nil {
+			return err
+		}
 	}
-
-	return result, nil
+	return nil
 }
 
 // Insert 用于向表中插入记录
@@ -389,14 +497,18 @@ func (table *Table) Insert(xid int64, insert *statement.InsertStatement) error {
 	if err != nil {
 		return err
 	}
+	if err = table.checkWrite(xid, entry); err != nil {
+		return err
+	}
 	raw := table.entry2Raw(entry)
 	uid, err := table.TBM.VM.Insert(xid, raw)
 	if err != nil {
 		return err
 	}
+	table.TBM.VM.LogInsert(xid, uid)
 	for _, field := range table.Fields {
 		if field.IsIndexed() {
-			err = field.Insert(entry[field.FieldName], uid)
+			err = field.Insert(xid, entry[field.FieldName], uid)
 			if err != nil {
 				return err
 			}
@@ -405,34 +517,44 @@ func (table *Table) Insert(xid int64, insert *statement.InsertStatement) error {
 	return nil
 }
 
+// checkWrite 可串行化事务写入记录前，检查记录在每个索引中的key是否落在并发事务读取过的范围内
+func (table *Table) checkWrite(xid int64, entry map[string]interface{}) error {
+	for _, field := range table.Fields {
+		if field.IsIndexed() {
+			if err := table.TBM.VM.CheckWrite(xid, field.index, field.Value2UKey(entry[field.FieldName])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // =========== 如下进行字段中entry和原始字节的转换，用于读取和存储具体的字段中的值 ===========
 
 func (table *Table) string2Entry(values []string) (map[string]interface{}, error) {
 	if len(values) != len(table.Fields) {
-		return nil, errors.New(commons.ErrorMessage.InvalidValuesError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidValuesError)
 	}
 	entry := make(map[string]interface{})
 	for i, _ := range values {
 		field := table.Fields[i]
-		v := field.String2Value(values[i])
+		v, err := field.String2Value(values[i])
+		if err != nil {
+			return nil, err
+		}
 		entry[field.FieldName] = v
 	}
 	return entry, nil
 
 }
 
-func (table *Table) printEntry(entry map[string]interface{}) string {
-	var str string = "["
-	for i, _ := range table.Fields {
-		field := table.Fields[i]
-		str += field.PrintValue(entry[field.FieldName])
-		if i == len(table.Fields)-1 {
-			str += "]"
-		} else {
-			str += ","
-		}
+// entryValues 按照字段的顺序返回记录中的字段值
+func (table *Table) entryValues(entry map[string]interface{}) []interface{} {
+	values := make([]interface{}, len(table.Fields))
+	for i, field := range table.Fields {
+		values[i] = entry[field.FieldName]
 	}
-	return str
+	return values
 }
 
 // parseEntry 用于解析原始字节数据并返回一个Entry对象
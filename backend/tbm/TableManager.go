@@ -3,10 +3,14 @@ package tbm
 import (
 	"SimpleDB/backend/dm"
 	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/utils"
 	"SimpleDB/backend/vm"
 	"SimpleDB/commons"
 	"encoding/binary"
-	"errors"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 )
 
@@ -19,9 +23,21 @@ type TableManager struct {
 	booter *Booter
 	// 表缓存，用于缓存已加载的表，键是表名，值是表对象
 	tableCache map[string]*Table
-	// 事务表缓存，用于缓存每个事务修改过的表，键是事务ID，值是表对象列表
-	xidTableCache map[int64][]*Table
+	// 事务表缓存，用于缓存每个事务创建但还没有提交的表，键是事务ID，值是按照创建顺序排列的表
+	// 这些表只对创建它的事务可见，提交时才写入表记录并加入表链和表缓存
+	xidTableCache map[int64][]*pendingTable
 	lock          commons.ReentrantLock
+	// readOnly 数据库以只读方式打开，所有事务都是只读事务
+	readOnly bool
+	// fileDir COPY 和 BACKUP TO 语句读写文件的目录，为空时不能读写服务端的文件
+	fileDir string
+}
+
+// pendingTable 事务创建但还没有提交的表
+type pendingTable struct {
+	table *Table
+	// savepoints 创建表时事务中保存点的数量，回滚到不晚于创建时的保存点时删除该表
+	savepoints int
 }
 
 func CreateTableManger(path string, vm *vm.VersionManager, dm *dm.DataManager) *TableManager {
@@ -35,13 +51,27 @@ func OpenTableManager(path string, vm *vm.VersionManager, dm *dm.DataManager) *T
 	return NewTableManager(vm, dm, booter)
 }
 
+// CreateMemoryTableManager 创建内存数据库的表管理器，vm和dm也应当是内存数据库的
+func CreateMemoryTableManager(vm *vm.VersionManager, dm *dm.DataManager) *TableManager {
+	booter := CreateMemoryBooter()
+	booter.Update([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+	return NewTableManager(vm, dm, booter)
+}
+
+// OpenReadOnlyTableManager 以只读方式打开表管理器，vm和dm也应当以只读方式打开
+func OpenReadOnlyTableManager(path string, vm *vm.VersionManager, dm *dm.DataManager) *TableManager {
+	tableManager := NewTableManager(vm, dm, OpenReadOnlyBooter(path))
+	tableManager.readOnly = true
+	return tableManager
+}
+
 func NewTableManager(vm *vm.VersionManager, dm *dm.DataManager, booter *Booter) *TableManager {
 	tableManager := &TableManager{
 		VM:            vm,
 		DM:            dm,
 		booter:        booter,
 		tableCache:    make(map[string]*Table),
-		xidTableCache: make(map[int64][]*Table),
+		xidTableCache: make(map[int64][]*pendingTable),
 	}
 
 	tableManager.loadTables()
@@ -54,6 +84,19 @@ func (tableManager *TableManager) loadTables() {
 	uid := tableManager.firstTableUid()
 	// 当UID不为0时，表示还有表需要加载
 	for uid != 0 {
+		raw, err := tableManager.VM.Read(tm.SuperXid, uid)
+		if err != nil {
+			panic(err)
+		}
+		// 表记录由SuperXid写入，恢复时不会被撤销
+		if raw == nil {
+			panic(commons.NewError(commons.ErrorMessage.TableNotFoundError))
+		}
+		// 创建表的事务在更新启动信息之后、提交之前崩溃，表记录仍然在表链中，但字段随事务被撤销，跳过该表
+		if !tableManager.isCommittedTable(raw) {
+			uid = parseNextUid(raw)
+			continue
+		}
 		// 加载表，并获取表的UID
 		tb := LoadTable(tableManager, uid)
 		// 更新UID为下一个表的UID
@@ -63,6 +106,19 @@ func (tableManager *TableManager) loadTables() {
 	}
 }
 
+// isCommittedTable 判断表记录raw对应的建表事务是否已经提交，字段与建表的事务一起写入，事务没有提交时字段不可见
+func (tableManager *TableManager) isCommittedTable(raw []byte) bool {
+	uid, ok := parseFirstFieldUid(raw)
+	if !ok {
+		return true
+	}
+	field, err := tableManager.VM.Read(tm.SuperXid, uid)
+	if err != nil {
+		panic(err)
+	}
+	return field != nil
+}
+
 // firstTableUid 获取 Booter 文件的前八位字节
 func (tableManager *TableManager) firstTableUid() int64 {
 	raw := tableManager.booter.Load()
@@ -85,30 +141,225 @@ type BeginResult struct {
 func (tableManager *TableManager) Begin(begin *statement.BeginStatement) *BeginResult {
 	result := &BeginResult{}
 	var level int32
-	if begin.IsRepeatableRead {
+	if begin.IsSerializable {
+		level = vm.LevelSerializable
+	} else if begin.IsRepeatableRead {
 		level = 1
 	} else {
 		level = 0
 	}
-	result.Xid = tableManager.VM.Begin(level)
+	if begin.IsReadOnly || tableManager.readOnly {
+		result.Xid = tableManager.VM.BeginReadOnly(level)
+	} else {
+		result.Xid = tableManager.VM.Begin(level)
+	}
 	result.Result = []byte("begin")
 
 	return result
 }
 
+// IsReadOnly 判断事务xid是否为只读事务
+func (tableManager *TableManager) IsReadOnly(xid int64) bool {
+	return tableManager.readOnly || tableManager.VM.IsReadOnly(xid)
+}
+
+// IsReadOnlyDatabase 判断数据库是否以只读方式打开
+func (tableManager *TableManager) IsReadOnlyDatabase() bool {
+	return tableManager.readOnly
+}
+
+// Commit 提交事务，事务创建的表在提交时写入表记录并加入表链
+// 表记录由SuperXid写入，不会因为建表的事务没有提交而被恢复撤销，因此启动信息可以先于事务提交更新；
+// 提交之前崩溃时表链仍然完整，加载时根据字段是否可见跳过没有提交的表
 func (tableManager *TableManager) Commit(xid int64) ([]byte, error) {
-	err := tableManager.VM.Commit(xid)
+	tableManager.lock.Lock()
+	pending := tableManager.xidTableCache[xid]
+	if len(pending) == 0 {
+		tableManager.lock.Unlock()
+		if err := tableManager.VM.Commit(xid); err != nil {
+			return nil, err
+		}
+		return []byte("commit"), nil
+	}
+	// 提交期间持有表管理器的锁，避免其他事务同时修改表链
+	defer tableManager.lock.Unlock()
+	delete(tableManager.xidTableCache, xid)
+
+	first, err := tableManager.publishTables(pending)
 	if err != nil {
 		return nil, err
 	}
+	if err := tableManager.VM.Commit(xid); err != nil {
+		tableManager.updateFirstTableUid(first)
+		return nil, err
+	}
+	for _, p := range pending {
+		tableManager.tableCache[p.table.Name] = p.table
+	}
 	return []byte("commit"), nil
 }
 
+// publishTables 写入事务创建的表的记录，并将启动信息指向新的表链头，返回原来的表链头，调用时必须持有表管理器的锁
+func (tableManager *TableManager) publishTables(pending []*pendingTable) (int64, error) {
+	first := tableManager.firstTableUid()
+	head := first
+	for _, p := range pending {
+		p.table.NextUid = head
+		if _, err := p.table.persistSelf(tm.SuperXid); err != nil {
+			return first, err
+		}
+		head = p.table.Uid
+	}
+	tableManager.updateFirstTableUid(head)
+	return first, nil
+}
+
+// Prepare 预备事务，预备之后事务与连接分离，由 CommitPrepared 或者 RollbackPrepared 结束
+// 创建了表的事务不能预备，表的记录只在提交时写入，无法在重启后恢复
+func (tableManager *TableManager) Prepare(xid int64, prepare *statement.PrepareStatement) ([]byte, error) {
+	tableManager.lock.Lock()
+	pending := len(tableManager.xidTableCache[xid])
+	tableManager.lock.Unlock()
+	if pending > 0 {
+		return nil, commons.NewError(commons.ErrorMessage.CannotPrepareError)
+	}
+	if err := tableManager.VM.Prepare(xid, prepare.Gid); err != nil {
+		return nil, err
+	}
+	return []byte("prepare transaction"), nil
+}
+
+// CommitPrepared 提交预备事务
+func (tableManager *TableManager) CommitPrepared(commit *statement.CommitPreparedStatement) ([]byte, error) {
+	if err := tableManager.VM.CommitPrepared(commit.Gid); err != nil {
+		return nil, err
+	}
+	return []byte("commit prepared"), nil
+}
+
+// RollbackPrepared 终止预备事务
+func (tableManager *TableManager) RollbackPrepared(rollback *statement.RollbackPreparedStatement) ([]byte, error) {
+	if err := tableManager.VM.RollbackPrepared(rollback.Gid); err != nil {
+		return nil, err
+	}
+	return []byte("rollback prepared"), nil
+}
+
+// Abort 终止事务，事务创建的表被丢弃
 func (tableManager *TableManager) Abort(xid int64) []byte {
+	tableManager.lock.Lock()
+	delete(tableManager.xidTableCache, xid)
+	tableManager.lock.Unlock()
+
 	tableManager.VM.Abort(xid)
 	return []byte("abort")
 }
 
+// Savepoint 在事务中设置保存点，之后可以回滚到该保存点
+func (tableManager *TableManager) Savepoint(xid int64, savepoint *statement.SavepointStatement) ([]byte, error) {
+	if err := tableManager.VM.Savepoint(xid, savepoint.Name); err != nil {
+		return nil, err
+	}
+	return []byte("savepoint " + savepoint.Name), nil
+}
+
+// Release 删除保存点以及之后设置的保存点，保存点之后的修改和创建的表保留在事务中
+func (tableManager *TableManager) Release(xid int64, release *statement.ReleaseStatement) ([]byte, error) {
+	if err := tableManager.releaseSavepoint(xid, release.Name); err != nil {
+		return nil, err
+	}
+	return []byte("release " + release.Name), nil
+}
+
+// releaseSavepoint 删除保存点，之前创建的表不再属于被删除的保存点
+func (tableManager *TableManager) releaseSavepoint(xid int64, name string) error {
+	if err := tableManager.VM.ReleaseSavepoint(xid, name); err != nil {
+		return err
+	}
+	count := tableManager.VM.SavepointCount(xid)
+	tableManager.lock.Lock()
+	defer tableManager.lock.Unlock()
+	for _, p := range tableManager.xidTableCache[xid] {
+		if p.savepoints > count {
+			p.savepoints = count
+		}
+	}
+	return nil
+}
+
+// RollbackTo 回滚到保存点，撤销之后插入和删除的记录，从索引中删除之后插入的索引项，并丢弃之后创建的表
+func (tableManager *TableManager) RollbackTo(xid int64, rollback *statement.RollbackStatement) ([]byte, error) {
+	changes, err := tableManager.VM.RollbackToSavepoint(xid, rollback.Savepoint)
+	if err != nil {
+		return nil, err
+	}
+	count := tableManager.VM.SavepointCount(xid)
+
+	tableManager.lock.Lock()
+	fields := make(map[int64]*Field)
+	tables := make([]*Table, 0, len(tableManager.tableCache))
+	for _, table := range tableManager.tableCache {
+		tables = append(tables, table)
+	}
+	kept := make([]*pendingTable, 0)
+	for _, p := range tableManager.xidTableCache[xid] {
+		tables = append(tables, p.table)
+		if p.savepoints < count {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		delete(tableManager.xidTableCache, xid)
+	} else {
+		tableManager.xidTableCache[xid] = kept
+	}
+	for _, table := range tables {
+		for _, field := range table.Fields {
+			if field.IsIndexed() {
+				fields[field.index] = field
+			}
+		}
+	}
+	tableManager.lock.Unlock()
+
+	for _, change := range changes {
+		if err = fields[change.Index].Remove(change.Key, change.Uid); err != nil {
+			return nil, err
+		}
+	}
+	return []byte("rollback to " + rollback.Savepoint), nil
+}
+
+// statementSavepoint 显式事务中每条语句开始前设置的保存点，用户的保存点名称不能为空，因此不会冲突
+const statementSavepoint = ""
+
+// BeginStatement 在显式事务中开始执行一条语句
+func (tableManager *TableManager) BeginStatement(xid int64) error {
+	return tableManager.VM.Savepoint(xid, statementSavepoint)
+}
+
+// EndStatement 语句执行结束，语句出错且事务没有被终止时撤销语句的所有修改，事务可以继续执行
+// 撤销失败时事务被自动终止，返回的错误由执行器报告，之后事务中的语句都返回该错误
+func (tableManager *TableManager) EndStatement(xid int64, failed bool) error {
+	if !tableManager.VM.IsAlive(xid) {
+		return nil
+	}
+	var err error
+	if failed {
+		_, err = tableManager.RollbackTo(xid, &statement.RollbackStatement{Savepoint: statementSavepoint})
+	}
+	if err == nil {
+		err = tableManager.releaseSavepoint(xid, statementSavepoint)
+	}
+	if err != nil {
+		tableManager.lock.Lock()
+		delete(tableManager.xidTableCache, xid)
+		tableManager.lock.Unlock()
+		return tableManager.VM.Fail(xid, err)
+	}
+	return nil
+}
+
 func (tableManager *TableManager) Show(xid int64) []byte {
 	tableManager.lock.Lock()
 	defer tableManager.lock.Unlock()
@@ -118,16 +369,11 @@ func (tableManager *TableManager) Show(xid int64) []byte {
 		str += tb.String()
 		str += "\n"
 	}
-
-	//tables := tableManager.xidTableCache[xid]
-	//if tables == nil {
-	//	return []byte("No tables\n")
-	//}
-
-	//for _, tb := range tables {
-	//	str += tb.String()
-	//	str += "\n"
-	//}
+	// 事务自己创建但还没有提交的表
+	for _, p := range tableManager.xidTableCache[xid] {
+		str += p.table.String()
+		str += "\n"
+	}
 	return []byte(str)
 }
 
@@ -136,37 +382,38 @@ func (tableManager *TableManager) Create(xid int64, create *statement.CreateStat
 	defer tableManager.lock.Unlock()
 
 	_, ok := tableManager.tableCache[create.TableName]
-	// 如果表已经存在，则返回错误
+	// 如果表已经存在，或者其他事务正在创建同名的表，则返回错误
 	if ok {
-		return nil, errors.New(commons.ErrorMessage.DuplicatedTableError)
+		return nil, commons.NewError(commons.ErrorMessage.DuplicatedTableError)
+	}
+	for _, pending := range tableManager.xidTableCache {
+		for _, p := range pending {
+			if p.table.Name == create.TableName {
+				return nil, commons.NewError(commons.ErrorMessage.DuplicatedTableError)
+			}
+		}
 	}
 
 	// 创建表
-	table, err := CreateTable(tableManager, tableManager.firstTableUid(), xid, create)
+	table, err := CreateTable(tableManager, xid, create)
 	if err != nil {
 		return nil, err
 	}
 
-	// 更新第一个数据表的Uid
-	tableManager.updateFirstTableUid(table.Uid)
-
-	// 将表添加到表缓存中
-	tableManager.tableCache[table.Name] = table
-	// 将表添加到事务表缓存中
-	tableManager.xidTableCache[xid] = append(tableManager.xidTableCache[xid], table)
+	// 将表添加到事务表缓存中，提交之后才加入表缓存
+	tableManager.xidTableCache[xid] = append(tableManager.xidTableCache[xid], &pendingTable{
+		table:      table,
+		savepoints: tableManager.VM.SavepointCount(xid),
+	})
 
 	return []byte("create " + create.TableName), nil
 }
 
 func (tableManager *TableManager) Insert(xid int64, insert *statement.InsertStatement) ([]byte, error) {
-	tableManager.lock.Lock()
-
-	table := tableManager.tableCache[insert.TableName]
-
-	tableManager.lock.Unlock()
+	table := tableManager.getTable(xid, insert.TableName)
 
 	if table == nil {
-		return nil, errors.New(commons.ErrorMessage.TableNotFoundError)
+		return nil, commons.NewError(commons.ErrorMessage.TableNotFoundError)
 	}
 	err := table.Insert(xid, insert)
 	if err != nil {
@@ -176,29 +423,36 @@ func (tableManager *TableManager) Insert(xid int64, insert *statement.InsertStat
 }
 
 func (tableManager *TableManager) Read(xid int64, read *statement.SelectStatement) ([]byte, error) {
-	tableManager.lock.Lock()
-	table := tableManager.tableCache[read.TableName]
-	tableManager.lock.Unlock()
+	result, err := tableManager.Query(xid, read)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result.String()), nil
+}
 
+// Query 查询表中的记录，返回带有字段信息的查询结果
+func (tableManager *TableManager) Query(xid int64, read *statement.SelectStatement) (*QueryResult, error) {
+	table := tableManager.getTable(xid, read.TableName)
 	if table == nil {
-		return nil, errors.New(commons.ErrorMessage.TableNotFoundError)
+		return nil, commons.NewError(commons.ErrorMessage.TableNotFoundError)
 	}
+	return table.Query(xid, read)
+}
 
-	data, err := table.Read(xid, read)
-	if err != nil {
-		return nil, err
+// OpenCursor 执行查询并返回游标，调用者逐批读取查询结果
+func (tableManager *TableManager) OpenCursor(xid int64, read *statement.SelectStatement) (*Cursor, error) {
+	table := tableManager.getTable(xid, read.TableName)
+	if table == nil {
+		return nil, commons.NewError(commons.ErrorMessage.TableNotFoundError)
 	}
-
-	return []byte(data), nil
+	return table.OpenCursor(xid, read)
 }
 
 func (tableManager *TableManager) Update(xid int64, update *statement.UpdateStatement) ([]byte, error) {
-	tableManager.lock.Lock()
-	table := tableManager.tableCache[update.TableName]
-	tableManager.lock.Unlock()
+	table := tableManager.getTable(xid, update.TableName)
 
 	if table == nil {
-		return nil, errors.New(commons.ErrorMessage.TableNotFoundError)
+		return nil, commons.NewError(commons.ErrorMessage.TableNotFoundError)
 	}
 	count, err := table.Update(xid, update)
 	if err != nil {
@@ -208,12 +462,10 @@ func (tableManager *TableManager) Update(xid int64, update *statement.UpdateStat
 }
 
 func (tableManager *TableManager) Delete(xid int64, deleteStatement *statement.DeleteStatement) ([]byte, error) {
-	tableManager.lock.Lock()
-	table := tableManager.tableCache[deleteStatement.TableName]
-	tableManager.lock.Unlock()
+	table := tableManager.getTable(xid, deleteStatement.TableName)
 
 	if table == nil {
-		return nil, errors.New(commons.ErrorMessage.TableNotFoundError)
+		return nil, commons.NewError(commons.ErrorMessage.TableNotFoundError)
 	}
 
 	count, err := table.Delete(xid, deleteStatement)
@@ -222,3 +474,99 @@ func (tableManager *TableManager) Delete(xid int64, deleteStatement *statement.D
 	}
 	return []byte("delete " + strconv.Itoa(count)), nil
 }
+
+// TableNames 返回所有表名，按照字典序排列
+func (tableManager *TableManager) TableNames() []string {
+	tableManager.lock.Lock()
+	defer tableManager.lock.Unlock()
+
+	names := make([]string, 0, len(tableManager.tableCache))
+	for name := range tableManager.tableCache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Copy 执行 COPY 语句，在事务xid中从CSV文件导入表的数据，或者将事务xid可见的数据导出到CSV文件
+// 文件由服务端进程读写，路径是相对于服务端配置的文件目录的路径，而不是客户端的路径
+func (tableManager *TableManager) Copy(xid int64, copyStatement *statement.CopyStatement) ([]byte, error) {
+	table := tableManager.getTable(xid, copyStatement.TableName)
+
+	if table == nil {
+		return nil, commons.NewError(commons.ErrorMessage.TableNotFoundError)
+	}
+	file, err := tableManager.resolveFile(copyStatement.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	if copyStatement.IsFrom {
+		count, err = table.CopyFrom(xid, file, copyStatement.Header)
+	} else {
+		count, err = table.CopyTo(xid, file, copyStatement.Header)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte("copy " + strconv.Itoa(count)), nil
+}
+
+// getTable 获取事务xid能够使用的表，包括事务自己创建但还没有提交的表
+func (tableManager *TableManager) getTable(xid int64, name string) *Table {
+	tableManager.lock.Lock()
+	defer tableManager.lock.Unlock()
+	for _, p := range tableManager.xidTableCache[xid] {
+		if p.table.Name == name {
+			return p.table
+		}
+	}
+	return tableManager.tableCache[name]
+}
+
+// GetTable 根据表名获取已经提交的表，表不存在时返回nil
+func (tableManager *TableManager) GetTable(name string) *Table {
+	tableManager.lock.Lock()
+	defer tableManager.lock.Unlock()
+	return tableManager.tableCache[name]
+}
+
+// Backup 在数据库运行期间将.bt、.db、.xid文件和日志段一致地复制到dir目录中，dir与COPY的文件一样是文件目录下的相对路径
+// 复制顺序为 .bt -> .db -> .xid -> 日志，数据页和xid文件中出现的修改，其日志一定在之后复制的日志段中，
+// 打开备份时通过日志恢复即可得到一致的状态；备份期间新建的表不包含在备份中
+func (tableManager *TableManager) Backup(backup *statement.BackupStatement) ([]byte, error) {
+	if tableManager.booter.memory {
+		return nil, commons.NewError(commons.ErrorMessage.MemoryDatabaseError)
+	}
+	dir, err := tableManager.resolveFile(backup.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, filepath.Base(tableManager.booter.Path))
+	// 复制数据页之后建立的检查点会删除备份所需要的日志段
+	tableManager.DM.DBLogger.PinSegments()
+	defer tableManager.DM.DBLogger.UnpinSegments()
+
+	// 复制启动信息时持有表管理器的锁，避免与建表同时进行
+	tableManager.lock.Lock()
+	err = utils.WriteFileSync(path+BooterSuffix, tableManager.booter.Load())
+	tableManager.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tableManager.DM.PC.Backup(path); err != nil {
+		return nil, err
+	}
+	if err = tableManager.VM.TM.Backup(path); err != nil {
+		return nil, err
+	}
+	if err = tableManager.DM.DBLogger.Backup(path); err != nil {
+		return nil, err
+	}
+	return []byte("backup to " + path), nil
+}
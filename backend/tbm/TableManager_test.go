@@ -0,0 +1,89 @@
+package tbm
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/parser"
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTableManager 打开path处已有的数据库，不关闭之前打开的数据库，模拟崩溃后重启
+func openTableManager(path string) (*TableManager, func()) {
+	transactionManager, err := tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		panic(err)
+	}
+	dataManager := dm.OpenDataManager(path, 64<<20, transactionManager)
+	tableManager := OpenTableManager(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	return tableManager, func() {
+		dataManager.Close()
+		transactionManager.Close()
+	}
+}
+
+func mustParse(t *testing.T, sql string) interface{} {
+	stat, err := parser.Parse([]byte(sql))
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return stat
+}
+
+// createTable 在事务xid中创建表table并插入一条记录
+func createTable(t *testing.T, tableManager *TableManager, xid int64, table string) {
+	if _, err := tableManager.Create(xid, mustParse(t, "create table "+table+" id int32, (index id)").(*statement.CreateStatement)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tableManager.Insert(xid, mustParse(t, "insert into "+table+" values 1").(*statement.InsertStatement)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCreateTableCrashBeforeCommit 写入表记录并更新启动信息之后、事务提交之前崩溃，重启后之前的表仍然可以访问
+func TestCreateTableCrashBeforeCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	for _, table := range []string{"teacher", "course"} {
+		xid := tableManager.Begin(&statement.BeginStatement{}).Xid
+		createTable(t, tableManager, xid, table)
+		if _, err := tableManager.Commit(xid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	xid := tableManager.Begin(&statement.BeginStatement{}).Xid
+	createTable(t, tableManager, xid, "student")
+	tableManager.lock.Lock()
+	if _, err := tableManager.publishTables(tableManager.xidTableCache[xid]); err != nil {
+		t.Fatal(err)
+	}
+	tableManager.lock.Unlock()
+
+	tableManager, closeDB := openTableManager(path)
+	if names := strings.Join(tableManager.TableNames(), ","); names != "course,teacher" {
+		t.Fatalf("unexpected tables after crash: %s", names)
+	}
+	read := mustParse(t, "select * from teacher").(*statement.SelectStatement)
+	if res, err := tableManager.Read(tm.SuperXid, read); err != nil || string(res) != "[1]\n" {
+		t.Fatalf("unexpected result %q %v", res, err)
+	}
+	// 没有提交的表被跳过，可以重新创建同名的表
+	xid = tableManager.Begin(&statement.BeginStatement{}).Xid
+	createTable(t, tableManager, xid, "student")
+	if _, err := tableManager.Commit(xid); err != nil {
+		t.Fatal(err)
+	}
+	closeDB()
+
+	tableManager, closeDB = openTableManager(path)
+	defer closeDB()
+	if names := strings.Join(tableManager.TableNames(), ","); names != "course,student,teacher" {
+		t.Fatalf("unexpected tables after reopen: %s", names)
+	}
+}
@@ -0,0 +1,300 @@
+package tm
+
+import (
+	"SimpleDB/backend/utils"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/**
+ * 提交时间文件与xid文件放在一起，记录每个事务提交的时间，用于 AS OF 查询
+ * 文件由定长的记录组成：[XID][Timestamp][Counter]，各8字节，Timestamp为Unix纳秒，
+ * Counter为提交时已经分配的最大事务ID，事务ID大于Counter的事务开始时该事务已经提交
+ * 记录按照提交的顺序追加，写入提交时间之后才会在xid文件中标记提交，
+ * 提交时不单独落盘，提交日志中带有相同的时间，崩溃后恢复时根据提交日志补齐丢失的记录，
+ * 崩溃时末尾不完整的记录会被截断，重复的记录以最后一条为准
+ * 超出保留时间的记录会被清理，清理时先写临时文件再替换，
+ * XID为0的记录保存清理的时间点，早于该时间的提交日志在恢复时不再补齐
+ */
+
+var (
+	// CommitTimeSuffix 提交时间文件后缀
+	CommitTimeSuffix = ".xts"
+	// CommitTimeTmpSuffix 清理提交时间时使用的临时文件后缀
+	CommitTimeTmpSuffix = ".xts.tmp"
+	// CommitTimeRecordLength 每条提交时间记录的长度
+	CommitTimeRecordLength = 24
+)
+
+// commitRecord 一个事务的提交记录
+type commitRecord struct {
+	xid       int64
+	timestamp int64
+	// counter 提交时已经分配的最大事务ID
+	counter int64
+}
+
+func (record *commitRecord) bytes() []byte {
+	raw := make([]byte, CommitTimeRecordLength)
+	binary.BigEndian.PutUint64(raw[:8], uint64(record.xid))
+	binary.BigEndian.PutUint64(raw[8:16], uint64(record.timestamp))
+	binary.BigEndian.PutUint64(raw[16:], uint64(record.counter))
+	return raw
+}
+
+func parseCommitRecord(raw []byte) commitRecord {
+	return commitRecord{
+		xid:       int64(binary.BigEndian.Uint64(raw[:8])),
+		timestamp: int64(binary.BigEndian.Uint64(raw[8:16])),
+		counter:   int64(binary.BigEndian.Uint64(raw[16:])),
+	}
+}
+
+// openCommitTimes 打开并加载提交时间文件，文件不存在时创建一个空文件，只读打开时只加载已有的记录
+func (manager *TransactionManagerImpl) openCommitTimes() error {
+	manager.commitTimes = make(map[int64]commitRecord)
+	manager.commitOrder = nil
+	manager.prunedBefore = 0
+	name := manager.path + CommitTimeSuffix
+	if manager.readOnly {
+		if !utils.FileExists(name) {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		manager.loadCommitTimes(data)
+		return nil
+	}
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil {
+		return err
+	}
+	manager.commitTimeFile = file
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	size := manager.loadCommitTimes(data)
+	if size != int64(len(data)) {
+		return file.Truncate(size)
+	}
+	return nil
+}
+
+// loadCommitTimes 解析提交时间记录并按照提交时间排序，返回完整记录的总长度
+func (manager *TransactionManagerImpl) loadCommitTimes(data []byte) int64 {
+	n := len(data) / CommitTimeRecordLength
+	for i := 0; i < n; i++ {
+		record := parseCommitRecord(data[i*CommitTimeRecordLength : (i+1)*CommitTimeRecordLength])
+		if record.xid == SuperXid {
+			if record.timestamp > manager.prunedBefore {
+				manager.prunedBefore = record.timestamp
+			}
+			continue
+		}
+		manager.commitTimes[record.xid] = record
+	}
+	manager.commitOrder = make([]commitRecord, 0, len(manager.commitTimes))
+	for _, record := range manager.commitTimes {
+		manager.commitOrder = append(manager.commitOrder, record)
+	}
+	sort.Slice(manager.commitOrder, func(i, j int) bool {
+		return commitBefore(&manager.commitOrder[i], &manager.commitOrder[j])
+	})
+	return int64(n * CommitTimeRecordLength)
+}
+
+// commitBefore commitOrder中的顺序，按照提交时间排序，时间相同时按照事务ID排序
+func commitBefore(a *commitRecord, b *commitRecord) bool {
+	if a.timestamp != b.timestamp {
+		return a.timestamp < b.timestamp
+	}
+	return a.xid < b.xid
+}
+
+// CommitAt 以timestamp作为提交时间提交一个事务，timestamp应当与提交日志中的时间相同
+// 恢复时重复提交已有记录的事务，保留原来记录的事务计数器；没有记录时只能使用当前的计数器，
+// 这样得到的计数器不小于实际提交时的值，AS OF XID 查询只会更保守地认为它还没有提交
+func (manager *TransactionManagerImpl) CommitAt(xid int64, timestamp int64) {
+	manager.lock.Lock()
+	record := commitRecord{xid: xid, timestamp: timestamp, counter: manager.state.Counter()}
+	if old, ok := manager.commitTimes[xid]; ok {
+		record.counter = old.counter
+		manager.removeCommitRecord(old)
+	}
+	if !manager.readOnly {
+		size, err := utils.GetFileSize(manager.commitTimeFile)
+		if err != nil {
+			panic(err)
+		}
+		size -= size % int64(CommitTimeRecordLength)
+		if _, err = manager.commitTimeFile.WriteAt(record.bytes(), size); err != nil {
+			panic(err)
+		}
+	}
+	manager.commitTimes[xid] = record
+	manager.insertCommitRecord(record)
+	manager.lock.Unlock()
+
+	manager.updateXID(xid, FieldTranCommitted)
+}
+
+// RestoreCommitTime 恢复时根据提交日志补齐已经提交但是丢失了提交记录的事务，不改变事务的状态
+// 清理时间点之前提交的事务的记录是被清理掉的，不再补齐；计数器与CommitAt一样只能使用当前的值
+func (manager *TransactionManagerImpl) RestoreCommitTime(xid int64, timestamp int64) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	if _, ok := manager.commitTimes[xid]; ok || timestamp < manager.prunedBefore {
+		return
+	}
+	record := commitRecord{xid: xid, timestamp: timestamp, counter: manager.state.Counter()}
+	if !manager.readOnly {
+		size, err := utils.GetFileSize(manager.commitTimeFile)
+		if err != nil {
+			panic(err)
+		}
+		size -= size % int64(CommitTimeRecordLength)
+		if _, err = manager.commitTimeFile.WriteAt(record.bytes(), size); err != nil {
+			panic(err)
+		}
+	}
+	manager.commitTimes[xid] = record
+	manager.insertCommitRecord(record)
+}
+
+// SyncCommitTimes 将提交时间文件落盘，关闭数据库之前和删除旧的日志段之前调用
+func (manager *TransactionManagerImpl) SyncCommitTimes() {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	if manager.commitTimeFile == nil {
+		return
+	}
+	if err := manager.commitTimeFile.Sync(); err != nil {
+		panic(err)
+	}
+}
+
+// insertCommitRecord 将记录插入commitOrder，提交时间通常是递增的，一般直接追加在末尾
+func (manager *TransactionManagerImpl) insertCommitRecord(record commitRecord) {
+	order := manager.commitOrder
+	i := len(order)
+	for i > 0 && commitBefore(&record, &order[i-1]) {
+		i--
+	}
+	order = append(order, commitRecord{})
+	copy(order[i+1:], order[i:])
+	order[i] = record
+	manager.commitOrder = order
+}
+
+// removeCommitRecord 从commitOrder中删除记录
+func (manager *TransactionManagerImpl) removeCommitRecord(record commitRecord) {
+	order := manager.commitOrder
+	i := sort.Search(len(order), func(i int) bool { return !commitBefore(&order[i], &record) })
+	if i < len(order) && order[i].xid == record.xid {
+		manager.commitOrder = append(order[:i], order[i+1:]...)
+	}
+}
+
+// CommitTime 返回事务的提交时间，没有记录提交时间的事务（例如升级之前提交或者已经被清理的事务）返回false
+func (manager *TransactionManagerImpl) CommitTime(xid int64) (int64, bool) {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	record, ok := manager.commitTimes[xid]
+	return record.timestamp, ok
+}
+
+// CommittedBefore 判断事务xid是否在事务n开始之前提交，即是否对事务n开始时的快照可见
+// 没有提交记录的已提交事务视为很早之前就已经提交
+func (manager *TransactionManagerImpl) CommittedBefore(xid int64, n int64) bool {
+	if xid >= n {
+		return false
+	}
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	record, ok := manager.commitTimes[xid]
+	return !ok || record.counter < n
+}
+
+// FirstCommittedSince 返回在timestamp及之后提交的事务中最小的事务ID，没有这样的事务时返回下一个将要分配的事务ID
+// 只需要查找提交时间不早于timestamp的记录，清理之后这些记录都在保留时间之内
+func (manager *TransactionManagerImpl) FirstCommittedSince(timestamp int64) int64 {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	first := manager.state.Counter() + 1
+	order := manager.commitOrder
+	for i := sort.Search(len(order), func(i int) bool { return order[i].timestamp >= timestamp }); i < len(order); i++ {
+		if order[i].xid < first && manager.state.Status(order[i].xid) == FieldTranCommitted {
+			first = order[i].xid
+		}
+	}
+	return first
+}
+
+// PruneCommitTimes 清理在cutoff之前提交、并且提交时的事务计数器小于horizon的记录，返回清理的记录数
+// 这些事务对任何不早于cutoff的 AS OF TIMESTAMP 查询和不小于horizon的 AS OF XID 查询都已经提交，
+// 清理之后视为很早之前就已经提交，查询结果不变
+func (manager *TransactionManagerImpl) PruneCommitTimes(horizon int64, cutoff int64) int {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	n := 0
+	for n < len(manager.commitOrder) && manager.commitOrder[n].timestamp < cutoff && manager.commitOrder[n].counter < horizon {
+		delete(manager.commitTimes, manager.commitOrder[n].xid)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	manager.commitOrder = append([]commitRecord(nil), manager.commitOrder[n:]...)
+	if cutoff > manager.prunedBefore {
+		manager.prunedBefore = cutoff
+	}
+	manager.rewriteCommitTimes()
+	return n
+}
+
+// rewriteCommitTimes 将内存中的提交记录写入提交时间文件，先写临时文件再替换，调用者需要持有锁
+func (manager *TransactionManagerImpl) rewriteCommitTimes() {
+	if manager.readOnly {
+		return
+	}
+	data := make([]byte, 0, (len(manager.commitOrder)+1)*CommitTimeRecordLength)
+	if manager.prunedBefore > 0 {
+		mark := commitRecord{xid: SuperXid, timestamp: manager.prunedBefore}
+		data = append(data, mark.bytes()...)
+	}
+	for i := range manager.commitOrder {
+		data = append(data, manager.commitOrder[i].bytes()...)
+	}
+	if manager.memory {
+		if _, err := manager.commitTimeFile.WriteAt(data, 0); err != nil {
+			panic(err)
+		}
+		if err := manager.commitTimeFile.Truncate(int64(len(data))); err != nil {
+			panic(err)
+		}
+		return
+	}
+	tmp := manager.path + CommitTimeTmpSuffix
+	_ = os.Remove(tmp)
+	if err := utils.WriteFileSync(tmp, data); err != nil {
+		panic(err)
+	}
+	if err := os.Rename(tmp, manager.path+CommitTimeSuffix); err != nil {
+		panic(err)
+	}
+	if err := utils.SyncDir(filepath.Dir(manager.path)); err != nil {
+		panic(err)
+	}
+	file, err := os.OpenFile(manager.path+CommitTimeSuffix, os.O_RDWR, 0755)
+	if err != nil {
+		panic(err)
+	}
+	_ = manager.commitTimeFile.Close()
+	manager.commitTimeFile = file
+}
@@ -0,0 +1,221 @@
+package tm
+
+import (
+	"SimpleDB/backend/utils"
+	"SimpleDB/commons"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/**
+ * 预备事务文件与xid文件放在一起，记录处于预备状态的事务的全局事务ID，以及恢复它们所需的状态（例如持有的行锁）
+ * 文件由变长的记录组成：[XID 8][GidLength 2][Gid][StateLength 4][State]
+ * 预备时先追加记录再在xid文件中标记预备状态，打开时只保留xid文件中仍为预备状态的事务的记录，
+ * 预备事务结束后重写整个文件，崩溃时末尾不完整的记录会被丢弃
+ */
+
+var (
+	// PreparedSuffix 预备事务文件后缀
+	PreparedSuffix = ".xpr"
+	// PreparedTmpSuffix 重写预备事务文件时使用的临时文件后缀
+	PreparedTmpSuffix = ".xpr.tmp"
+	// MaxGidLength 全局事务ID的最大长度
+	MaxGidLength = 200
+)
+
+// PreparedTransaction 一个处于预备状态的事务
+type PreparedTransaction struct {
+	Xid int64
+	// Gid 协调者指定的全局事务ID
+	Gid string
+	// State 由上层保存的事务状态，重启后用于恢复事务，事务管理器不解析它
+	State []byte
+}
+
+// bytes 序列化为预备事务文件中的一条记录
+func (prepared *PreparedTransaction) bytes() []byte {
+	data := make([]byte, 8+2+len(prepared.Gid)+4+len(prepared.State))
+	binary.BigEndian.PutUint64(data, uint64(prepared.Xid))
+	binary.BigEndian.PutUint16(data[8:], uint16(len(prepared.Gid)))
+	copy(data[10:], prepared.Gid)
+	offset := 10 + len(prepared.Gid)
+	binary.BigEndian.PutUint32(data[offset:], uint32(len(prepared.State)))
+	copy(data[offset+4:], prepared.State)
+	return data
+}
+
+// parsePrepared 解析预备事务文件，遇到不完整的记录时停止
+func parsePrepared(data []byte) []*PreparedTransaction {
+	result := make([]*PreparedTransaction, 0)
+	for len(data) >= 10 {
+		gidLength := int(binary.BigEndian.Uint16(data[8:10]))
+		if len(data) < 10+gidLength+4 {
+			break
+		}
+		stateLength := int(binary.BigEndian.Uint32(data[10+gidLength:]))
+		end := 10 + gidLength + 4 + stateLength
+		if len(data) < end {
+			break
+		}
+		state := make([]byte, stateLength)
+		copy(state, data[10+gidLength+4:end])
+		result = append(result, &PreparedTransaction{
+			Xid:   int64(binary.BigEndian.Uint64(data[:8])),
+			Gid:   string(data[10 : 10+gidLength]),
+			State: state,
+		})
+		data = data[end:]
+	}
+	return result
+}
+
+// openPrepared 加载预备事务文件，只保留仍处于预备状态的事务，文件与内存中的状态不一致时重写
+func (manager *TransactionManagerImpl) openPrepared() error {
+	manager.prepared = make(map[int64]*PreparedTransaction)
+	data, err := os.ReadFile(manager.path + PreparedSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, prepared := range parsePrepared(data) {
+		if prepared.Xid <= manager.state.Frozen() || prepared.Xid > manager.state.Counter() ||
+			manager.state.Status(prepared.Xid) != FieldTranPrepared {
+			continue
+		}
+		manager.prepared[prepared.Xid] = prepared
+	}
+	// 标记为预备状态的事务一定已经写入了记录
+	for xid := manager.state.Frozen() + 1; xid <= manager.state.Counter(); xid++ {
+		if manager.state.Status(xid) == FieldTranPrepared && manager.prepared[xid] == nil {
+			commons.Logger.Errorf("prepared xid %d has no record", xid)
+			panic(commons.ErrorMessage.BadXIDFileException)
+		}
+	}
+	if !bytes.Equal(data, manager.preparedBytes()) {
+		manager.rewritePrepared()
+	}
+	return nil
+}
+
+// preparedBytes 序列化所有预备事务，按照事务ID排序
+func (manager *TransactionManagerImpl) preparedBytes() []byte {
+	data := make([]byte, 0)
+	for _, prepared := range manager.sortedPrepared() {
+		data = append(data, prepared.bytes()...)
+	}
+	return data
+}
+
+// sortedPrepared 按照事务ID排序的预备事务
+func (manager *TransactionManagerImpl) sortedPrepared() []*PreparedTransaction {
+	result := make([]*PreparedTransaction, 0, len(manager.prepared))
+	for _, prepared := range manager.prepared {
+		result = append(result, prepared)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Xid < result[j].Xid })
+	return result
+}
+
+// rewritePrepared 将内存中的预备事务写入文件，先写临时文件再替换
+func (manager *TransactionManagerImpl) rewritePrepared() {
+	if manager.readOnly || manager.memory {
+		return
+	}
+	tmp := manager.path + PreparedTmpSuffix
+	if err := utils.WriteFileSync(tmp, manager.preparedBytes()); err != nil {
+		panic(err)
+	}
+	if err := os.Rename(tmp, manager.path+PreparedSuffix); err != nil {
+		panic(err)
+	}
+	if err := utils.SyncDir(filepath.Dir(manager.path)); err != nil {
+		panic(err)
+	}
+}
+
+// forgetPrepared 预备事务结束后删除它的记录，调用者需要持有锁
+func (manager *TransactionManagerImpl) forgetPrepared(xid int64) {
+	if _, ok := manager.prepared[xid]; !ok {
+		return
+	}
+	delete(manager.prepared, xid)
+	manager.rewritePrepared()
+}
+
+// ValidateGid 检查全局事务ID是否合法，不能为空，也不能超过 MaxGidLength 字节
+func ValidateGid(gid string) error {
+	if gid == "" || len(gid) > MaxGidLength {
+		return commons.NewError(commons.ErrorMessage.InvalidGidError)
+	}
+	return nil
+}
+
+// Prepare 将活动事务xid设置为预备状态，gid不能与其他预备事务重复
+// 调用者需要保证事务的所有日志已经落盘，预备之后事务只能通过 Commit 或者 Abort 结束，重启后仍然保持预备状态
+func (manager *TransactionManagerImpl) Prepare(xid int64, gid string, state []byte) error {
+	if err := ValidateGid(gid); err != nil {
+		return err
+	}
+	manager.lock.Lock()
+	if manager.state.Status(xid) != FieldTranActive {
+		manager.lock.Unlock()
+		return commons.NewError(commons.ErrorMessage.TransactionNotActiveError)
+	}
+	for _, prepared := range manager.prepared {
+		if prepared.Gid == gid {
+			manager.lock.Unlock()
+			return commons.NewError(commons.ErrorMessage.DuplicatedGidError)
+		}
+	}
+	prepared := &PreparedTransaction{Xid: xid, Gid: gid, State: state}
+	if !manager.readOnly && !manager.memory {
+		file, err := os.OpenFile(manager.path+PreparedSuffix, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0755)
+		if err != nil {
+			manager.lock.Unlock()
+			return err
+		}
+		_, err = file.Write(prepared.bytes())
+		if err == nil {
+			err = file.Sync()
+		}
+		_ = file.Close()
+		if err != nil {
+			manager.lock.Unlock()
+			return err
+		}
+	}
+	manager.prepared[xid] = prepared
+	manager.lock.Unlock()
+
+	manager.updateXID(xid, FieldTranPrepared)
+	return nil
+}
+
+// PreparedXid 返回全局事务ID对应的预备事务
+func (manager *TransactionManagerImpl) PreparedXid(gid string) (int64, bool) {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	for xid, prepared := range manager.prepared {
+		if prepared.Gid == gid {
+			return xid, true
+		}
+	}
+	return 0, false
+}
+
+// Prepared 返回所有处于预备状态的事务，按照事务ID排序
+func (manager *TransactionManagerImpl) Prepared() []*PreparedTransaction {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	return manager.sortedPrepared()
+}
+
+// backupPrepared 将预备事务写入path对应的预备事务文件，调用者需要持有锁
+func (manager *TransactionManagerImpl) backupPrepared(path string) error {
+	if len(manager.prepared) == 0 {
+		return nil
+	}
+	return utils.WriteFileSync(path+PreparedSuffix, manager.preparedBytes())
+}
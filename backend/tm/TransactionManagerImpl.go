@@ -3,67 +3,99 @@ package tm
 import (
 	"SimpleDB/backend/utils"
 	"SimpleDB/commons"
+	"bytes"
 	"encoding/binary"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
 var (
-	// LenXidHeaderLength XID文件头长度
-	LenXidHeaderLength int64 = 8
-	// LenXidFieldSize 每个事务的占用长度
-	LenXidFieldSize int64 = 1
-
-	// FieldTranActive 事务的三种状态
+	// FieldTranActive 事务的四种状态，预备状态的事务已经执行完毕，等待协调者决定提交或者终止
 	FieldTranActive    byte = 0
 	FieldTranCommitted byte = 1
 	FieldTranAborted   byte = 2
+	FieldTranPrepared  byte = 3
 
 	// SuperXid 超级事务，永远为commited状态
 	SuperXid int64 = 0
 
 	// XidSuffix 事务文件后缀
 	XidSuffix = ".xid"
+	// XidTmpSuffix 重写xid文件时使用的临时文件后缀
+	XidTmpSuffix = ".xid.tmp"
+
+	// FreezeThreshold 未冻结的事务数达到该值时才会尝试冻结
+	FreezeThreshold int64 = 4096
 )
 
 type TransactionManagerImpl struct {
-	file *os.File
-	// xidCounter 事务id的编号，同时也是计数器
-	xidCounter int64
-	// counterLock 用于保护xidCounter，自动初始化，不用手动赋值
-	counterLock sync.Mutex
+	path string
+	file utils.File
+	// state 所有事务的状态，检查事务状态时不需要读取文件
+	state *XidState
+	// lock 用于保护state和file，自动初始化，不用手动赋值
+	lock sync.RWMutex
+	// readOnly 只读打开时事务状态的变化只保存在内存中，不会写入文件
+	readOnly bool
+	// memory 内存数据库的事务管理器，xid文件和提交时间文件都是内存文件，预备事务只保存在内存中
+	memory bool
+	// commitTimeFile 提交时间文件，只读打开时为nil
+	commitTimeFile utils.File
+	// commitTimes 事务的提交记录，键是事务ID
+	commitTimes map[int64]commitRecord
+	// commitOrder 按照提交时间排序的提交记录，用于查找某个时间之后提交的事务以及清理过期的记录
+	commitOrder []commitRecord
+	// prunedBefore 清理提交记录的时间点，早于该时间提交的事务的记录已经被清理
+	prunedBefore int64
+	// prepared 处于预备状态的事务，键是事务ID
+	prepared map[int64]*PreparedTransaction
 }
 
 // CreateTransactionManagerImpl 创建一个新的事务管理器
 func CreateTransactionManagerImpl(path string) (*TransactionManagerImpl, error) {
-	var transactionManager *TransactionManagerImpl
 	// 如果文件已经存在那么直接报错
 	if utils.FileExists(path + XidSuffix) {
 		panic(commons.ErrorMessage.FileExistError)
 	}
+	state := NewXidState()
+	// 写空XID文件头
+	if err := utils.WriteFileSync(path+XidSuffix, state.Bytes()); err != nil {
+		return nil, err
+	}
 	// 尝试打开文件
-	file, err := os.OpenFile(path+XidSuffix, os.O_RDWR|os.O_CREATE, 0755)
+	file, err := os.OpenFile(path+XidSuffix, os.O_RDWR, 0755)
 	if err != nil {
 		return nil, err
-	} else {
-		// 创建新的事务管理器TM
-		transactionManager = &TransactionManagerImpl{
-			file: file,
-		}
 	}
-
-	// 写空XID文件头
-	blankHeader := make([]byte, LenXidHeaderLength)
-	writeNum, err := transactionManager.file.WriteAt(blankHeader, 0)
-	if err != nil {
+	// 创建新的事务管理器TM
+	transactionManager := &TransactionManagerImpl{
+		path:  path,
+		file:  file,
+		state: state,
+	}
+	if err = transactionManager.openCommitTimes(); err != nil {
 		return nil, err
 	}
-	if int64(writeNum) != LenXidHeaderLength {
-		panic(commons.ErrorMessage.WriteFileHeaderError)
+	if err = transactionManager.openPrepared(); err != nil {
+		return nil, err
 	}
 	return transactionManager, nil
 }
 
+// CreateMemoryTransactionManagerImpl 创建内存数据库的事务管理器
+func CreateMemoryTransactionManagerImpl() *TransactionManagerImpl {
+	state := NewXidState()
+	return &TransactionManagerImpl{
+		file:           utils.NewMemoryFile(state.Bytes()),
+		state:          state,
+		memory:         true,
+		commitTimeFile: utils.NewMemoryFile(nil),
+		commitTimes:    make(map[int64]commitRecord),
+		prepared:       make(map[int64]*PreparedTransaction),
+	}
+}
+
 func OpenTransactionManagerImpl(path string) (*TransactionManagerImpl, error) {
 	// 如果文件不存在那么直接报错
 	if !utils.FileExists(path + XidSuffix) {
@@ -76,91 +108,225 @@ func OpenTransactionManagerImpl(path string) (*TransactionManagerImpl, error) {
 	}
 	// 创建新的事务管理器TM
 	transactionManager := &TransactionManagerImpl{
+		path: path,
 		file: file,
 	}
-	// 检查XID计数器是否合法
-	transactionManager.checkXidCounter()
+	// 检查XID文件是否合法，并加载所有事务的状态
+	transactionManager.loadXidState()
 	commons.Logger.Debugf("xid文件校验成功!")
+	if err = transactionManager.openCommitTimes(); err != nil {
+		return nil, err
+	}
+	if err = transactionManager.openPrepared(); err != nil {
+		return nil, err
+	}
 
 	return transactionManager, nil
 }
 
-// checkXidCounter 检查XID计数器是否合法
-// 读取XID_FILE_HEADER中的xidCounter，根据它计算文件的理论长度，对比实际长度
-func (manager *TransactionManagerImpl) checkXidCounter() {
-	// 获取文件长度
-	fileLength, _ := utils.GetFileSizeByPath(manager.file.Name())
-	if fileLength < LenXidHeaderLength {
-		panic(commons.ErrorMessage.BadXIDFileException)
+// OpenReadOnlyTransactionManagerImpl 以只读方式打开事务管理器，恢复时修改的事务状态只保存在内存中
+func OpenReadOnlyTransactionManagerImpl(path string) (*TransactionManagerImpl, error) {
+	file, err := os.Open(path + XidSuffix)
+	if err != nil {
+		return nil, err
 	}
-	// 读取xid头标识的文件长度
-	xidHeader := make([]byte, LenXidHeaderLength)
-	_, _ = manager.file.ReadAt(xidHeader, 0)
-	manager.xidCounter = int64(binary.BigEndian.Uint64(xidHeader))
-
-	if fileLength != manager.getXidPosition(manager.xidCounter+1) {
-		panic(commons.ErrorMessage.BadXIDFileException)
+	transactionManager := &TransactionManagerImpl{
+		path:     path,
+		file:     file,
+		readOnly: true,
 	}
-
-}
-
-// getXidPosition 根据事务xid取得其在xid文件中对应的位置
-func (manager *TransactionManagerImpl) getXidPosition(xid int64) int64 {
-	return LenXidHeaderLength + (xid-1)*LenXidFieldSize
+	transactionManager.loadXidState()
+	if err = transactionManager.openCommitTimes(); err != nil {
+		return nil, err
+	}
+	if err = transactionManager.openPrepared(); err != nil {
+		return nil, err
+	}
+	return transactionManager, nil
 }
 
-// updateXID 更新xid事务的状态为status
-func (manager *TransactionManagerImpl) updateXID(xid int64, status byte) {
-	offset := manager.getXidPosition(xid)
-	// 创建事务的状态的字节数组
-	tmp := make([]byte, LenXidFieldSize)
-	tmp[0] = status
-	// 写入事务状态
-	_, err := manager.file.WriteAt(tmp[:], offset)
+// loadXidState 读取并检查xid文件，旧格式或者长度与计数器不一致的文件会被重写
+func (manager *TransactionManagerImpl) loadXidState() {
+	data, err := os.ReadFile(manager.path + XidSuffix)
 	if err != nil {
 		panic(err)
 	}
-
-	// 强制刷新
-	err = manager.file.Sync()
+	state, err := ParseXidState(data)
 	if err != nil {
-		panic(err)
+		commons.Logger.Errorf("%v", err)
+		panic(commons.ErrorMessage.BadXIDFileException)
+	}
+	if err = state.Validate(); err != nil {
+		commons.Logger.Errorf("%v", err)
+		panic(commons.ErrorMessage.BadXIDFileException)
+	}
+	manager.state = state
+	if int64(len(data)) != state.FileLength() || !bytes.Equal(data, state.Bytes()) {
+		manager.rewrite()
 	}
 }
 
-// incrXIDCounter 增加xidCounter， 并更新XID文件的头部信息
-func (manager *TransactionManagerImpl) incrXIDCounter() {
-	// 事务总数加一
-	manager.xidCounter++
-	// 创建一个长度为8的字节数组
-	tmp := make([]byte, LenXidHeaderLength)
-	// 将xidCounter转换为字节数组
-	binary.BigEndian.PutUint64(tmp, uint64(manager.xidCounter))
-	// 将xidCounter写入文件
-	_, err := manager.file.WriteAt(tmp[:], 0)
+// rewrite 将内存中的状态完整写入xid文件，先写临时文件再替换，保证崩溃时文件完整
+func (manager *TransactionManagerImpl) rewrite() {
+	if manager.readOnly {
+		return
+	}
+	if manager.memory {
+		data := manager.state.Bytes()
+		manager.writeAt(data, 0)
+		if err := manager.file.Truncate(int64(len(data))); err != nil {
+			panic(err)
+		}
+		return
+	}
+	tmp := manager.path + XidTmpSuffix
+	_ = os.Remove(tmp)
+	if err := utils.WriteFileSync(tmp, manager.state.Bytes()); err != nil {
+		panic(err)
+	}
+	if err := os.Rename(tmp, manager.path+XidSuffix); err != nil {
+		panic(err)
+	}
+	if err := utils.SyncDir(filepath.Dir(manager.path)); err != nil {
+		panic(err)
+	}
+	file, err := os.OpenFile(manager.path+XidSuffix, os.O_RDWR, 0755)
 	if err != nil {
 		panic(err)
 	}
+	_ = manager.file.Close()
+	manager.file = file
+}
 
-	// 强制刷新
-	err = manager.file.Sync()
-	if err != nil {
+// writeAt 写入并强制刷新
+func (manager *TransactionManagerImpl) writeAt(data []byte, offset int64) {
+	if manager.readOnly {
+		return
+	}
+	if _, err := manager.file.WriteAt(data, offset); err != nil {
 		panic(err)
 	}
+	if err := manager.file.Sync(); err != nil {
+		panic(err)
+	}
+}
+
+// updateXID 更新xid事务的状态为status
+func (manager *TransactionManagerImpl) updateXID(xid int64, status byte) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if manager.state.Status(xid) == FieldTranPrepared && status != FieldTranPrepared {
+		manager.forgetPrepared(xid)
+	}
+	if xid <= manager.state.Frozen() {
+		// 只有恢复到更早的时间点时才会修改已经冻结的事务，此时终止事务列表的长度会变化，需要重写整个文件
+		manager.state.Set(xid, status)
+		manager.rewrite()
+		return
+	}
+	b := manager.state.Set(xid, status)
+	manager.writeAt([]byte{b}, manager.state.bitmapOffset(xid))
+}
+
+// incrXIDCounter 分配一个新的事务ID，新事务为活动状态，并更新XID文件的头部信息
+func (manager *TransactionManagerImpl) incrXIDCounter() int64 {
+	// 需要新的字节时先扩展文件
+	if manager.state.Append() && !manager.readOnly {
+		if _, err := manager.file.WriteAt([]byte{0}, manager.state.bitmapOffset(manager.state.Counter())); err != nil {
+			panic(err)
+		}
+	}
+	// 将xidCounter写入文件
+	tmp := make([]byte, 8)
+	binary.BigEndian.PutUint64(tmp, uint64(manager.state.Counter()))
+	manager.writeAt(tmp, XidOffsetCounter)
+	return manager.state.Counter()
 }
 
 // Begin 开启一个事务
 func (manager *TransactionManagerImpl) Begin() int64 {
-	manager.counterLock.Lock()
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	return manager.incrXIDCounter()
+}
 
-	// 更新xidCounter
-	xid := manager.xidCounter + 1
-	// 更新事务状态
-	manager.updateXID(xid, FieldTranActive)
-	// 调用incrXIDCounter方法，将事务计数器加1，并更新XID文件的头部信息
-	manager.incrXIDCounter()
-	defer manager.counterLock.Unlock()
-	return xid
+// XidCounter 返回当前已经分配的最大事务ID
+func (manager *TransactionManagerImpl) XidCounter() int64 {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	return manager.state.Counter()
+}
+
+// FrozenXid 返回已经冻结的最大事务ID
+func (manager *TransactionManagerImpl) FrozenXid() int64 {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	return manager.state.Frozen()
+}
+
+// AdvanceXidCounter 将事务计数器推进到xid，中间新增的事务均为活动状态，用于从日志中补齐落后的xid文件
+func (manager *TransactionManagerImpl) AdvanceXidCounter(xid int64) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	for manager.state.Counter() < xid {
+		manager.incrXIDCounter()
+	}
+}
+
+// NeedFreeze 判断未冻结的事务是否足够多，需要尝试冻结
+func (manager *TransactionManagerImpl) NeedFreeze() bool {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	return manager.state.Counter()-manager.state.Frozen() >= FreezeThreshold
+}
+
+// Freeze 冻结before之前已经结束的事务，before应当不大于最早的活动快照中的事务
+// 冻结后这些事务不再占用bitmap，只有终止的事务会被单独记录，返回冻结后的最大事务ID
+func (manager *TransactionManagerImpl) Freeze(before int64) int64 {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	frozen := manager.state.Frozen()
+	if manager.state.Freeze(before) != frozen {
+		manager.rewrite()
+	}
+	return manager.state.Frozen()
+}
+
+// AbortActive 将所有活动状态的事务设置为终止，用于在没有事务运行时清理上次运行遗留的事务
+// 预备状态的事务需要等待协调者的决定，不会被终止
+func (manager *TransactionManagerImpl) AbortActive() {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	for xid := manager.state.Frozen() + 1; xid <= manager.state.Counter(); xid++ {
+		if manager.state.Status(xid) == FieldTranActive {
+			b := manager.state.Set(xid, FieldTranAborted)
+			manager.writeAt([]byte{b}, manager.state.bitmapOffset(xid))
+		}
+	}
+}
+
+// Backup 将xid文件复制为path对应的xid文件，复制期间不允许开启新的事务，保证文件头与文件长度一致
+func (manager *TransactionManagerImpl) Backup(path string) error {
+	if manager.memory {
+		return commons.NewError(commons.ErrorMessage.MemoryDatabaseError)
+	}
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	if err := utils.WriteFileSync(path+XidSuffix, manager.state.Bytes()); err != nil {
+		return err
+	}
+	if err := manager.backupPrepared(path); err != nil {
+		return err
+	}
+	// 备份中的xid文件已经提交的事务，其提交时间一定已经写入
+	if manager.commitTimeFile == nil {
+		return nil
+	}
+	return utils.CopyFile(manager.path+CommitTimeSuffix, path+CommitTimeSuffix)
 }
 
 // Commit 提交一个事务
@@ -175,16 +341,9 @@ func (manager *TransactionManagerImpl) Abort(xid int64) {
 
 // CheckXID 检查事务的状态，判断xid对应的事务是否处于status状态
 func (manager *TransactionManagerImpl) CheckXID(xid int64, status byte) bool {
-	offset := manager.getXidPosition(xid)
-	// 创建一个长度为8的字节数组
-	buf := make([]byte, LenXidFieldSize)
-	// 读取事务状态
-	_, err := manager.file.ReadAt(buf, offset)
-	if err != nil {
-		panic(err)
-	}
-
-	return buf[0] == status
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+	return manager.state.Status(xid) == status
 }
 
 // IsActive 判断事务是否处于活动状态
@@ -203,6 +362,14 @@ func (manager *TransactionManagerImpl) IsCommitted(xid int64) bool {
 	return manager.CheckXID(xid, FieldTranCommitted)
 }
 
+// IsPrepared 判断事务是否处于预备状态
+func (manager *TransactionManagerImpl) IsPrepared(xid int64) bool {
+	if xid == SuperXid {
+		return false
+	}
+	return manager.CheckXID(xid, FieldTranPrepared)
+}
+
 // IsAborted 判断事务是否处于终止状态
 func (manager *TransactionManagerImpl) IsAborted(xid int64) bool {
 	if xid == SuperXid {
@@ -217,4 +384,12 @@ func (manager *TransactionManagerImpl) Close() {
 	if err != nil {
 		panic(err)
 	}
+	if manager.commitTimeFile != nil {
+		if err = manager.commitTimeFile.Sync(); err != nil {
+			panic(err)
+		}
+		if err = manager.commitTimeFile.Close(); err != nil {
+			panic(err)
+		}
+	}
 }
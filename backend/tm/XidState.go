@@ -0,0 +1,348 @@
+package tm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/**
+ * xid文件格式：
+ * [Magic 4][XidCounter 8][FrozenXid 8][AbortedLength 8][Aborted AbortedLength][Bitmap]
+ * FrozenXid 及之前的事务已经冻结，它们都已经结束，除了 Aborted 中记录的事务以外都是提交状态
+ * Aborted 将终止的事务按照连续的区间记录，每个区间为两个uvarint：与上一个区间结尾的距离、区间的长度减1
+ * 这样间隔较近的终止事务每个只占用几个字节，恢复时一起终止的大量事务只占用一个区间
+ * Bitmap 中每个事务占2位，依次记录 FrozenXid+1 到 XidCounter 的事务状态，每个字节记录4个事务
+ *
+ * 旧版本的xid文件为 [XidCounter 8] 加上每个事务1字节，打开时会转换为新格式
+ */
+
+var (
+	// XidMagic 新格式xid文件的魔数，旧格式文件的前8字节为事务计数器，第一个字节不会是该值
+	XidMagic = []byte{0xFF, 'X', 'I', 'D'}
+
+	// XidOffsetCounter 事务计数器的偏移位置
+	XidOffsetCounter int64 = 4
+	// XidOffsetFrozen 冻结事务ID的偏移位置
+	XidOffsetFrozen = XidOffsetCounter + 8
+	// XidOffsetAbortedLength 冻结范围内终止事务区间编码长度的偏移位置
+	XidOffsetAbortedLength = XidOffsetFrozen + 8
+	// XidOffsetAborted 冻结范围内终止事务区间的偏移位置
+	XidOffsetAborted = XidOffsetAbortedLength + 8
+
+	// XidStatusBits 每个事务状态占用的位数
+	XidStatusBits = 2
+	// XidsPerByte 每个字节记录的事务数
+	XidsPerByte int64 = 8 / int64(XidStatusBits)
+)
+
+// xidRange 连续的事务ID区间 [start, end]
+type xidRange struct {
+	start int64
+	end   int64
+}
+
+// XidState xid文件在内存中的表示
+type XidState struct {
+	counter int64
+	frozen  int64
+	// aborted 冻结范围内终止的事务区间，升序，相邻的区间之间至少间隔一个事务
+	aborted []xidRange
+	// abortedRaw aborted编码后的数据，修改aborted之后需要重新编码
+	abortedRaw []byte
+	// bitmap 第i个事务状态对应 frozen+1+i
+	bitmap []byte
+}
+
+// NewXidState 创建空的事务状态
+func NewXidState() *XidState {
+	return &XidState{aborted: make([]xidRange, 0), abortedRaw: make([]byte, 0), bitmap: make([]byte, 0)}
+}
+
+// ParseXidState 解析xid文件，同时支持旧格式
+func ParseXidState(data []byte) (*XidState, error) {
+	if len(data) >= len(XidMagic) && string(data[:len(XidMagic)]) == string(XidMagic) {
+		return parseXidState(data)
+	}
+	return parseLegacyXidState(data)
+}
+
+// parseXidState 解析新格式的xid文件
+func parseXidState(data []byte) (*XidState, error) {
+	if int64(len(data)) < XidOffsetAborted {
+		return nil, fmt.Errorf("xid file is shorter than its header: %d bytes", len(data))
+	}
+	state := &XidState{
+		counter: int64(binary.BigEndian.Uint64(data[XidOffsetCounter:XidOffsetFrozen])),
+		frozen:  int64(binary.BigEndian.Uint64(data[XidOffsetFrozen:XidOffsetAbortedLength])),
+	}
+	abortedLength := int64(binary.BigEndian.Uint64(data[XidOffsetAbortedLength:XidOffsetAborted]))
+	if state.frozen < 0 || state.counter < state.frozen || abortedLength < 0 {
+		return nil, fmt.Errorf("invalid xid header: counter %d, frozen %d, aborted length %d", state.counter, state.frozen, abortedLength)
+	}
+	bitmapOffset := XidOffsetAborted + abortedLength
+	if int64(len(data)) < bitmapOffset {
+		return nil, fmt.Errorf("xid file is shorter than its aborted list: %d bytes", len(data))
+	}
+	aborted, err := decodeAborted(data[XidOffsetAborted:bitmapOffset], state.frozen)
+	if err != nil {
+		return nil, err
+	}
+	state.aborted = aborted
+	state.abortedRaw = append([]byte(nil), data[XidOffsetAborted:bitmapOffset]...)
+	// 开启事务时先扩展文件再写入计数器，崩溃后文件长度可能与计数器不一致
+	// 多出的字节属于尚未分配的事务，缺少的字节对应的事务为活动状态，都可以直接补齐
+	state.bitmap = make([]byte, bitmapLength(state.counter-state.frozen))
+	copy(state.bitmap, data[bitmapOffset:])
+	return state, nil
+}
+
+// decodeAborted 解析终止事务区间，所有区间都必须在冻结范围之内
+func decodeAborted(raw []byte, frozen int64) ([]xidRange, error) {
+	aborted := make([]xidRange, 0)
+	var end int64 = 0
+	for len(raw) > 0 {
+		gap, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return nil, errors.New("invalid frozen aborted xid range")
+		}
+		raw = raw[n:]
+		length, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return nil, errors.New("invalid frozen aborted xid range")
+		}
+		raw = raw[n:]
+		r := xidRange{start: end + int64(gap), end: end + int64(gap) + int64(length)}
+		// 第一个区间之后的区间与上一个区间之间至少间隔一个事务
+		if gap == 0 || (len(aborted) > 0 && gap < 2) || r.start <= end || r.end < r.start || r.end > frozen {
+			return nil, fmt.Errorf("invalid frozen aborted xid range [%d, %d]", r.start, r.end)
+		}
+		aborted = append(aborted, r)
+		end = r.end
+	}
+	return aborted, nil
+}
+
+// encodeAborted 修改aborted之后重新编码
+func (state *XidState) encodeAborted() {
+	raw := make([]byte, 0, len(state.aborted)*2)
+	var end int64 = 0
+	for _, r := range state.aborted {
+		raw = binary.AppendUvarint(raw, uint64(r.start-end))
+		raw = binary.AppendUvarint(raw, uint64(r.end-r.start))
+		end = r.end
+	}
+	state.abortedRaw = raw
+}
+
+// FileLength 序列化后xid文件的长度
+func (state *XidState) FileLength() int64 {
+	return XidOffsetAborted + int64(len(state.abortedRaw)) + int64(len(state.bitmap))
+}
+
+// parseLegacyXidState 解析每个事务占1字节的旧格式xid文件
+func parseLegacyXidState(data []byte) (*XidState, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("xid file is shorter than its header: %d bytes", len(data))
+	}
+	counter := int64(binary.BigEndian.Uint64(data[:8]))
+	if counter < 0 || int64(len(data)) != 8+counter {
+		return nil, fmt.Errorf("xid counter %d requires %d bytes, file has %d", counter, 8+counter, len(data))
+	}
+	state := NewXidState()
+	for i := int64(1); i <= counter; i++ {
+		status := data[8+i-1]
+		if status > FieldTranAborted {
+			return nil, fmt.Errorf("invalid status %d of xid %d", status, i)
+		}
+		state.Append()
+		state.Set(i, status)
+	}
+	return state, nil
+}
+
+// bitmapLength 记录n个事务需要的字节数
+func bitmapLength(n int64) int64 {
+	return (n + XidsPerByte - 1) / XidsPerByte
+}
+
+// Bytes 序列化为新格式的xid文件
+func (state *XidState) Bytes() []byte {
+	data := make([]byte, XidOffsetAborted, state.FileLength())
+	copy(data, XidMagic)
+	binary.BigEndian.PutUint64(data[XidOffsetCounter:], uint64(state.counter))
+	binary.BigEndian.PutUint64(data[XidOffsetFrozen:], uint64(state.frozen))
+	binary.BigEndian.PutUint64(data[XidOffsetAbortedLength:], uint64(len(state.abortedRaw)))
+	data = append(data, state.abortedRaw...)
+	return append(data, state.bitmap...)
+}
+
+// Counter 返回已经分配的最大事务ID
+func (state *XidState) Counter() int64 {
+	return state.counter
+}
+
+// Frozen 返回已经冻结的最大事务ID
+func (state *XidState) Frozen() int64 {
+	return state.frozen
+}
+
+// position 事务在bitmap中的字节下标与位移
+func (state *XidState) position(xid int64) (int64, uint) {
+	i := xid - state.frozen - 1
+	return i / XidsPerByte, uint(i%XidsPerByte) * uint(XidStatusBits)
+}
+
+// bitmapOffset 事务所在字节在文件中的偏移
+func (state *XidState) bitmapOffset(xid int64) int64 {
+	index, _ := state.position(xid)
+	return XidOffsetAborted + int64(len(state.abortedRaw)) + index
+}
+
+// Status 返回事务的状态，事务必须已经分配
+func (state *XidState) Status(xid int64) byte {
+	if xid <= 0 || xid > state.counter {
+		panic(fmt.Sprintf("xid %d out of range [1, %d]", xid, state.counter))
+	}
+	if xid <= state.frozen {
+		if state.isFrozenAborted(xid) {
+			return FieldTranAborted
+		}
+		return FieldTranCommitted
+	}
+	index, shift := state.position(xid)
+	return (state.bitmap[index] >> shift) & (1<<XidStatusBits - 1)
+}
+
+// searchAborted 返回第一个结尾不小于xid的终止事务区间的下标
+func (state *XidState) searchAborted(xid int64) int {
+	return sort.Search(len(state.aborted), func(i int) bool { return state.aborted[i].end >= xid })
+}
+
+// isFrozenAborted 判断冻结范围内的事务是否终止
+func (state *XidState) isFrozenAborted(xid int64) bool {
+	i := state.searchAborted(xid)
+	return i < len(state.aborted) && state.aborted[i].start <= xid
+}
+
+// Append 分配下一个事务ID，状态为活动，返回是否需要新的字节
+func (state *XidState) Append() bool {
+	state.counter++
+	if index, _ := state.position(state.counter); index >= int64(len(state.bitmap)) {
+		state.bitmap = append(state.bitmap, 0)
+		return true
+	}
+	return false
+}
+
+// Set 设置未冻结事务的状态，返回事务所在的字节
+// 冻结范围内的事务只能是提交或者终止，修改时会调整终止事务区间
+func (state *XidState) Set(xid int64, status byte) byte {
+	if xid <= state.frozen {
+		aborted := state.isFrozenAborted(xid)
+		switch {
+		case status == FieldTranAborted && !aborted:
+			state.addAborted(xid)
+		case status == FieldTranCommitted && aborted:
+			state.removeAborted(xid)
+		case status == FieldTranActive || status == FieldTranPrepared:
+			panic(fmt.Sprintf("frozen xid %d can not be active or prepared", xid))
+		}
+		return 0
+	}
+	index, shift := state.position(xid)
+	state.bitmap[index] = state.bitmap[index]&^((1<<XidStatusBits-1)<<shift) | status<<shift
+	return state.bitmap[index]
+}
+
+// addAborted 将不在任何区间中的xid加入终止事务区间，与相邻的区间合并
+func (state *XidState) addAborted(xid int64) {
+	i := state.searchAborted(xid)
+	mergePrev := i > 0 && state.aborted[i-1].end+1 == xid
+	mergeNext := i < len(state.aborted) && state.aborted[i].start-1 == xid
+	switch {
+	case mergePrev && mergeNext:
+		state.aborted[i-1].end = state.aborted[i].end
+		state.aborted = append(state.aborted[:i], state.aborted[i+1:]...)
+	case mergePrev:
+		state.aborted[i-1].end = xid
+	case mergeNext:
+		state.aborted[i].start = xid
+	default:
+		state.aborted = append(state.aborted, xidRange{})
+		copy(state.aborted[i+1:], state.aborted[i:])
+		state.aborted[i] = xidRange{start: xid, end: xid}
+	}
+	state.encodeAborted()
+}
+
+// removeAborted 将xid从所在的终止事务区间中移除，必要时拆分区间
+func (state *XidState) removeAborted(xid int64) {
+	i := state.searchAborted(xid)
+	r := state.aborted[i]
+	switch {
+	case r.start == r.end:
+		state.aborted = append(state.aborted[:i], state.aborted[i+1:]...)
+	case xid == r.start:
+		state.aborted[i].start++
+	case xid == r.end:
+		state.aborted[i].end--
+	default:
+		state.aborted = append(state.aborted, xidRange{})
+		copy(state.aborted[i+1:], state.aborted[i:])
+		state.aborted[i] = xidRange{start: r.start, end: xid - 1}
+		state.aborted[i+1] = xidRange{start: xid + 1, end: r.end}
+	}
+	state.encodeAborted()
+}
+
+// Freeze 冻结before之前已经结束的事务，遇到活动或者预备状态的事务时停止，返回冻结后的最大事务ID
+func (state *XidState) Freeze(before int64) int64 {
+	frozen := state.frozen
+	for frozen+1 < before && frozen+1 <= state.counter {
+		status := state.Status(frozen + 1)
+		if status == FieldTranActive || status == FieldTranPrepared {
+			break
+		}
+		if status == FieldTranAborted {
+			if n := len(state.aborted); n > 0 && state.aborted[n-1].end == frozen {
+				state.aborted[n-1].end++
+			} else {
+				state.aborted = append(state.aborted, xidRange{start: frozen + 1, end: frozen + 1})
+			}
+		}
+		frozen++
+	}
+	if frozen == state.frozen {
+		return frozen
+	}
+	state.encodeAborted()
+
+	// 重新排列剩余事务的状态
+	bitmap := make([]byte, bitmapLength(state.counter-frozen))
+	for xid := frozen + 1; xid <= state.counter; xid++ {
+		i := xid - frozen - 1
+		bitmap[i/XidsPerByte] |= state.Status(xid) << (uint(i%XidsPerByte) * uint(XidStatusBits))
+	}
+	state.frozen = frozen
+	state.bitmap = bitmap
+	return frozen
+}
+
+// Validate 检查所有未冻结事务的状态是否合法
+func (state *XidState) Validate() error {
+	for xid := state.frozen + 1; xid <= state.counter; xid++ {
+		if status := state.Status(xid); status > FieldTranPrepared {
+			return fmt.Errorf("invalid status %d of xid %d", status, xid)
+		}
+	}
+	if state.counter > state.frozen {
+		// bitmap最后一个字节中超出计数器的部分必须为0
+		index, shift := state.position(state.counter)
+		if shift+uint(XidStatusBits) < 8 && state.bitmap[index]>>(shift+uint(XidStatusBits)) != 0 {
+			return errors.New("unused bits of the xid bitmap are not zero")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"SimpleDB/backend/tm"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	manager, err := tm.CreateTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		manager.CommitAt(manager.Begin(), i*100)
+	}
+	manager.Begin()
+	manager.Close()
+
+	// 模拟写入提交时间时崩溃，末尾留下不完整的记录
+	file, err := os.OpenFile(path+tm.CommitTimeSuffix, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 0, 0})
+	file.Close()
+
+	manager, err = tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	for xid := int64(1); xid <= 3; xid++ {
+		if timestamp, ok := manager.CommitTime(xid); !ok || timestamp != xid*100 {
+			t.Fatalf("xid %d: commit time %d %v", xid, timestamp, ok)
+		}
+	}
+	if _, ok := manager.CommitTime(4); ok {
+		t.Fatal("active transaction should not have a commit time")
+	}
+	if first := manager.FirstCommittedSince(150); first != 2 {
+		t.Fatalf("first committed since 150: %d", first)
+	}
+	if first := manager.FirstCommittedSince(1000); first != 5 {
+		t.Fatalf("first committed since 1000: %d", first)
+	}
+	manager.CommitAt(4, 400)
+	if info, _ := os.Stat(path + tm.CommitTimeSuffix); info.Size() != int64(4*tm.CommitTimeRecordLength) {
+		t.Fatalf("unexpected commit time file size %d", info.Size())
+	}
+}
+
+// TestCommittedBefore 事务ID较小但是在事务n开始之后才提交的事务对n的快照不可见
+func TestCommittedBefore(t *testing.T) {
+	manager := tm.CreateMemoryTransactionManagerImpl()
+	first := manager.Begin()
+	second := manager.Begin()
+	manager.CommitAt(second, 100)
+	manager.CommitAt(first, 200)
+	if manager.CommittedBefore(first, second) {
+		t.Fatal("transaction committed after the snapshot was taken should not be visible")
+	}
+	if !manager.CommittedBefore(first, second+1) || !manager.CommittedBefore(second, second+1) {
+		t.Fatal("transactions committed before the snapshot should be visible")
+	}
+	if manager.CommittedBefore(second, second) {
+		t.Fatal("a snapshot should not see its own transaction")
+	}
+}
+
+// TestPruneCommitTimes 清理之后的事务没有提交时间，但是对之后的快照仍然可见，重新打开后不会再加载
+func TestPruneCommitTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	manager, err := tm.CreateTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := manager.Begin()
+	second := manager.Begin()
+	manager.CommitAt(second, 100)
+	manager.CommitAt(first, 200)
+	third := manager.Begin()
+	manager.CommitAt(third, 300)
+
+	// 提交时的计数器不小于horizon的记录不能清理
+	if pruned := manager.PruneCommitTimes(second, 250); pruned != 0 {
+		t.Fatalf("pruned %d records below the horizon", pruned)
+	}
+	if pruned := manager.PruneCommitTimes(third, 250); pruned != 2 {
+		t.Fatalf("expected 2 records pruned, got %d", pruned)
+	}
+	if _, ok := manager.CommitTime(first); ok {
+		t.Fatal("pruned commit time should be forgotten")
+	}
+	if !manager.CommittedBefore(first, third) || manager.CommittedBefore(third, third) {
+		t.Fatal("pruning should not change the visibility for snapshots after the horizon")
+	}
+	if since := manager.FirstCommittedSince(250); since != third {
+		t.Fatalf("first committed since 250: %d", since)
+	}
+	manager.Close()
+
+	// 剩下一条提交记录和一条记录清理时间点的记录
+	if info, _ := os.Stat(path + tm.CommitTimeSuffix); info.Size() != int64(2*tm.CommitTimeRecordLength) {
+		t.Fatalf("commit time file is not compacted: %d bytes", info.Size())
+	}
+	manager, err = tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if _, ok := manager.CommitTime(first); ok {
+		t.Fatal("pruned commit time is loaded again")
+	}
+	if timestamp, ok := manager.CommitTime(third); !ok || timestamp != 300 {
+		t.Fatalf("commit time of xid %d: %d %v", third, timestamp, ok)
+	}
+}
+
+// TestRestoreCommitTime 恢复时只补齐丢失的提交记录，清理时间点之前的记录不会重新出现
+func TestRestoreCommitTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	manager, err := tm.CreateTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := manager.Begin()
+	manager.CommitAt(first, 100)
+	second := manager.Begin()
+	manager.CommitAt(second, 200)
+	third := manager.Begin()
+	if pruned := manager.PruneCommitTimes(third, 150); pruned != 1 {
+		t.Fatalf("expected 1 record pruned, got %d", pruned)
+	}
+	manager.Close()
+
+	manager, err = tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	manager.RestoreCommitTime(first, 100)
+	if _, ok := manager.CommitTime(first); ok {
+		t.Fatal("pruned commit time should not be restored")
+	}
+	manager.RestoreCommitTime(second, 250)
+	if timestamp, _ := manager.CommitTime(second); timestamp != 200 {
+		t.Fatalf("existing commit time should be kept, got %d", timestamp)
+	}
+	manager.RestoreCommitTime(third, 300)
+	if timestamp, ok := manager.CommitTime(third); !ok || timestamp != 300 {
+		t.Fatalf("commit time of xid %d: %d %v", third, timestamp, ok)
+	}
+}
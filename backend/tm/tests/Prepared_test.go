@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"SimpleDB/backend/tm"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	manager, err := tm.CreateTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		manager.Begin()
+	}
+	if err = manager.Prepare(1, "a", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Prepare(2, "a", nil); err == nil {
+		t.Fatal("expected duplicated gid")
+	}
+	if err = manager.Prepare(2, "b", nil); err != nil {
+		t.Fatal(err)
+	}
+	manager.Close()
+
+	// 模拟写入预备记录时崩溃，末尾留下不完整的记录，对应的事务在xid文件中仍为活动状态
+	file, err := os.OpenFile(path+tm.PreparedSuffix, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 0, 0, 0, 0, 0, 0, 3, 0})
+	file.Close()
+
+	manager, err = tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	// 重启后只有活动事务被终止，预备事务保持预备状态
+	manager.AbortActive()
+	if !manager.IsPrepared(1) || !manager.IsPrepared(2) || !manager.IsAborted(3) {
+		t.Fatal("prepared transactions should survive a restart")
+	}
+	prepared := manager.Prepared()
+	if len(prepared) != 2 || prepared[0].Gid != "a" || string(prepared[0].State) != string([]byte{1, 2, 3}) || prepared[1].Gid != "b" {
+		t.Fatalf("unexpected prepared transactions %v", prepared)
+	}
+	if manager.Freeze(4) != 0 {
+		t.Fatal("prepared transactions should not be frozen")
+	}
+
+	manager.CommitAt(1, 100)
+	if xid, ok := manager.PreparedXid("a"); ok || !manager.IsCommitted(1) {
+		t.Fatalf("committed transaction is still prepared: %d", xid)
+	}
+	if xid, ok := manager.PreparedXid("b"); !ok || xid != 2 {
+		t.Fatalf("unexpected xid %d of gid b", xid)
+	}
+	manager.Abort(2)
+	if len(manager.Prepared()) != 0 {
+		t.Fatal("no transaction should be prepared")
+	}
+	if info, _ := os.Stat(path + tm.PreparedSuffix); info.Size() != 0 {
+		t.Fatalf("unexpected prepared file size %d", info.Size())
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"SimpleDB/backend/tm"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// expectStatus 检查每个事务的状态
+func expectStatus(t *testing.T, manager *tm.TransactionManagerImpl, status map[int64]byte) {
+	for xid, s := range status {
+		if !manager.CheckXID(xid, s) {
+			t.Fatalf("xid %d: expected status %d", xid, s)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	manager, err := tm.CreateTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[int64]byte)
+	for i := 0; i < 1000; i++ {
+		xid := manager.Begin()
+		switch {
+		case xid == 600:
+			status[xid] = tm.FieldTranActive
+		case xid%7 == 0:
+			manager.Abort(xid)
+			status[xid] = tm.FieldTranAborted
+		default:
+			manager.Commit(xid)
+			status[xid] = tm.FieldTranCommitted
+		}
+	}
+	expectStatus(t, manager, status)
+
+	// 冻结在第一个活动事务处停止
+	if frozen := manager.Freeze(900); frozen != 599 {
+		t.Fatalf("expected frozen xid 599, got %d", frozen)
+	}
+	expectStatus(t, manager, status)
+
+	// 恢复到更早的时间点时可以修改已经冻结的事务
+	manager.Abort(10)
+	status[10] = tm.FieldTranAborted
+	manager.Commit(14)
+	status[14] = tm.FieldTranCommitted
+	manager.Close()
+
+	manager, err = tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if manager.FrozenXid() != 599 || manager.XidCounter() != 1000 {
+		t.Fatalf("unexpected frozen %d, counter %d", manager.FrozenXid(), manager.XidCounter())
+	}
+	expectStatus(t, manager, status)
+
+	// 冻结部分只记录终止的事务，其余事务每个占2位
+	info, err := os.Stat(path + tm.XidSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1000 {
+		t.Fatalf("xid file is too large: %d bytes", info.Size())
+	}
+}
+
+func TestOpenLegacyXidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	// 旧格式：8字节计数器，每个事务1字节
+	data := make([]byte, 8, 13)
+	binary.BigEndian.PutUint64(data, 5)
+	data = append(data, tm.FieldTranCommitted, tm.FieldTranAborted, tm.FieldTranActive, tm.FieldTranCommitted, tm.FieldTranCommitted)
+	if err := os.WriteFile(path+tm.XidSuffix, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, manager, map[int64]byte{
+		1: tm.FieldTranCommitted, 2: tm.FieldTranAborted, 3: tm.FieldTranActive, 4: tm.FieldTranCommitted, 5: tm.FieldTranCommitted,
+	})
+	if xid := manager.Begin(); xid != 6 {
+		t.Fatalf("expected xid 6, got %d", xid)
+	}
+	manager.Close()
+
+	converted, err := os.ReadFile(path + tm.XidSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(converted[:len(tm.XidMagic)]) != string(tm.XidMagic) {
+		t.Fatal("xid file is not converted")
+	}
+}
+
+// TestFrozenAbortedRanges 冻结范围内终止的事务按照区间记录，连续终止的事务只占用一个区间
+func TestFrozenAbortedRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tm")
+	manager, err := tm.CreateTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[int64]byte)
+	for i := 0; i < 10000; i++ {
+		xid := manager.Begin()
+		// 模拟崩溃时一起终止的大量事务，以及零散终止的事务
+		if (xid >= 5000 && xid < 6000) || xid%3 == 0 {
+			manager.Abort(xid)
+			status[xid] = tm.FieldTranAborted
+		} else {
+			manager.Commit(xid)
+			status[xid] = tm.FieldTranCommitted
+		}
+	}
+	if frozen := manager.Freeze(10001); frozen != 10000 {
+		t.Fatalf("expected frozen xid 10000, got %d", frozen)
+	}
+	// 拆分区间之后再合并
+	manager.Commit(5500)
+	manager.Commit(5501)
+	manager.Abort(5500)
+	status[5501] = tm.FieldTranCommitted
+	manager.Commit(5000)
+	status[5000] = tm.FieldTranCommitted
+	manager.Close()
+
+	manager, err = tm.OpenTransactionManagerImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	expectStatus(t, manager, status)
+
+	// 约3000个零散的终止事务，每个8字节时超过24KB
+	info, err := os.Stat(path + tm.XidSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 8<<10 {
+		t.Fatalf("xid file is too large: %d bytes", info.Size())
+	}
+}
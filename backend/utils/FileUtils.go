@@ -1,6 +1,9 @@
 package utils
 
-import "os"
+import (
+	"io"
+	"os"
+)
 
 // FileExists 判断文件是否存在
 func FileExists(filename string) bool {
@@ -24,7 +27,7 @@ func GetFileSizeByPath(filename string) (int64, error) {
 }
 
 // GetFileSize 获取文件大小（字节数）
-func GetFileSize(file *os.File) (int64, error) {
+func GetFileSize(file File) (int64, error) {
 	// 使用 os.Stat 获取文件信息
 	fileInfo, err := file.Stat()
 	if err != nil {
@@ -34,3 +37,56 @@ func GetFileSize(file *os.File) (int64, error) {
 	// 使用 Size 方法获取文件大小
 	return fileInfo.Size(), nil
 }
+
+// CopyFile 将source复制到target并落盘，target必须不存在
+func CopyFile(source string, target string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// WriteFileSync 将data写入新建的文件target并落盘，target必须不存在
+func WriteFileSync(target string, data []byte) error {
+	dst, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err = dst.Write(data); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// SyncDir 强制刷新目录，保证目录中文件的创建和重命名已经落盘
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err = d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// File 数据库读写的文件，*os.File 和 MemoryFile 都实现了它
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+	Stat() (os.FileInfo, error)
+}
+
+// MemoryFile 只保存在内存中的文件，用于内存数据库，可以被多个协程同时读写
+type MemoryFile struct {
+	lock sync.RWMutex
+	data []byte
+}
+
+// NewMemoryFile 创建内容为data的内存文件
+func NewMemoryFile(data []byte) *MemoryFile {
+	return &MemoryFile{data: append([]byte(nil), data...)}
+}
+
+// ReadAt 与 os.File 相同，读取到文件末尾时返回 io.EOF
+func (file *MemoryFile) ReadAt(p []byte, off int64) (int, error) {
+	file.lock.RLock()
+	defer file.lock.RUnlock()
+	if off >= int64(len(file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, file.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt 写入数据，超过文件末尾时文件自动增长，中间的空洞填充0
+func (file *MemoryFile) WriteAt(p []byte, off int64) (int, error) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	if end := off + int64(len(p)); end > int64(len(file.data)) {
+		file.grow(end)
+	}
+	return copy(file.data[off:], p), nil
+}
+
+// Truncate 将文件截断或者扩展到size字节
+func (file *MemoryFile) Truncate(size int64) error {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	if size < int64(len(file.data)) {
+		file.data = file.data[:size]
+	} else {
+		file.grow(size)
+	}
+	return nil
+}
+
+func (file *MemoryFile) grow(size int64) {
+	if size <= int64(cap(file.data)) {
+		old := len(file.data)
+		file.data = file.data[:size]
+		for i := old; i < len(file.data); i++ {
+			file.data[i] = 0
+		}
+		return
+	}
+	data := make([]byte, size, size*2)
+	copy(data, file.data)
+	file.data = data
+}
+
+// Sync 内存文件不需要落盘
+func (file *MemoryFile) Sync() error {
+	return nil
+}
+
+// Close 内存文件关闭之后内容仍然保留
+func (file *MemoryFile) Close() error {
+	return nil
+}
+
+// Stat 返回文件的信息，只有 Size 有意义
+func (file *MemoryFile) Stat() (os.FileInfo, error) {
+	file.lock.RLock()
+	defer file.lock.RUnlock()
+	return memoryFileInfo(len(file.data)), nil
+}
+
+// Bytes 返回文件内容的副本
+func (file *MemoryFile) Bytes() []byte {
+	file.lock.RLock()
+	defer file.lock.RUnlock()
+	return append([]byte(nil), file.data...)
+}
+
+// memoryFileInfo 内存文件的信息，值为文件的大小
+type memoryFileInfo int64
+
+func (info memoryFileInfo) Name() string       { return "memory" }
+func (info memoryFileInfo) Size() int64        { return int64(info) }
+func (info memoryFileInfo) Mode() os.FileMode  { return 0600 }
+func (info memoryFileInfo) ModTime() time.Time { return time.Time{} }
+func (info memoryFileInfo) IsDir() bool        { return false }
+func (info memoryFileInfo) Sys() interface{}   { return nil }
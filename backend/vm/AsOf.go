@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"SimpleDB/backend/tm"
+	"SimpleDB/commons"
+	"time"
+)
+
+// AsOf 历史查询的目标，Xid和Timestamp二者只需设置其一
+type AsOf struct {
+	// Xid 查询该事务开始时的状态，在该事务开始之前已经提交的事务的修改可见
+	Xid int64
+	// Timestamp 查询该时间点的状态，Unix纳秒，在该时间及之前提交的事务的修改可见
+	Timestamp int64
+}
+
+// isCommitted 判断事务xid在查询的时间点是否已经提交
+// 没有记录提交时间的事务（升级之前提交的事务）视为很早之前就已经提交
+func (asOf *AsOf) isCommitted(transactionManager *tm.TransactionManagerImpl, xid int64) bool {
+	if !transactionManager.IsCommitted(xid) {
+		return false
+	}
+	if xid == tm.SuperXid {
+		return true
+	}
+	if asOf.Xid > 0 {
+		// 事务ID小于Xid的事务在Xid开始时可能还没有提交
+		return transactionManager.CommittedBefore(xid, asOf.Xid)
+	}
+	timestamp, ok := transactionManager.CommitTime(xid)
+	return !ok || timestamp <= asOf.Timestamp
+}
+
+// IsVisibleAsOf 判断记录e在查询的时间点是否存在，即创建版本已经提交而删除版本还没有提交
+func IsVisibleAsOf(transactionManager *tm.TransactionManagerImpl, asOf *AsOf, e *Entry) bool {
+	if !asOf.isCommitted(transactionManager, e.GetXMin()) {
+		return false
+	}
+	XMax := e.GetXMax()
+	return XMax == 0 || !asOf.isCommitted(transactionManager, XMax)
+}
+
+// SetRetention 设置历史查询能够访问的时间范围，0表示不限制
+func (versionManager *VersionManager) SetRetention(retention time.Duration) {
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	versionManager.retention = retention
+}
+
+// RetentionHorizon 返回 AS OF XID 查询能够访问的最早的事务ID，早于保留时间提交的事务都小于该值
+func (versionManager *VersionManager) RetentionHorizon() int64 {
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	if versionManager.retention == 0 {
+		return 1
+	}
+	horizon, _ := versionManager.retentionHorizon()
+	return horizon
+}
+
+// retentionHorizon 返回历史查询能够访问的最早的事务ID和最早的时间，调用者需要持有锁并且设置了保留时间
+func (versionManager *VersionManager) retentionHorizon() (int64, int64) {
+	cutoff := time.Now().Add(-versionManager.retention).UnixNano()
+	horizon := versionManager.TM.FirstCommittedSince(cutoff)
+	// 活动事务提交时一定晚于cutoff
+	for xid := range versionManager.ActiveTransaction {
+		if xid > tm.SuperXid && xid < horizon {
+			horizon = xid
+		}
+	}
+	return horizon, cutoff
+}
+
+// pruneCommitTimes 清理保留时间之外的提交记录，调用者需要持有锁
+func (versionManager *VersionManager) pruneCommitTimes() {
+	if versionManager.retention == 0 {
+		return
+	}
+	horizon, cutoff := versionManager.retentionHorizon()
+	versionManager.TM.PruneCommitTimes(horizon, cutoff)
+}
+
+// CheckAsOf 检查历史查询的目标是否在保留的范围之内
+func (versionManager *VersionManager) CheckAsOf(asOf *AsOf) error {
+	if asOf.Xid > 0 {
+		if asOf.Xid < versionManager.RetentionHorizon() {
+			return commons.NewError(commons.ErrorMessage.AsOfTooOldError)
+		}
+		return nil
+	}
+	versionManager.Lock.Lock()
+	retention := versionManager.retention
+	versionManager.Lock.Unlock()
+	if retention > 0 && asOf.Timestamp < time.Now().Add(-retention).UnixNano() {
+		return commons.NewError(commons.ErrorMessage.AsOfTooOldError)
+	}
+	return nil
+}
+
+// ReadAsOf 读取记录uid在asOf时间点的数据，记录在该时间点不存在时返回nil
+// 历史查询不考虑事务自己的修改，也不会与并发事务产生冲突
+func (versionManager *VersionManager) ReadAsOf(xid int64, uid int64, asOf *AsOf) ([]byte, error) {
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+
+	if transaction.Err != nil {
+		return nil, transaction.Err
+	}
+	entry, err := versionManager.CacheManager.Get(uid)
+	if err != nil && err.Error() == commons.ErrorMessage.NullEntryError {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Release()
+	if IsVisibleAsOf(versionManager.TM, asOf, entry) {
+		return entry.Data(), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,245 @@
+package vm
+
+import (
+	"SimpleDB/commons"
+	"sync"
+)
+
+/**
+ * ConflictTable 实现可串行化快照隔离（SSI）
+ * 可串行化事务在可重复读快照的基础上，记录事务之间的读写反依赖（rw-conflict）：
+ * 事务R读取的数据被并发事务W修改，但R看不到W的修改时，记为 R -> W
+ * 当某个事务同时存在读写反依赖的入边和出边时（T_in -> pivot -> T_out），调度可能不可串行化，需要终止其中一个事务
+ *
+ * 读写反依赖通过两种方式发现：
+ * 1. 读取时：读到的版本因为快照对当前事务不可见，或者读到的版本已经被并发事务删除
+ * 2. 写入时：写入的key落在并发事务读取过的索引范围内（谓词锁，只用于检测，不会阻塞）
+ *
+ * 已提交事务的谓词锁和冲突信息需要保留到所有与它并发的事务结束为止
+ */
+
+// predicate 可串行化事务读取过的索引范围 [left, right]
+type predicate struct {
+	// index 索引的启动UID，用于区分不同的索引
+	index int64
+	left  int64
+	right int64
+}
+
+// serializableTransaction 可串行化事务的冲突信息
+type serializableTransaction struct {
+	xid int64
+	// beginSeq 和 commitSeq 用于判断两个事务是否并发，commitSeq为0表示事务未提交
+	beginSeq  int64
+	commitSeq int64
+	// in 读取了本事务所写数据的事务，out 本事务读取了它们所写数据的事务
+	in  map[int64]bool
+	out map[int64]bool
+	// summaryIn 和 summaryOut 记录已经被清理的已提交事务留下的冲突
+	summaryIn  bool
+	summaryOut bool
+	predicates []*predicate
+	// doomed 事务已经被选为终止的对象，之后的操作和提交都会失败
+	doomed bool
+}
+
+func (t *serializableTransaction) hasIn() bool {
+	return t.summaryIn || len(t.in) > 0
+}
+
+func (t *serializableTransaction) hasOut() bool {
+	return t.summaryOut || len(t.out) > 0
+}
+
+type ConflictTable struct {
+	lock sync.Mutex
+	// seq 可串行化事务开始和提交的序号
+	seq          int64
+	transactions map[int64]*serializableTransaction
+}
+
+func NewConflictTable() *ConflictTable {
+	return &ConflictTable{
+		transactions: make(map[int64]*serializableTransaction),
+	}
+}
+
+// Begin 登记一个可串行化事务
+func (conflictTable *ConflictTable) Begin(xid int64) {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+
+	conflictTable.seq++
+	conflictTable.transactions[xid] = &serializableTransaction{
+		xid:      xid,
+		beginSeq: conflictTable.seq,
+		in:       make(map[int64]bool),
+		out:      make(map[int64]bool),
+	}
+}
+
+// IsTracked 判断事务是否为可串行化事务
+func (conflictTable *ConflictTable) IsTracked(xid int64) bool {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+	_, ok := conflictTable.transactions[xid]
+	return ok
+}
+
+// concurrent 判断两个事务的执行时间是否重叠
+func concurrent(a *serializableTransaction, b *serializableTransaction) bool {
+	return (a.commitSeq == 0 || a.commitSeq > b.beginSeq) && (b.commitSeq == 0 || b.commitSeq > a.beginSeq)
+}
+
+// AddPredicate 记录事务xid读取了索引index中 [left, right] 范围内的数据
+func (conflictTable *ConflictTable) AddPredicate(xid int64, index int64, left int64, right int64) error {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+
+	t, ok := conflictTable.transactions[xid]
+	if !ok {
+		return nil
+	}
+	if t.doomed {
+		return commons.NewError(commons.ErrorMessage.SerializationFailureError)
+	}
+	for _, p := range t.predicates {
+		if p.index == index && p.left <= left && right <= p.right {
+			return nil
+		}
+	}
+	t.predicates = append(t.predicates, &predicate{index: index, left: left, right: right})
+	return nil
+}
+
+// CheckRead 事务reader读取到了事务writer写入但reader看不到的修改
+func (conflictTable *ConflictTable) CheckRead(reader int64, writer int64) error {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+
+	r, ok := conflictTable.transactions[reader]
+	if !ok {
+		return nil
+	}
+	if r.doomed {
+		return commons.NewError(commons.ErrorMessage.SerializationFailureError)
+	}
+	w, ok := conflictTable.transactions[writer]
+	if !ok || reader == writer || !concurrent(r, w) {
+		return nil
+	}
+	return conflictTable.addConflict(r, w, r)
+}
+
+// CheckWrite 事务writer向索引index写入了key，检查并发事务的谓词锁
+func (conflictTable *ConflictTable) CheckWrite(writer int64, index int64, key int64) error {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+
+	w, ok := conflictTable.transactions[writer]
+	if !ok {
+		return nil
+	}
+	if w.doomed {
+		return commons.NewError(commons.ErrorMessage.SerializationFailureError)
+	}
+	for xid, r := range conflictTable.transactions {
+		if xid == writer || !concurrent(r, w) {
+			continue
+		}
+		for _, p := range r.predicates {
+			if p.index == index && p.left <= key && key <= p.right {
+				if err := conflictTable.addConflict(r, w, w); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// addConflict 记录 r -> w，并检查 r 或 w 是否成为危险结构的中间事务
+// current 为当前正在执行操作的事务，返回错误表示当前事务需要终止
+func (conflictTable *ConflictTable) addConflict(r *serializableTransaction, w *serializableTransaction, current *serializableTransaction) error {
+	r.out[w.xid] = true
+	w.in[r.xid] = true
+	for _, pivot := range []*serializableTransaction{w, r} {
+		if !pivot.hasIn() || !pivot.hasOut() {
+			continue
+		}
+		// 中间事务尚未提交时终止它，否则只能终止当前事务
+		victim := pivot
+		if pivot.commitSeq != 0 {
+			victim = current
+		}
+		victim.doomed = true
+		if victim == current {
+			return commons.NewError(commons.ErrorMessage.SerializationFailureError)
+		}
+	}
+	return nil
+}
+
+// Commit 提交可串行化事务，已经被选为终止对象的事务不能提交
+func (conflictTable *ConflictTable) Commit(xid int64) error {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+
+	t, ok := conflictTable.transactions[xid]
+	if !ok {
+		return nil
+	}
+	if t.doomed {
+		return commons.NewError(commons.ErrorMessage.SerializationFailureError)
+	}
+	conflictTable.seq++
+	t.commitSeq = conflictTable.seq
+	conflictTable.cleanup()
+	return nil
+}
+
+// Abort 终止可串行化事务，终止的事务不会产生任何冲突
+func (conflictTable *ConflictTable) Abort(xid int64) {
+	conflictTable.lock.Lock()
+	defer conflictTable.lock.Unlock()
+
+	if _, ok := conflictTable.transactions[xid]; !ok {
+		return
+	}
+	conflictTable.remove(xid, false)
+	conflictTable.cleanup()
+}
+
+// remove 移除事务，summary为true时在相关事务中保留冲突的记录
+func (conflictTable *ConflictTable) remove(xid int64, summary bool) {
+	t := conflictTable.transactions[xid]
+	for other := range t.in {
+		if o, ok := conflictTable.transactions[other]; ok {
+			delete(o.out, xid)
+			o.summaryOut = o.summaryOut || summary
+		}
+	}
+	for other := range t.out {
+		if o, ok := conflictTable.transactions[other]; ok {
+			delete(o.in, xid)
+			o.summaryIn = o.summaryIn || summary
+		}
+	}
+	delete(conflictTable.transactions, xid)
+}
+
+// cleanup 清理不再与任何未提交事务并发的已提交事务
+func (conflictTable *ConflictTable) cleanup() {
+	var oldest int64 = -1
+	for _, t := range conflictTable.transactions {
+		if t.commitSeq == 0 && (oldest == -1 || t.beginSeq < oldest) {
+			oldest = t.beginSeq
+		}
+	}
+	for xid, t := range conflictTable.transactions {
+		if t.commitSeq != 0 && (oldest == -1 || t.commitSeq < oldest) {
+			conflictTable.remove(xid, true)
+		}
+	}
+}
@@ -66,13 +66,18 @@ func (entry *Entry) GetXMax() int64 {
 
 // SetXMax 设置删除版本的事务编号
 func (entry *Entry) SetXMax(xid int64) {
+	entry.setXMax(xid, xid)
+}
+
+// setXMax 将删除版本设置为value，修改日志属于事务xid
+func (entry *Entry) setXMax(value int64, xid int64) {
 	// 在修改或删除之前先拷贝好旧数值
 	entry.dataItem.Before()
 	// 生成一个修改日志
 	defer entry.dataItem.After(xid)
 
 	sa := entry.dataItem.Data()
-	copy(sa[EntryOffsetXMAX:EntryOffsetData], commons.Int64ToBytes(xid))
+	copy(sa[EntryOffsetXMAX:EntryOffsetData], commons.Int64ToBytes(value))
 }
 
 func (entry *Entry) GetUid() int64 {
@@ -2,143 +2,352 @@ package vm
 
 import (
 	"SimpleDB/commons"
-	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
+// DeadlockPolicy 发生死锁时选择终止哪个事务
+type DeadlockPolicy int
+
+const (
+	// VictimRequester 终止请求资源而形成环的事务
+	VictimRequester DeadlockPolicy = iota
+	// VictimYoungest 终止环中最晚开始的事务
+	VictimYoungest
+	// VictimFewestLocks 终止环中持有资源最少的事务，相同时终止最晚开始的事务
+	VictimFewestLocks
+)
+
+// ParseDeadlockPolicy 解析死锁牺牲者策略：requester、youngest、fewest
+func ParseDeadlockPolicy(name string) (DeadlockPolicy, error) {
+	switch strings.ToLower(name) {
+	case "requester":
+		return VictimRequester, nil
+	case "youngest":
+		return VictimYoungest, nil
+	case "fewest":
+		return VictimFewestLocks, nil
+	}
+	return VictimRequester, fmt.Errorf("invalid deadlock policy %q", name)
+}
+
+// LockMode 锁的模式，共享锁之间互相兼容，排他锁与任何锁都不兼容
+type LockMode int
+
+const (
+	// LockExclusive 排他锁，删除、更新记录以及 SELECT ... FOR UPDATE 时使用
+	LockExclusive LockMode = iota
+	// LockShared 共享锁，SELECT ... FOR SHARE 时使用
+	LockShared
+)
+
+// waiter 等待资源的事务，创建时mutex处于加锁状态
+// 资源分配给它或者它被选为死锁的牺牲者时关闭done并释放mutex，Lock获得mutex即表示等待结束
+type waiter struct {
+	mutex sync.Mutex
+	done  chan struct{}
+	err   error
+}
+
+func newWaiter() *waiter {
+	w := &waiter{done: make(chan struct{})}
+	w.mutex.Lock()
+	return w
+}
+
+// wake 结束等待，err不为nil表示没有获得资源
+func (w *waiter) wake(err error) {
+	w.err = err
+	close(w.done)
+	w.mutex.Unlock()
+}
+
+// Lock 阻塞直到等待结束
+func (w *waiter) Lock() {
+	w.mutex.Lock()
+}
+
+// Unlock 释放Lock获得的mutex
+func (w *waiter) Unlock() {
+	w.mutex.Unlock()
+}
+
 // LockTable 维护了一个依赖等待图，以进行死锁检测
 type LockTable struct {
 	// 某个XID已经获得的资源的UID列表，键是事务ID，值是该事务持有的资源ID列表。
 	x2u map[int64][]int64
-	// UID被某个XID持有,键是资源ID，值是持有该资源的事务ID。
-	u2x map[int64]int64
-	// 正在等待UID的XID列表，键是资源ID，值是正在等待该资源的事务ID。
+	// UID被哪些XID持有,键是资源ID，值是持有该资源的事务ID列表，排他锁只有一个持有者。
+	u2x map[int64][]int64
+	// UID上的锁的模式
+	uMode map[int64]LockMode
+	// 正在等待UID的XID队列，键是资源ID，值是按照先后顺序等待该资源的事务ID。
 	wait map[int64][]int64
 	// 正在等待资源的XID的锁,键是事务ID，值是该事务的锁对象。
-	waitLock map[int64]sync.Locker
+	waitLock map[int64]*waiter
 	// XID正在等待的UID,键是事务ID，值是该事务正在等待的资源ID。
 	waitU map[int64]int64
-	lock  commons.ReentrantLock
+	// XID请求的锁的模式
+	waitMode map[int64]LockMode
+	// XID将共享锁升级为排他锁的UID列表，按照升级的顺序排列
+	x2upgraded map[int64][]int64
+	lock       commons.ReentrantLock
 
-	// 以下两个字段用于死锁检测
-	// xidStamp 事务ID的时间戳映射
-	xidStamp map[int64]int
-	// stamp 全局的时间戳
-	stamp int
+	// timeout 等待资源的最长时间，为0时一直等待
+	timeout time.Duration
+	// policy 死锁牺牲者的选择策略
+	policy DeadlockPolicy
 }
 
 func NewLockTable() *LockTable {
 	return &LockTable{
 		x2u:      make(map[int64][]int64),
-		u2x:      make(map[int64]int64),
+		u2x:      make(map[int64][]int64),
+		uMode:    make(map[int64]LockMode),
 		wait:     make(map[int64][]int64),
-		waitLock: make(map[int64]sync.Locker),
+		waitLock: make(map[int64]*waiter),
 		waitU:    make(map[int64]int64),
+		waitMode: make(map[int64]LockMode),
+
+		x2upgraded: make(map[int64][]int64),
 	}
 }
 
-// Add 添加一个事务ID和资源ID的映射关系，返回一个锁对象，如果发生死锁，返回错误
+// SetLockTimeout 设置等待资源的最长时间，为0时一直等待
+func (lockTable *LockTable) SetLockTimeout(timeout time.Duration) {
+	lockTable.lock.Lock()
+	defer lockTable.lock.Unlock()
+	lockTable.timeout = timeout
+}
+
+// SetDeadlockPolicy 设置死锁牺牲者的选择策略
+func (lockTable *LockTable) SetDeadlockPolicy(policy DeadlockPolicy) {
+	lockTable.lock.Lock()
+	defer lockTable.lock.Unlock()
+	lockTable.policy = policy
+}
+
+// Add 为事务xid申请资源uid的排他锁，需要等待时返回一个锁对象，如果发生死锁，返回错误
 func (lockTable *LockTable) Add(xid int64, uid int64) (sync.Locker, error) {
+	return lockTable.Acquire(xid, uid, LockExclusive)
+}
+
+// AddShared 为事务xid申请资源uid的共享锁，需要等待时返回一个锁对象，如果发生死锁，返回错误
+func (lockTable *LockTable) AddShared(xid int64, uid int64) (sync.Locker, error) {
+	return lockTable.Acquire(xid, uid, LockShared)
+}
+
+// Acquire 为事务xid申请资源uid上模式为mode的锁
+// 已经持有共享锁的事务申请排他锁时进行锁升级，只需要等待其他持有者释放
+func (lockTable *LockTable) Acquire(xid int64, uid int64, mode LockMode) (sync.Locker, error) {
 	lockTable.lock.Lock()
 	defer lockTable.lock.Unlock()
 
 	// 检查x2u是否已经拥有这个资源
-	// 如果事务xid已经持有资源uid，返回nil
-	if lockTable.isInList(xid, uid) {
-		// 如果已经拥有，直接返回nil
+	held := lockTable.isInList(xid, uid)
+	if held && (mode == LockShared || lockTable.uMode[uid] == LockExclusive) {
+		// 已经持有足够强的锁，直接返回nil
 		return nil, nil
 	}
-	// 检查UID资源是否已经被其他XID事务持有
-	if _, ok := lockTable.u2x[uid]; !ok {
-		// 如果没有被持有，将资源分配给当前事务
-		lockTable.u2x[uid] = xid
-		// 将资源添加到事务的资源列表中
-		lockTable.x2u[xid] = append(lockTable.x2u[xid], uid)
-		// 返回nil
+	holders := lockTable.u2x[uid]
+	// 资源没有被持有，或者只被当前事务以共享锁持有，或者与持有的共享锁兼容且没有事务在排队时，直接分配
+	if len(holders) == 0 || (held && len(holders) == 1) ||
+		(!held && mode == LockShared && lockTable.uMode[uid] == LockShared && len(lockTable.wait[uid]) == 0) {
+		lockTable.grant(xid, uid, mode)
 		return nil, nil
 	}
 
-	// 如果资源已经被其他事务持有，将当前事务添加到等待列表中(waitU是一个map，键是事务ID，值是资源ID，代表事务正在等待的资源)
+	// 需要等待，将当前事务添加到资源的等待队列中，锁升级排在队列最前面
 	lockTable.waitU[xid] = uid
-	// 反过来，将资源添加到等待列表中(wait是一个map，键是资源ID，值是事务ID列表，代表正在等待该资源的事务)
-	lockTable.wait[uid] = append(lockTable.wait[uid], xid)
+	lockTable.waitMode[xid] = mode
+	if held {
+		lockTable.wait[uid] = append([]int64{xid}, lockTable.wait[uid]...)
+	} else {
+		lockTable.wait[uid] = append(lockTable.wait[uid], xid)
+	}
+	lock := newWaiter()
+	lockTable.waitLock[xid] = lock
 
 	// 检查是否存在死锁
-	if lockTable.hasDeadLock() {
-		// 如果存在死锁，从等待列表中移除当前事务
-		delete(lockTable.waitU, xid)
-		// 从资源的等待列表中移除当前事务
-		lockTable.removeFromList(lockTable.wait, uid, xid)
-		// 返回错误
-		return nil, errors.New(commons.ErrorMessage.DeadLockError)
+	if cycle := lockTable.findCycle(xid); cycle != nil {
+		victim := lockTable.selectVictim(cycle, xid)
+		commons.Logger.Warnf("Deadlock detected: %s, victim: %d", lockTable.formatCycle(cycle), victim)
+		if victim == xid {
+			// 如果存在死锁，从等待队列中移除当前事务，并返回错误
+			lockTable.cancelWait(xid, nil)
+			return nil, commons.NewError(commons.ErrorMessage.DeadLockError)
+		}
+		// 环中的事务都在等待资源，唤醒牺牲者并让它放弃等待即可打破环
+		lockTable.cancelWait(victim, commons.NewError(commons.ErrorMessage.DeadLockError))
 	}
-
-	// 如果不存在死锁，为当前事务创建一个新的锁，并锁定它
-	lock := &commons.ReentrantLock{}
-	lock.Lock()
-	lockTable.waitLock[xid] = lock
 	return lock, nil
 }
 
+// grant 将资源uid上模式为mode的锁分配给事务xid
+func (lockTable *LockTable) grant(xid int64, uid int64, mode LockMode) {
+	if lockTable.isInList(xid, uid) {
+		// 锁升级
+		lockTable.uMode[uid] = mode
+		lockTable.x2upgraded[xid] = append(lockTable.x2upgraded[xid], uid)
+		return
+	}
+	if len(lockTable.u2x[uid]) == 0 {
+		lockTable.uMode[uid] = mode
+	}
+	lockTable.u2x[uid] = append(lockTable.u2x[uid], xid)
+	// 将资源添加到事务的资源列表中
+	lockTable.x2u[xid] = append(lockTable.x2u[xid], uid)
+}
+
+// Wait 等待Add返回的锁，超过等待时间或者被选为死锁的牺牲者时返回错误，此时事务不再等待该资源
+func (lockTable *LockTable) Wait(xid int64, l sync.Locker) error {
+	w := l.(*waiter)
+	lockTable.lock.Lock()
+	timeout := lockTable.timeout
+	lockTable.lock.Unlock()
+
+	if timeout <= 0 {
+		<-w.done
+		return w.err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.done:
+		return w.err
+	case <-timer.C:
+	}
+
+	lockTable.lock.Lock()
+	defer lockTable.lock.Unlock()
+	// 超时的同时资源可能刚好分配给了当前事务
+	select {
+	case <-w.done:
+		return w.err
+	default:
+	}
+	lockTable.cancelWait(xid, commons.NewError(commons.ErrorMessage.LockTimeoutError))
+	return w.err
+}
+
+// cancelWait 让事务xid放弃等待，err不为nil时唤醒它
+// 排在它后面的事务可能因此可以获得资源
+func (lockTable *LockTable) cancelWait(xid int64, err error) {
+	uid, ok := lockTable.waitU[xid]
+	if !ok {
+		return
+	}
+	delete(lockTable.waitU, xid)
+	delete(lockTable.waitMode, xid)
+	lockTable.removeFromList(lockTable.wait, uid, xid)
+	if w, ok := lockTable.waitLock[xid]; ok {
+		delete(lockTable.waitLock, xid)
+		if err != nil {
+			w.wake(err)
+		}
+	}
+	lockTable.selectNewXID(uid)
+}
+
 // Remove 当一个事务commit或者abort时，就会释放掉它自己持有的锁，并将自身从等待图中删除
 func (lockTable *LockTable) Remove(xid int64) {
 	lockTable.lock.Lock()
 	defer lockTable.lock.Unlock()
 
+	// 如果事务正在等待资源，从等待队列中移除
+	lockTable.cancelWait(xid, nil)
 	// 从x2u映射中获取当前事务ID已经获得的资源的UID列表
-	uids, ok := lockTable.x2u[xid]
-	if ok {
-		for len(uids) > 0 {
-			// 获取并移除列表中的第一个资源ID
-			uid := uids[0]
-			uids = uids[1:]
-			// 从等待队列中选择一个新的事务ID来占用这个资源
-			lockTable.selectNewXID(uid)
-		}
-	}
-	// 从waitU映射中移除当前事务ID
-	delete(lockTable.waitU, xid)
+	uids := lockTable.x2u[xid]
 	// 从x2u映射中移除当前事务ID
 	delete(lockTable.x2u, xid)
-	// 从waitLock映射中移除当前事务ID
-	delete(lockTable.waitLock, xid)
+	delete(lockTable.x2upgraded, xid)
+	for _, uid := range uids {
+		// 从资源的持有者中移除当前事务
+		lockTable.removeFromList(lockTable.u2x, uid, xid)
+		if len(lockTable.u2x[uid]) == 0 {
+			delete(lockTable.uMode, uid)
+		}
+		// 从等待队列中选择新的事务来占用这个资源
+		lockTable.selectNewXID(uid)
+	}
 }
 
-// 从等待队列中选择一个xid来占用uid
-func (lockTable *LockTable) selectNewXID(uid int64) {
-	// 从u2x映射中移除当前资源ID
-	delete(lockTable.u2x, uid)
-	// 从等待队列中获取当前资源ID的等待列表
-	xids, ok := lockTable.wait[uid]
-	// 如果等待队列为空，立即返回
-	if !ok {
+// Locks 返回事务xid持有的锁，键是资源ID，值是锁的模式
+func (lockTable *LockTable) Locks(xid int64) map[int64]LockMode {
+	lockTable.lock.Lock()
+	defer lockTable.lock.Unlock()
+
+	locks := make(map[int64]LockMode)
+	for _, uid := range lockTable.x2u[xid] {
+		locks[uid] = lockTable.uMode[uid]
+	}
+	return locks
+}
+
+// LockMark 事务在某一时刻持有的锁的位置，用于回滚到保存点时释放之后获得的锁
+type LockMark struct {
+	held     int
+	upgraded int
+}
+
+// Mark 记录事务xid当前持有的锁的位置
+func (lockTable *LockTable) Mark(xid int64) LockMark {
+	lockTable.lock.Lock()
+	defer lockTable.lock.Unlock()
+	return LockMark{held: len(lockTable.x2u[xid]), upgraded: len(lockTable.x2upgraded[xid])}
+}
+
+// ReleaseSince 释放事务xid在mark之后获得的锁，mark之后升级的锁恢复为共享锁
+func (lockTable *LockTable) ReleaseSince(xid int64, mark LockMark) {
+	lockTable.lock.Lock()
+	defer lockTable.lock.Unlock()
+
+	upgraded := lockTable.x2upgraded[xid]
+	for i := len(upgraded) - 1; i >= mark.upgraded; i-- {
+		lockTable.uMode[upgraded[i]] = LockShared
+		lockTable.selectNewXID(upgraded[i])
+	}
+	if len(upgraded) > mark.upgraded {
+		lockTable.x2upgraded[xid] = upgraded[:mark.upgraded]
+	}
+
+	uids := lockTable.x2u[xid]
+	if len(uids) <= mark.held {
 		return
 	}
-	// 断言等待队列不为空
-	if len(xids) == 0 {
-		panic("xids 理论不该为0！")
-	}
-
-	// 遍历等待队列
-	for len(xids) > 0 {
-		// 获取并移除队列中的第一个事务ID
-		xid := xids[0]
-		xids = xids[1:]
-		// 检查事务ID是否在waitLock映射中
-		lock, ok := lockTable.waitLock[xid]
-		// 如果在waitLock映射中，表示这个事务ID已经被锁定
-		if !ok {
-			continue
-		} else {
-			// 将事务ID和资源ID添加到u2x映射中
-			lockTable.u2x[uid] = xid
-			// 从waitLock映射中移除这个事务ID
+	lockTable.x2u[xid] = uids[:mark.held]
+	for _, uid := range uids[mark.held:] {
+		lockTable.removeFromList(lockTable.u2x, uid, xid)
+		if len(lockTable.u2x[uid]) == 0 {
+			delete(lockTable.uMode, uid)
+		}
+		lockTable.selectNewXID(uid)
+	}
+}
+
+// 按照等待队列的顺序，将uid分配给与当前持有者兼容的事务
+func (lockTable *LockTable) selectNewXID(uid int64) {
+	for len(lockTable.wait[uid]) > 0 {
+		// 获取队列中的第一个事务ID
+		xid := lockTable.wait[uid][0]
+		mode := lockTable.waitMode[xid]
+		holders := lockTable.u2x[uid]
+		held := lockTable.isInList(xid, uid)
+		if !(len(holders) == 0 || (held && len(holders) == 1) ||
+			(!held && mode == LockShared && lockTable.uMode[uid] == LockShared)) {
+			// 与当前的持有者不兼容，后面的事务也需要继续等待
+			return
+		}
+		lockTable.grant(xid, uid, mode)
+		// 从等待队列中移除这个事务
+		lockTable.removeFromList(lockTable.wait, uid, xid)
+		delete(lockTable.waitU, xid)
+		delete(lockTable.waitMode, xid)
+		// 唤醒这个事务
+		if lock, ok := lockTable.waitLock[xid]; ok {
 			delete(lockTable.waitLock, xid)
-			// 从waitU映射中移除这个事务ID
-			delete(lockTable.waitU, xid)
-			// 解锁这个事务ID的锁
-			lock.Unlock()
-			break
+			lock.wake(nil)
 		}
 	}
 }
@@ -176,65 +385,81 @@ func (lockTable *LockTable) removeFromList(listMap map[int64][]int64, uid0 int64
 	}
 }
 
-// hasDeadLock 检查是否存在死锁
-func (lockTable *LockTable) hasDeadLock() bool {
-	lockTable.lock.Lock()
-	defer lockTable.lock.Unlock()
-
-	// 创建一个新的xidStamp哈希映射
-	lockTable.xidStamp = make(map[int64]int)
-	// 将stamp设置为1
-	lockTable.stamp = 1
-	// 遍历所有已经获得资源的事务ID
-	for xid, _ := range lockTable.x2u {
-		// 获取xidStamp中对应事务ID的记录
-		s, ok := lockTable.xidStamp[xid]
-		// 如果记录存在，并且值大于0
-		if ok && s > 0 {
-			// 跳过这个事务ID，继续下一个
-			continue
+// blockers 返回事务xid正在等待的事务：资源的其他持有者，以及排在它前面的事务
+func (lockTable *LockTable) blockers(xid int64) []int64 {
+	uid, ok := lockTable.waitU[xid]
+	if !ok {
+		return nil
+	}
+	result := make([]int64, 0)
+	for _, holder := range lockTable.u2x[uid] {
+		if holder != xid {
+			result = append(result, holder)
 		}
-		// 将stamp加1
-		lockTable.stamp++
-		// 调用dfs方法进行深度优先搜索
-		if lockTable.dfs(xid) {
-			// 如果dfs方法返回true，表示存在死锁，那么hasDeadLock方法也返回true
-			return true
+	}
+	for _, waiting := range lockTable.wait[uid] {
+		if waiting == xid {
+			break
 		}
-
+		result = append(result, waiting)
 	}
-	// 如果所有的事务ID都被检查过，并且没有发现死锁，那么hasDeadLock方法返回false
-	return false
+	return result
 }
 
-// dfs 深度优先搜索，检查是否存在死锁
-func (lockTable *LockTable) dfs(xid int64) bool {
-	// 从xidStamp映射中获取当前事务ID的时间戳
-	stamp, ok := lockTable.xidStamp[xid]
-	// 如果时间戳存在并且等于全局时间戳，说明发生了死锁（这意味着是在dfs递归的过程中又检查到了这个xid）
-	if ok && stamp == lockTable.stamp {
-		// 存在死锁，返回true
-		return true
-	}
-	// 如果时间戳存在并且小于全局时间戳
-	if ok && stamp < lockTable.stamp {
-		// 这个事务ID已经被检查过，并且没有发现死锁，返回false
+// findCycle 检查事务xid开始等待后是否形成了环，返回环中的事务
+// 加入新的等待之前等待图中没有环，因此只需要从xid出发深度优先搜索是否能回到xid
+func (lockTable *LockTable) findCycle(xid int64) []int64 {
+	visited := make(map[int64]bool)
+	path := []int64{xid}
+	var dfs func(current int64) bool
+	dfs = func(current int64) bool {
+		for _, next := range lockTable.blockers(current) {
+			if next == xid {
+				return true
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			path = append(path, next)
+			if dfs(next) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
 		return false
 	}
+	if dfs(xid) {
+		return path
+	}
+	return nil
+}
 
-	// 如果时间戳不存在，将当前事务ID的时间戳设置为全局时间戳
-	lockTable.xidStamp[xid] = lockTable.stamp
-
-	// 从waitU映射中获取当前事务ID正在等待的资源ID
-	uid, ok := lockTable.waitU[xid]
-	if !ok {
-		// 如果资源ID不存在，表示当前事务ID不在等待任何资源，返回false
-		return false
+// selectVictim 根据策略从环中选择终止的事务
+func (lockTable *LockTable) selectVictim(cycle []int64, requester int64) int64 {
+	victim := requester
+	for _, xid := range cycle {
+		switch lockTable.policy {
+		case VictimYoungest:
+			if xid > victim {
+				victim = xid
+			}
+		case VictimFewestLocks:
+			held, victimHeld := len(lockTable.x2u[xid]), len(lockTable.x2u[victim])
+			if held < victimHeld || (held == victimHeld && xid > victim) {
+				victim = xid
+			}
+		}
 	}
-	// 从u2x映射中获取当前资源ID被哪个事务ID持有，这里应该是一定有的，因为在Add方法中，如果资源ID存在，一定会被分配给一个事务ID
-	holdXid, ok := lockTable.u2x[uid]
-	if !ok {
-		panic("uid should be hold by some xid")
+	return victim
+}
+
+// formatCycle 输出环中每个事务等待的资源，例如 1 -(uid 5)-> 2 -(uid 7)-> 1
+func (lockTable *LockTable) formatCycle(cycle []int64) string {
+	var builder strings.Builder
+	for _, xid := range cycle {
+		builder.WriteString(fmt.Sprintf("%d -(uid %d)-> ", xid, lockTable.waitU[xid]))
 	}
-	return lockTable.dfs(holdXid)
+	builder.WriteString(fmt.Sprintf("%d", cycle[0]))
+	return builder.String()
 }
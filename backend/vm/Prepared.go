@@ -0,0 +1,137 @@
+package vm
+
+import (
+	"SimpleDB/backend/tm"
+	"SimpleDB/commons"
+	"encoding/binary"
+)
+
+/**
+ * 两阶段提交
+ * PREPARE TRANSACTION 之后事务与连接分离，但仍然留在活动事务中：
+ * 1. 其他事务的快照中仍然包含它，提交之前它的修改对其他事务不可见
+ * 2. 它持有的行锁不会释放，持有的锁随预备记录一起写入预备事务文件，重启后重新获得这些锁
+ * 可串行化事务在预备时完成读写冲突的检查，之后不会再因为冲突而终止
+ */
+
+// preparedLockLength 预备记录中每个锁的长度：[UID 8][Mode 1]
+const preparedLockLength = 9
+
+// encodeLocks 将持有的锁编码为预备记录中保存的状态
+func encodeLocks(locks map[int64]LockMode) []byte {
+	data := make([]byte, 0, len(locks)*preparedLockLength)
+	for uid, mode := range locks {
+		lock := make([]byte, preparedLockLength)
+		binary.BigEndian.PutUint64(lock, uint64(uid))
+		lock[8] = byte(mode)
+		data = append(data, lock...)
+	}
+	return data
+}
+
+// decodeLocks 解析预备记录中保存的锁
+func decodeLocks(data []byte) map[int64]LockMode {
+	locks := make(map[int64]LockMode)
+	for len(data) >= preparedLockLength {
+		locks[int64(binary.BigEndian.Uint64(data[:8]))] = LockMode(data[8])
+		data = data[preparedLockLength:]
+	}
+	return locks
+}
+
+// Prepare 预备事务xid，预备之后事务的修改在重启后仍然保留，并且继续持有行锁，直到 CommitPrepared 或者 RollbackPrepared
+func (versionManager *VersionManager) Prepare(xid int64, gid string) error {
+	// 没有分配事务ID的只读事务没有可以保存的状态
+	if isVirtualXid(xid) {
+		return commons.NewError(commons.ErrorMessage.CannotPrepareError)
+	}
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+
+	if transaction.Err != nil {
+		return transaction.Err
+	}
+	// 在改变事务的状态之前检查全局事务ID，ID不合法时事务可以继续执行
+	if err := tm.ValidateGid(gid); err != nil {
+		return err
+	}
+	if _, ok := versionManager.TM.PreparedXid(gid); ok {
+		return commons.NewError(commons.ErrorMessage.DuplicatedGidError)
+	}
+	// 预备相当于可串行化事务的提交点
+	if err := versionManager.serializationCheck(xid, versionManager.CT.Commit(xid)); err != nil {
+		return err
+	}
+
+	// 预备之前事务的所有日志必须已经落盘，恢复时才能重做它的修改
+	// 此时已经通过了可串行化事务的提交点，写入预备状态失败时只能终止事务
+	versionManager.DM.SyncLog()
+	if err := versionManager.TM.Prepare(xid, gid, encodeLocks(versionManager.LT.Locks(xid))); err != nil {
+		return versionManager.Fail(xid, err)
+	}
+	versionManager.Lock.Lock()
+	transaction.Prepared = true
+	transaction.savepoints = nil
+	transaction.undo = nil
+	versionManager.Lock.Unlock()
+	return nil
+}
+
+// takePrepared 从活动事务中移除全局事务ID对应的预备事务，并发结束同一个预备事务时只有一个能够成功
+func (versionManager *VersionManager) takePrepared(gid string) (int64, error) {
+	xid, ok := versionManager.TM.PreparedXid(gid)
+	if !ok {
+		return 0, commons.NewError(commons.ErrorMessage.PreparedTransactionNotFoundError)
+	}
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	transaction, ok := versionManager.ActiveTransaction[xid]
+	if !ok || !transaction.Prepared {
+		return 0, commons.NewError(commons.ErrorMessage.PreparedTransactionNotFoundError)
+	}
+	delete(versionManager.ActiveTransaction, xid)
+	return xid, nil
+}
+
+// CommitPrepared 提交全局事务ID为gid的预备事务
+func (versionManager *VersionManager) CommitPrepared(gid string) error {
+	xid, err := versionManager.takePrepared(gid)
+	if err != nil {
+		return err
+	}
+	timestamp := versionManager.DM.LogCommit(xid)
+	versionManager.TM.CommitAt(xid, timestamp)
+	versionManager.LT.Remove(xid)
+	versionManager.freeze()
+	versionManager.checkpoint()
+	return nil
+}
+
+// RollbackPrepared 终止全局事务ID为gid的预备事务
+func (versionManager *VersionManager) RollbackPrepared(gid string) error {
+	xid, err := versionManager.takePrepared(gid)
+	if err != nil {
+		return err
+	}
+	versionManager.LT.Remove(xid)
+	versionManager.TM.Abort(xid)
+	versionManager.CT.Abort(xid)
+	versionManager.freeze()
+	return nil
+}
+
+// restorePrepared 重启后恢复上次运行遗留的预备事务，并重新获得它们持有的锁
+// 此时还没有其他事务运行，获得锁时不需要等待
+func (versionManager *VersionManager) restorePrepared() {
+	for _, prepared := range versionManager.TM.Prepared() {
+		transaction := NewTransaction(prepared.Xid, 0, nil)
+		transaction.Prepared = true
+		versionManager.ActiveTransaction[prepared.Xid] = transaction
+		for uid, mode := range decodeLocks(prepared.State) {
+			if _, err := versionManager.LT.Acquire(prepared.Xid, uid, mode); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
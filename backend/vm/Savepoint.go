@@ -0,0 +1,186 @@
+package vm
+
+import (
+	"SimpleDB/commons"
+)
+
+/**
+ * 保存点
+ * 设置保存点之后，事务插入、删除的记录以及插入的索引项都会记录在撤销日志中，
+ * 回滚到保存点时按照相反的顺序撤销：
+ * 1. 插入的记录将XMAX设置为当前事务，相当于被当前事务删除
+ * 2. 删除的记录将XMAX恢复为0
+ * 3. 插入的索引项从B+树中删除，由上层完成
+ * 同时释放保存点之后获得的锁，以及在保存点之后升级的锁
+ */
+
+const (
+	undoInsert = iota
+	undoDelete
+	undoIndex
+)
+
+// undoRecord 撤销日志中的一项
+type undoRecord struct {
+	kind int
+	uid  int64
+	// index 和 key 只用于索引项
+	index int64
+	key   int64
+}
+
+// savepoint 保存点，记录设置保存点时撤销日志和锁的位置
+type savepoint struct {
+	name  string
+	undo  int
+	locks LockMark
+}
+
+// IndexChange 回滚到保存点时需要从索引中删除的键值对
+type IndexChange struct {
+	// Index 索引的启动UID
+	Index int64
+	Key   int64
+	Uid   int64
+}
+
+// logUndo 只有设置了保存点的事务才需要记录撤销日志
+func (t *Transaction) logUndo(record *undoRecord) {
+	if len(t.savepoints) > 0 {
+		t.undo = append(t.undo, record)
+	}
+}
+
+// findSavepoint 从后向前查找名称为name的保存点
+func (t *Transaction) findSavepoint(name string) int {
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// transaction 获取可以继续执行的事务
+func (versionManager *VersionManager) transaction(xid int64) (*Transaction, error) {
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+
+	if transaction.Err != nil {
+		return nil, transaction.Err
+	}
+	return transaction, nil
+}
+
+// IsAlive 判断事务是否可以继续执行，出现死锁、并发更新等错误的事务已经被自动终止
+func (versionManager *VersionManager) IsAlive(xid int64) bool {
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	transaction, ok := versionManager.ActiveTransaction[xid]
+	return ok && transaction.Err == nil
+}
+
+// LogInsert 记录事务插入的记录，Insert也用于写入表和字段的元数据，因此由上层在插入记录后调用
+func (versionManager *VersionManager) LogInsert(xid int64, uid int64) {
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+	transaction.logUndo(&undoRecord{kind: undoInsert, uid: uid})
+}
+
+// LogIndex 记录事务向索引index中插入的键值对
+func (versionManager *VersionManager) LogIndex(xid int64, index int64, key int64, uid int64) {
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+	transaction.logUndo(&undoRecord{kind: undoIndex, uid: uid, index: index, key: key})
+}
+
+// Savepoint 设置保存点，同名的保存点可以重复设置，使用时以最近的为准
+func (versionManager *VersionManager) Savepoint(xid int64, name string) error {
+	transaction, err := versionManager.transaction(xid)
+	if err != nil {
+		return err
+	}
+	transaction.savepoints = append(transaction.savepoints, &savepoint{
+		name:  name,
+		undo:  len(transaction.undo),
+		locks: versionManager.LT.Mark(xid),
+	})
+	return nil
+}
+
+// ReleaseSavepoint 删除保存点以及之后设置的保存点，保留保存点之后的修改
+func (versionManager *VersionManager) ReleaseSavepoint(xid int64, name string) error {
+	transaction, err := versionManager.transaction(xid)
+	if err != nil {
+		return err
+	}
+	i := transaction.findSavepoint(name)
+	if i == -1 {
+		return commons.NewError(commons.ErrorMessage.SavepointNotFoundError)
+	}
+	transaction.savepoints = transaction.savepoints[:i]
+	// 没有保存点时不再需要撤销日志
+	if len(transaction.savepoints) == 0 {
+		transaction.undo = nil
+	}
+	return nil
+}
+
+// SavepointCount 返回事务当前保存点的数量
+func (versionManager *VersionManager) SavepointCount(xid int64) int {
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	transaction, ok := versionManager.ActiveTransaction[xid]
+	if !ok {
+		return 0
+	}
+	return len(transaction.savepoints)
+}
+
+// RollbackToSavepoint 撤销保存点之后的修改并释放之后获得的锁，保存点本身保留
+// 返回需要从索引中删除的键值对
+func (versionManager *VersionManager) RollbackToSavepoint(xid int64, name string) ([]*IndexChange, error) {
+	transaction, err := versionManager.transaction(xid)
+	if err != nil {
+		return nil, err
+	}
+	i := transaction.findSavepoint(name)
+	if i == -1 {
+		return nil, commons.NewError(commons.ErrorMessage.SavepointNotFoundError)
+	}
+	sp := transaction.savepoints[i]
+	transaction.savepoints = transaction.savepoints[:i+1]
+
+	changes := make([]*IndexChange, 0)
+	for j := len(transaction.undo) - 1; j >= sp.undo; j-- {
+		record := transaction.undo[j]
+		switch record.kind {
+		case undoIndex:
+			changes = append(changes, &IndexChange{Index: record.index, Key: record.key, Uid: record.uid})
+		case undoInsert:
+			err = versionManager.setXMax(record.uid, xid, xid)
+		case undoDelete:
+			err = versionManager.setXMax(record.uid, 0, xid)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	transaction.undo = transaction.undo[:sp.undo]
+	versionManager.LT.ReleaseSince(xid, sp.locks)
+	return changes, nil
+}
+
+// setXMax 将记录uid的XMAX设置为value，日志属于事务xid
+func (versionManager *VersionManager) setXMax(uid int64, value int64, xid int64) error {
+	entry, err := versionManager.CacheManager.Get(uid)
+	if err != nil {
+		return err
+	}
+	defer entry.Release()
+	entry.setXMax(value, xid)
+	return nil
+}
@@ -2,6 +2,9 @@ package vm
 
 import "SimpleDB/backend/tm"
 
+// LevelSerializable 可串行化隔离级别，0为读已提交，1为可重复读
+const LevelSerializable int32 = 2
+
 // Transaction 对一个事务的抽象
 type Transaction struct {
 	Xid int64
@@ -12,6 +15,15 @@ type Transaction struct {
 	Err      error
 	// 标志事务是否自动中止
 	AutoAborted bool
+	// ReadOnly 只读事务，没有分配事务ID时Xid为开始时下一个将要分配的事务ID，只用于判断可见性
+	ReadOnly bool
+	// Prepared 事务已经预备，只能通过 COMMIT PREPARED 或者 ROLLBACK PREPARED 结束
+	Prepared bool
+
+	// savepoints 按照设置顺序排列的保存点
+	savepoints []*savepoint
+	// undo 设置保存点之后的撤销日志
+	undo []*undoRecord
 }
 
 // NewTransaction 创建一个新的事务
@@ -28,6 +40,10 @@ func NewTransaction(xid int64, level int32, active map[int64]*Transaction) *Tran
 		snapShot = make(map[int64]bool)
 		// 将活跃事务的ID添加到快照中
 		for k, _ := range active {
+			// 没有分配事务ID的只读事务不会写入任何数据
+			if isVirtualXid(k) {
+				continue
+			}
 			snapShot[k] = true
 		}
 		transaction.SnapShot = snapShot
@@ -35,6 +51,16 @@ func NewTransaction(xid int64, level int32, active map[int64]*Transaction) *Tran
 	return transaction
 }
 
+// isVirtualXid 判断xid是否为没有分配事务ID的只读事务的编号，这些编号都是负数
+func isVirtualXid(xid int64) bool {
+	return xid < tm.SuperXid
+}
+
+// owns 判断xid是否为当前事务，只读事务的Xid可能与之后开始的事务相同，不属于任何版本
+func (t *Transaction) owns(xid int64) bool {
+	return !t.ReadOnly && xid == t.Xid
+}
+
 func (t *Transaction) IsInSnapShot(xid int64) bool {
 	if xid == tm.SuperXid {
 		return false
@@ -5,8 +5,8 @@ import (
 	"SimpleDB/backend/dm"
 	"SimpleDB/backend/tm"
 	"SimpleDB/commons"
-	"errors"
 	"sync"
+	"time"
 )
 
 type VersionManager struct {
@@ -16,6 +16,12 @@ type VersionManager struct {
 
 	Lock commons.ReentrantLock
 	LT   *LockTable
+	// CT 可串行化事务之间的读写冲突
+	CT *ConflictTable
+	// virtualXid 最近一个没有分配事务ID的只读事务的编号，从-1开始递减
+	virtualXid int64
+	// retention 历史查询能够访问的时间范围，0表示不限制
+	retention time.Duration
 
 	CacheManager *common.AbstractCache[*Entry]
 }
@@ -36,6 +42,10 @@ func (versionManager *VersionManager) Read(xid int64, uid int64) ([]byte, error)
 
 	var entry *Entry = nil
 	entry, err := versionManager.CacheManager.Get(uid)
+	// 数据项在恢复时被撤销，但索引中仍然指向它，视为记录不存在
+	if err != nil && err.Error() == commons.ErrorMessage.NullEntryError {
+		return nil, nil
+	}
 	if err != nil {
 		if entry != nil {
 			entry.Release()
@@ -49,13 +59,78 @@ func (versionManager *VersionManager) Read(xid int64, uid int64) ([]byte, error)
 	// 释放数据项
 	defer entry.Release()
 	// 如果数据项对当前事务可见，那么返回数据项的数据
-	if IsVisible(versionManager.TM, transaction, entry) {
+	visible := IsVisible(versionManager.TM, transaction, entry)
+	if transaction.Level == LevelSerializable {
+		if err = versionManager.checkReadConflict(transaction, entry, visible); err != nil {
+			return nil, err
+		}
+	}
+	if visible {
 		return entry.Data(), nil
 	} else {
 		return nil, nil
 	}
 }
 
+// checkReadConflict 可串行化事务读取时，检查读到的版本是否被并发事务修改过
+func (versionManager *VersionManager) checkReadConflict(transaction *Transaction, entry *Entry, visible bool) error {
+	xid := transaction.Xid
+	var writer int64 = tm.SuperXid
+	if visible {
+		// 可见的版本已经被并发事务删除，只是当前事务看不到删除
+		XMax := entry.GetXMax()
+		if XMax != 0 && XMax != xid && !versionManager.TM.IsAborted(XMax) {
+			writer = XMax
+		}
+	} else {
+		// 版本由并发事务创建，因此当前事务看不到
+		XMin := entry.GetXMin()
+		if XMin != xid && XMin != tm.SuperXid && !versionManager.TM.IsAborted(XMin) &&
+			(versionManager.TM.IsActive(XMin) || XMin > xid || transaction.IsInSnapShot(XMin)) {
+			writer = XMin
+		}
+	}
+	if writer == tm.SuperXid {
+		return nil
+	}
+	return versionManager.serializationCheck(xid, versionManager.CT.CheckRead(xid, writer))
+}
+
+// PredicateLock 可串行化事务读取了索引index中 [left, right] 范围内的数据，其他事务之后写入该范围时会产生读写冲突
+func (versionManager *VersionManager) PredicateLock(xid int64, index int64, left int64, right int64) error {
+	return versionManager.serializationCheck(xid, versionManager.CT.AddPredicate(xid, index, left, right))
+}
+
+// CheckWrite 可串行化事务向索引index写入key之前，检查是否落在并发事务读取过的范围内
+func (versionManager *VersionManager) CheckWrite(xid int64, index int64, key int64) error {
+	return versionManager.serializationCheck(xid, versionManager.CT.CheckWrite(xid, index, key))
+}
+
+// IsSerializable 判断事务是否为可串行化事务
+func (versionManager *VersionManager) IsSerializable(xid int64) bool {
+	return versionManager.CT.IsTracked(xid)
+}
+
+// serializationCheck 出现可串行化冲突时自动中止事务
+func (versionManager *VersionManager) serializationCheck(xid int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	return versionManager.Fail(xid, err)
+}
+
+// Fail 自动中止事务，之后事务中的操作都返回err，直到客户端提交或者终止事务
+func (versionManager *VersionManager) Fail(xid int64, err error) error {
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+
+	transaction.Err = err
+	versionManager.internAbort(xid, true)
+	transaction.AutoAborted = true
+	return err
+}
+
 // Insert 将数据包裹成Entry，然后交给DM插入即可
 func (versionManager *VersionManager) Insert(xid int64, data []byte) (int64, error) {
 	versionManager.Lock.Lock()
@@ -87,6 +162,9 @@ func (versionManager *VersionManager) Delete(xid int64, uid int64) (bool, error)
 
 	var entry *Entry = nil
 	entry, err := versionManager.CacheManager.Get(uid)
+	if err != nil && err.Error() == commons.ErrorMessage.NullEntryError {
+		return false, nil
+	}
 	if err != nil {
 		if entry != nil {
 			entry.Release()
@@ -105,37 +183,95 @@ func (versionManager *VersionManager) Delete(xid int64, uid int64) (bool, error)
 	}
 
 	var l sync.Locker = nil
-	// 尝试为数据项添加锁
+	// 尝试为数据项添加锁，需要等待时一直等到获得资源
 	l, err = versionManager.LT.Add(xid, uid)
-	// 如果出现并发更新的错误，那么中止事务，并抛出错误
+	if err == nil && l != nil {
+		err = versionManager.LT.Wait(xid, l)
+	}
+	// 等待超时只让当前语句失败，由上层撤销语句的修改
+	if err != nil && err.Error() == commons.ErrorMessage.LockTimeoutError {
+		return false, err
+	}
+	// 如果发生死锁，那么中止事务，并抛出错误
 	if err != nil {
-		transaction.Err = errors.New(commons.ErrorMessage.ConcurrentUpdateError)
+		transaction.Err = err
 		versionManager.internAbort(xid, true)
 		transaction.AutoAborted = true
 		return false, transaction.Err
 	}
-	// 如果成功获取到锁，那么锁定并立即解锁
-	if l != nil {
-		l.Lock()
-		l.Unlock()
-	}
 	// 如果数据项已经被当前事务删除，那么返回false
 	if entry.GetXMax() == xid {
 		return false, nil
 	}
 	// 如果数据项的版本被跳过，那么中止事务，并抛出错误
 	if IsVersionSkip(versionManager.TM, transaction, entry) {
-		transaction.Err = errors.New(commons.ErrorMessage.ConcurrentUpdateError)
+		transaction.Err = commons.NewError(commons.ErrorMessage.ConcurrentUpdateError)
 		versionManager.internAbort(xid, true)
 		transaction.AutoAborted = true
 		return false, transaction.Err
 	}
+	// 读已提交级别下，数据项可能在等待锁期间被其他事务删除
+	if !IsVisible(versionManager.TM, transaction, entry) {
+		return false, nil
+	}
 
 	// 设置数据项的xmax为当前事务的ID，表示数据项被当前事务删除
 	entry.SetXMax(xid)
+	transaction.logUndo(&undoRecord{kind: undoDelete, uid: uid})
 	return true, nil
 }
 
+// LockRow 为事务xid可见的记录uid加锁，用于 SELECT ... FOR UPDATE / FOR SHARE
+// 等待结束后记录可能已经被其他事务删除或更新，返回加锁后仍然可见的数据，记录不再可见时返回nil
+func (versionManager *VersionManager) LockRow(xid int64, uid int64, mode LockMode) ([]byte, error) {
+	versionManager.Lock.Lock()
+	transaction := versionManager.ActiveTransaction[xid]
+	versionManager.Lock.Unlock()
+
+	if transaction.Err != nil {
+		return nil, transaction.Err
+	}
+	entry, err := versionManager.CacheManager.Get(uid)
+	if err != nil && err.Error() == commons.ErrorMessage.NullEntryError {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Release()
+	if !IsVisible(versionManager.TM, transaction, entry) {
+		return nil, nil
+	}
+
+	l, err := versionManager.LT.Acquire(xid, uid, mode)
+	if err == nil && l != nil {
+		err = versionManager.LT.Wait(xid, l)
+	}
+	// 等待超时只让当前语句失败，由上层撤销语句的修改
+	if err != nil && err.Error() == commons.ErrorMessage.LockTimeoutError {
+		return nil, err
+	}
+	// 如果发生死锁，那么中止事务，并抛出错误
+	if err != nil {
+		transaction.Err = err
+		versionManager.internAbort(xid, true)
+		transaction.AutoAborted = true
+		return nil, transaction.Err
+	}
+	// 快照之后记录被其他事务修改过，可重复读级别下不能继续
+	if IsVersionSkip(versionManager.TM, transaction, entry) {
+		transaction.Err = commons.NewError(commons.ErrorMessage.ConcurrentUpdateError)
+		versionManager.internAbort(xid, true)
+		transaction.AutoAborted = true
+		return nil, transaction.Err
+	}
+	// 读已提交级别下，记录可能在等待期间被删除或更新
+	if !IsVisible(versionManager.TM, transaction, entry) {
+		return nil, nil
+	}
+	return entry.Data(), nil
+}
+
 // Begin 开启一个事务，并初始化事务的结构
 func (versionManager *VersionManager) Begin(level int32) int64 {
 	versionManager.Lock.Lock()
@@ -146,12 +282,52 @@ func (versionManager *VersionManager) Begin(level int32) int64 {
 	transaction := NewTransaction(xid, level, versionManager.ActiveTransaction)
 	// 将事务对象添加到活动事务中
 	versionManager.ActiveTransaction[xid] = transaction
+	if level == LevelSerializable {
+		versionManager.CT.Begin(xid)
+	}
 
 	return xid
 }
 
+// BeginReadOnly 开启一个只读事务，只读事务不会写入数据，也不会加行锁
+// 可串行化的只读事务仍然需要参与读写冲突的检测，因此分配真正的事务ID，
+// 其他隔离级别下不分配事务ID，也不会写入xid文件，返回的编号为负数
+func (versionManager *VersionManager) BeginReadOnly(level int32) int64 {
+	if level == LevelSerializable {
+		xid := versionManager.Begin(level)
+		versionManager.Lock.Lock()
+		versionManager.ActiveTransaction[xid].ReadOnly = true
+		versionManager.Lock.Unlock()
+		return xid
+	}
+
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	versionManager.virtualXid--
+	// 快照的上界是下一个将要分配的事务ID，之后开始的事务的修改都不可见
+	transaction := NewTransaction(versionManager.TM.XidCounter()+1, level, versionManager.ActiveTransaction)
+	transaction.ReadOnly = true
+	versionManager.ActiveTransaction[versionManager.virtualXid] = transaction
+	return versionManager.virtualXid
+}
+
+// IsReadOnly 判断事务是否为只读事务
+func (versionManager *VersionManager) IsReadOnly(xid int64) bool {
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+	transaction, ok := versionManager.ActiveTransaction[xid]
+	return ok && transaction.ReadOnly
+}
+
 // Commit 公开的commit方法，用于提交一个事务
 func (versionManager *VersionManager) Commit(xid int64) error {
+	// 没有分配事务ID的只读事务只需要从活动事务中移除
+	if isVirtualXid(xid) {
+		versionManager.Lock.Lock()
+		delete(versionManager.ActiveTransaction, xid)
+		versionManager.Lock.Unlock()
+		return nil
+	}
 	versionManager.Lock.Lock()
 	// 从活动事务中获取事务对象
 	transaction := versionManager.ActiveTransaction[xid]
@@ -163,6 +339,10 @@ func (versionManager *VersionManager) Commit(xid int64) error {
 		commons.Logger.Errorf("活动事务集：%v", transaction.SnapShot)
 		return transaction.Err
 	}
+	// 可串行化事务在提交时可能因为读写冲突而失败
+	if err := versionManager.serializationCheck(xid, versionManager.CT.Commit(xid)); err != nil {
+		return err
+	}
 
 	versionManager.Lock.Lock()
 	// 从活动事务中移除这个事务
@@ -170,10 +350,14 @@ func (versionManager *VersionManager) Commit(xid int64) error {
 
 	versionManager.Lock.Unlock()
 
-	// 从锁表中移除这个事务的锁
+	// 先写入提交日志，用于时间点恢复
+	timestamp := versionManager.DM.LogCommit(xid)
+	// 调用事务管理器的commit方法，进行事务的提交操作，同时记录提交时间
+	versionManager.TM.CommitAt(xid, timestamp)
+	// 提交之后再释放锁，被唤醒的事务才能看到提交后的状态
 	versionManager.LT.Remove(xid)
-	// 调用事务管理器的commit方法，进行事务的提交操作
-	versionManager.TM.Commit(xid)
+	versionManager.freeze()
+	versionManager.checkpoint()
 	return nil
 }
 
@@ -200,13 +384,52 @@ func (versionManager *VersionManager) internAbort(xid int64, autoAborted bool) {
 	}
 	versionManager.Lock.Unlock()
 	// 如果事务已经被自动中止，那么直接返回，不做任何处理
-	if transaction.AutoAborted {
+	if transaction.AutoAborted || isVirtualXid(xid) {
 		return
 	}
 	// 从锁表中移除这个事务的锁
 	versionManager.LT.Remove(xid)
 	// 调用事务管理器的abort方法，进行事务的中止操作
 	versionManager.TM.Abort(xid)
+	versionManager.CT.Abort(xid)
+	versionManager.freeze()
+}
+
+// freeze 未冻结的事务足够多时，冻结最早的活动快照之前的事务
+// 活动事务以及它们快照中的事务都不会被冻结，冻结不改变事务的状态，只改变存储方式
+func (versionManager *VersionManager) freeze() {
+	if !versionManager.TM.NeedFreeze() {
+		return
+	}
+	versionManager.Lock.Lock()
+	defer versionManager.Lock.Unlock()
+
+	before := versionManager.TM.XidCounter() + 1
+	for xid, transaction := range versionManager.ActiveTransaction {
+		if xid == tm.SuperXid {
+			continue
+		}
+		// 只读事务的Xid是它开始时下一个将要分配的事务ID
+		if transaction.Xid < before {
+			before = transaction.Xid
+		}
+		for snapShotXid := range transaction.SnapShot {
+			if snapShotXid < before {
+				before = snapShotXid
+			}
+		}
+	}
+	versionManager.TM.Freeze(before)
+	// 冻结时顺便清理保留时间之外的提交记录
+	versionManager.pruneCommitTimes()
+}
+
+// checkpoint 日志切换到新的段之后建立检查点，删除不再需要重放的旧的段
+// 检查点失败不影响事务的提交，旧的段保留到下次检查点
+func (versionManager *VersionManager) checkpoint() {
+	if err := versionManager.DM.Checkpoint(versionManager.TM); err != nil {
+		commons.Logger.Errorf("checkpoint failed: %v", err)
+	}
 }
 
 func (versionManager *VersionManager) ReleaseEntry(entry *Entry) {
@@ -217,7 +440,7 @@ func (versionManager *VersionManager) GetForCache(uid int64) (*Entry, error) {
 	// 核心还是调用dm.Read()方法
 	entry := LoadEntry(versionManager, uid)
 	if entry == nil {
-		return nil, errors.New(commons.ErrorMessage.NullEntryError)
+		return nil, commons.NewError(commons.ErrorMessage.NullEntryError)
 	}
 
 	return entry, nil
@@ -236,8 +459,12 @@ func NewVersionManager(transactionManager *tm.TransactionManagerImpl, dm *dm.Dat
 		DM:                dm,
 		ActiveTransaction: make(map[int64]*Transaction),
 		LT:                NewLockTable(),
+		CT:                NewConflictTable(),
 	}
 	vm.ActiveTransaction[tm.SuperXid] = NewTransaction(tm.SuperXid, 0, nil)
+	// 此时还没有任何事务在运行，仍处于活动状态的事务都是上次运行遗留的，将它们终止以便冻结
+	transactionManager.AbortActive()
+	vm.restorePrepared()
 	cacheManager := common.NewAbstractCache[*Entry](0, vm)
 	vm.CacheManager = cacheManager
 	return vm
@@ -12,9 +12,9 @@ func IsVersionSkip(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) bool
 	}
 }
 
-// IsVisible 判断记录e是否对事务t可见
+// IsVisible 判断记录e是否对事务t可见，可串行化级别与可重复读使用相同的快照
 func IsVisible(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) bool {
-	// 如果是可重复读级别
+	// 如果是读已提交级别
 	if t.Level == 0 {
 		return readCommitted(tm, t, e)
 	} else {
@@ -24,15 +24,13 @@ func IsVisible(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) bool {
 
 // readCommitted 如果是读已提交的隔离级别，判断e是否对事务t可见
 func readCommitted(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) bool {
-	// 获取事务的ID
-	xid := t.Xid
 	// 获取记录的创建版本号
 	XMin := e.GetXMin()
 	// 获取记录的删除版本号
 	XMax := e.GetXMax()
 	// 如果记录的创建版本号等于事务的ID并且记录未被删除，则返回true
 	// ---即记录e由当前事务创建且还未被删除
-	if XMin == xid && XMax == 0 {
+	if t.owns(XMin) && XMax == 0 {
 		return true
 	}
 
@@ -45,7 +43,7 @@ func readCommitted(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) bool
 		}
 
 		// 如果记录的删除版本号不等于事务的ID
-		if XMax != xid {
+		if !t.owns(XMax) {
 			// 如果记录的删除版本未提交，则返回true
 			// 因为没有提交，代表该数据还是上一个版本可见的
 			if !tm.IsCommitted(XMax) {
@@ -67,7 +65,7 @@ func repeatableRead(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) boo
 	XMax := e.GetXMax()
 	// 如果记录的创建版本号等于事务的ID并且记录未被删除，则返回true
 	// ---即记录e由当前事务创建且还未被删除
-	if XMin == xid && XMax == 0 {
+	if t.owns(XMin) && XMax == 0 {
 		return true
 	}
 	// 如果记录e的创建版本已经提交，并且创建版本号小于事务的ID，并且创建版本号不在事务的快照中
@@ -77,9 +75,10 @@ func repeatableRead(tm *tm.TransactionManagerImpl, t *Transaction, e *Entry) boo
 			return true
 		}
 		// 如果条目的删除版本号不等于事务的ID
-		if XMin != xid {
-			// 如果条目的删除版本未提交，或者删除版本号大于事务的ID，或者删除版本号在事务的快照中，则返回true
-			if !tm.IsCommitted(XMax) || XMax > xid || t.IsInSnapShot(XMax) {
+		if !t.owns(XMax) {
+			// 如果条目的删除版本未提交，或者删除版本号不小于事务的ID，或者删除版本号在事务的快照中，则返回true
+			// 只读事务的Xid由之后开始的事务使用，等于Xid的删除版本也不可见
+			if !tm.IsCommitted(XMax) || XMax >= xid || t.IsInSnapShot(XMax) {
 				return true
 			}
 		}
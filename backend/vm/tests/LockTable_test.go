@@ -4,6 +4,7 @@ import (
 	"SimpleDB/backend/vm"
 	"SimpleDB/commons"
 	"testing"
+	"time"
 )
 
 func TestLockTable(t *testing.T) {
@@ -78,3 +79,140 @@ func TestLockTable2(t *testing.T) {
 		commons.Logger.Debugf("Deadlock not detected")
 	}
 }
+
+func TestLockTimeout(t *testing.T) {
+	lt := vm.NewLockTable()
+	lt.SetLockTimeout(50 * time.Millisecond)
+	lt.Add(1, 1)
+	o, err := lt.Add(2, 1)
+	if err != nil || o == nil {
+		t.Fatalf("expected to wait, got %v", err)
+	}
+	start := time.Now()
+	err = lt.Wait(2, o)
+	if err == nil || err.Error() != commons.ErrorMessage.LockTimeoutError {
+		t.Fatalf("expected lock timeout, got %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("gave up too early")
+	}
+
+	// 超时的事务不再等待，资源释放后分配给后面的事务
+	o, _ = lt.Add(3, 1)
+	lt.Remove(1)
+	if err = lt.Wait(3, o); err != nil {
+		t.Fatalf("expected to acquire the lock, got %v", err)
+	}
+}
+
+func TestDeadlockVictim(t *testing.T) {
+	lt := vm.NewLockTable()
+	lt.SetDeadlockPolicy(vm.VictimYoungest)
+	lt.Add(1, 1)
+	lt.Add(2, 2)
+	lt.Add(2, 3)
+	o2, _ := lt.Add(2, 1)
+
+	// 事务1形成环，最晚开始的事务2被选为牺牲者，事务1继续等待
+	o1, err := lt.Add(1, 2)
+	if err != nil || o1 == nil {
+		t.Fatalf("requester should wait, got %v", err)
+	}
+	if err = lt.Wait(2, o2); err == nil || err.Error() != commons.ErrorMessage.DeadLockError {
+		t.Fatalf("expected the youngest to be the victim, got %v", err)
+	}
+	lt.Remove(2)
+	if err = lt.Wait(1, o1); err != nil {
+		t.Fatalf("expected to acquire the lock, got %v", err)
+	}
+
+	// 事务3持有的资源比事务4多，形成环的事务3继续等待
+	lt = vm.NewLockTable()
+	lt.SetDeadlockPolicy(vm.VictimFewestLocks)
+	lt.Add(3, 1)
+	lt.Add(3, 2)
+	lt.Add(4, 3)
+	o4, _ := lt.Add(4, 1)
+	if _, err = lt.Add(3, 3); err != nil {
+		t.Fatalf("requester should wait, got %v", err)
+	}
+	if err = lt.Wait(4, o4); err == nil || err.Error() != commons.ErrorMessage.DeadLockError {
+		t.Fatalf("expected the transaction with fewest locks to be the victim, got %v", err)
+	}
+
+	if _, err = vm.ParseDeadlockPolicy("oldest"); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+}
+
+func TestSharedLock(t *testing.T) {
+	lt := vm.NewLockTable()
+	// 共享锁之间兼容
+	if o, err := lt.AddShared(1, 1); o != nil || err != nil {
+		t.Fatalf("shared lock should be granted: %v", err)
+	}
+	if o, err := lt.AddShared(2, 1); o != nil || err != nil {
+		t.Fatalf("shared lock should be granted: %v", err)
+	}
+	// 排他锁需要等待所有共享锁释放，之后到来的共享锁排在它后面
+	o3, err := lt.Add(3, 1)
+	if o3 == nil || err != nil {
+		t.Fatalf("exclusive lock should wait: %v", err)
+	}
+	o4, _ := lt.AddShared(4, 1)
+	if o4 == nil {
+		t.Fatal("shared lock should wait behind the exclusive lock")
+	}
+	// 两个持有共享锁的事务同时升级会形成死锁
+	o1, err := lt.Add(1, 1)
+	if o1 == nil || err != nil {
+		t.Fatalf("upgrade should wait: %v", err)
+	}
+	if _, err = lt.Add(2, 1); err == nil || err.Error() != commons.ErrorMessage.DeadLockError {
+		t.Fatalf("expected deadlock, got %v", err)
+	}
+	lt.Remove(2)
+	if err = lt.Wait(1, o1); err != nil {
+		t.Fatalf("upgrade should be granted: %v", err)
+	}
+	lt.Remove(1)
+	if err = lt.Wait(3, o3); err != nil {
+		t.Fatalf("exclusive lock should be granted: %v", err)
+	}
+	lt.Remove(3)
+	if err = lt.Wait(4, o4); err != nil {
+		t.Fatalf("shared lock should be granted: %v", err)
+	}
+}
+
+// TestWaiterLocker 等待结束后Add返回的锁与互斥锁一样，Unlock之前其他的Lock会阻塞
+func TestWaiterLocker(t *testing.T) {
+	lt := vm.NewLockTable()
+	if _, err := lt.Add(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	o, err := lt.Add(2, 1)
+	if err != nil || o == nil {
+		t.Fatalf("expected to wait, got %v %v", o, err)
+	}
+	lt.Remove(1)
+	o.Lock()
+
+	locked := make(chan struct{})
+	go func() {
+		o.Lock()
+		close(locked)
+		o.Unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Lock should block until Unlock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	o.Unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("Lock is not released by Unlock")
+	}
+}
@@ -1,32 +1,104 @@
 package client
 
 import (
+	"SimpleDB/commons"
 	"SimpleDB/transport"
 )
 
 type Client struct {
 	// rt RoundTripper实例，用于处理请求的往返传输
 	rt *RoundTripper
+	// fetchSize 每次从服务端获取的记录数
+	fetchSize int
+	// rows 当前未关闭的结果集，服务端同一时间只为每个连接保留一个结果集
+	rows *Rows
 }
 
 // NewClient 接收一个Packager对象作为参数，并创建一个新的RoundTripper实例
 func NewClient(packager *transport.Packager) *Client {
 	rt := NewRoundTripper(packager)
 	return &Client{
-		rt: rt,
+		rt:        rt,
+		fetchSize: transport.DefaultFetchSize,
 	}
 }
 
+// SetFetchSize 设置读取结果集时每次从服务端获取的记录数，结果集的第一批记录由服务端决定
+func (client *Client) SetFetchSize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	client.fetchSize = n
+}
+
 // Execute 接收一个字节数组作为参数，将其封装为一个Package对象，并通过RoundTripper发送
 // 如果响应的Package对象中包含错误，那么抛出这个错误
 // 否则，返回响应的Package对象中的数据
+// 查询语句的结构化结果会转换为文本形式
 func (client *Client) Execute(stat []byte) ([]byte, error) {
-	pkg := transport.NewPackage(stat, nil)
+	return executeText(client.Run(stat))
+}
+
+// executeText 将查询语句的结果集读取完毕并转换为文本形式
+func executeText(rows *Rows, res []byte, err error) ([]byte, error) {
+	if rows == nil {
+		return res, err
+	}
+	defer rows.Close()
+	var text []byte
+	for rows.Next() {
+		text = append(text, transport.FormatRow(rows.Values())...)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return text, nil
+}
+
+// Run 执行一条语句，查询语句返回结果集的迭代器rows，其他语句返回文本形式的结果
+// 使用十六进制协议时查询语句也返回文本形式的结果
+// 之前未读取完的结果集会被服务端关闭
+func (client *Client) Run(stat []byte) (*Rows, []byte, error) {
+	return client.run(&transport.Package{Type: transport.MsgQuery, Data: stat})
+}
+
+// run 发送执行语句的数据包，处理服务端返回的结果或者结果集
+func (client *Client) run(pkg *transport.Package) (*Rows, []byte, error) {
+	if client.rows != nil {
+		client.rows.abandon()
+	}
 	resPkg, err := client.rt.RoundTrip(pkg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resPkg.GetErr() != nil {
+		return nil, nil, resPkg.GetErr()
+	}
+	if resPkg.GetType() == transport.MsgResultSet {
+		rs, err := transport.DecodeResultSet(resPkg.GetData())
+		if err != nil {
+			return nil, nil, err
+		}
+		client.rows = newRows(client, rs)
+		return client.rows, nil, nil
+	}
+	return nil, resPkg.GetData(), nil
+}
+
+// Query 执行查询语句，返回结果集的迭代器，语句没有返回结果集时返回错误
+func (client *Client) Query(stat []byte) (*Rows, error) {
+	return queryRows(client.Run(stat))
+}
+
+// queryRows 检查执行的语句是否返回了结果集
+func queryRows(rows *Rows, _ []byte, err error) (*Rows, error) {
 	if err != nil {
 		return nil, err
 	}
-	return resPkg.GetData(), resPkg.GetErr()
+	if rows == nil {
+		return nil, commons.NewError(commons.ErrorMessage.NoResultSetError)
+	}
+	return rows, nil
 }
 
 func (client *Client) Close() {
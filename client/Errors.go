@@ -0,0 +1,19 @@
+package client
+
+import "SimpleDB/commons"
+
+// ErrorCode 返回错误的错误码，服务端返回的错误带有错误码，其他错误为 commons.CodeInternalError
+func ErrorCode(err error) string {
+	return commons.ErrorCode(err)
+}
+
+// IsTransactionRollback 判断事务是否因为并发冲突（序列化失败、死锁）而必须回滚，这时应该重试整个事务
+func IsTransactionRollback(err error) bool {
+	return err != nil && commons.AsError(err).Class() == "40"
+}
+
+// IsRetryable 判断错误是否是暂时的，可以通过重试解决
+// 事务回滚类的错误需要重试整个事务，等待锁超时只有当前语句失败，可以只重试当前语句
+func IsRetryable(err error) bool {
+	return IsTransactionRollback(err) || ErrorCode(err) == commons.CodeLockNotAvailable
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"fmt"
+)
+
+// Rows 查询结果的迭代器，服务端每次返回一批记录，当前批次读取完毕后自动获取下一批，使用方式：
+//
+//	defer rows.Close()
+//	for rows.Next() {
+//		var id int64
+//		var name string
+//		if err := rows.Scan(&id, &name); err != nil { ... }
+//	}
+//	if err := rows.Err(); err != nil { ... }
+type Rows struct {
+	client  *Client
+	columns []transport.Column
+	// batch 当前批次的记录，pos 为当前行在批次中的下标，调用Next之前为-1
+	batch [][]interface{}
+	pos   int
+	// more 服务端是否还有更多的记录
+	more   bool
+	err    error
+	closed bool
+}
+
+func newRows(client *Client, rs *transport.ResultSet) *Rows {
+	return &Rows{client: client, columns: rs.Columns, batch: rs.Rows, pos: -1, more: rs.More}
+}
+
+// Columns 返回每一列的名称和类型
+func (rows *Rows) Columns() []transport.Column {
+	return rows.columns
+}
+
+// Next 移动到下一行，没有更多的行、出错或者迭代器已经关闭时返回false
+func (rows *Rows) Next() bool {
+	if rows.closed {
+		return false
+	}
+	for rows.pos+1 >= len(rows.batch) {
+		if !rows.more {
+			rows.close()
+			return false
+		}
+		if err := rows.fetch(); err != nil {
+			rows.err = err
+			rows.more = false
+			rows.close()
+			return false
+		}
+	}
+	rows.pos++
+	return true
+}
+
+// fetch 从服务端获取下一批记录
+func (rows *Rows) fetch() error {
+	resPkg, err := rows.client.rt.RoundTrip(transport.NewFetchPackage(rows.client.fetchSize))
+	if err != nil {
+		return err
+	}
+	if resPkg.GetErr() != nil {
+		return resPkg.GetErr()
+	}
+	if resPkg.GetType() != transport.MsgRowBatch {
+		return commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	batch, more, err := transport.DecodeRowBatch(rows.columns, resPkg.GetData())
+	if err != nil {
+		return err
+	}
+	rows.batch, rows.pos, rows.more = batch, -1, more
+	return nil
+}
+
+// Values 返回当前行的值，值的类型为 int32、int64 或者 string
+func (rows *Rows) Values() []interface{} {
+	if rows.closed || rows.pos < 0 || rows.pos >= len(rows.batch) {
+		return nil
+	}
+	return rows.batch[rows.pos]
+}
+
+// Scan 将当前行的值依次写入dest，支持 *int32、*int64、*int、*string、*[]byte 和 *interface{}
+// 整数可以写入更宽的整数类型或者字符串，字符串只能写入字符串或者字节数组
+func (rows *Rows) Scan(dest ...interface{}) error {
+	values := rows.Values()
+	if values == nil {
+		return fmt.Errorf("Scan called without a current row")
+	}
+	if len(dest) != len(values) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(values), len(dest))
+	}
+	for i, v := range values {
+		if err := transport.ConvertAssign(dest[i], v); err != nil {
+			return fmt.Errorf("column %s: %v", rows.columns[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Err 返回迭代过程中遇到的错误
+func (rows *Rows) Err() error {
+	return rows.err
+}
+
+// Close 关闭迭代器，之后Next总是返回false
+// 服务端还有未读取的记录时通知服务端停止查询，释放服务端的资源
+func (rows *Rows) Close() error {
+	if rows.closed {
+		return nil
+	}
+	var err error
+	if rows.more {
+		rows.more = false
+		var resPkg *transport.Package
+		if resPkg, err = rows.client.rt.RoundTrip(&transport.Package{Type: transport.MsgClose}); err == nil {
+			err = resPkg.GetErr()
+		}
+	}
+	rows.close()
+	return err
+}
+
+// close 在本地将迭代器标记为关闭
+func (rows *Rows) close() {
+	rows.closed = true
+	rows.batch = nil
+	if rows.client.rows == rows {
+		rows.client.rows = nil
+	}
+}
+
+// abandon 客户端执行下一条语句时调用，服务端会自动关闭之前的结果集，剩余的记录无法再读取
+func (rows *Rows) abandon() {
+	if rows.more {
+		rows.err = commons.NewError(commons.ErrorMessage.ResultSetClosedError)
+		rows.more = false
+	}
+	rows.close()
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"SimpleDB/commons"
+	"SimpleDB/transport"
 	"bufio"
 	"fmt"
 	"os"
+	"strings"
 )
 
 // Shell 用于接受用户的输入，并调用Client.execute()
@@ -31,9 +34,11 @@ func (shell *Shell) Run() {
 		if statStr == "exit" || statStr == "quit" {
 			break
 		}
-		res, err := shell.client.Execute([]byte(statStr))
+		rows, res, err := shell.client.Run([]byte(statStr))
 		if err != nil {
-			fmt.Println(err.Error())
+			fmt.Println(formatError(err))
+		} else if rows != nil {
+			fmt.Print(formatTable(rows))
 		} else {
 			fmt.Println(string(res))
 		}
@@ -43,3 +48,69 @@ func (shell *Shell) Run() {
 		fmt.Println("Error reading from input:", err)
 	}
 }
+
+// formatTable 将结果集格式化为表格，每一列按照最宽的值对齐，最后一行为行数
+func formatTable(rows *Rows) string {
+	columns := rows.Columns()
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = len(column.Name)
+	}
+	cells := make([][]string, 0)
+	for rows.Next() {
+		values := rows.Values()
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = transport.FormatValue(v)
+			if len(row[i]) > widths[i] {
+				widths[i] = len(row[i])
+			}
+		}
+		cells = append(cells, row)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err().Error() + "\n"
+	}
+
+	var sb strings.Builder
+	writeLine := func(row []string) {
+		for i, cell := range row {
+			if i > 0 {
+				sb.WriteString(" | ")
+			}
+			sb.WriteString(cell)
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-len(cell)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	names := make([]string, len(columns))
+	separator := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+		separator[i] = strings.Repeat("-", widths[i])
+	}
+	writeLine(names)
+	sb.WriteString(strings.Join(separator, "-+-"))
+	sb.WriteString("\n")
+	for _, row := range cells {
+		writeLine(row)
+	}
+	if len(cells) == 1 {
+		sb.WriteString("(1 row)\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("(%d rows)\n", len(cells)))
+	}
+	return sb.String()
+}
+
+// formatError 显示错误码、错误信息以及错误在语句中的位置
+func formatError(err error) string {
+	e := commons.AsError(err)
+	if e.Position > 0 {
+		return fmt.Sprintf("ERROR %s: %s (at position %d)", e.Code, e.Message, e.Position)
+	}
+	return fmt.Sprintf("ERROR %s: %s", e.Code, e.Message)
+}
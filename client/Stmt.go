@@ -0,0 +1,89 @@
+package client
+
+import (
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"fmt"
+)
+
+// Stmt 服务端的预备语句，语句只解析一次，每次执行时绑定参数的值，参数的值不会被当作SQL解析
+// 预备语句属于创建它的连接，不再使用时需要调用 Close 释放
+type Stmt struct {
+	client *Client
+	id     uint32
+	// NumParams 语句中参数占位符 ? 的个数
+	NumParams int
+	closed    bool
+}
+
+// Prepare 在服务端解析带有参数占位符 ? 的语句，参数只能出现在值的位置上，只有二进制协议支持预备语句
+// 准备和释放预备语句不会关闭当前的结果集
+func (client *Client) Prepare(stat []byte) (*Stmt, error) {
+	if !client.rt.packager.IsBinary() {
+		return nil, commons.NewCodeError(commons.CodeFeatureNotSupported, "Prepared statements require the binary protocol")
+	}
+	resPkg, err := client.rt.RoundTrip(&transport.Package{Type: transport.MsgPrepare, Data: stat})
+	if err != nil {
+		return nil, err
+	}
+	if resPkg.GetErr() != nil {
+		return nil, resPkg.GetErr()
+	}
+	if resPkg.GetType() != transport.MsgPrepared {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	id, params, err := transport.DecodePrepared(resPkg.GetData())
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{client: client, id: id, NumParams: params}, nil
+}
+
+// Run 绑定参数并执行预备语句，结果与 Client.Run 相同
+// 参数的类型可以是 int、int32、int64、string 或者 []byte
+func (stmt *Stmt) Run(params ...interface{}) (*Rows, []byte, error) {
+	if stmt.closed {
+		return nil, nil, commons.NewError(commons.ErrorMessage.PreparedStatementNotFoundError)
+	}
+	values := make([]interface{}, len(params))
+	for i, param := range params {
+		switch v := param.(type) {
+		case int:
+			values[i] = int64(v)
+		case []byte:
+			values[i] = string(v)
+		case int32, int64, string:
+			values[i] = v
+		default:
+			return nil, nil, commons.NewCodeError(commons.CodeDatatypeMismatch, fmt.Sprintf("%s: parameter %d has type %T", commons.ErrorMessage.InvalidParameterTypeError, i+1, param))
+		}
+	}
+	pkg, err := transport.NewExecutePackage(stmt.id, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stmt.client.run(pkg)
+}
+
+// Query 绑定参数并执行查询语句，返回结果集的迭代器
+func (stmt *Stmt) Query(params ...interface{}) (*Rows, error) {
+	return queryRows(stmt.Run(params...))
+}
+
+// Execute 绑定参数并执行语句，返回文本形式的结果
+func (stmt *Stmt) Execute(params ...interface{}) ([]byte, error) {
+	return executeText(stmt.Run(params...))
+}
+
+// Close 释放服务端的预备语句
+func (stmt *Stmt) Close() error {
+	if stmt.closed {
+		return nil
+	}
+	stmt.closed = true
+	resPkg, err := stmt.client.rt.RoundTrip(transport.NewDeallocatePackage(stmt.id))
+	if err != nil {
+		return err
+	}
+	return resPkg.GetErr()
+}
@@ -3,19 +3,32 @@ package main
 import (
 	"SimpleDB/client"
 	"SimpleDB/transport"
+	"flag"
 	"fmt"
 	"net"
 )
 
 func main() {
-	conn, err := net.Dial("tcp", "127.0.0.1:9998")
+	addrFlag := flag.String("addr", "127.0.0.1:9998", "Server address")
+	protocolFlag := flag.String("protocol", "binary", "Wire protocol: binary, or hex for servers of the previous release")
+	flag.Parse()
+
+	protocol, err := transport.ParseProtocol(*protocolFlag)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	conn, err := net.Dial("tcp", *addrFlag)
 	if err != nil {
 		fmt.Println("Error connecting to server:", err)
 		return
 	}
-	encoder := &transport.Encoder{}
-	transporter := transport.NewTransporter(conn)
-	packager := transport.NewPackager(transporter, encoder)
+	packager, err := transport.ClientHandshake(conn, protocol)
+	if err != nil {
+		fmt.Println("Error negotiating protocol:", err)
+		conn.Close()
+		return
+	}
 
 	cl := client.NewClient(packager)
 	shell := client.NewShell(cl)
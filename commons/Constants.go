@@ -27,12 +27,18 @@ type ErrorMessageType struct {
 
 	// 死锁异常
 	DeadLockError string
+	// 等待锁超时
+	LockTimeoutError string
+	// 保存点不存在
+	SavepointNotFoundError string
 
 	// Entry为空异常
 	NullEntryError string
 
 	// 并发更新错误
 	ConcurrentUpdateError string
+	// 可串行化事务之间存在读写冲突，事务需要重试
+	SerializationFailureError string
 
 	// 语句解析错误
 	InvalidCommandError string
@@ -66,31 +72,94 @@ type ErrorMessageType struct {
 	NestedTransactionError string
 	// 无事务错误（提交或终止了不存在的事务）
 	NoTransactionError string
+	// 只读事务中执行了写语句
+	ReadOnlyTransactionError string
+	// 数据库以只读方式打开
+	ReadOnlyDatabaseError string
+	// 历史查询的目标早于保留的范围
+	AsOfTooOldError string
+	// 全局事务ID已经被其他预备事务使用
+	DuplicatedGidError string
+	// 全局事务ID对应的预备事务不存在
+	PreparedTransactionNotFoundError string
+	// 事务不能预备，例如只读事务或者创建了表的事务
+	CannotPrepareError string
+	// 全局事务ID为空或者过长
+	InvalidGidError string
+	// 事务不是活动状态，例如已经预备或者已经结束
+	TransactionNotActiveError string
+	// 协商时双方没有都支持的协议版本
+	UnsupportedProtocolError string
+	// 期望返回结果集的语句没有返回结果集
+	NoResultSetError string
+	// 获取后续记录时没有打开的结果集
+	NoOpenCursorError string
+	// 结果集没有读取完就执行了下一条语句
+	ResultSetClosedError string
+	// 语句中有参数占位符，但是没有通过预备语句绑定参数
+	UnboundParameterError string
+	// 绑定的参数个数与语句中的参数个数不同
+	ParameterCountError string
+	// 预备语句不存在
+	PreparedStatementNotFoundError string
+	// 参数的类型不支持
+	InvalidParameterTypeError string
+	// 数据库已经关闭
+	DatabaseClosedError string
+	// 内存数据库不支持的操作，例如备份和日志归档
+	MemoryDatabaseError string
+	// 没有配置服务端读写文件的目录
+	FileAccessDisabledError string
+	// 文件路径不是文件目录下的相对路径
+	InvalidFilePathError string
 }
 
 var ErrorMessage = ErrorMessageType{
-	FileExistError:           "文件已存在",
-	WriteFileHeaderError:     "写入文件头错误",
-	BadXIDFileException:      "Bad XID file!",
-	CacheIsFullError:         "缓存已满，需要删除一个资源",
-	AllocMemoryTooSmallError: "分配用于缓存的内存过小",
-	BadLogFileError:          "日志文件错误",
-	BadLogCheckSumError:      "日志校验失败错误",
-	DataTooLargeError:        "Data too large",
-	DatabaseBusyError:        "Database is busy!",
-	DeadLockError:            "Deadlock detected",
-	NullEntryError:           "Entry is null",
-	ConcurrentUpdateError:    "Concurrent update error",
-	InvalidCommandError:      "Invalid command",
-	TableNoIndexError:        "Table has no index",
-	InvalidFieldTypeError:    "Invalid field type",
-	FieldNotIndexedError:     "Field not indexed",
-	FieldNotFoundError:       "Field not found",
-	InvalidLogOpError:        "Invalid logical operator",
-	InvalidValuesError:       "Invalid values",
-	DuplicatedTableError:     "Duplicated table",
-	TableNotFoundError:       "Table not found",
-	InvalidPkgDataError:      "Invalid package data",
-	NestedTransactionError:   "Nested transaction not supported!",
-	NoTransactionError:       "No transaction",
+	FileExistError:                   "File already exists",
+	WriteFileHeaderError:             "Failed to write file header",
+	BadXIDFileException:              "Bad XID file!",
+	CacheIsFullError:                 "Cache is full",
+	AllocMemoryTooSmallError:         "Memory allocated for cache is too small",
+	BadLogFileError:                  "Bad log file",
+	BadLogCheckSumError:              "Bad log checksum",
+	DataTooLargeError:                "Data too large",
+	DatabaseBusyError:                "Database is busy!",
+	DeadLockError:                    "Deadlock detected",
+	LockTimeoutError:                 "Lock wait timeout exceeded",
+	SavepointNotFoundError:           "Savepoint does not exist",
+	NullEntryError:                   "Entry is null",
+	ConcurrentUpdateError:            "Concurrent update error",
+	SerializationFailureError:        "Could not serialize access due to read/write dependencies among transactions",
+	InvalidCommandError:              "Invalid command",
+	TableNoIndexError:                "Table has no index",
+	InvalidFieldTypeError:            "Invalid field type",
+	FieldNotIndexedError:             "Field not indexed",
+	FieldNotFoundError:               "Field not found",
+	InvalidLogOpError:                "Invalid logical operator",
+	InvalidValuesError:               "Invalid values",
+	DuplicatedTableError:             "Duplicated table",
+	TableNotFoundError:               "Table not found",
+	InvalidPkgDataError:              "Invalid package data",
+	NestedTransactionError:           "Nested transaction not supported!",
+	NoTransactionError:               "No transaction",
+	ReadOnlyTransactionError:         "Cannot execute write statement in a read-only transaction",
+	ReadOnlyDatabaseError:            "Database is opened read-only",
+	AsOfTooOldError:                  "AS OF target is older than the retention horizon",
+	DuplicatedGidError:               "Global transaction id is already in use",
+	PreparedTransactionNotFoundError: "Prepared transaction does not exist",
+	CannotPrepareError:               "Transaction cannot be prepared",
+	InvalidGidError:                  "Invalid global transaction id",
+	TransactionNotActiveError:        "Transaction is not active",
+	UnsupportedProtocolError:         "Unsupported protocol version",
+	NoResultSetError:                 "Statement did not return a result set",
+	NoOpenCursorError:                "No open result set",
+	ResultSetClosedError:             "Result set was closed by a later statement",
+	UnboundParameterError:            "Statement has parameters that are not bound",
+	ParameterCountError:              "Wrong number of parameters",
+	PreparedStatementNotFoundError:   "Prepared statement does not exist",
+	InvalidParameterTypeError:        "Invalid parameter type",
+	DatabaseClosedError:              "Database is closed",
+	MemoryDatabaseError:              "Not supported by an in-memory database",
+	FileAccessDisabledError:          "Server file access is disabled, no file directory is configured",
+	InvalidFilePathError:             "File path must be relative to the file directory and must not contain '..'",
 }
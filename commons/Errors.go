@@ -0,0 +1,203 @@
+package commons
+
+import (
+	"errors"
+	"strings"
+)
+
+/**
+ * 带有错误码的错误
+ * 错误码参考 SQLSTATE，由5个字符组成，前两个字符为错误的类别，例如 40 表示事务回滚，42 表示语法错误或者访问规则错误
+ * 错误信息可能随版本变化，客户端应该根据错误码判断错误的类型
+ */
+
+const (
+	// CodeProtocolViolation 数据包格式错误
+	CodeProtocolViolation = "08P01"
+	// CodeConnectionDoesNotExist 连接或者嵌入的数据库已经关闭
+	CodeConnectionDoesNotExist = "08003"
+	// CodeConnectionRejected 服务端拒绝连接，例如不支持客户端的协议版本
+	CodeConnectionRejected = "08004"
+	// CodeFeatureNotSupported 不支持的功能
+	CodeFeatureNotSupported = "0A000"
+	// CodeInvalidTextRepresentation 值的格式错误
+	CodeInvalidTextRepresentation = "22P02"
+	// CodeInvalidParameterValue 参数的值不合法，例如全局事务ID过长
+	CodeInvalidParameterValue = "22023"
+	// CodeInvalidCursorState 结果集的状态错误
+	CodeInvalidCursorState = "24000"
+	// CodeInvalidTransactionState 事务的状态不允许执行该操作
+	CodeInvalidTransactionState = "25000"
+	// CodeActiveTransaction 已经在事务中
+	CodeActiveTransaction = "25001"
+	// CodeReadOnlyTransaction 在只读事务或者只读数据库中执行写操作
+	CodeReadOnlyTransaction = "25006"
+	// CodeNoActiveTransaction 不在事务中
+	CodeNoActiveTransaction = "25P01"
+	// CodeSavepointNotFound 保存点不存在
+	CodeSavepointNotFound = "3B001"
+	// CodeSerializationFailure 并发事务之间存在冲突，需要重试整个事务
+	CodeSerializationFailure = "40001"
+	// CodeDeadlockDetected 检测到死锁，事务已经被终止，需要重试整个事务
+	CodeDeadlockDetected = "40P01"
+	// CodeInvalidStatementName 预备语句不存在
+	CodeInvalidStatementName = "26000"
+	// CodeUndefinedParameter 语句中的参数没有绑定值
+	CodeUndefinedParameter = "42P02"
+	// CodeDatatypeMismatch 值的类型不匹配
+	CodeDatatypeMismatch = "42804"
+	// CodeSyntaxError 语法错误
+	CodeSyntaxError = "42601"
+	// CodeUndefinedColumn 字段不存在
+	CodeUndefinedColumn = "42703"
+	// CodeUndefinedObject 对象不存在，例如字段类型或者预备事务
+	CodeUndefinedObject = "42704"
+	// CodeDuplicateObject 对象已经存在，例如全局事务ID
+	CodeDuplicateObject = "42710"
+	// CodeUndefinedTable 表不存在
+	CodeUndefinedTable = "42P01"
+	// CodeDuplicateTable 表已经存在
+	CodeDuplicateTable = "42P07"
+	// CodeInsufficientPrivilege 没有权限执行的操作
+	CodeInsufficientPrivilege = "42501"
+	// CodeInvalidTableDefinition 表的定义错误
+	CodeInvalidTableDefinition = "42P16"
+	// CodeInsufficientResources 资源不足
+	CodeInsufficientResources = "53000"
+	// CodeOutOfMemory 内存不足
+	CodeOutOfMemory = "53200"
+	// CodeProgramLimitExceeded 超出了实现的限制，例如数据太大
+	CodeProgramLimitExceeded = "54000"
+	// CodeLockNotAvailable 等待锁超时，只有当前语句失败
+	CodeLockNotAvailable = "55P03"
+	// CodeDuplicateFile 文件已经存在
+	CodeDuplicateFile = "58P02"
+	// CodeIOError 读写文件错误
+	CodeIOError = "58030"
+	// CodeSnapshotTooOld 查询的历史版本已经不再保留
+	CodeSnapshotTooOld = "72000"
+	// CodeInternalError 内部错误，没有错误码的错误都属于这一类
+	CodeInternalError = "XX000"
+	// CodeDataCorrupted 数据文件损坏
+	CodeDataCorrupted = "XX001"
+)
+
+// errorCodes ErrorMessage 中每一种错误的错误码
+var errorCodes = map[string]string{
+	ErrorMessage.FileExistError:                   CodeDuplicateFile,
+	ErrorMessage.WriteFileHeaderError:             CodeIOError,
+	ErrorMessage.BadXIDFileException:              CodeDataCorrupted,
+	ErrorMessage.CacheIsFullError:                 CodeInsufficientResources,
+	ErrorMessage.AllocMemoryTooSmallError:         CodeOutOfMemory,
+	ErrorMessage.BadLogFileError:                  CodeDataCorrupted,
+	ErrorMessage.BadLogCheckSumError:              CodeDataCorrupted,
+	ErrorMessage.DataTooLargeError:                CodeProgramLimitExceeded,
+	ErrorMessage.DatabaseBusyError:                CodeInsufficientResources,
+	ErrorMessage.DeadLockError:                    CodeDeadlockDetected,
+	ErrorMessage.LockTimeoutError:                 CodeLockNotAvailable,
+	ErrorMessage.SavepointNotFoundError:           CodeSavepointNotFound,
+	ErrorMessage.NullEntryError:                   CodeInternalError,
+	ErrorMessage.ConcurrentUpdateError:            CodeSerializationFailure,
+	ErrorMessage.SerializationFailureError:        CodeSerializationFailure,
+	ErrorMessage.InvalidCommandError:              CodeSyntaxError,
+	ErrorMessage.TableNoIndexError:                CodeInvalidTableDefinition,
+	ErrorMessage.InvalidFieldTypeError:            CodeUndefinedObject,
+	ErrorMessage.FieldNotIndexedError:             CodeFeatureNotSupported,
+	ErrorMessage.FieldNotFoundError:               CodeUndefinedColumn,
+	ErrorMessage.InvalidLogOpError:                CodeSyntaxError,
+	ErrorMessage.InvalidValuesError:               CodeInvalidTextRepresentation,
+	ErrorMessage.DuplicatedTableError:             CodeDuplicateTable,
+	ErrorMessage.TableNotFoundError:               CodeUndefinedTable,
+	ErrorMessage.InvalidPkgDataError:              CodeProtocolViolation,
+	ErrorMessage.NestedTransactionError:           CodeActiveTransaction,
+	ErrorMessage.NoTransactionError:               CodeNoActiveTransaction,
+	ErrorMessage.ReadOnlyTransactionError:         CodeReadOnlyTransaction,
+	ErrorMessage.ReadOnlyDatabaseError:            CodeReadOnlyTransaction,
+	ErrorMessage.AsOfTooOldError:                  CodeSnapshotTooOld,
+	ErrorMessage.DuplicatedGidError:               CodeDuplicateObject,
+	ErrorMessage.PreparedTransactionNotFoundError: CodeUndefinedObject,
+	ErrorMessage.CannotPrepareError:               CodeFeatureNotSupported,
+	ErrorMessage.InvalidGidError:                  CodeInvalidParameterValue,
+	ErrorMessage.TransactionNotActiveError:        CodeInvalidTransactionState,
+	ErrorMessage.UnsupportedProtocolError:         CodeConnectionRejected,
+	ErrorMessage.NoResultSetError:                 CodeInvalidCursorState,
+	ErrorMessage.NoOpenCursorError:                CodeInvalidCursorState,
+	ErrorMessage.ResultSetClosedError:             CodeInvalidCursorState,
+	ErrorMessage.UnboundParameterError:            CodeUndefinedParameter,
+	ErrorMessage.ParameterCountError:              CodeProtocolViolation,
+	ErrorMessage.PreparedStatementNotFoundError:   CodeInvalidStatementName,
+	ErrorMessage.InvalidParameterTypeError:        CodeDatatypeMismatch,
+	ErrorMessage.DatabaseClosedError:              CodeConnectionDoesNotExist,
+	ErrorMessage.MemoryDatabaseError:              CodeFeatureNotSupported,
+	ErrorMessage.FileAccessDisabledError:          CodeInsufficientPrivilege,
+	ErrorMessage.InvalidFilePathError:             CodeInsufficientPrivilege,
+}
+
+// Error 带有错误码的错误，Error() 只返回错误信息，因此可以继续与 ErrorMessage 中的错误信息比较
+type Error struct {
+	Code    string
+	Message string
+	// Position 错误在语句中的位置，从1开始，为0表示没有位置
+	Position int
+}
+
+// NewError 根据 ErrorMessage 中的错误信息创建错误，错误码由错误信息决定
+func NewError(message string) *Error {
+	return &Error{Code: lookupCode(message), Message: message}
+}
+
+// lookupCode 查找错误信息对应的错误码，"错误信息: 上下文" 形式的错误信息使用冒号之前的错误信息的错误码
+func lookupCode(message string) string {
+	if code, ok := errorCodes[message]; ok {
+		return code
+	}
+	if i := strings.Index(message, ": "); i > 0 {
+		if code, ok := errorCodes[message[:i]]; ok {
+			return code
+		}
+	}
+	return CodeInternalError
+}
+
+// NewCodeError 创建指定错误码的错误，用于错误信息中带有上下文的错误
+func NewCodeError(code string, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// Class 返回错误码的类别
+func (err *Error) Class() string {
+	return err.Code[:2]
+}
+
+// WithPosition 返回带有位置的错误
+func (err *Error) WithPosition(position int) *Error {
+	return &Error{Code: err.Code, Message: err.Message, Position: position}
+}
+
+// AsError 将任意错误转换为带有错误码的错误，包装了 *Error 的错误保留它的错误码和位置，使用包装后的错误信息
+// 其他错误根据错误信息查找错误码，找不到时为 CodeInternalError
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		if e == err {
+			return e
+		}
+		return &Error{Code: e.Code, Message: err.Error(), Position: e.Position}
+	}
+	return NewError(err.Error())
+}
+
+// ErrorCode 返回错误的错误码，nil 返回空字符串
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	return AsError(err).Code
+}
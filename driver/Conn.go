@@ -0,0 +1,320 @@
+package driver
+
+import (
+	"SimpleDB/client"
+	"SimpleDB/commons"
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conn 实现 driver.Conn，一个 Conn 对应服务端的一个连接
+type Conn struct {
+	client *client.Client
+	config *Config
+	// bad 连接出现网络错误后不能再使用，连接池会丢弃它
+	bad bool
+}
+
+// Prepare 在服务端创建预备语句
+func (c *Conn) Prepare(query string) (sqldriver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext 在服务端创建预备语句，语句只解析一次，之后每次执行时绑定参数
+func (c *Conn) PrepareContext(ctx context.Context, query string) (sqldriver.Stmt, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	stmt, err := c.client.Prepare([]byte(query))
+	if err != nil {
+		return nil, c.fail(err)
+	}
+	return &Stmt{conn: c, stmt: stmt}, nil
+}
+
+// Close 关闭连接，服务端会终止连接上未提交的事务
+func (c *Conn) Close() error {
+	c.client.Close()
+	return nil
+}
+
+// Begin 使用DSN中的隔离级别开启事务
+func (c *Conn) Begin() (sqldriver.Tx, error) {
+	return c.BeginTx(context.Background(), sqldriver.TxOptions{})
+}
+
+// BeginTx 开启事务，没有指定隔离级别时使用DSN中的隔离级别
+func (c *Conn) BeginTx(ctx context.Context, opts sqldriver.TxOptions) (sqldriver.Tx, error) {
+	level := sql.IsolationLevel(opts.Isolation)
+	if level == sql.LevelDefault {
+		level = c.config.Isolation
+	}
+	stat, err := beginStatement(level, opts.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.exec(ctx, stat, nil); err != nil {
+		return nil, err
+	}
+	return &Tx{conn: c}, nil
+}
+
+// ExecContext 执行不返回记录的语句，有参数时使用一次性的预备语句绑定参数
+func (c *Conn) ExecContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	res, err := c.exec(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result(res), nil
+}
+
+// QueryContext 执行查询语句，返回分批读取的结果集，有参数时使用一次性的预备语句绑定参数
+func (c *Conn) QueryContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	return queryRows(c.run(ctx, query, args))
+}
+
+// exec 执行一条语句，返回文本形式的结果，查询语句的结果集会被直接关闭
+func (c *Conn) exec(ctx context.Context, query string, args []sqldriver.NamedValue) ([]byte, error) {
+	return c.drain(c.run(ctx, query, args))
+}
+
+// run 执行一条语句，没有参数时直接发送语句，否则创建预备语句，绑定参数执行之后释放
+// 释放预备语句不会关闭返回的结果集
+func (c *Conn) run(ctx context.Context, query string, args []sqldriver.NamedValue) (*client.Rows, []byte, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, nil, err
+	}
+	if len(args) == 0 {
+		rows, res, err := c.client.Run([]byte(query))
+		if err != nil {
+			return nil, nil, c.fail(err)
+		}
+		return rows, res, nil
+	}
+	stmt, err := c.client.Prepare([]byte(query))
+	if err != nil {
+		return nil, nil, c.fail(err)
+	}
+	rows, res, err := c.runStmt(stmt, args)
+	if closeErr := stmt.Close(); closeErr != nil && err == nil {
+		return nil, nil, c.fail(closeErr)
+	}
+	return rows, res, err
+}
+
+// runStmt 绑定参数并执行预备语句
+func (c *Conn) runStmt(stmt *client.Stmt, args []sqldriver.NamedValue) (*client.Rows, []byte, error) {
+	params, err := bindArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, res, err := stmt.Run(params...)
+	if err != nil {
+		return nil, nil, c.fail(err)
+	}
+	return rows, res, nil
+}
+
+// drain 关闭查询语句的结果集，返回文本形式的结果
+func (c *Conn) drain(rows *client.Rows, res []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if rows != nil {
+		if err = rows.Close(); err != nil {
+			return nil, c.fail(err)
+		}
+	}
+	return res, nil
+}
+
+// queryRows 包装查询的结果集，不返回记录的语句返回一个空的结果集
+func queryRows(rows *client.Rows, _ []byte, err error) (sqldriver.Rows, error) {
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		return &Rows{}, nil
+	}
+	return &Rows{rows: rows}, nil
+}
+
+// check 在发送语句之前检查连接和上下文
+func (c *Conn) check(ctx context.Context) error {
+	if c.bad {
+		return sqldriver.ErrBadConn
+	}
+	return ctx.Err()
+}
+
+// fail 服务端返回的错误都带有错误码，其他错误来自网络，连接不能再使用
+// 语句可能已经执行，因此不能返回 driver.ErrBadConn 让 database/sql 重试
+func (c *Conn) fail(err error) error {
+	var e *commons.Error
+	if !errors.As(err, &e) {
+		c.bad = true
+	}
+	return err
+}
+
+// IsValid 实现 driver.Validator，出现网络错误的连接不再放回连接池
+func (c *Conn) IsValid() bool {
+	return !c.bad
+}
+
+// ResetSession 实现 driver.SessionResetter
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if c.bad {
+		return sqldriver.ErrBadConn
+	}
+	return nil
+}
+
+// CheckNamedValue 实现 driver.NamedValueChecker，在发送之前转换参数的类型
+// 数据库只有整数和字符串类型，bool 转换为 1 和 0，没有小数部分的 float64 转换为 int64，
+// 无法表示的参数（包括 time.Time）直接返回错误，不会发送到服务端
+func (c *Conn) CheckNamedValue(nv *sqldriver.NamedValue) error {
+	value, err := sqldriver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return commons.NewCodeError(commons.CodeDatatypeMismatch, fmt.Sprintf("%s: argument %d: %v", commons.ErrorMessage.InvalidParameterTypeError, nv.Ordinal, err))
+	}
+	switch v := value.(type) {
+	case bool:
+		if v {
+			value = int64(1)
+		} else {
+			value = int64(0)
+		}
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return commons.NewCodeError(commons.CodeDatatypeMismatch, fmt.Sprintf("%s: argument %d is float64 %v, only integral values in the int64 range are supported", commons.ErrorMessage.InvalidParameterTypeError, nv.Ordinal, v))
+		}
+		value = int64(v)
+	case time.Time:
+		return commons.NewCodeError(commons.CodeDatatypeMismatch, fmt.Sprintf("%s: argument %d is time.Time, format it as a string or convert it to an integer", commons.ErrorMessage.InvalidParameterTypeError, nv.Ordinal))
+	}
+	nv.Value = value
+	return nil
+}
+
+// bindArgs 将参数转换为预备语句的参数，只支持按位置传递的 int64、string 和 []byte
+// 其他类型的参数已经在 CheckNamedValue 中转换或者拒绝
+func bindArgs(args []sqldriver.NamedValue) ([]interface{}, error) {
+	params := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("named argument %s is not supported", arg.Name)
+		}
+		switch v := arg.Value.(type) {
+		case int64, string, []byte:
+			params[i] = v
+		default:
+			return nil, commons.NewCodeError(commons.CodeDatatypeMismatch, fmt.Sprintf("%s: argument %d has type %T", commons.ErrorMessage.InvalidParameterTypeError, arg.Ordinal, v))
+		}
+	}
+	return params, nil
+}
+
+// result 根据服务端返回的文本解析影响的行数，例如 "update 3"、"delete 1"、"copy 10"，插入语句总是插入一行
+func result(res []byte) sqldriver.Result {
+	fields := strings.Fields(string(res))
+	if len(fields) == 0 {
+		return sqldriver.RowsAffected(0)
+	}
+	switch fields[0] {
+	case "insert":
+		return sqldriver.RowsAffected(1)
+	case "update", "delete", "copy":
+		if len(fields) == 2 {
+			if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				return sqldriver.RowsAffected(n)
+			}
+		}
+	}
+	return sqldriver.RowsAffected(0)
+}
+
+// Tx 实现 driver.Tx
+type Tx struct {
+	conn *Conn
+}
+
+// Commit 提交事务
+func (tx *Tx) Commit() error {
+	_, err := tx.conn.exec(context.Background(), "commit", nil)
+	return err
+}
+
+// Rollback 终止事务
+func (tx *Tx) Rollback() error {
+	_, err := tx.conn.exec(context.Background(), "abort", nil)
+	return err
+}
+
+// Stmt 实现 driver.Stmt，对应服务端的一个预备语句
+type Stmt struct {
+	conn *Conn
+	stmt *client.Stmt
+}
+
+// Close 释放服务端的预备语句
+func (s *Stmt) Close() error {
+	if s.conn.bad {
+		return nil
+	}
+	if err := s.stmt.Close(); err != nil {
+		return s.conn.fail(err)
+	}
+	return nil
+}
+
+// NumInput 返回语句中参数占位符的个数，database/sql 在执行之前检查参数的个数
+func (s *Stmt) NumInput() int {
+	return s.stmt.NumParams
+}
+
+// Exec 执行语句
+func (s *Stmt) Exec(args []sqldriver.Value) (sqldriver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+// ExecContext 绑定参数并执行语句
+func (s *Stmt) ExecContext(ctx context.Context, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	res, err := s.conn.drain(s.run(ctx, args))
+	if err != nil {
+		return nil, err
+	}
+	return result(res), nil
+}
+
+// Query 执行查询语句
+func (s *Stmt) Query(args []sqldriver.Value) (sqldriver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+// QueryContext 绑定参数并执行查询语句
+func (s *Stmt) QueryContext(ctx context.Context, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	return queryRows(s.run(ctx, args))
+}
+
+func (s *Stmt) run(ctx context.Context, args []sqldriver.NamedValue) (*client.Rows, []byte, error) {
+	if err := s.conn.check(ctx); err != nil {
+		return nil, nil, err
+	}
+	return s.conn.runStmt(s.stmt, args)
+}
+
+func namedValues(args []sqldriver.Value) []sqldriver.NamedValue {
+	named := make([]sqldriver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = sqldriver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
@@ -0,0 +1,106 @@
+package driver
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DefaultHost 默认的服务端地址
+	DefaultHost = "localhost"
+	// DefaultPort 默认的服务端端口，与 db_server 的端口相同
+	DefaultPort = 9998
+)
+
+// Config 连接参数
+type Config struct {
+	Host string
+	Port int
+	// Isolation 显式事务默认的隔离级别，为 sql.LevelDefault 时使用服务端的默认隔离级别（读已提交）
+	// 不在事务中执行的语句总是在服务端的临时事务中执行
+	Isolation sql.IsolationLevel
+}
+
+// ParseDSN 解析DSN，格式为 [simpledb://]host[:port][?isolation=level]
+// level 可以是 read_committed、repeatable_read、serializable，单词之间也可以使用空格或者连字符
+func ParseDSN(dsn string) (*Config, error) {
+	if !strings.Contains(dsn, "://") {
+		dsn = "simpledb://" + dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "simpledb" {
+		return nil, fmt.Errorf("invalid scheme %q in DSN", u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("unexpected path %q in DSN", u.Path)
+	}
+	config := &Config{Host: u.Hostname(), Port: DefaultPort, Isolation: sql.LevelDefault}
+	if config.Host == "" {
+		config.Host = DefaultHost
+	}
+	if port := u.Port(); port != "" {
+		if config.Port, err = strconv.Atoi(port); err != nil || config.Port <= 0 || config.Port > 65535 {
+			return nil, fmt.Errorf("invalid port %q in DSN", port)
+		}
+	}
+	for key, values := range u.Query() {
+		switch key {
+		case "isolation":
+			if config.Isolation, err = parseIsolation(values[len(values)-1]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown DSN parameter %q", key)
+		}
+	}
+	return config, nil
+}
+
+// Addr 返回服务端的地址
+func (config *Config) Addr() string {
+	return net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+}
+
+// parseIsolation 解析隔离级别的名称
+func parseIsolation(name string) (sql.IsolationLevel, error) {
+	name = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(strings.TrimSpace(name)))
+	switch name {
+	case "", "default":
+		return sql.LevelDefault, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unsupported isolation level %q", name)
+}
+
+// beginStatement 根据隔离级别和是否只读生成 begin 语句
+// 可重复读使用快照隔离实现，因此 sql.LevelSnapshot 也对应可重复读
+func beginStatement(level sql.IsolationLevel, readOnly bool) (string, error) {
+	stat := "begin"
+	switch level {
+	case sql.LevelDefault:
+	case sql.LevelReadCommitted:
+		stat += " isolation level read committed"
+	case sql.LevelRepeatableRead, sql.LevelSnapshot:
+		stat += " isolation level repeatable read"
+	case sql.LevelSerializable:
+		stat += " isolation level serializable"
+	default:
+		return "", fmt.Errorf("unsupported isolation level %s", level)
+	}
+	if readOnly {
+		stat += " read only"
+	}
+	return stat, nil
+}
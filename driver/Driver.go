@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"SimpleDB/client"
+	"SimpleDB/transport"
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"net"
+	"time"
+)
+
+/**
+ * database/sql 驱动，驱动名称为 simpledb：
+ *
+ *	db, err := sql.Open("simpledb", "localhost:9998?isolation=serializable")
+ *
+ * 每个连接使用二进制协议与服务端通信，查询结果分批读取
+ * 服务端为每个连接只保留一个打开的结果集，同一个连接（或者事务）上执行下一条语句时之前未读取完的结果集会被关闭
+ */
+
+func init() {
+	sql.Register("simpledb", &Driver{})
+}
+
+// Driver 实现 driver.Driver 和 driver.DriverContext
+type Driver struct {
+}
+
+// Open 使用DSN建立一个新的连接
+func (d *Driver) Open(dsn string) (sqldriver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+// OpenConnector 解析DSN，返回用于建立连接的 Connector
+func (d *Driver) OpenConnector(dsn string) (sqldriver.Connector, error) {
+	config, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{driver: d, config: config}, nil
+}
+
+// Connector 使用固定的连接参数建立连接
+type Connector struct {
+	driver *Driver
+	config *Config
+}
+
+// NewConnector 使用连接参数创建 Connector，可以通过 sql.OpenDB 使用
+func NewConnector(config *Config) *Connector {
+	return &Connector{driver: &Driver{}, config: config}
+}
+
+// Connect 连接服务端并完成协议协商
+func (c *Connector) Connect(ctx context.Context) (sqldriver.Conn, error) {
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", c.config.Addr())
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	packager, err := transport.ClientHandshake(netConn, transport.ProtocolBinary)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	return &Conn{client: client.NewClient(packager), config: c.config}, nil
+}
+
+// Driver 返回创建 Connector 的驱动
+func (c *Connector) Driver() sqldriver.Driver {
+	return c.driver
+}
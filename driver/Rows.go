@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"SimpleDB/client"
+	"SimpleDB/transport"
+	sqldriver "database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Rows 实现 driver.Rows，rows 为nil时表示不返回记录的语句的空结果集
+type Rows struct {
+	rows *client.Rows
+}
+
+// Columns 返回每一列的名称
+func (r *Rows) Columns() []string {
+	if r.rows == nil {
+		return []string{}
+	}
+	columns := r.rows.Columns()
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Next 读取下一行，int32 的值转换为 int64
+func (r *Rows) Next(dest []sqldriver.Value) error {
+	if r.rows == nil {
+		return io.EOF
+	}
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, v := range r.rows.Values() {
+		if n, ok := v.(int32); ok {
+			dest[i] = int64(n)
+		} else {
+			dest[i] = v
+		}
+	}
+	return nil
+}
+
+// Close 关闭结果集，服务端还有未读取的记录时停止查询
+func (r *Rows) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	return r.rows.Close()
+}
+
+// ColumnTypeDatabaseTypeName 实现 driver.RowsColumnTypeDatabaseTypeName，返回 INT32、INT64 或者 STRING
+func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(transport.ColumnTypeName(r.rows.Columns()[index].Type))
+}
+
+// ColumnTypeScanType 实现 driver.RowsColumnTypeScanType
+func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
+	switch r.rows.Columns()[index].Type {
+	case transport.ColumnInt32:
+		return reflect.TypeOf(int32(0))
+	case transport.ColumnInt64:
+		return reflect.TypeOf(int64(0))
+	}
+	return reflect.TypeOf("")
+}
@@ -0,0 +1,306 @@
+package tests
+
+import (
+	"SimpleDB/backend/dm"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tbm"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/vm"
+	"SimpleDB/client"
+	"SimpleDB/commons"
+	"SimpleDB/driver"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openDB 启动进程内的服务端，返回连接它的 sql.DB
+func openDB(t *testing.T, params string) *sql.DB {
+	path := filepath.Join(t.TempDir(), "db")
+	transactionManager, _ := tm.CreateTransactionManagerImpl(path)
+	dataManager := dm.CreateDataManager(path, 64<<20)
+	tableManager := tbm.CreateTableManger(path, vm.NewVersionManager(transactionManager, dataManager), dataManager)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		server.NewServer(0, tableManager).Serve(ln)
+		close(done)
+	}()
+	db, err := sql.Open("simpledb", "simpledb://"+ln.Addr().String()+params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		ln.Close()
+		<-done
+		dataManager.Close()
+		transactionManager.Close()
+	})
+	return db
+}
+
+func mustExec(t *testing.T, db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, query string) sql.Result {
+	res, err := db.Exec(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return res
+}
+
+func TestParseDSN(t *testing.T) {
+	config, err := driver.ParseDSN("simpledb://db.local:1234?isolation=repeatable_read")
+	if err != nil || config.Addr() != "db.local:1234" || config.Isolation != sql.LevelRepeatableRead {
+		t.Fatalf("unexpected config %+v %v", config, err)
+	}
+	config, err = driver.ParseDSN("127.0.0.1?isolation=Serializable")
+	if err != nil || config.Addr() != fmt.Sprintf("127.0.0.1:%d", driver.DefaultPort) || config.Isolation != sql.LevelSerializable {
+		t.Fatalf("unexpected config %+v %v", config, err)
+	}
+	config, err = driver.ParseDSN("")
+	if err != nil || config.Host != driver.DefaultHost || config.Isolation != sql.LevelDefault {
+		t.Fatalf("unexpected config %+v %v", config, err)
+	}
+	for _, dsn := range []string{"mysql://localhost", "localhost:0", "localhost:x", "localhost?isolation=chaos", "localhost?user=root", "localhost/db"} {
+		if _, err = driver.ParseDSN(dsn); err == nil {
+			t.Fatalf("%s should be rejected", dsn)
+		}
+	}
+}
+
+func TestDriver(t *testing.T) {
+	db := openDB(t, "")
+	mustExec(t, db, "create table student id int32, age int64, name string, (index id)")
+	for i := 1; i <= 3; i++ {
+		if n, _ := mustExec(t, db, fmt.Sprintf("insert into student values %d %d name%d", i, 20+i, i)).RowsAffected(); n != 1 {
+			t.Fatalf("insert affected %d rows", n)
+		}
+	}
+	if n, _ := mustExec(t, db, "update student set age = 30 where id > 1").RowsAffected(); n != 2 {
+		t.Fatalf("update affected %d rows", n)
+	}
+
+	rows, err := db.Query("select * from student where id > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, _ := rows.ColumnTypes()
+	if len(types) != 3 || types[0].Name() != "id" || types[0].DatabaseTypeName() != "INT32" || types[1].DatabaseTypeName() != "INT64" || types[2].DatabaseTypeName() != "STRING" {
+		t.Fatalf("unexpected column types %v", types)
+	}
+	var got []string
+	for rows.Next() {
+		var id int32
+		var age int64
+		var name string
+		if err = rows.Scan(&id, &age, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d %d %s", id, age, name))
+	}
+	if rows.Err() != nil || fmt.Sprint(got) != "[1 21 name1 2 30 name2 3 30 name3]" {
+		t.Fatalf("unexpected rows %v %v", got, rows.Err())
+	}
+
+	var name string
+	if err = db.QueryRow("select * from student where id = 4").Scan(&name); err != sql.ErrNoRows {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+	_, err = db.Exec("select * from teacher")
+	if client.ErrorCode(err) != commons.CodeUndefinedTable {
+		t.Fatalf("expected undefined table, got %v", err)
+	}
+	if _, err = db.Exec("insert into student values ? ? ?", 4, 24.5, "name4"); client.ErrorCode(err) != commons.CodeDatatypeMismatch {
+		t.Fatalf("float argument should be rejected, got %v", err)
+	}
+}
+
+func TestDriverArgs(t *testing.T) {
+	db := openDB(t, "")
+	mustExec(t, db, "create table student id int32, age int64, name string, (index id)")
+	if n, err := db.Exec("insert into student values ? ? ?", 1, int64(1)<<40, "x' or '1'='1"); err != nil {
+		t.Fatal(err)
+	} else if affected, _ := n.RowsAffected(); affected != 1 {
+		t.Fatalf("insert affected %d rows", affected)
+	}
+
+	stmt, err := db.Prepare("insert into student values ? ? ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	for i := 2; i <= 4; i++ {
+		if _, err = stmt.Exec(i, 20+i, []byte(fmt.Sprintf("name %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = stmt.Exec(5, 25); err == nil {
+		t.Fatal("wrong number of arguments should be rejected")
+	}
+
+	var age int64
+	var name string
+	if err = db.QueryRow("select * from student where id = ?", 1).Scan(new(int32), &age, &name); err != nil || age != 1<<40 || name != "x' or '1'='1" {
+		t.Fatalf("unexpected row %d %q %v", age, name, err)
+	}
+	rows, err := db.Query("select * from student where id > ? and id < ?", 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for rows.Next() {
+		rows.Scan(new(int32), &age, &name)
+		names = append(names, name)
+	}
+	if rows.Err() != nil || fmt.Sprint(names) != "[name 2 name 3]" {
+		t.Fatalf("unexpected rows %q %v", names, rows.Err())
+	}
+	if n, err := db.Exec("delete from student where id = ?", 4); err != nil {
+		t.Fatal(err)
+	} else if affected, _ := n.RowsAffected(); affected != 1 {
+		t.Fatalf("delete affected %d rows", affected)
+	}
+}
+
+func TestDriverTransaction(t *testing.T) {
+	db := openDB(t, "?isolation=repeatable_read")
+	db.SetMaxOpenConns(2)
+	mustExec(t, db, "create table account id int32, balance int64, (index id)")
+	mustExec(t, db, "insert into account values 1 100")
+
+	count := func() int {
+		n := 0
+		rows, err := db.Query("select * from account where id > 0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			n++
+		}
+		return n
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx, "insert into account values 2 50")
+	if count() != 1 {
+		t.Fatal("uncommitted insert is visible")
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 1 {
+		t.Fatal("rolled back insert is visible")
+	}
+
+	tx, _ = db.Begin()
+	mustExec(t, tx, "insert into account values 2 50")
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 2 {
+		t.Fatal("committed insert is not visible")
+	}
+
+	// 只读事务拒绝写语句，不支持的隔离级别直接返回错误
+	tx, err = db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("insert into account values 3 10"); client.ErrorCode(err) != commons.CodeReadOnlyTransaction {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	tx.Rollback()
+	if _, err = db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadUncommitted}); err == nil {
+		t.Fatal("read uncommitted should be rejected")
+	}
+}
+
+// TestDriverStreaming 提前关闭结果集之后连接仍然可以继续使用
+func TestDriverStreaming(t *testing.T) {
+	db := openDB(t, "")
+	db.SetMaxOpenConns(1)
+	mustExec(t, db, "create table student id int32, name string, (index id)")
+	tx, _ := db.Begin()
+	for i := 1; i <= 600; i++ {
+		mustExec(t, tx, fmt.Sprintf("insert into student values %d name%d", i, i))
+	}
+	tx.Commit()
+
+	rows, err := db.Query("select * from student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Next()
+	rows.Close()
+	n := 0
+	rows, _ = db.Query("select * from student")
+	for rows.Next() {
+		n++
+	}
+	if rows.Err() != nil || n != 600 {
+		t.Fatalf("read %d rows: %v", n, rows.Err())
+	}
+}
+
+// TestDriverArgTypes bool 和没有小数部分的 float64 转换为整数，其他无法表示的参数在发送之前被拒绝
+func TestDriverArgTypes(t *testing.T) {
+	db := openDB(t, "")
+	db.SetMaxOpenConns(1)
+	mustExec(t, db, "create table student id int32, age int64, name string, (index id)")
+	if _, err := db.Exec("insert into student values ? ? ?", true, float64(1<<40), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("insert into student values ? ? ?", false, float32(20), "b"); err != nil {
+		t.Fatal(err)
+	}
+	var age int64
+	var name string
+	if err := db.QueryRow("select * from student where id = ?", true).Scan(new(int32), &age, &name); err != nil || age != 1<<40 || name != "a" {
+		t.Fatalf("unexpected row %d %q %v", age, name, err)
+	}
+	if err := db.QueryRow("select * from student where id = ?", 0.0).Scan(new(int32), &age, &name); err != nil || age != 20 || name != "b" {
+		t.Fatalf("unexpected row %d %q %v", age, name, err)
+	}
+
+	for _, c := range []struct {
+		arg     interface{}
+		message string
+	}{
+		{1.5, "float64 1.5"},
+		{math.Inf(1), "float64 +Inf"},
+		{float64(1 << 63), "float64"},
+		{time.Now(), "time.Time"},
+		{nil, "<nil>"},
+	} {
+		_, err := db.Exec("insert into student values ? ? ?", 2, c.arg, "c")
+		if commons.ErrorCode(err) != commons.CodeDatatypeMismatch || !strings.Contains(err.Error(), c.message) {
+			t.Fatalf("argument %v: expected invalid parameter type error, got %v", c.arg, err)
+		}
+	}
+	// 被拒绝的参数没有发送到服务端，连接仍然可以使用
+	var count int
+	rows, err := db.Query("select * from student")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		count++
+	}
+	if rows.Err() != nil || count != 2 {
+		t.Fatalf("%d rows, expected 2: %v", count, rows.Err())
+	}
+}
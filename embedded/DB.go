@@ -0,0 +1,283 @@
+package embedded
+
+import (
+	"SimpleDB/backend/parser"
+	"SimpleDB/backend/parser/statement"
+	"SimpleDB/backend/server"
+	"SimpleDB/backend/tm"
+	"SimpleDB/backend/utils"
+	"SimpleDB/commons"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMemory 页面缓存默认的大小
+const DefaultMemory = server.DefaultMemory
+
+// Options 打开数据库的选项，零值表示使用默认值，与 db_server 的命令行参数对应
+type Options = server.Options
+
+// DB 在当前进程中打开的数据库，不需要启动服务端，可以被多个协程同时使用
+// 每次调用 Exec 和 Query 都使用一个新的会话，与客户端的一次连接相同；需要在同一个事务中执行多条语句时使用 Begin
+type DB struct {
+	database *server.Database
+	// lock 执行语句时持有读锁，Close 持有写锁，等待正在执行的语句结束
+	lock   sync.RWMutex
+	closed atomic.Bool
+	// sessions 还没有结束的会话，Close 时终止会话中的事务并关闭游标
+	sessions    map[*session]struct{}
+	sessionLock sync.Mutex
+}
+
+// session 一个会话，执行语句时持有会话的锁，Close 据此区分空闲的会话和正在执行语句的会话
+type session struct {
+	lock     sync.Mutex
+	executor *server.Executor
+	closed   bool
+}
+
+// enter 开始在会话中执行语句，会话已经被关闭时返回错误
+func (s *session) enter() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return commons.NewError(commons.ErrorMessage.DatabaseClosedError)
+	}
+	return nil
+}
+
+func (s *session) leave() {
+	s.lock.Unlock()
+}
+
+// close 终止会话中未提交的事务，调用时必须持有会话的锁
+func (s *session) close() {
+	if !s.closed {
+		s.closed = true
+		s.executor.Close()
+	}
+}
+
+// Open 打开path处的数据库，数据库不存在时创建新的数据库，path 与 db_server -open 的参数相同，为数据库文件的路径前缀
+// opts 为nil时使用默认选项，只读打开时数据库必须已经存在
+func Open(path string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if utils.FileExists(path + tm.XidSuffix) {
+		return newDB(server.OpenDatabase(path, opts))
+	}
+	if opts.ReadOnly {
+		return nil, fmt.Errorf("database %s does not exist", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return newDB(server.CreateDatabase(path, opts))
+}
+
+// OpenMemory 创建一个只保存在内存中的临时数据库，页面、日志和事务状态都不会写入磁盘，关闭之后数据全部丢失
+// 内存数据库不支持只读打开、日志归档和备份
+func OpenMemory(opts *Options) (*DB, error) {
+	return newDB(server.CreateMemoryDatabase(opts))
+}
+
+func newDB(database *server.Database, err error) (*DB, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &DB{database: database, sessions: make(map[*session]struct{})}, nil
+}
+
+// Close 终止所有未结束的事务，将页面写回磁盘并将 PageOne 标记为正常关闭，下次打开时不需要恢复
+// 关闭之后数据库的所有操作都返回 DatabaseClosedError
+// 空闲会话中的事务先被终止并释放行锁，等待这些行锁的语句因此能够结束，之后再等待所有正在执行的语句
+func (db *DB) Close() (err error) {
+	if !db.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("close database failed: %v", r)
+		}
+	}()
+	db.closeSessions(false)
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.closeSessions(true)
+	db.database.Close()
+	return nil
+}
+
+// closeSessions 关闭会话，wait为false时跳过正在执行语句的会话
+func (db *DB) closeSessions(wait bool) {
+	db.sessionLock.Lock()
+	defer db.sessionLock.Unlock()
+	for s := range db.sessions {
+		if wait {
+			s.lock.Lock()
+		} else if !s.lock.TryLock() {
+			continue
+		}
+		s.close()
+		s.lock.Unlock()
+		delete(db.sessions, s)
+	}
+}
+
+// Exec 在新的会话中执行一条语句，返回文本形式的结果，与 server.Executor 的 Execute 相同
+// 会话在语句执行完毕后结束，因此 begin 等事务控制语句应该使用 Begin
+func (db *DB) Exec(sql []byte) ([]byte, error) {
+	if err := db.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.lock.RUnlock()
+	s := db.newSession()
+	defer db.endSession(s)
+	if err := s.enter(); err != nil {
+		return nil, err
+	}
+	defer s.leave()
+	return s.executor.Execute(sql)
+}
+
+// Query 在新的会话中执行查询语句，返回逐条读取记录的结果集，会话在结果集关闭时结束
+// 语句不是查询语句时仍然会被执行，但是返回 NoResultSetError
+func (db *DB) Query(sql []byte) (*Rows, error) {
+	if err := db.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.lock.RUnlock()
+	s := db.newSession()
+	rows, err := openRows(db, s, sql, true)
+	if err != nil {
+		db.endSession(s)
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Begin 使用默认的隔离级别开启事务
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginWith([]byte("begin"))
+}
+
+// BeginWith 使用 begin 语句开启事务，例如 "begin isolation level serializable" 或者 "begin read only"
+func (db *DB) BeginWith(begin []byte) (*Tx, error) {
+	stat, err := parser.Parse(begin)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := stat.(*statement.BeginStatement); !ok {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidCommandError)
+	}
+	if err = db.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.lock.RUnlock()
+	s := db.newSession()
+	if err = s.enter(); err != nil {
+		db.endSession(s)
+		return nil, err
+	}
+	_, err = s.executor.Execute(begin)
+	s.leave()
+	if err != nil {
+		db.endSession(s)
+		return nil, err
+	}
+	return &Tx{db: db, session: s}, nil
+}
+
+// acquire 获取读锁，数据库已经关闭时返回错误
+func (db *DB) acquire() error {
+	db.lock.RLock()
+	if db.closed.Load() {
+		db.lock.RUnlock()
+		return commons.NewError(commons.ErrorMessage.DatabaseClosedError)
+	}
+	return nil
+}
+
+func (db *DB) newSession() *session {
+	s := &session{executor: server.NewExecutor(db.database.TBM)}
+	db.sessionLock.Lock()
+	db.sessions[s] = struct{}{}
+	db.sessionLock.Unlock()
+	return s
+}
+
+// endSession 结束会话，会话中未提交的事务被终止，调用时必须持有读锁，不能持有会话的锁
+func (db *DB) endSession(s *session) {
+	db.sessionLock.Lock()
+	delete(db.sessions, s)
+	db.sessionLock.Unlock()
+	s.lock.Lock()
+	s.close()
+	s.lock.Unlock()
+}
+
+// Tx 一个会话中的事务，不能被多个协程同时使用
+type Tx struct {
+	db      *DB
+	session *session
+	done    bool
+}
+
+// Exec 在事务中执行一条语句，返回文本形式的结果，语句出错时只撤销这条语句的修改
+func (tx *Tx) Exec(sql []byte) ([]byte, error) {
+	if err := tx.acquire(); err != nil {
+		return nil, err
+	}
+	defer tx.db.lock.RUnlock()
+	if err := tx.session.enter(); err != nil {
+		return nil, err
+	}
+	defer tx.session.leave()
+	return tx.session.executor.Execute(sql)
+}
+
+// Query 在事务中执行查询语句，事务中执行下一条语句时之前的结果集被关闭
+func (tx *Tx) Query(sql []byte) (*Rows, error) {
+	if err := tx.acquire(); err != nil {
+		return nil, err
+	}
+	defer tx.db.lock.RUnlock()
+	return openRows(tx.db, tx.session, sql, false)
+}
+
+// Commit 提交事务并结束会话
+func (tx *Tx) Commit() error {
+	return tx.end([]byte("commit"))
+}
+
+// Rollback 终止事务并结束会话
+func (tx *Tx) Rollback() error {
+	return tx.end([]byte("abort"))
+}
+
+func (tx *Tx) end(sql []byte) error {
+	if err := tx.acquire(); err != nil {
+		return err
+	}
+	defer tx.db.lock.RUnlock()
+	tx.done = true
+	defer tx.db.endSession(tx.session)
+	if err := tx.session.enter(); err != nil {
+		return err
+	}
+	defer tx.session.leave()
+	_, err := tx.session.executor.Execute(sql)
+	return err
+}
+
+// acquire 获取数据库的读锁，事务已经结束时返回错误
+func (tx *Tx) acquire() error {
+	if tx.done {
+		return commons.NewError(commons.ErrorMessage.NoTransactionError)
+	}
+	return tx.db.acquire()
+}
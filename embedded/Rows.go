@@ -0,0 +1,148 @@
+package embedded
+
+import (
+	"SimpleDB/backend/tbm"
+	"SimpleDB/commons"
+	"SimpleDB/transport"
+	"fmt"
+)
+
+// Rows 查询结果的迭代器，记录在调用 Next 时才从游标中读取，不能被多个协程同时使用
+type Rows struct {
+	db      *DB
+	session *session
+	cursor  *tbm.Cursor
+	// owned 结果集是否独占会话，独占的会话在结果集关闭时结束
+	owned  bool
+	row    []interface{}
+	err    error
+	closed bool
+}
+
+// openRows 在会话中执行语句并打开结果集，调用时必须持有读锁
+func openRows(db *DB, s *session, sql []byte, owned bool) (*Rows, error) {
+	if err := s.enter(); err != nil {
+		return nil, err
+	}
+	defer s.leave()
+	_, cursor, err := s.executor.Open(sql)
+	if err != nil {
+		return nil, err
+	}
+	if cursor == nil {
+		return nil, commons.NewError(commons.ErrorMessage.NoResultSetError)
+	}
+	return &Rows{db: db, session: s, cursor: cursor, owned: owned}, nil
+}
+
+// Columns 返回每一列的名称
+func (rows *Rows) Columns() []string {
+	names := make([]string, len(rows.cursor.Fields))
+	for i, field := range rows.cursor.Fields {
+		names[i] = field.FieldName
+	}
+	return names
+}
+
+// ColumnTypes 返回每一列的类型：int32、int64 或者 string
+func (rows *Rows) ColumnTypes() []string {
+	types := make([]string, len(rows.cursor.Fields))
+	for i, field := range rows.cursor.Fields {
+		types[i] = field.FieldType
+	}
+	return types
+}
+
+// Next 读取下一行，没有更多的行、出错或者结果集已经关闭时返回false
+func (rows *Rows) Next() bool {
+	if rows.closed {
+		return false
+	}
+	if err := rows.db.acquire(); err != nil {
+		rows.err = err
+		rows.closed = true
+		return false
+	}
+	defer rows.db.lock.RUnlock()
+	if err := rows.session.enter(); err != nil {
+		rows.err = err
+		rows.closed = true
+		return false
+	}
+	// 同一个事务中执行的下一条语句会关闭之前的游标
+	if rows.session.executor.Cursor() != rows.cursor {
+		rows.session.leave()
+		rows.err = commons.NewError(commons.ErrorMessage.ResultSetClosedError)
+		rows.close()
+		return false
+	}
+	rows.row, rows.err = rows.session.executor.Next()
+	rows.session.leave()
+	if rows.row == nil {
+		rows.close()
+		return false
+	}
+	return true
+}
+
+// Values 返回当前行的值，值的类型为 int32、int64 或者 string
+func (rows *Rows) Values() []interface{} {
+	if rows.closed {
+		return nil
+	}
+	return rows.row
+}
+
+// Scan 将当前行的值依次写入dest，支持的类型与 client.Rows 的 Scan 相同
+func (rows *Rows) Scan(dest ...interface{}) error {
+	values := rows.Values()
+	if values == nil {
+		return fmt.Errorf("Scan called without a current row")
+	}
+	if len(dest) != len(values) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(values), len(dest))
+	}
+	for i, v := range values {
+		if err := transport.ConvertAssign(dest[i], v); err != nil {
+			return fmt.Errorf("column %s: %v", rows.cursor.Fields[i].FieldName, err)
+		}
+	}
+	return nil
+}
+
+// Err 返回迭代过程中遇到的错误
+func (rows *Rows) Err() error {
+	return rows.err
+}
+
+// Close 关闭结果集，停止查询，不在事务中的查询使用的临时事务随之提交
+func (rows *Rows) Close() error {
+	if rows.closed {
+		return nil
+	}
+	if rows.db.acquire() != nil {
+		// 数据库关闭时已经终止了所有会话
+		rows.closed = true
+		return nil
+	}
+	defer rows.db.lock.RUnlock()
+	rows.close()
+	return nil
+}
+
+// close 关闭结果集，调用时必须持有读锁，不能持有会话的锁
+func (rows *Rows) close() {
+	rows.closed = true
+	rows.row = nil
+	if rows.session.enter() != nil {
+		// 数据库关闭时已经终止了会话
+		return
+	}
+	if rows.session.executor.Cursor() == rows.cursor {
+		rows.session.executor.CloseCursor()
+	}
+	rows.session.leave()
+	if rows.owned {
+		rows.db.endSession(rows.session)
+	}
+}
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"SimpleDB/backend/fsck"
+	"SimpleDB/commons"
+	"SimpleDB/embedded"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustExec(t *testing.T, exec func([]byte) ([]byte, error), sql string) string {
+	res, err := exec([]byte(sql))
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return string(res)
+}
+
+// count 读取查询结果的行数
+func count(t *testing.T, db *embedded.DB) int {
+	rows, err := db.Query([]byte("select * from student where id > 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+	return n
+}
+
+func TestEmbedded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "db")
+	db, err := embedded.Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, db.Exec, "create table student id int32, age int64, name string, (index id)")
+	for i := 1; i <= 3; i++ {
+		mustExec(t, db.Exec, fmt.Sprintf("insert into student values %d %d name%d", i, 20+i, i))
+	}
+	if res := mustExec(t, db.Exec, "select * from student where id = 2"); res != "[2,22,name2]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+
+	rows, err := db.Query([]byte("select * from student where id > 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(rows.Columns(), rows.ColumnTypes()) != "[id age name] [int32 int64 string]" {
+		t.Fatalf("unexpected columns %v %v", rows.Columns(), rows.ColumnTypes())
+	}
+	var got []string
+	for rows.Next() {
+		var id int
+		var age int64
+		var name string
+		if err = rows.Scan(&id, &age, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d %d %s", id, age, name))
+	}
+	if rows.Err() != nil || fmt.Sprint(got) != "[1 21 name1 2 22 name2 3 23 name3]" {
+		t.Fatalf("unexpected rows %v %v", got, rows.Err())
+	}
+	if _, err = db.Query([]byte("insert into student values 4 24 name4")); err == nil || err.Error() != commons.ErrorMessage.NoResultSetError {
+		t.Fatalf("expected no result set, got %v", err)
+	}
+
+	// 事务中的修改在提交之前对其他会话不可见，终止之后被撤销
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx.Exec, "delete from student where id = 1")
+	if count(t, db) != 4 {
+		t.Fatal("uncommitted delete is visible")
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec([]byte("delete from student where id = 1")); err == nil {
+		t.Fatal("finished transaction should be rejected")
+	}
+	tx, _ = db.BeginWith([]byte("begin isolation level repeatable read"))
+	rows, _ = tx.Query([]byte("select * from student where id > 0"))
+	rows.Next()
+	mustExec(t, tx.Exec, "delete from student where id = 1")
+	if rows.Next() || rows.Err() == nil || rows.Err().Error() != commons.ErrorMessage.ResultSetClosedError {
+		t.Fatalf("later statement should close the result set, got %v", rows.Err())
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if count(t, db) != 3 {
+		t.Fatal("committed delete is not visible")
+	}
+	if _, err = db.BeginWith([]byte("select * from student")); err == nil {
+		t.Fatal("BeginWith should only accept begin statements")
+	}
+
+	// 关闭时终止未结束的事务，并将数据库标记为正常关闭
+	tx, _ = db.Begin()
+	mustExec(t, tx.Exec, "insert into student values 5 25 name5")
+	rows, _ = db.Query([]byte("select * from student where id > 0"))
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec([]byte("show")); commons.ErrorCode(err) != commons.CodeConnectionDoesNotExist {
+		t.Fatalf("expected closed database, got %v", err)
+	}
+	if rows.Next() || rows.Close() != nil {
+		t.Fatal("result set should be closed with the database")
+	}
+	if report := fsck.Check(path); !report.OK || !report.Stats.CleanShutdown {
+		t.Fatalf("database is not consistent after close: %s", report.JSON())
+	}
+
+	db, err = embedded.Open(path, &embedded.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count(t, db) != 3 {
+		t.Fatal("reopened database lost rows")
+	}
+	if _, err = db.Exec([]byte("insert into student values 6 26 name6")); commons.ErrorCode(err) != commons.CodeReadOnlyTransaction {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	db.Close()
+	if _, err = embedded.Open(filepath.Join(t.TempDir(), "missing"), &embedded.Options{ReadOnly: true}); err == nil {
+		t.Fatal("read-only open should not create a database")
+	}
+}
+
+// TestCloseWithBlockedStatement 语句等待空闲事务持有的行锁时关闭数据库，空闲事务被终止，语句得以结束，Close 不会一直等待
+func TestCloseWithBlockedStatement(t *testing.T) {
+	db, err := embedded.Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, db.Exec, "create table student id int32, (index id)")
+	mustExec(t, db.Exec, "insert into student values 1")
+	tx, _ := db.Begin()
+	mustExec(t, tx.Exec, "delete from student where id = 1")
+
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := db.Exec([]byte("delete from student where id = 1"))
+		blocked <- err
+	}()
+	select {
+	case err = <-blocked:
+		t.Fatalf("statement should wait for the row lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- db.Close()
+	}()
+	select {
+	case err = <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hangs while a statement waits for a row lock")
+	}
+	if err = <-blocked; err != nil {
+		t.Fatalf("blocked statement should finish after the lock holder is aborted, got %v", err)
+	}
+	if err = tx.Commit(); commons.ErrorCode(err) != commons.CodeConnectionDoesNotExist {
+		t.Fatalf("expected closed database, got %v", err)
+	}
+}
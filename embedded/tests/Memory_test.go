@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"SimpleDB/commons"
+	"SimpleDB/embedded"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	// 内存数据库不会在工作目录中创建任何文件
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	db, err := embedded.OpenMemory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, db.Exec, "create table student id int32, age int64, name string, (index id age)")
+	for i := 1; i <= 200; i++ {
+		mustExec(t, db.Exec, fmt.Sprintf("insert into student values %d %d name%d", i, 20+i%10, i))
+	}
+	mustExec(t, db.Exec, "update student set name = renamed where id = 7")
+	mustExec(t, db.Exec, "delete from student where id > 100")
+	if res := mustExec(t, db.Exec, "select * from student where id = 7"); res != "[7,27,renamed]\n" {
+		t.Fatalf("unexpected result %q", res)
+	}
+	if count(t, db) != 100 {
+		t.Fatal("unexpected row count")
+	}
+
+	// 事务、保存点和隔离与磁盘上的数据库相同
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx.Exec, "delete from student where id = 1")
+	mustExec(t, tx.Exec, "savepoint s")
+	mustExec(t, tx.Exec, "delete from student where id = 2")
+	mustExec(t, tx.Exec, "rollback to savepoint s")
+	if count(t, db) != 100 {
+		t.Fatal("uncommitted delete is visible")
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if count(t, db) != 99 {
+		t.Fatal("savepoint was not honoured")
+	}
+
+	if _, err = db.Exec([]byte("backup to '" + filepath.Join(dir, "backup") + "'")); commons.ErrorCode(err) != commons.CodeFeatureNotSupported {
+		t.Fatalf("expected backup to be rejected, got %v", err)
+	}
+	if _, err = embedded.OpenMemory(&embedded.Options{ReadOnly: true}); commons.ErrorCode(err) != commons.CodeFeatureNotSupported {
+		t.Fatalf("expected read-only memory database to be rejected, got %v", err)
+	}
+
+	// 不同的内存数据库相互独立
+	other, err := embedded.OpenMemory(&embedded.Options{Memory: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.Exec([]byte("select * from student where id = 7")); err == nil {
+		t.Fatal("memory databases should not share tables")
+	}
+	other.Close()
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec([]byte("show")); commons.ErrorCode(err) != commons.CodeConnectionDoesNotExist {
+		t.Fatalf("expected closed database, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("memory database created files: %v", entries)
+	}
+}
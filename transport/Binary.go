@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"SimpleDB/commons"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+/**
+ * 二进制协议
+ * 每一帧为 [Length 4][Type 1][Payload]，Length 为 Type 与 Payload 的总长度，大端序
+ * 错误消息的 Payload 为 [Code 5][Position 4][Message]，Code 为错误码，Position 为错误在语句中的位置，为0表示没有位置，
+ * 协商的版本为1时错误消息的 Payload 只有 [Message]，接收方根据错误信息还原错误码
+ * BinaryTransporter 负责按照长度收发一帧，BinaryEncoder 负责消息类型与数据包之间的转换
+ */
+
+// errorCodeLength 错误码的长度
+const errorCodeLength = 5
+
+var (
+	// MaxFrameLength 一帧数据的最大长度，避免错误的长度导致分配过多的内存
+	MaxFrameLength = 256 << 20
+)
+
+// BinaryTransporter 使用长度前缀分帧的传输器
+type BinaryTransporter struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// NewBinaryTransporter 创建一个新的 BinaryTransporter 实例
+func NewBinaryTransporter(conn net.Conn) *BinaryTransporter {
+	return newBinaryTransporter(conn, bufio.NewReader(conn))
+}
+
+// newBinaryTransporter 使用协商时创建的reader创建 BinaryTransporter
+func newBinaryTransporter(conn net.Conn, reader *bufio.Reader) *BinaryTransporter {
+	return &BinaryTransporter{
+		conn:   conn,
+		reader: reader,
+		writer: bufio.NewWriter(conn),
+	}
+}
+
+// Send 发送一帧数据
+func (t *BinaryTransporter) Send(data []byte) error {
+	if len(data) > MaxFrameLength {
+		return fmt.Errorf("frame of %d bytes exceeds the limit %d", len(data), MaxFrameLength)
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	if _, err := t.writer.Write(length); err != nil {
+		return err
+	}
+	if _, err := t.writer.Write(data); err != nil {
+		return err
+	}
+	return t.writer.Flush()
+}
+
+// Receive 接收一帧数据
+func (t *BinaryTransporter) Receive() ([]byte, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(t.reader, length); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length)
+	if int64(n) > int64(MaxFrameLength) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit %d", n, MaxFrameLength)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(t.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Close 关闭连接
+func (t *BinaryTransporter) Close() error {
+	return t.conn.Close()
+}
+
+// BinaryEncoder 二进制协议的编码器，第一个字节为消息类型
+type BinaryEncoder struct {
+	// Version 握手时协商的协议版本，为0时使用当前支持的最高版本
+	Version uint16
+}
+
+// errorCoded 判断错误消息是否带有错误码和位置
+func (e *BinaryEncoder) errorCoded() bool {
+	return e.Version == 0 || e.Version >= ErrorCodeProtocolVersion
+}
+
+// Encode 将数据包编码为 [Type][Payload]
+func (e *BinaryEncoder) Encode(pkg *Package) []byte {
+	msgType := pkg.GetType()
+	if msgType == MsgError {
+		err := pkg.GetError()
+		if err == nil || err.Message == "" {
+			err = commons.NewCodeError(commons.CodeInternalError, "Internal server error!")
+		}
+		if !e.errorCoded() {
+			return append([]byte{msgType}, err.Message...)
+		}
+		data := append([]byte{msgType}, err.Code...)
+		data = binary.BigEndian.AppendUint32(data, uint32(err.Position))
+		return append(data, err.Message...)
+	}
+	return commons.BytesConcat([]byte{msgType}, pkg.GetData())
+}
+
+// Decode 解析 [Type][Payload]，未知的消息类型返回错误
+func (e *BinaryEncoder) Decode(data []byte) (*Package, error) {
+	if len(data) < 1 {
+		return nil, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	switch data[0] {
+	case MsgQuery, MsgResult, MsgResultSet, MsgFetch, MsgRowBatch, MsgClose, MsgPrepare, MsgPrepared, MsgExecute, MsgDeallocate:
+		return &Package{Type: data[0], Data: data[1:]}, nil
+	case MsgError:
+		if !e.errorCoded() {
+			return &Package{Type: MsgError, Err: commons.NewError(string(data[1:]))}, nil
+		}
+		if len(data) < 1+errorCodeLength+4 {
+			return nil, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+		}
+		err := &commons.Error{
+			Code:     string(data[1 : 1+errorCodeLength]),
+			Position: int(binary.BigEndian.Uint32(data[1+errorCodeLength:])),
+			Message:  string(data[1+errorCodeLength+4:]),
+		}
+		return &Package{Type: MsgError, Err: err}, nil
+	}
+	return nil, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+}
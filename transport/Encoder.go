@@ -2,7 +2,6 @@ package transport
 
 import (
 	"SimpleDB/commons"
-	"errors"
 )
 
 type Encoder struct {
@@ -25,14 +24,15 @@ func (e *Encoder) Encode(pkg *Package) []byte {
 // Decode 根据data，解析出对应的Package
 func (e *Encoder) Decode(data []byte) (*Package, error) {
 	if len(data) < 1 {
-		return nil, errors.New(commons.ErrorMessage.InvalidPkgDataError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
 	}
 
 	if data[0] == 0 {
 		return &Package{Data: data[1:]}, nil
 	} else if data[0] == 1 {
-		return &Package{Err: errors.New(string(data[1:]))}, nil
+		// 十六进制协议只传输错误信息，根据错误信息还原错误码
+		return &Package{Err: commons.NewError(string(data[1:]))}, nil
 	} else {
-		return nil, errors.New(commons.ErrorMessage.InvalidPkgDataError)
+		return nil, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
 	}
 }
@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"SimpleDB/commons"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+/**
+ * 协议协商
+ * 使用二进制协议的客户端连接后先发送 [Magic 4][Version 2]，Version为客户端支持的最高版本，
+ * 服务端回复相同格式的消息，Version为双方都支持的最高版本，为0表示不支持客户端的版本，之后服务端关闭连接
+ * 十六进制协议的客户端不进行协商，直接发送十六进制字符串，它的第一个字节不会是Magic的第一个字节，
+ * 服务端根据第一个字节选择协议。十六进制协议只为旧版本客户端保留一个版本，之后会被移除
+ */
+
+// Protocol 客户端使用的协议
+type Protocol int
+
+const (
+	// ProtocolBinary 长度前缀分帧的二进制协议
+	ProtocolBinary Protocol = iota
+	// ProtocolHex 旧的十六进制协议
+	ProtocolHex
+)
+
+var (
+	// ProtocolMagic 二进制协议握手消息的魔数
+	ProtocolMagic = []byte{0xFF, 'S', 'D', 'B'}
+	// ProtocolVersion 当前支持的最高协议版本
+	ProtocolVersion uint16 = 2
+	// MinProtocolVersion 当前支持的最低协议版本，版本1的对端收到的错误消息不带错误码
+	MinProtocolVersion uint16 = 1
+	// ErrorCodeProtocolVersion 错误消息带有错误码和位置的最低协议版本
+	ErrorCodeProtocolVersion uint16 = 2
+
+	// handshakeLength 握手消息的长度
+	handshakeLength = len(ProtocolMagic) + 2
+)
+
+// ParseProtocol 解析协议名称：binary、hex
+func ParseProtocol(name string) (Protocol, error) {
+	switch strings.ToLower(name) {
+	case "binary":
+		return ProtocolBinary, nil
+	case "hex":
+		return ProtocolHex, nil
+	}
+	return ProtocolBinary, fmt.Errorf("invalid protocol %q", name)
+}
+
+// handshakeMessage 生成握手消息
+func handshakeMessage(version uint16) []byte {
+	message := make([]byte, handshakeLength)
+	copy(message, ProtocolMagic)
+	binary.BigEndian.PutUint16(message[len(ProtocolMagic):], version)
+	return message
+}
+
+// readHandshake 读取握手消息，返回其中的版本
+func readHandshake(reader io.Reader) (uint16, error) {
+	message := make([]byte, handshakeLength)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(message[:len(ProtocolMagic)], ProtocolMagic) {
+		return 0, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	return binary.BigEndian.Uint16(message[len(ProtocolMagic):]), nil
+}
+
+// ClientHandshake 客户端使用protocol协议与服务端协商，返回之后用于收发数据包的Packager
+func ClientHandshake(conn net.Conn, protocol Protocol) (*Packager, error) {
+	if protocol == ProtocolHex {
+		return NewPackager(NewTransporter(conn), &Encoder{}), nil
+	}
+	if _, err := conn.Write(handshakeMessage(ProtocolVersion)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	version, err := readHandshake(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version < MinProtocolVersion || version > ProtocolVersion {
+		return nil, commons.NewError(commons.ErrorMessage.UnsupportedProtocolError)
+	}
+	return NewPackager(newBinaryTransporter(conn, reader), &BinaryEncoder{Version: version}), nil
+}
+
+// ServerHandshake 服务端根据客户端发送的第一个字节选择协议，二进制协议需要完成版本协商
+func ServerHandshake(conn net.Conn) (*Packager, error) {
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != ProtocolMagic[0] {
+		return NewPackager(newTransporter(conn, reader), &Encoder{}), nil
+	}
+	version, err := readHandshake(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	if version < MinProtocolVersion {
+		_, _ = conn.Write(handshakeMessage(0))
+		return nil, commons.NewError(commons.ErrorMessage.UnsupportedProtocolError)
+	}
+	if _, err = conn.Write(handshakeMessage(version)); err != nil {
+		return nil, err
+	}
+	return NewPackager(newBinaryTransporter(conn, reader), &BinaryEncoder{Version: version}), nil
+}
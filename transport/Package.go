@@ -1,6 +1,52 @@
 package transport
 
+import (
+	"SimpleDB/commons"
+	"encoding/binary"
+)
+
+var (
+	// MsgQuery 客户端发送的SQL语句
+	MsgQuery byte = 1
+	// MsgResult 语句执行成功的结果
+	MsgResult byte = 2
+	// MsgError 语句执行失败的错误信息
+	MsgError byte = 3
+	// MsgResultSet 查询语句的结构化结果，包含第一批记录，编码方式见 EncodeResultSet
+	MsgResultSet byte = 4
+	// MsgFetch 客户端获取结果集的后续记录，数据为 [Count 4]，表示最多获取的行数
+	MsgFetch byte = 5
+	// MsgRowBatch 服务端返回的一批后续记录，编码方式见 EncodeRowBatch
+	MsgRowBatch byte = 6
+	// MsgClose 客户端提前关闭结果集，服务端停止查询并回复 MsgResult
+	MsgClose byte = 7
+)
+
+var (
+	// DefaultFetchSize 每一批记录默认的最大行数，结果集的第一批记录也使用这个行数
+	DefaultFetchSize = 256
+	// MaxBatchBytes 每一批记录编码后的最大长度，至少包含一行记录
+	MaxBatchBytes = 1 << 20
+)
+
+// NewFetchPackage 创建获取后续n条记录的数据包
+func NewFetchPackage(n int) *Package {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(n))
+	return &Package{Type: MsgFetch, Data: data}
+}
+
+// FetchSize 解析 MsgFetch 数据包中的行数
+func (pack *Package) FetchSize() (int, error) {
+	if len(pack.Data) != 4 {
+		return 0, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	return int(binary.BigEndian.Uint32(pack.Data)), nil
+}
+
 type Package struct {
+	// Type 消息类型，为0时根据Err推断为MsgResult或者MsgError
+	Type byte
 	Data []byte
 	Err  error
 }
@@ -19,3 +65,19 @@ func (pack *Package) GetData() []byte {
 func (pack *Package) GetErr() error {
 	return pack.Err
 }
+
+// GetError 返回带有错误码的错误，没有错误时返回nil
+func (pack *Package) GetError() *commons.Error {
+	return commons.AsError(pack.Err)
+}
+
+// GetType 返回数据包的消息类型
+func (pack *Package) GetType() byte {
+	if pack.Type != 0 {
+		return pack.Type
+	}
+	if pack.Err != nil {
+		return MsgError
+	}
+	return MsgResult
+}
@@ -1,11 +1,24 @@
 package transport
 
+// FrameTransporter 负责在连接上发送和接收一帧完整的数据
+type FrameTransporter interface {
+	Send(data []byte) error
+	Receive() ([]byte, error)
+	Close() error
+}
+
+// PackageEncoder 负责数据包与一帧数据之间的转换
+type PackageEncoder interface {
+	Encode(pkg *Package) []byte
+	Decode(data []byte) (*Package, error)
+}
+
 type Packager struct {
-	transporter *Transporter
-	encoder     *Encoder
+	transporter FrameTransporter
+	encoder     PackageEncoder
 }
 
-func NewPackager(transporter *Transporter, encoder *Encoder) *Packager {
+func NewPackager(transporter FrameTransporter, encoder PackageEncoder) *Packager {
 	return &Packager{
 		transporter: transporter,
 		encoder:     encoder,
@@ -36,3 +49,9 @@ func (packager *Packager) Receive() (*Package, error) {
 func (packager *Packager) Close() error {
 	return packager.transporter.Close()
 }
+
+// IsBinary 判断是否使用二进制协议，只有二进制协议能够传输结构化的结果集
+func (packager *Packager) IsBinary() bool {
+	_, ok := packager.encoder.(*BinaryEncoder)
+	return ok
+}
@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"SimpleDB/commons"
+	"encoding/binary"
+	"fmt"
+)
+
+/**
+ * 预备语句的消息，整数均为大端序：
+ * MsgPrepare 的数据为带有参数占位符 ? 的SQL语句，服务端回复 MsgPrepared：[StmtId 4][ParamCount 2]
+ * MsgExecute 的数据为 [StmtId 4][ParamCount 2]，之后每个参数为 [Type 1][Value]，值的编码与结果集中相同类型的值相同
+ * 服务端的回复与 MsgQuery 相同
+ * MsgDeallocate 的数据为 [StmtId 4]，服务端回复 MsgResult
+ */
+
+var (
+	// MsgPrepare 客户端发送的带有参数占位符的SQL语句
+	MsgPrepare byte = 8
+	// MsgPrepared 服务端返回的预备语句编号和参数个数
+	MsgPrepared byte = 9
+	// MsgExecute 客户端绑定参数并执行预备语句
+	MsgExecute byte = 10
+	// MsgDeallocate 客户端释放预备语句
+	MsgDeallocate byte = 11
+)
+
+// NewPreparedPackage 创建 MsgPrepared 数据包
+func NewPreparedPackage(id uint32, params int) *Package {
+	data := binary.BigEndian.AppendUint32(nil, id)
+	data = binary.BigEndian.AppendUint16(data, uint16(params))
+	return &Package{Type: MsgPrepared, Data: data}
+}
+
+// DecodePrepared 解析 MsgPrepared 数据包中的预备语句编号和参数个数
+func DecodePrepared(data []byte) (uint32, int, error) {
+	if len(data) != 6 {
+		return 0, 0, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	return binary.BigEndian.Uint32(data), int(binary.BigEndian.Uint16(data[4:])), nil
+}
+
+// NewExecutePackage 创建 MsgExecute 数据包，参数的类型为 int32、int64 或者 string
+func NewExecutePackage(id uint32, params []interface{}) (*Package, error) {
+	data := binary.BigEndian.AppendUint32(nil, id)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(params)))
+	for i, param := range params {
+		var column Column
+		switch param.(type) {
+		case int32:
+			column.Type = ColumnInt32
+		case int64:
+			column.Type = ColumnInt64
+		case string:
+			column.Type = ColumnString
+		default:
+			return nil, commons.NewCodeError(commons.CodeDatatypeMismatch, fmt.Sprintf("%s: parameter %d has type %T", commons.ErrorMessage.InvalidParameterTypeError, i+1, param))
+		}
+		data = append(data, column.Type)
+		data = appendRow(data, []Column{column}, []interface{}{param})
+	}
+	return &Package{Type: MsgExecute, Data: data}, nil
+}
+
+// DecodeExecute 解析 MsgExecute 数据包中的预备语句编号和参数
+func DecodeExecute(data []byte) (uint32, []interface{}, error) {
+	r := &resultSetReader{data: data}
+	id := r.uint32()
+	params := make([]interface{}, r.uint16())
+	for i := range params {
+		columnType := r.next(1)
+		if r.err != nil {
+			return 0, nil, r.err
+		}
+		switch columnType[0] {
+		case ColumnInt32:
+			params[i] = int32(r.uint32())
+		case ColumnInt64:
+			if b := r.next(8); b != nil {
+				params[i] = int64(binary.BigEndian.Uint64(b))
+			}
+		case ColumnString:
+			params[i] = string(r.next(int(r.uint32())))
+		default:
+			return 0, nil, commons.NewCodeError(commons.CodeProtocolViolation, fmt.Sprintf("%s: unknown parameter type %d", commons.ErrorMessage.InvalidPkgDataError, columnType[0]))
+		}
+	}
+	if r.err == nil && len(r.data) != 0 {
+		r.err = commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+	return id, params, nil
+}
+
+// NewDeallocatePackage 创建释放预备语句的数据包
+func NewDeallocatePackage(id uint32) *Package {
+	return &Package{Type: MsgDeallocate, Data: binary.BigEndian.AppendUint32(nil, id)}
+}
+
+// StatementId 解析 MsgDeallocate 数据包中的预备语句编号
+func (pack *Package) StatementId() (uint32, error) {
+	if len(pack.Data) != 4 {
+		return 0, commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	return binary.BigEndian.Uint32(pack.Data), nil
+}
@@ -0,0 +1,298 @@
+package transport
+
+import (
+	"SimpleDB/commons"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 结果集的二进制编码，整数均为大端序：
+ * [ColumnCount 2] 每一列 [NameLength 2][Name][Type 1]，之后是第一批记录
+ * 每一批记录为 [RowCount 4][Rows][More 1]，More 为1表示还有更多的记录，客户端需要继续获取或者关闭结果集
+ * 每一行按照列的顺序依次编码每个值：int32 为4字节，int64 为8字节，string 为 [Length 4][Bytes]
+ */
+
+var (
+	// ColumnInt32 int32 类型的列
+	ColumnInt32 byte = 1
+	// ColumnInt64 int64 类型的列
+	ColumnInt64 byte = 2
+	// ColumnString string 类型的列
+	ColumnString byte = 3
+)
+
+// Column 结果集中一列的信息
+type Column struct {
+	Name string
+	Type byte
+}
+
+// ResultSet 结构化的查询结果，每一行按照列的顺序保存值，值的类型为 int32、int64 或者 string
+// 结果集可能只包含第一批记录，More 表示服务端是否还有更多的记录
+type ResultSet struct {
+	Columns []Column
+	Rows    [][]interface{}
+	More    bool
+}
+
+// ColumnType 根据字段类型的名称返回列的类型
+func ColumnType(name string) (byte, error) {
+	switch name {
+	case "int32":
+		return ColumnInt32, nil
+	case "int64":
+		return ColumnInt64, nil
+	case "string":
+		return ColumnString, nil
+	}
+	return 0, commons.NewError(commons.ErrorMessage.InvalidFieldTypeError)
+}
+
+// ColumnTypeName 返回列的类型的名称
+func ColumnTypeName(columnType byte) string {
+	switch columnType {
+	case ColumnInt32:
+		return "int32"
+	case ColumnInt64:
+		return "int64"
+	case ColumnString:
+		return "string"
+	}
+	return "unknown"
+}
+
+// EncodeResultSet 将结果集编码为二进制数据
+func EncodeResultSet(rs *ResultSet) []byte {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, uint16(len(rs.Columns)))
+	for _, column := range rs.Columns {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(column.Name)))
+		data = append(data, column.Name...)
+		data = append(data, column.Type)
+	}
+	return appendRowBatch(data, rs.Columns, rs.Rows, rs.More)
+}
+
+// EncodeRowBatch 编码结果集之后的一批记录
+func EncodeRowBatch(columns []Column, rows [][]interface{}, more bool) []byte {
+	return appendRowBatch(nil, columns, rows, more)
+}
+
+func appendRowBatch(data []byte, columns []Column, rows [][]interface{}, more bool) []byte {
+	data = binary.BigEndian.AppendUint32(data, uint32(len(rows)))
+	for _, row := range rows {
+		data = appendRow(data, columns, row)
+	}
+	if more {
+		return append(data, 1)
+	}
+	return append(data, 0)
+}
+
+// appendRow 按照列的类型编码一行数据
+func appendRow(data []byte, columns []Column, row []interface{}) []byte {
+	for i, column := range columns {
+		switch column.Type {
+		case ColumnInt32:
+			data = binary.BigEndian.AppendUint32(data, uint32(row[i].(int32)))
+		case ColumnInt64:
+			data = binary.BigEndian.AppendUint64(data, uint64(row[i].(int64)))
+		case ColumnString:
+			data = binary.BigEndian.AppendUint32(data, uint32(len(row[i].(string))))
+			data = append(data, row[i].(string)...)
+		}
+	}
+	return data
+}
+
+// RowSize 返回一行数据编码后的长度，用于限制每一批记录的大小
+func RowSize(columns []Column, row []interface{}) int {
+	size := 0
+	for i, column := range columns {
+		switch column.Type {
+		case ColumnInt32:
+			size += 4
+		case ColumnInt64:
+			size += 8
+		case ColumnString:
+			size += 4 + len(row[i].(string))
+		}
+	}
+	return size
+}
+
+// resultSetReader 解码结果集时使用的读取器，数据不足时记录错误
+type resultSetReader struct {
+	data []byte
+	err  error
+}
+
+func (r *resultSetReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data) < n {
+		r.err = commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *resultSetReader) uint16() int {
+	if b := r.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *resultSetReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// DecodeResultSet 解析二进制编码的结果集
+func DecodeResultSet(data []byte) (*ResultSet, error) {
+	r := &resultSetReader{data: data}
+	rs := &ResultSet{Columns: make([]Column, r.uint16())}
+	for i := range rs.Columns {
+		name := string(r.next(r.uint16()))
+		columnType := r.next(1)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if columnType[0] < ColumnInt32 || columnType[0] > ColumnString {
+			return nil, commons.NewCodeError(commons.CodeProtocolViolation, fmt.Sprintf("%s: unknown column type %d", commons.ErrorMessage.InvalidPkgDataError, columnType[0]))
+		}
+		rs.Columns[i] = Column{Name: name, Type: columnType[0]}
+	}
+	rs.Rows, rs.More = r.rowBatch(rs.Columns)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return rs, nil
+}
+
+// DecodeRowBatch 解析结果集之后的一批记录，columns 为结果集的列
+func DecodeRowBatch(columns []Column, data []byte) ([][]interface{}, bool, error) {
+	r := &resultSetReader{data: data}
+	rows, more := r.rowBatch(columns)
+	if r.err != nil {
+		return nil, false, r.err
+	}
+	return rows, more, nil
+}
+
+// rowBatch 读取一批记录，读取之后必须没有剩余的数据
+func (r *resultSetReader) rowBatch(columns []Column) ([][]interface{}, bool) {
+	count := r.uint32()
+	rows := make([][]interface{}, 0)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		row := make([]interface{}, len(columns))
+		for j, column := range columns {
+			switch column.Type {
+			case ColumnInt32:
+				row[j] = int32(r.uint32())
+			case ColumnInt64:
+				if b := r.next(8); b != nil {
+					row[j] = int64(binary.BigEndian.Uint64(b))
+				}
+			case ColumnString:
+				row[j] = string(r.next(int(r.uint32())))
+			}
+		}
+		rows = append(rows, row)
+	}
+	more := r.next(1)
+	if r.err == nil && (len(r.data) != 0 || more[0] > 1) {
+		r.err = commons.NewError(commons.ErrorMessage.InvalidPkgDataError)
+	}
+	if r.err != nil {
+		return nil, false
+	}
+	return rows, more[0] == 1
+}
+
+// FormatValue 返回值的文本形式
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// ConvertAssign 将结果集中的值v写入dest，支持 *int32、*int64、*int、*string、*[]byte 和 *interface{}
+// 整数可以写入更宽的整数类型或者字符串，字符串只能写入字符串或者字节数组
+func ConvertAssign(dest interface{}, v interface{}) error {
+	switch d := dest.(type) {
+	case *interface{}:
+		*d = v
+		return nil
+	case *string:
+		*d = FormatValue(v)
+		return nil
+	case *[]byte:
+		*d = []byte(FormatValue(v))
+		return nil
+	}
+	var n int64
+	switch v := v.(type) {
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	case string:
+		return fmt.Errorf("cannot scan string %q into %T", v, dest)
+	}
+	switch d := dest.(type) {
+	case *int64:
+		*d = n
+	case *int:
+		if strconv.IntSize == 32 && int64(int(n)) != n {
+			return fmt.Errorf("value %d overflows %T", n, dest)
+		}
+		*d = int(n)
+	case *int32:
+		if int64(int32(n)) != n {
+			return fmt.Errorf("value %d overflows %T", n, dest)
+		}
+		*d = int32(n)
+	default:
+		return fmt.Errorf("unsupported Scan destination %T", dest)
+	}
+	return nil
+}
+
+// FormatRow 返回一行的文本形式：[v1,v2,...] 加换行符
+func FormatRow(row []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, v := range row {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(FormatValue(v))
+	}
+	sb.WriteString("]\n")
+	return sb.String()
+}
+
+// String 返回结果集中记录的文本形式，与旧协议中查询结果的格式相同
+func (rs *ResultSet) String() string {
+	var sb strings.Builder
+	for _, row := range rs.Rows {
+		sb.WriteString(FormatRow(row))
+	}
+	return sb.String()
+}
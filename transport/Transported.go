@@ -7,6 +7,7 @@ import (
 )
 
 // Transporter 结构体，负责处理数据的发送和接收
+// 十六进制协议：每个数据包编码为十六进制字符串，以换行符结尾，只为旧版本客户端保留
 type Transporter struct {
 	conn   net.Conn
 	reader *bufio.Reader
@@ -15,9 +16,14 @@ type Transporter struct {
 
 // NewTransporter 创建一个新的 Transporter 实例
 func NewTransporter(conn net.Conn) *Transporter {
+	return newTransporter(conn, bufio.NewReader(conn))
+}
+
+// newTransporter 使用已经读取过数据的reader创建 Transporter，用于协商时已经预读了第一个字节的情况
+func newTransporter(conn net.Conn, reader *bufio.Reader) *Transporter {
 	return &Transporter{
 		conn:   conn,
-		reader: bufio.NewReader(conn),
+		reader: reader,
 		writer: bufio.NewWriter(conn),
 	}
 }